@@ -0,0 +1,111 @@
+package application
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AirportPage is an airport with its runways, longest first, and its frequencies embedded, as
+// materialized in the airport pages collection so a page takes a single read
+type AirportPage struct {
+	Airport     `bson:",inline"`
+	Runways     []*Runway    `bson:"runways" json:"runways"`
+	Frequencies []*Frequency `bson:"frequencies" json:"frequencies"`
+}
+
+func (mongoClient *MongoClient) airportPages() *mongo.Collection {
+	return mongoClient.collection(AirportPagesCollection)
+}
+
+// AirportPagesView is the name of the view materializing the airport pages
+const AirportPagesView = "airport-pages"
+
+// airportPagesPipeline embeds the runways and frequencies in the airports matching the query
+func airportPagesPipeline(appContext *AppContext, query bson.M) *Pipeline {
+	return NewPipeline().
+		Match(query).
+		Lookup(appContext, Lookup{
+			From: RunwaysCollection,
+			Let:  bson.M{"airport": "$_id"},
+			Pipeline: NewPipeline().
+				MatchExpr(bson.M{"$eq": bson.A{"$airport_ref", "$$airport"}}).
+				Sort(bson.D{{Key: "length_ft", Value: -1}}),
+			As: "runways"}).
+		Lookup(appContext, Lookup{
+			From:         FrequenciesCollection,
+			LocalField:   "_id",
+			ForeignField: "airport_ref",
+			As:           "frequencies"})
+}
+
+// airportPagesView materializes the page of every airport, with the indexes the pages are
+// looked up by
+var airportPagesView = MaterializedView{
+	Name:       AirportPagesView,
+	Collection: AirportsCollection,
+	Target:     AirportPagesCollection,
+	Pipeline: func(appContext *AppContext) *Pipeline {
+		return airportPagesPipeline(appContext, bson.M{})
+	},
+	Indexes: []mongo.IndexModel{
+		{Keys: bson.D{{Key: "icao_code", Value: 1}}},
+		{Keys: bson.D{{Key: "iata_code", Value: 1}}},
+		{Keys: bson.D{{Key: "local_code", Value: 1}}},
+	},
+}
+
+// refreshAirportPage materializes the page of a single airport again, or removes it when the
+// airport is gone
+func (mongoClient *MongoClient) refreshAirportPage(ctx context.Context, airportID int64) error {
+	pages := mongoClient.airportPages()
+
+	cursor, err := mongoClient.airports().Aggregate(ctx, airportPagesPipeline(mongoClient.appContext, bson.M{"_id": airportID}).Stages())
+	if err != nil {
+		return err
+	}
+	var page AirportPage
+	found := cursor.Next(ctx)
+	if found {
+		err = cursor.Decode(&page)
+	}
+	if err == nil {
+		err = cursor.Err()
+	}
+	cursor.Close(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		_, err = pages.DeleteOne(ctx, bson.M{"_id": airportID})
+		return err
+	}
+	_, err = pages.ReplaceOne(ctx, bson.M{"_id": airportID}, &page, options.Replace().SetUpsert(true))
+
+	return err
+}
+
+// AirportPage finds the page of an airport by trying the ICAO, IATA and local code in that order
+func (mongoClient *MongoClient) AirportPage(ctx context.Context, ident string) (*AirportPage, error) {
+	code := NormalizeCode(ident)
+	if code == "" {
+		return nil, ErrNotFound
+	}
+
+	for _, field := range []string{"icao_code", "iata_code", "local_code"} {
+		var page AirportPage
+		err := mongoClient.readCollection(AirportPagesCollection).FindOne(ctx, bson.M{field: code}).Decode(&page)
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &page, nil
+	}
+
+	return nil, ErrNotFound
+}
@@ -0,0 +1,270 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/ralph-nijpels/geography-application/v2/units"
+)
+
+// ErrNotFound is returned when a lookup does not match any document
+var ErrNotFound = errors.New("not found")
+
+// Airport describes an airport as stored in the airports collection
+type Airport struct {
+	AirportID        int64                  `bson:"_id" json:"id"`
+	Ident            string                 `bson:"ident" json:"ident"`
+	Type             AirportType            `bson:"type" json:"type"`
+	Name             string                 `bson:"name" json:"name"`
+	Names            []string               `bson:"names,omitempty" json:"names,omitempty"`
+	Location         Coordinate             `bson:"location" json:"location"`
+	Elevation        units.LengthFeet       `bson:"elevation_ft,omitempty" json:"elevation-ft,omitempty"`
+	Continent        Continent              `bson:"continent" json:"continent"`
+	Country          string                 `bson:"iso_country" json:"country"`
+	Region           string                 `bson:"iso_region" json:"region"`
+	Municipality     string                 `bson:"municipality,omitempty" json:"municipality,omitempty"`
+	ScheduledService bool                   `bson:"scheduled_service" json:"scheduled-service"`
+	GPSCode          string                 `bson:"gps_code,omitempty" json:"gps-code,omitempty"`
+	ICAOCode         string                 `bson:"icao_code,omitempty" json:"icao-code,omitempty"`
+	IATACode         string                 `bson:"iata_code,omitempty" json:"iata-code,omitempty"`
+	LocalCode        string                 `bson:"local_code,omitempty" json:"local-code,omitempty"`
+	HomeLink         string                 `bson:"home_link,omitempty" json:"home-link,omitempty"`
+	WikipediaLink    string                 `bson:"wikipedia_link,omitempty" json:"wikipedia-link,omitempty"`
+	Keywords         string                 `bson:"keywords,omitempty" json:"keywords,omitempty"`
+	Tokens           []string               `bson:"tokens,omitempty" json:"tokens,omitempty"`
+	Extra            map[string]interface{} `bson:"extra,omitempty" json:"extra,omitempty"`
+	Hash             string                 `bson:"hash,omitempty" json:"hash,omitempty"`
+}
+
+// NormalizeCode brings an airport code in its canonical form
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func (mongoClient *MongoClient) airports() *mongo.Collection {
+	return mongoClient.collection(AirportsCollection)
+}
+
+// EnsureAirportIndexes creates the indexes backing the code lookups and the search
+func (mongoClient *MongoClient) EnsureAirportIndexes(ctx context.Context) error {
+	return mongoClient.ensureAirportIndexes(ctx, mongoClient.airports())
+}
+
+// ensureAirportIndexes creates the airport indexes on the given collection, which may be
+// a shadow collection that is swapped in later
+func (mongoClient *MongoClient) ensureAirportIndexes(ctx context.Context, collection *mongo.Collection) error {
+
+	err := mongoClient.appContext.CheckWritable()
+	if err != nil {
+		return err
+	}
+
+	// Codes are optional, so only the documents that have one take part in the index
+	codeIndex := func(field string) mongo.IndexModel {
+		return mongo.IndexModel{
+			Keys: bson.D{{Key: field, Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{field: bson.M{"$gt": ""}})}
+	}
+
+	_, err = collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		codeIndex("icao_code"),
+		codeIndex("iata_code"),
+		{Keys: bson.D{{Key: "local_code", Value: 1}}},
+		{Keys: bson.D{{Key: "location", Value: "2dsphere"}}},
+		{Keys: bson.D{{Key: "continent", Value: 1}}},
+		{Keys: bson.D{{Key: "scheduled_service", Value: 1}}},
+		{Keys: bson.D{{Key: "iso_country", Value: 1}, {Key: "type", Value: 1}}},
+		{Keys: bson.D{{Key: "tokens", Value: 1}}},
+		{Keys: bson.D{{Key: "name", Value: "text"}, {Key: "names", Value: "text"}, {Key: "tokens", Value: "text"},
+			{Key: "municipality", Value: "text"}},
+			Options: options.Index().SetName("airport_search").SetDefaultLanguage("none").
+				SetWeights(bson.M{"name": 10, "names": 5, "tokens": 5, "municipality": 2})},
+	})
+
+	return err
+}
+
+func (mongoClient *MongoClient) airportBy(ctx context.Context, field string, code string, fields FieldMask) (*Airport, error) {
+
+	code = NormalizeCode(code)
+	if code == "" {
+		return nil, ErrNotFound
+	}
+
+	projection, err := fields.projection(Airport{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Bogus codes that were asked for recently don't reach the database
+	negativeLookups := mongoClient.appContext.negativeLookups
+	if negativeLookups != nil {
+		_, found := negativeLookups.get(field + ":" + code)
+		if found {
+			return nil, ErrNotFound
+		}
+	}
+
+	var airport Airport
+	err = mongoClient.readCollection(AirportsCollection).FindOne(ctx, bson.M{field: code}, options.FindOne().SetProjection(projection)).Decode(&airport)
+	if err == mongo.ErrNoDocuments {
+		if negativeLookups != nil {
+			negativeLookups.put(field+":"+code, true)
+		}
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &airport, nil
+}
+
+// AirportByICAO finds an airport by its ICAO code, optionally with only the given fields
+func (mongoClient *MongoClient) AirportByICAO(ctx context.Context, icao string, fields ...string) (*Airport, error) {
+	return mongoClient.airportBy(ctx, "icao_code", icao, fields)
+}
+
+// AirportByIATA finds an airport by its IATA code, optionally with only the given fields
+func (mongoClient *MongoClient) AirportByIATA(ctx context.Context, iata string, fields ...string) (*Airport, error) {
+	return mongoClient.airportBy(ctx, "iata_code", iata, fields)
+}
+
+// LookupIdent finds an airport by trying the ICAO, IATA and local code in that order,
+// optionally with only the given fields
+func (mongoClient *MongoClient) LookupIdent(ctx context.Context, ident string, fields ...string) (*Airport, error) {
+
+	for _, field := range []string{"icao_code", "iata_code", "local_code"} {
+		airport, err := mongoClient.airportBy(ctx, field, ident, fields)
+		if err == nil {
+			return airport, nil
+		}
+		if err != ErrNotFound {
+			return nil, err
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// AirportFilter selects airports in a search, empty fields are not filtered on. The name
+// matches part of the name or of one of the alternate names, the keyword one of the keywords
+// exactly. The text is searched for in the names, keywords and municipality, ranking the
+// results by how well they match.
+type AirportFilter struct {
+	Continent        Continent
+	Country          string
+	Region           string
+	Types            []AirportType
+	ScheduledService *bool
+	Name             string
+	Keyword          string
+	Text             string
+}
+
+// Page selects a window of the search results and, if not empty, the fields returned
+type Page struct {
+	Offset int64
+	Limit  int64
+	Fields FieldMask
+}
+
+func (filter *AirportFilter) query() bson.M {
+	query := bson.M{}
+
+	if filter.Continent != "" {
+		query["continent"] = filter.Continent
+	}
+	if filter.Country != "" {
+		query["iso_country"] = NormalizeCode(filter.Country)
+	}
+	if filter.Region != "" {
+		query["iso_region"] = NormalizeCode(filter.Region)
+	}
+	if len(filter.Types) > 0 {
+		query["type"] = bson.M{"$in": filter.Types}
+	}
+	if filter.ScheduledService != nil {
+		query["scheduled_service"] = *filter.ScheduledService
+	}
+	if filter.Name != "" {
+		name := primitive.Regex{Pattern: regexp.QuoteMeta(filter.Name), Options: "i"}
+		query["$or"] = bson.A{bson.M{"name": name}, bson.M{"names": name}}
+	}
+	if filter.Keyword != "" {
+		query["tokens"] = strings.ToLower(strings.Join(strings.Fields(filter.Keyword), " "))
+	}
+	if filter.Text != "" {
+		query["$text"] = bson.M{"$search": filter.Text}
+	}
+
+	return query
+}
+
+// PageLimit caps the requested page size at MaxResults
+func (appContext *AppContext) PageLimit(limit int64) int64 {
+	if limit <= 0 || (appContext.MaxResults > 0 && limit > appContext.MaxResults) {
+		return appContext.MaxResults
+	}
+
+	return limit
+}
+
+// AirportSearch returns the airports matching the filter, limited to MaxResults per page. The
+// closed airports are left out when the policy excludes them, unless the filter asks for a type.
+func (mongoClient *MongoClient) AirportSearch(ctx context.Context, filter *AirportFilter, page *Page) ([]*Airport, error) {
+
+	limit := mongoClient.appContext.PageLimit(page.Limit)
+	projection, err := page.Fields.projection(Airport{})
+	if err != nil {
+		return nil, err
+	}
+
+	// A text search ranks the best matches first
+	sort := bson.D{{Key: "_id", Value: 1}}
+	if filter.Text != "" {
+		score := bson.M{"$meta": "textScore"}
+		if projection == nil {
+			projection = bson.M{}
+		}
+		projection["score"] = score
+		sort = bson.D{{Key: "score", Value: score}, {Key: "_id", Value: 1}}
+	}
+
+	// Identical searches between imports are served from the query cache, if so configured
+	query := mongoClient.appContext.excludeClosed(ctx, filter.query())
+	collection := mongoClient.readCollection(AirportsCollection)
+	key := mongoClient.queryKey(ctx, collection, query, sort, projection, page.Offset, limit)
+	cached, found := mongoClient.appContext.cachedQuery(key)
+	if found {
+		return cached.([]*Airport), nil
+	}
+
+	cursor, err := collection.Find(ctx, query,
+		options.Find().
+			SetSort(sort).
+			SetSkip(page.Offset).
+			SetLimit(limit).
+			SetProjection(projection))
+	if err != nil {
+		return nil, err
+	}
+
+	airports := []*Airport{}
+	err = cursor.All(ctx, &airports)
+	if err != nil {
+		return nil, err
+	}
+	mongoClient.appContext.cacheQuery(key, airports)
+
+	return airports, nil
+}
@@ -0,0 +1,55 @@
+package application
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AirportType classifies airports as in the OurAirports type column
+type AirportType string
+
+// The airport types known in the source data
+const (
+	LargeAirport  AirportType = "large_airport"
+	MediumAirport AirportType = "medium_airport"
+	SmallAirport  AirportType = "small_airport"
+	Heliport      AirportType = "heliport"
+	SeaplaneBase  AirportType = "seaplane_base"
+	BalloonPort   AirportType = "balloonport"
+	ClosedAirport AirportType = "closed"
+)
+
+// AirportTypes lists all known airport types
+var AirportTypes = []AirportType{
+	LargeAirport, MediumAirport, SmallAirport, Heliport, SeaplaneBase, BalloonPort, ClosedAirport,
+}
+
+// ParseAirportType reads an airport type, forgiving case, spaces and dashes
+func ParseAirportType(s string) (AirportType, error) {
+	normalized := strings.ToLower(strings.TrimSpace(s))
+	normalized = strings.NewReplacer(" ", "_", "-", "_").Replace(normalized)
+
+	for _, airportType := range AirportTypes {
+		if string(airportType) == normalized {
+			return airportType, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown airport type %q", s)
+}
+
+// Valid tells whether the airport type is one of the known types
+func (airportType AirportType) Valid() bool {
+	for _, known := range AirportTypes {
+		if airportType == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AddAirportType counts an imported airport by its type in the report
+func (report *RunReport) AddAirportType(airportType AirportType) {
+	report.AddCount("airport-type:"+string(airportType), 1)
+}
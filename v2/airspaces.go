@@ -0,0 +1,247 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/ralph-nijpels/geography-application/v2/units"
+)
+
+// openAIPAirspaceTypes names the airspace type codes of openAIP
+var openAIPAirspaceTypes = []string{
+	"OTHER", "RESTRICTED", "DANGER", "PROHIBITED", "CTR", "TMZ", "RMZ", "TMA", "TRA", "TSA",
+	"FIR", "UIR", "ADIZ", "ATZ", "MATZ", "AIRWAY", "MTR", "ALERT", "WARNING", "PROTECTED",
+	"HTZ", "GLIDING", "TRP", "TIZ", "TIA", "MTA", "CTA", "ACC", "SPORT", "LOW-OVERFLIGHT",
+}
+
+// openAIPAirspaceClasses names the ICAO class codes of openAIP
+var openAIPAirspaceClasses = []string{"A", "B", "C", "D", "E", "F", "G", "SUA", "UNCLASSIFIED"}
+
+// openAIP codes for the units and reference datums of airspace limits
+const (
+	openAIPFlightLevel = 6
+	openAIPGround      = 0
+	openAIPMSL         = 1
+	openAIPStandard    = 2
+)
+
+// The reference datums of airspace limits
+const (
+	DatumGround   = "GND"
+	DatumMSL      = "MSL"
+	DatumStandard = "STD"
+)
+
+// Boundary is the GeoJSON polygon of an airspace
+type Boundary struct {
+	Type        string         `bson:"type" json:"type"`
+	Coordinates [][][2]float64 `bson:"coordinates" json:"coordinates"`
+}
+
+// Airspace describes an airspace as stored in the airspaces collection. The limits are in feet,
+// a flight level is converted at standard pressure.
+type Airspace struct {
+	AirspaceID string           `bson:"_id" json:"id"`
+	Name       string           `bson:"name" json:"name"`
+	Type       string           `bson:"type" json:"type"`
+	Class      string           `bson:"class,omitempty" json:"class,omitempty"`
+	Country    string           `bson:"iso_country" json:"country"`
+	Lower      units.LengthFeet `bson:"lower_ft" json:"lower-ft"`
+	LowerDatum string           `bson:"lower_datum" json:"lower-datum"`
+	Upper      units.LengthFeet `bson:"upper_ft" json:"upper-ft"`
+	UpperDatum string           `bson:"upper_datum" json:"upper-datum"`
+	Boundary   Boundary         `bson:"boundary" json:"boundary"`
+}
+
+func (mongoClient *MongoClient) airspaces() *mongo.Collection {
+	return mongoClient.collection(AirspacesCollection)
+}
+
+// codeName looks up the name of an openAIP code, unknown codes are kept as they are
+func codeName(names []string, code string) string {
+	index, err := strconv.Atoi(code)
+	if err != nil || index < 0 || index >= len(names) {
+		return code
+	}
+
+	return names[index]
+}
+
+// parseLimit reads an airspace limit, either an openAIP limit object or plain feet above MSL
+func parseLimit(record map[string]string, column string) (units.LengthFeet, string, error) {
+	var limit struct {
+		Value          float64 `json:"value"`
+		Unit           int     `json:"unit"`
+		ReferenceDatum int     `json:"referenceDatum"`
+	}
+
+	text := record[column]
+	if text == "" || text[0] != '{' {
+		feet, err := parseFloat(record, column)
+		return units.LengthFeet(feet), DatumMSL, err
+	}
+
+	err := json.Unmarshal([]byte(text), &limit)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid %s: %v", column, err)
+	}
+
+	feet := units.LengthFeet(limit.Value)
+	switch limit.Unit {
+	case openAIPMeters:
+		feet = units.LengthMeters(limit.Value).Feet()
+	case openAIPFlightLevel:
+		feet = units.LengthFeet(limit.Value * 100)
+	}
+
+	datum := DatumMSL
+	switch limit.ReferenceDatum {
+	case openAIPGround:
+		datum = DatumGround
+	case openAIPStandard:
+		datum = DatumStandard
+	}
+
+	return feet, datum, nil
+}
+
+// airspaceFromRecord converts a record of the airspaces source, from openAIP or a GeoJSON
+// file with id, name, type, class, country, lowerLimit and upperLimit properties
+func airspaceFromRecord(record map[string]string) (*Airspace, error) {
+	var err error
+	airspace := Airspace{
+		AirspaceID: record["id"],
+		Name:       record["name"],
+		Type:       codeName(openAIPAirspaceTypes, record["type"]),
+		Class:      codeName(openAIPAirspaceClasses, record["icaoClass"]),
+		Country:    NormalizeCode(record["country"])}
+
+	if airspace.Class == "" {
+		airspace.Class = NormalizeCode(record["class"])
+	}
+
+	airspace.Lower, airspace.LowerDatum, err = parseLimit(record, "lowerLimit")
+	if err != nil {
+		return nil, err
+	}
+	airspace.Upper, airspace.UpperDatum, err = parseLimit(record, "upperLimit")
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(record["geometry"]), &airspace.Boundary)
+	if err != nil {
+		return nil, fmt.Errorf("invalid boundary: %v", err)
+	}
+	if airspace.Boundary.Type != "Polygon" || len(airspace.Boundary.Coordinates) == 0 {
+		return nil, fmt.Errorf("expected a polygon boundary, got %q", airspace.Boundary.Type)
+	}
+
+	return &airspace, nil
+}
+
+// EnsureAirspaceIndexes creates the indexes backing the lookups by country and the geo queries
+func (mongoClient *MongoClient) EnsureAirspaceIndexes(ctx context.Context) error {
+	return mongoClient.ensureAirspaceIndexes(ctx, mongoClient.airspaces())
+}
+
+// ensureAirspaceIndexes creates the airspace indexes on the given collection, which may be a shadow
+// collection that is swapped in later
+func (mongoClient *MongoClient) ensureAirspaceIndexes(ctx context.Context, collection *mongo.Collection) error {
+	err := mongoClient.appContext.CheckWritable()
+	if err != nil {
+		return err
+	}
+
+	_, err = collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "boundary", Value: "2dsphere"}}},
+		{Keys: bson.D{{Key: "iso_country", Value: 1}}},
+	})
+
+	return err
+}
+
+// ImportAirspaces imports the airspace boundaries from the configured source
+func (mongoClient *MongoClient) ImportAirspaces(ctx context.Context, report *RunReport) error {
+	appContext := mongoClient.appContext
+
+	err := appContext.CheckWritable()
+	if err != nil {
+		return err
+	}
+	if appContext.AirspacesSource == nil {
+		return ErrNoSource
+	}
+
+	err = mongoClient.EnsureAirspaceIndexes(ctx)
+	if err != nil {
+		return err
+	}
+
+	live, err := mongoClient.airspaces().CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	_, err = appContext.importSource(ctx, report, appContext.AirspacesSource, live,
+		func(record map[string]string) (*keyedDocument, error) {
+			airspace, err := airspaceFromRecord(record)
+			if err != nil {
+				return nil, err
+			}
+			report.AddCount("airspace-type:"+airspace.Type, 1)
+			return &keyedDocument{id: airspace.AirspaceID, document: airspace}, nil
+		},
+		func(batch []keyedDocument) (int64, error) {
+			return mongoClient.bulkUpsert(ctx, mongoClient.airspaces(), batch, report)
+		})
+	if err != nil {
+		return err
+	}
+
+	err = mongoClient.recordDataset(ctx, appContext.AirspacesSource.Name(), report)
+	if err != nil {
+		return err
+	}
+	err = mongoClient.RefreshViews(ctx)
+	if err != nil {
+		return err
+	}
+	appContext.CacheReset()
+
+	return nil
+}
+
+// AirspacesAt returns the airspaces containing the point at the given altitude in feet, lowest
+// first. Limits relative to the ground or standard pressure are compared as if they were
+// relative to MSL, as the terrain and the actual pressure are not known.
+func (mongoClient *MongoClient) AirspacesAt(ctx context.Context, latitude float64, longitude float64, altitude units.LengthFeet) ([]*Airspace, error) {
+
+	location := Coordinate{Latitude: latitude, Longitude: longitude}.Normalize()
+	err := location.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{
+		"boundary": bson.M{"$geoIntersects": bson.M{"$geometry": location}},
+		"lower_ft": bson.M{"$lte": float64(altitude)},
+		"upper_ft": bson.M{"$gte": float64(altitude)}}
+	cursor, err := mongoClient.readCollection(AirspacesCollection).Find(ctx, filter, options.Find().SetSort(bson.M{"lower_ft": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	airspaces := []*Airspace{}
+	err = cursor.All(ctx, &airspaces)
+	if err != nil {
+		return nil, err
+	}
+
+	return airspaces, nil
+}
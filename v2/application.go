@@ -8,33 +8,121 @@ import (
 	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/minio/minio-go"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
 )
 
 // AppContext describes the environment of the application including
 // permanent connections and defaults
 type AppContext struct {
-	S3Client       *minio.Client
-	DBURI          string
-	logBuffer      *bytes.Buffer
-	logTopic       string
-	MaxResults     int64
-	CountriesURL   string
-	RegionsURL     string
-	AirportsURL    string
-	RunwaysURL     string
-	FrequenciesURL string
+	Profile                 string
+	OptionsFile             string
+	OptionsKey              OptionsKeyFunc
+	Clock                   Clock
+	IDs                     IDGenerator
+	s3Client                *atomic.Value
+	DBURI                   string
+	DBName                  string
+	CollectionPrefix        string
+	CollectionSuffix        string
+	CollectionNames         map[string]string
+	logBuffer               *bytes.Buffer
+	logTopic                string
+	logName                 string
+	logMutex                *sync.Mutex
+	logStarted              time.Time
+	logPart                 int
+	logOutput               io.Writer
+	logFlushCancel          context.CancelFunc
+	LogFlushInterval        time.Duration
+	LogFlushBytes           int
+	LogSinks                []LogSink
+	EventSinks              []EventSink
+	Notifiers               []Notifier
+	Enrichers               map[string][]Enricher
+	MaterializedViews       []MaterializedView
+	countryTrees            *cache
+	NegativeCacheTTL        time.Duration
+	negativeLookups         *cache
+	QueryCacheTTL           time.Duration
+	queryResults            *cache
+	RateLimiter             *RateLimiter
+	LogSpoolDir             string
+	WorkspaceDir            string
+	WorkspaceBucket         string
+	DiscardFailedWorkspaces bool
+	logSpoolCancel          context.CancelFunc
+	ReadOnly                bool
+	SlowQueryThreshold      time.Duration
+	slowQueries             *int64
+	MaxResults              int64
+	ImportBatchRows         int
+	CountriesURL            string
+	RegionsURL              string
+	AirportsURL             string
+	AirportsSource          Source
+	ReportingPointsSource   Source
+	AirspacesSource         Source
+	RunwaysURL              string
+	FrequenciesURL          string
+	NavaidsURL              string
+	FixesURL                string
+	OverridesURL            string
+	MetarURL                string
+	TAFURL                  string
+	WeatherCacheTTL         time.Duration
+	QueryReadPreference     *readpref.ReadPref
+	storageOptions          storageOptions
+	healthMutex             *sync.Mutex
+	health                  map[string]*ComponentHealth
+	healthCancel            context.CancelFunc
+	HealthInterval          time.Duration
+	weatherReports          *cache
+	Diagnostics             bool
+	Authenticator           Authenticator
+	Roles                   map[string]Role
+	APIKeyRoles             map[string]Role
+	datasetVersions         *cache
+	importMetrics           *cache
+	dashboard               *cache
+	CORSOrigins             []string
+	Compression             bool
+	CacheMaxAge             time.Duration
+	LogErrors               bool
+	LogErrorsBucket         string
+	errorBuffer             *bytes.Buffer
+	ImportThrottle          *Throttle
+	Replicator              *Replicator
+	SourceImports           map[string]SourceImport
+	Validation              Validation
+	MaxRejectedPercent      float64
+	MaxShrinkPercent        float64
+	RequireApproval         bool
+	Tenant                  string
+	StorageDir              string
+	logTopicOverride        string
+	RunwaySurfaces          map[string]RunwaySurface
+	ClosedPolicy            ClosedPolicy
+	MongoOptions            []func(clientOptions *options.ClientOptions)
 }
 
+// MongoClient describes an open connection to the MongoDB
 type MongoClient struct {
-	DBClient  *mongo.Client
-	DBContext context.Context
-	dbCancel  context.CancelFunc
+	DBClient   *mongo.Client
+	DBContext  context.Context
+	dbCancel   context.CancelFunc
+	appContext *AppContext
+	dbName     string
 }
 
 // Optionfile descibes the content of the options file
@@ -42,34 +130,109 @@ type sourceOptions struct {
 	CountriesURL   string `json:"countries-url"`
 	RegionsURL     string `json:"regions-url"`
 	AirportsURL    string `json:"airports-url"`
+	AirportsFormat string `json:"airports-format"`
+	AirspacesURL   string `json:"airspaces-url"`
 	RunwaysURL     string `json:"runways-url"`
 	FrequenciesURL string `json:"frequencies-url"`
+	NavaidsURL     string `json:"navaids-url"`
+	FixesURL       string `json:"fixes-url"`
+	OverridesURL   string `json:"overrides-url"`
+	OpenAIPURL     string `json:"openaip-url"`
+	OpenAIPKey     string `json:"openaip-key"`
 }
 
 type storageOptions struct {
 	Server string `json:"server"`
 	Key    string `json:"key"`
 	Secret string `json:"secret"`
+	Local  string `json:"local"`
 }
 
 type optionFile struct {
-	Source     sourceOptions  `json:"source"`
-	Storage    storageOptions `json:"storage"`
-	Database   string         `json:"database"`
-	MaxResults int64          `json:"max-results"`
+	Source        sourceOptions           `json:"source"`
+	Storage       storageOptions          `json:"storage"`
+	Database      string                  `json:"database"`
+	Collections   collectionOptions       `json:"collections"`
+	MaxResults    int64                   `json:"max-results"`
+	ImportBatch   int                     `json:"import-batch-rows"`
+	ReadOnly      bool                    `json:"read-only"`
+	SlowQuery     int64                   `json:"slow-query-ms"`
+	NegativeCache int64                   `json:"negative-cache-seconds"`
+	QueryCache    int64                   `json:"query-cache-seconds"`
+	Notify        notifyOptions           `json:"notify"`
+	RateLimit     rateLimitOptions        `json:"rate-limit"`
+	LogSpool      string                  `json:"log-spool"`
+	LogFlush      logFlushOptions         `json:"log-flush"`
+	LogSinks      []logSinkOptions        `json:"log-sinks"`
+	EventSinks    []eventSinkOptions      `json:"event-sinks"`
+	Weather       weatherOptions          `json:"weather"`
+	QueryRead     string                  `json:"query-read-preference"`
+	Diagnostics   bool                    `json:"diagnostics"`
+	Auth          authOptions             `json:"auth"`
+	Server        serverOptions           `json:"server"`
+	LogErrors     logErrorsOptions        `json:"log-errors"`
+	Throttle      throttleOptions         `json:"import-throttle"`
+	Replica       replicaOptions          `json:"replica"`
+	Imports       map[string]SourceImport `json:"imports"`
+	Validation    validationOptions       `json:"validation"`
+	MaxShrink     float64                 `json:"max-shrink-percent"`
+	Approval      bool                    `json:"require-approval"`
+	Tenant        string                  `json:"tenant"`
+	Surfaces      map[string]string       `json:"runway-surfaces"`
+	Closed        string                  `json:"closed-airports"`
+	Mongo         mongoOptions            `json:"mongo"`
+	Workspace     workspaceOptions        `json:"workspace"`
 }
 
-func readOptions() (*optionFile, error) {
+// mergeOptions overlays the profile onto the base, descending into nested sections
+func mergeOptions(base map[string]interface{}, profile map[string]interface{}) {
+	for key, value := range profile {
+		baseSection, baseIsSection := base[key].(map[string]interface{})
+		profileSection, profileIsSection := value.(map[string]interface{})
+		if baseIsSection && profileIsSection {
+			mergeOptions(baseSection, profileSection)
+			continue
+		}
+		base[key] = value
+	}
+}
+
+// readOptions reads the options file, decrypting it when needed, and applies the named profile on
+// top of the base section
+func readOptions(fileName string, profile string, keyFunc OptionsKeyFunc) (*optionFile, error) {
 	var options optionFile
 
-	optionFile, err := os.Open("options.json")
+	if fileName == "" {
+		fileName = "options.json"
+	}
+	optionData, err := ReadOptionsFile(fileName, keyFunc)
 	if err != nil {
 		return nil, err
 	}
 
-	defer optionFile.Close()
-	decoder := json.NewDecoder(optionFile)
-	err = decoder.Decode(&options)
+	var content map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(optionData))
+	err = decoder.Decode(&content)
+	if err != nil {
+		return nil, err
+	}
+
+	// Profiles inherit everything they don't override from the base
+	profiles, _ := content["profiles"].(map[string]interface{})
+	delete(content, "profiles")
+	if profile != "" {
+		profileContent, found := profiles[profile].(map[string]interface{})
+		if !found {
+			return nil, fmt.Errorf("%s: unknown profile %s", fileName, profile)
+		}
+		mergeOptions(content, profileContent)
+	}
+
+	merged, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(merged, &options)
 	if err != nil {
 		return nil, err
 	}
@@ -77,72 +240,294 @@ func readOptions() (*optionFile, error) {
 	return &options, nil
 }
 
-func (appContext *AppContext) connectMinio(applicationOptions *optionFile) error {
+func (appContext *AppContext) connectMinio(storage storageOptions) error {
+	// Without a server the objects are kept in the storage folder, if there is one
+	if storage.Server == "" {
+		appContext.storageOptions = storage
+		return nil
+	}
+
 	// Connect to S3
-	minioClient, err := minio.New(
-		applicationOptions.Storage.Server,
-		applicationOptions.Storage.Key,
-		applicationOptions.Storage.Secret,
-		false)
+	ctx := context.Background()
+	minioClient, err := minio.New(storage.Server, &minio.Options{
+		Creds: credentials.NewStaticV4(storage.Key, storage.Secret, "")})
 	if err != nil {
 		return err
 	}
 
 	// Check the csv bucket
-	bucketFound, err := minioClient.BucketExists("csv")
+	bucketFound, err := minioClient.BucketExists(ctx, "csv")
 	if err != nil {
 		return err
 	}
 	if !bucketFound {
-		err = minioClient.MakeBucket("csv", "us-east-1")
+		err = minioClient.MakeBucket(ctx, "csv", minio.MakeBucketOptions{Region: "us-east-1"})
 		if err != nil {
 			return err
 		}
 	}
 
 	// Check the log bucket
-	bucketFound, err = minioClient.BucketExists("log")
+	bucketFound, err = minioClient.BucketExists(ctx, "log")
+	if err != nil {
+		return err
+	}
+	if !bucketFound {
+		err = minioClient.MakeBucket(ctx, "log", minio.MakeBucketOptions{Region: "us-east-1"})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Check the reports bucket
+	bucketFound, err = minioClient.BucketExists(ctx, "reports")
 	if err != nil {
 		return err
 	}
 	if !bucketFound {
-		err = minioClient.MakeBucket("log", "us-east-1")
+		err = minioClient.MakeBucket(ctx, "reports", minio.MakeBucketOptions{Region: "us-east-1"})
 		if err != nil {
 			return err
 		}
 	}
 
-	// Register result
-	appContext.S3Client = minioClient
+	// Register result, keeping the options to reconnect
+	appContext.s3Client.Store(minioClient)
+	appContext.storageOptions = storage
 
 	return nil
 }
 
-// CreateAppContext reads the application options and initializes permanent connections and defaults
-func CreateAppContext() (*AppContext, error) {
+// CreateAppContext reads the application options and initializes permanent connections and defaults,
+// the given options override what was read from the options file
+func CreateAppContext(contextOptions ...Option) (*AppContext, error) {
+
+	// The profile and options file decide what is read, so they are determined first
+	selection := AppContext{Profile: os.Getenv("GEO_PROFILE")}
+	for _, contextOption := range contextOptions {
+		contextOption(&selection)
+	}
 
-	applicationOptions, err := readOptions()
+	applicationOptions, err := readOptions(selection.OptionsFile, selection.Profile, selection.OptionsKey)
 	if err != nil {
 		return nil, err
 	}
 
+	// Keep the secrets out of what is logged before a logfile is opened
+	registerOptionSecrets(applicationOptions)
+	redactLog()
+
 	// Set up appContext
 	appContext := AppContext{
-		MaxResults:     applicationOptions.MaxResults,
-		CountriesURL:   applicationOptions.Source.CountriesURL,
-		RegionsURL:     applicationOptions.Source.RegionsURL,
-		AirportsURL:    applicationOptions.Source.AirportsURL,
-		RunwaysURL:     applicationOptions.Source.RunwaysURL,
-		FrequenciesURL: applicationOptions.Source.FrequenciesURL}
+		Profile:                 selection.Profile,
+		OptionsFile:             selection.OptionsFile,
+		OptionsKey:              selection.OptionsKey,
+		CollectionPrefix:        applicationOptions.Collections.Prefix,
+		CollectionSuffix:        applicationOptions.Collections.Suffix,
+		CollectionNames:         applicationOptions.Collections.Names,
+		MaxResults:              applicationOptions.MaxResults,
+		ImportBatchRows:         applicationOptions.ImportBatch,
+		SourceImports:           applicationOptions.Imports,
+		MaxShrinkPercent:        applicationOptions.MaxShrink,
+		RequireApproval:         applicationOptions.Approval,
+		Tenant:                  applicationOptions.Tenant,
+		StorageDir:              applicationOptions.Storage.Local,
+		CountriesURL:            applicationOptions.Source.CountriesURL,
+		RegionsURL:              applicationOptions.Source.RegionsURL,
+		AirportsURL:             applicationOptions.Source.AirportsURL,
+		RunwaysURL:              applicationOptions.Source.RunwaysURL,
+		FrequenciesURL:          applicationOptions.Source.FrequenciesURL,
+		NavaidsURL:              applicationOptions.Source.NavaidsURL,
+		FixesURL:                applicationOptions.Source.FixesURL,
+		OverridesURL:            applicationOptions.Source.OverridesURL,
+		MetarURL:                applicationOptions.Weather.MetarURL,
+		TAFURL:                  applicationOptions.Weather.TAFURL,
+		WeatherCacheTTL:         time.Duration(applicationOptions.Weather.CacheSeconds) * time.Second,
+		logMutex:                new(sync.Mutex),
+		healthMutex:             new(sync.Mutex),
+		slowQueries:             new(int64),
+		countryTrees:            newCache(countryTreeTTL),
+		datasetVersions:         newCache(datasetTTL),
+		importMetrics:           newCache(metricsTTL),
+		dashboard:               newCache(dashboardTTL),
+		ReadOnly:                applicationOptions.ReadOnly,
+		SlowQueryThreshold:      time.Duration(applicationOptions.SlowQuery) * time.Millisecond,
+		NegativeCacheTTL:        time.Duration(applicationOptions.NegativeCache) * time.Second,
+		QueryCacheTTL:           time.Duration(applicationOptions.QueryCache) * time.Second,
+		LogSpoolDir:             applicationOptions.LogSpool,
+		WorkspaceDir:            applicationOptions.Workspace.Dir,
+		WorkspaceBucket:         applicationOptions.Workspace.Bucket,
+		DiscardFailedWorkspaces: applicationOptions.Workspace.DiscardFailed,
+		LogFlushInterval:        time.Duration(applicationOptions.LogFlush.Minutes) * time.Minute,
+		LogFlushBytes:           applicationOptions.LogFlush.Megabytes * 1024 * 1024,
+		LogErrors:               applicationOptions.LogErrors.Enabled,
+		LogErrorsBucket:         applicationOptions.LogErrors.Bucket,
+		Diagnostics:             applicationOptions.Diagnostics,
+		CORSOrigins:             applicationOptions.Server.CORSOrigins,
+		Compression:             applicationOptions.Server.Compression,
+		CacheMaxAge:             time.Duration(applicationOptions.Server.CacheSeconds) * time.Second,
+		HealthInterval:          time.Duration(applicationOptions.Server.HealthSeconds) * time.Second,
+		s3Client:                new(atomic.Value)}
+
+	appContext.QueryReadPreference, err = parseReadPreference(applicationOptions.QueryRead)
+	if err != nil {
+		return nil, err
+	}
 
-	// Connect to Minio
-	err = appContext.connectMinio(applicationOptions)
+	if appContext.LogSpoolDir == "" {
+		appContext.LogSpoolDir = filepath.Join(os.TempDir(), "geography-log-spool")
+	}
+	if appContext.WorkspaceDir == "" {
+		appContext.WorkspaceDir = filepath.Join(os.TempDir(), "geography-work")
+	}
+
+	appContext.Authenticator = newAuthenticator(applicationOptions.Auth)
+	appContext.Roles, err = parseRoles("auth roles", applicationOptions.Auth.Roles)
 	if err != nil {
 		return nil, err
 	}
+	appContext.APIKeyRoles, err = parseRoles("auth api-key-roles", applicationOptions.Auth.APIKeyRoles)
+	if err != nil {
+		return nil, err
+	}
+
+	if applicationOptions.Throttle.LatencyMs > 0 {
+		appContext.ImportThrottle = NewThrottle(time.Duration(applicationOptions.Throttle.LatencyMs)*time.Millisecond,
+			time.Duration(applicationOptions.Throttle.MaxDelayMs)*time.Millisecond)
+	}
+
+	err = checkSourceImports(appContext.SourceImports)
+	if err != nil {
+		return nil, err
+	}
+	appContext.Validation, err = ParseValidation(applicationOptions.Validation.Mode)
+	if err != nil {
+		return nil, err
+	}
+	appContext.MaxRejectedPercent = applicationOptions.Validation.MaxRejectedPercent
+	appContext.RunwaySurfaces, err = parseSurfaces(applicationOptions.Surfaces)
+	if err != nil {
+		return nil, err
+	}
+	appContext.ClosedPolicy, err = ParseClosedPolicy(applicationOptions.Closed)
+	if err != nil {
+		return nil, err
+	}
+	customizeMongo, err := mongoCustomizer(applicationOptions.Mongo)
+	if err != nil {
+		return nil, err
+	}
+	appContext.MongoOptions = []func(clientOptions *options.ClientOptions){customizeMongo}
+
+	appContext.Replicator, err = newReplicator(applicationOptions.Replica)
+	if err != nil {
+		return nil, err
+	}
+
+	if applicationOptions.RateLimit.Rate > 0 {
+		appContext.RateLimiter = NewRateLimiter(applicationOptions.RateLimit.Rate, applicationOptions.RateLimit.Burst)
+	}
+
+	for _, contextOption := range contextOptions {
+		contextOption(&appContext)
+	}
+	err = checkTenant(appContext.Tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	if appContext.Clock == nil {
+		appContext.Clock = SystemClock{}
+	}
+	if appContext.IDs == nil {
+		appContext.IDs = ObjectIDGenerator{}
+	}
+
+	// Remember lookups that found nothing, if so configured
+	if appContext.NegativeCacheTTL > 0 {
+		appContext.negativeLookups = newCache(appContext.NegativeCacheTTL)
+	}
+
+	// Keep search results for identical queries on the same datasets, if so configured
+	if appContext.QueryCacheTTL > 0 {
+		appContext.queryResults = newCache(appContext.QueryCacheTTL)
+	}
+
+	// Weather reports are reused for a while, as they are only issued every half hour
+	if appContext.HealthInterval <= 0 {
+		appContext.HealthInterval = defaultHealthInterval
+	}
+	if appContext.WeatherCacheTTL <= 0 {
+		appContext.WeatherCacheTTL = defaultWeatherTTL
+	}
+	appContext.weatherReports = newCache(appContext.WeatherCacheTTL)
+
+	// The airports come from OurAirports unless configured otherwise
+	if appContext.AirportsSource == nil {
+		appContext.AirportsSource, err = NewSource("airports", applicationOptions.Source.AirportsFormat, appContext.AirportsURL, "id")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The openAIP data needs an API key, airspaces may come from a GeoJSON file instead
+	openAIPURL := applicationOptions.Source.OpenAIPURL
+	if openAIPURL == "" {
+		openAIPURL = defaultOpenAIPURL
+	}
+	if appContext.ReportingPointsSource == nil && applicationOptions.Source.OpenAIPKey != "" {
+		appContext.ReportingPointsSource = &OpenAIPSource{
+			SourceName: "reporting-points",
+			BaseURL:    openAIPURL,
+			Resource:   "reporting-points",
+			APIKey:     applicationOptions.Source.OpenAIPKey}
+	}
+	if appContext.AirspacesSource == nil && applicationOptions.Source.AirspacesURL != "" {
+		appContext.AirspacesSource = &GeoJSONSource{
+			SourceName:  "airspaces",
+			URL:         applicationOptions.Source.AirspacesURL,
+			KeyProperty: "id"}
+	}
+	if appContext.AirspacesSource == nil && applicationOptions.Source.OpenAIPKey != "" {
+		appContext.AirspacesSource = &OpenAIPSource{
+			SourceName: "airspaces",
+			BaseURL:    openAIPURL,
+			Resource:   "airspaces",
+			APIKey:     applicationOptions.Source.OpenAIPKey}
+	}
+
+	// Connect to Minio
+	err = appContext.connectMinio(applicationOptions.Storage)
+	if err != nil {
+		return nil, redactError(err)
+	}
 
 	// Connection to Mongo
 	appContext.DBURI = applicationOptions.Database
+	appContext.DBName = "geography"
+	dbConnString, err := connstring.Parse(applicationOptions.Database)
+	if err != nil {
+		return nil, redactError(err)
+	}
+	if dbConnString.Database != "" {
+		appContext.DBName = dbConnString.Database
+	}
+
+	// Set up notifications
+	appContext.Notifiers = createNotifiers(&applicationOptions.Notify)
+
+	// Set up log shipping
+	appContext.LogSinks, err = createLogSinks(applicationOptions.LogSinks)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set up event publishing, sinks given as option come on top
+	eventSinks, err := createEventSinks(applicationOptions.EventSinks)
+	if err != nil {
+		return nil, err
+	}
+	appContext.EventSinks = append(eventSinks, appContext.EventSinks...)
 
 	return &appContext, nil
 }
@@ -152,28 +537,49 @@ func (appContext *AppContext) DBOpen() (*MongoClient, error) {
 
 	// Connect to MongoDB
 	dbContext, dbCancel := context.WithTimeout(context.Background(), time.Second*10)
-	dbOptions := options.Client().ApplyURI(appContext.DBURI).SetDirect(true)
+	dbOptions := options.Client().ApplyURI(appContext.DBURI)
+
+	// Reading from secondaries needs the replica set to be discovered
+	if appContext.QueryReadPreference == nil {
+		dbOptions.SetDirect(true)
+	}
+	if appContext.SlowQueryThreshold > 0 {
+		dbOptions.SetMonitor(newSlowQueryMonitor(appContext))
+	}
+	for _, customize := range appContext.MongoOptions {
+		customize(dbOptions)
+	}
 	dbClient, err := mongo.Connect(dbContext, dbOptions)
 	if err != nil {
 		dbCancel()
-		return nil, err
+		return nil, redactError(err)
 	}
 
 	// Check the connection
 	err = dbClient.Ping(dbContext, nil)
 	if err != nil {
 		dbCancel()
-		return nil, err
+		return nil, redactError(err)
 	}
 
 	// Register it
 	return &MongoClient{
-		DBClient:  dbClient,
-		DBContext: dbContext,
-		dbCancel:  dbCancel,
+		DBClient:   dbClient,
+		DBContext:  dbContext,
+		dbCancel:   dbCancel,
+		appContext: appContext,
 	}, nil
 }
 
+// Database returns the geography database, or the scratch database of a simulation
+func (mongoClient *MongoClient) Database() *mongo.Database {
+	if mongoClient.dbName != "" {
+		return mongoClient.DBClient.Database(mongoClient.dbName)
+	}
+
+	return mongoClient.DBClient.Database(mongoClient.appContext.DBName)
+}
+
 // DBClose disconnects from the MongoDB
 func (mongoClient *MongoClient) DBClose() error {
 	// Already closed
@@ -181,28 +587,40 @@ func (mongoClient *MongoClient) DBClose() error {
 		return nil
 	}
 
-	// And not dropped
-	if mongoClient.DBContext.Err() == nil {
-		mongoClient.DBClient.Disconnect(mongoClient.DBContext)
-		mongoClient.dbCancel()
-	}
+	// The context of the connect may have timed out long ago, the pool is closed all the same
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	err := mongoClient.DBClient.Disconnect(ctx)
+	mongoClient.dbCancel()
 
 	// Register it
 	mongoClient.DBClient = nil
 	mongoClient.DBContext = nil
 	mongoClient.dbCancel = nil
 
-	return nil
+	return err
 }
 
 // LogFile creates a new logfile for the given topic in the logfolder
 func (appContext *AppContext) LogFile(topic string) (io.Writer, error) {
 
+	appContext.logMutex.Lock()
 	appContext.logBuffer = new(bytes.Buffer)
 	appContext.logTopic = topic
-	log.SetOutput(appContext.logBuffer)
+	appContext.logStarted = appContext.now()
+	appContext.logPart = 0
+	appContext.errorBuffer = nil
+	if appContext.LogErrors {
+		appContext.errorBuffer = new(bytes.Buffer)
+	}
+	appContext.logMutex.Unlock()
 
-	return appContext.logBuffer, nil
+	writer := &logWriter{appContext: appContext}
+	appContext.logOutput = log.Writer()
+	log.SetOutput(writer)
+	appContext.logFlushStart()
+
+	return writer, nil
 }
 
 // LogPrintln inserts a message in the logfile
@@ -212,31 +630,77 @@ func (appContext *AppContext) LogPrintln(s string) {
 	}
 }
 
-// LogError inserts an error in the logfile if there is one
+// LogError inserts an error in the logfile if there is one, marked for the error log when
+// that is kept
 func (appContext *AppContext) LogError(err error) {
-	if err != nil {
-		log.Println(err)
+	if err == nil {
+		return
 	}
+	if appContext.LogErrors {
+		log.Println(err.Error() + " " + errorMarker)
+		return
+	}
+
+	log.Println(err)
 }
 
-// LogClose moves the buffer to S3 in one go
-func (appContext *AppContext) LogClose() {
+// LogClose moves the buffer to S3 in one go, or as the last part when parts were flushed before.
+// A log the bucket does not take is spooled; the error is returned, the log is lost only when
+// spooling fails as well.
+func (appContext *AppContext) LogClose() error {
+
+	// Back to where the log went before the logfile, redacted
+	if appContext.logOutput != nil {
+		log.SetOutput(appContext.logOutput)
+		appContext.logOutput = nil
+	}
+	redactLog()
+	appContext.logFlushStop()
+	appContext.logSinkFlush()
+
+	appContext.logMutex.Lock()
+	defer appContext.logMutex.Unlock()
 
-	log.SetOutput(os.Stderr)
+	if appContext.logPart > 0 {
+		err := appContext.logFlushPart()
+		appContext.logBuffer = nil
+		errorsErr := appContext.logCloseErrors(fmt.Sprintf("%s-%s", appContext.logTopic, appContext.logStarted.Format("20060102-150405")))
+		if err != nil {
+			return fmt.Errorf("could not write logfile: %v", err)
+		}
+		return errorsErr
+	}
 
-	logDate := time.Now().Format("20060102-150405")
+	logDate := appContext.now().Format("20060102-150405")
 	logName := fmt.Sprintf("%s-%s.txt", appContext.logTopic, logDate)
+	errorsErr := appContext.logCloseErrors(fmt.Sprintf("%s-%s", appContext.logTopic, logDate))
 
-	s3Client := appContext.S3Client
-	_, err := s3Client.PutObject("log", logName, appContext.logBuffer, -1,
-		minio.PutObjectOptions{ContentType: "text/plain"})
+	logData := appContext.logBuffer.Bytes()
+	err := appContext.storeLog("log", logName, logData)
 	appContext.logBuffer = nil
+	appContext.logName = logName
 
+	// Keep the log locally until the bucket is reachable again
 	if err != nil {
-		log.Panicf("Could not write logfile\n")
+		spoolErr := appContext.logSpool(logName, logData)
+		if spoolErr != nil {
+			return fmt.Errorf("could not write logfile: %v, nor spool it: %v", err, spoolErr)
+		}
+		return fmt.Errorf("logfile spooled: %v", err)
 	}
 
+	return errorsErr
+}
+
+// LogName returns the object name of the most recently closed logfile
+func (appContext *AppContext) LogName() string {
+	return appContext.logName
 }
 
 func (appContext *AppContext) Destroy() {
+	appContext.HealthStop()
+	if appContext.Replicator != nil {
+		appContext.Replicator.pending.Wait()
+	}
+	appContext.LogSpoolStop()
 }
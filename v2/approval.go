@@ -0,0 +1,365 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrNotPending is returned when deciding on a staging that was decided or superseded before
+var ErrNotPending = errors.New("staging is not pending")
+
+// StagingStatus tells where a staged import is in the approval
+type StagingStatus string
+
+// The states of a staged import, a newer staging supersedes one still pending
+const (
+	StagingPending    StagingStatus = "pending"
+	StagingApproved   StagingStatus = "approved"
+	StagingRejected   StagingStatus = "rejected"
+	StagingSuperseded StagingStatus = "superseded"
+)
+
+// ChangeSummary counts what a staged import changes compared to the live airports
+type ChangeSummary struct {
+	Previous int64 `bson:"previous" json:"previous"`
+	Loaded   int64 `bson:"loaded" json:"loaded"`
+	Added    int64 `bson:"added" json:"added"`
+	Changed  int64 `bson:"changed" json:"changed"`
+	Removed  int64 `bson:"removed" json:"removed"`
+}
+
+// Staging is an import loaded into the shadow collection, going live once approved
+type Staging struct {
+	RunID     string        `bson:"_id" json:"run-id"`
+	Source    string        `bson:"source" json:"source"`
+	Version   string        `bson:"version" json:"version"`
+	Summary   ChangeSummary `bson:"summary" json:"summary"`
+	Status    StagingStatus `bson:"status" json:"status"`
+	Staged    time.Time     `bson:"staged" json:"staged"`
+	Decided   time.Time     `bson:"decided,omitempty" json:"decided,omitempty"`
+	DecidedBy string        `bson:"decided_by,omitempty" json:"decided-by,omitempty"`
+}
+
+// WithApproval stages the airport imports, in place or swapped, they only go live through Approve
+func WithApproval(required bool) Option {
+	return func(appContext *AppContext) {
+		appContext.RequireApproval = required
+	}
+}
+
+func (mongoClient *MongoClient) stagings() *mongo.Collection {
+	return mongoClient.collection(StagingsCollection)
+}
+
+// stagingShadow returns the shadow collection the airports staged by the run are loaded into
+func (mongoClient *MongoClient) stagingShadow(runID string) *mongo.Collection {
+	return mongoClient.Database().Collection(mongoClient.appContext.CollectionName(AirportsCollection) + stagingSuffix + runID)
+}
+
+// stageAirports returns a store function for loadShadow that counts the airports added and
+// changed compared to the live ones, and upserts them in the shadow collection
+func (mongoClient *MongoClient) stageAirports(ctx context.Context, report *RunReport, shadow *mongo.Collection, summary *ChangeSummary) func(batch []keyedDocument) (int64, error) {
+	return func(batch []keyedDocument) (int64, error) {
+		storedByID, err := mongoClient.storedAirports(ctx, batch)
+		if err != nil {
+			return 0, err
+		}
+
+		var added, changed int64
+		for _, document := range batch {
+			oldDocument, found := storedByID[document.id]
+			if !found {
+				added++
+				continue
+			}
+			newDocument, err := roundTrip(document.document)
+			if err != nil {
+				return 0, err
+			}
+			if len(diffDocuments(oldDocument, newDocument)) > 0 {
+				changed++
+			}
+		}
+
+		n, err := mongoClient.bulkUpsert(ctx, shadow, batch, report)
+		if err != nil {
+			return n, err
+		}
+
+		// Batches may be stored by several workers at once
+		report.mutex.Lock()
+		summary.Added += added
+		summary.Changed += changed
+		report.mutex.Unlock()
+
+		return n, nil
+	}
+}
+
+// StageAirports loads the airports into a shadow collection of the run like ImportAirportsSwap,
+// but leaves the live airports alone until the staging is approved. The operators are notified
+// of the change summary. A staging still pending is superseded and its shadow dropped.
+func (mongoClient *MongoClient) StageAirports(ctx context.Context, report *RunReport) (*Staging, error) {
+	appContext := mongoClient.appContext
+
+	err := appContext.CheckWritable()
+	if err != nil {
+		return nil, err
+	}
+
+	pending, err := mongoClient.stagings().Distinct(ctx, "_id", bson.M{"status": StagingPending})
+	if err != nil {
+		return nil, err
+	}
+	for _, runID := range pending {
+		superseded, _ := runID.(string)
+		_, err = mongoClient.stagings().UpdateOne(ctx, bson.M{"_id": superseded, "status": StagingPending},
+			bson.M{"$set": bson.M{"status": StagingSuperseded, "decided": appContext.now()}})
+		if err == nil {
+			err = mongoClient.stagingShadow(superseded).Drop(ctx)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var summary ChangeSummary
+	_, _, err = mongoClient.loadShadow(ctx, report, stagingSuffix+report.RunID, &summary)
+	if err != nil {
+		return nil, err
+	}
+
+	source := appContext.AirportsSource.Name()
+	staging := Staging{
+		RunID:   report.RunID,
+		Source:  source,
+		Version: report.Versions[source],
+		Summary: summary,
+		Status:  StagingPending,
+		Staged:  appContext.now()}
+	_, err = mongoClient.stagings().InsertOne(ctx, &staging)
+	if err != nil {
+		return nil, err
+	}
+
+	appContext.Logger().With("run-id", staging.RunID, "added", summary.Added, "changed", summary.Changed,
+		"removed", summary.Removed).Println("Airports staged for approval")
+	err = appContext.Notify(&Notification{
+		Topic:   report.Topic,
+		Subject: fmt.Sprintf("%s: airports staged for approval", report.Topic),
+		Message: staging.describe(),
+		LogName: appContext.LogName()})
+	if err != nil {
+		appContext.LogError(err)
+	}
+
+	return &staging, nil
+}
+
+// describe summarizes the staging for the operators deciding on it
+func (staging *Staging) describe() string {
+	var message strings.Builder
+
+	fmt.Fprintf(&message, "Run %s staged %s version %s\r\n", staging.RunID, staging.Source, staging.Version)
+	fmt.Fprintf(&message, "- %d airports, %d before\r\n", staging.Summary.Loaded, staging.Summary.Previous)
+	fmt.Fprintf(&message, "- %d added, %d changed, %d removed\r\n",
+		staging.Summary.Added, staging.Summary.Changed, staging.Summary.Removed)
+	fmt.Fprintf(&message, "Approve or reject run %s to decide\r\n", staging.RunID)
+
+	return message.String()
+}
+
+// Staging returns the staging of the run
+func (mongoClient *MongoClient) Staging(ctx context.Context, runID string) (*Staging, error) {
+	var staging Staging
+
+	err := mongoClient.stagings().FindOne(ctx, bson.M{"_id": runID}).Decode(&staging)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &staging, nil
+}
+
+// decide moves the pending staging of the run to the status, recording who decided
+func (mongoClient *MongoClient) decide(ctx context.Context, runID string, status StagingStatus) (*Staging, error) {
+	decidedBy := ""
+	principal := PrincipalFrom(ctx)
+	if principal != nil {
+		decidedBy = principal.Subject
+	}
+
+	var staging Staging
+	err := mongoClient.stagings().FindOneAndUpdate(ctx,
+		bson.M{"_id": runID, "status": StagingPending},
+		bson.M{"$set": bson.M{"status": status, "decided": mongoClient.appContext.now(), "decided_by": decidedBy}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&staging)
+	if err == mongo.ErrNoDocuments {
+		_, err = mongoClient.Staging(ctx, runID)
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrNotPending
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &staging, nil
+}
+
+// shadowChanges returns the history of the airports in the shadow collection compared to the
+// live ones, the live airports it lacks as removed, to be inserted once the shadow replaced them
+func (mongoClient *MongoClient) shadowChanges(ctx context.Context, shadow *mongo.Collection, version string) ([]interface{}, error) {
+	changes := []interface{}{}
+
+	cursor, err := shadow.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	batch := make([]keyedDocument, 0, importBatchSize)
+	flush := func() error {
+		batchChanges, err := mongoClient.airportChanges(ctx, batch, version)
+		changes = append(changes, batchChanges...)
+		batch = batch[:0]
+		return err
+	}
+	for cursor.Next(ctx) {
+		var airport Airport
+		err = cursor.Decode(&airport)
+		if err != nil {
+			return nil, err
+		}
+		batch = append(batch, keyedDocument{id: airport.AirportID, document: &airport})
+
+		if len(batch) == importBatchSize {
+			err = flush()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if cursor.Err() != nil {
+		return nil, cursor.Err()
+	}
+	err = flush()
+	if err != nil {
+		return nil, err
+	}
+
+	removed, err := mongoClient.shadowRemovals(ctx, shadow)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(changes, mongoClient.removalChanges(removed, version)...), nil
+}
+
+// checkStaging verifies the shadow of the staging is still there with the airports staged,
+// before anything is recorded of it
+func (mongoClient *MongoClient) checkStaging(ctx context.Context, staging *Staging) (*mongo.Collection, error) {
+	shadow := mongoClient.stagingShadow(staging.RunID)
+
+	names, err := mongoClient.Database().ListCollectionNames(ctx, bson.M{"name": shadow.Name()})
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("staging %s of version %s: %s is gone", staging.RunID, staging.Version, shadow.Name())
+	}
+	loaded, err := shadow.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	if loaded != staging.Summary.Loaded {
+		return nil, fmt.Errorf("staging %s of version %s: %s holds %d airports, %d were staged",
+			staging.RunID, staging.Version, shadow.Name(), loaded, staging.Summary.Loaded)
+	}
+
+	return shadow, nil
+}
+
+// Approve puts the staged airports of the run live: the shadow collection of the run replaces
+// the live one, after which the history is recorded and the version registered. A shadow that
+// is gone or does not hold what was staged is refused, leaving the live airports and their
+// history alone.
+func (mongoClient *MongoClient) Approve(ctx context.Context, runID string) (*Staging, error) {
+	appContext := mongoClient.appContext
+
+	err := appContext.CheckWritable()
+	if err != nil {
+		return nil, err
+	}
+
+	staging, err := mongoClient.decide(ctx, runID, StagingApproved)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []interface{}
+	shadow, err := mongoClient.checkStaging(ctx, staging)
+	if err == nil {
+		changes, err = mongoClient.shadowChanges(ctx, shadow, staging.Version)
+	}
+	if err == nil {
+		err = mongoClient.swapCollection(ctx, shadow.Name(), appContext.CollectionName(AirportsCollection))
+	}
+	if err != nil {
+		// Leave it to be approved again
+		mongoClient.stagings().UpdateOne(ctx, bson.M{"_id": runID},
+			bson.M{"$set": bson.M{"status": StagingPending}, "$unset": bson.M{"decided": "", "decided_by": ""}})
+		return nil, err
+	}
+
+	_, err = mongoClient.insertChanges(ctx, changes)
+	if err != nil {
+		return nil, err
+	}
+	err = mongoClient.storeDataset(ctx, staging.Source, staging.Version, staging.RunID)
+	if err != nil {
+		return nil, err
+	}
+	err = mongoClient.RefreshViews(ctx)
+	if err != nil {
+		return nil, err
+	}
+	appContext.CacheReset()
+	appContext.Logger().With("run-id", runID, "by", staging.DecidedBy).Println("Staged airports approved")
+
+	return staging, nil
+}
+
+// Reject discards the staged airports of the run
+func (mongoClient *MongoClient) Reject(ctx context.Context, runID string) (*Staging, error) {
+	appContext := mongoClient.appContext
+
+	err := appContext.CheckWritable()
+	if err != nil {
+		return nil, err
+	}
+
+	staging, err := mongoClient.decide(ctx, runID, StagingRejected)
+	if err != nil {
+		return nil, err
+	}
+
+	err = mongoClient.stagingShadow(runID).Drop(ctx)
+	if err != nil {
+		return nil, err
+	}
+	appContext.Logger().With("run-id", runID, "by", staging.DecidedBy).Println("Staged airports rejected")
+
+	return staging, nil
+}
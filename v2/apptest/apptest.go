@@ -0,0 +1,229 @@
+// Package apptest runs MongoDB and MinIO in Docker containers and creates an AppContext against
+// them, so integration tests can use the real stores with a single call
+package apptest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	application "github.com/ralph-nijpels/geography-application/v2"
+)
+
+// The containers started by default
+const (
+	DefaultMongoImage = "mongo:4.4"
+	DefaultMinioImage = "minio/minio:latest"
+)
+
+// The credentials of the MinIO container
+const (
+	minioKey    = "apptest"
+	minioSecret = "apptest-secret"
+)
+
+// startTimeout is how long the containers get to accept connections
+const startTimeout = time.Minute
+
+// Options selects the images and passes options on to the AppContext
+type Options struct {
+	MongoImage     string
+	MinioImage     string
+	ContextOptions []application.Option
+	Seed           bool
+}
+
+// Environment is a running MongoDB and MinIO with an AppContext connected to them
+type Environment struct {
+	AppContext    *application.AppContext
+	MongoURI      string
+	MinioEndpoint string
+	containers    []string
+	directory     string
+}
+
+// docker runs the docker command, returning its trimmed output
+func docker(ctx context.Context, args ...string) (string, error) {
+	output, err := exec.CommandContext(ctx, "docker", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("docker %s: %v: %s", args[0], err, strings.TrimSpace(string(output)))
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// Available tells whether the docker command can reach a daemon
+func Available(ctx context.Context) bool {
+	_, err := docker(ctx, "info", "--format", "{{.ServerVersion}}")
+	return err == nil
+}
+
+// startContainer runs the image, returning the local address of the given container port
+func (environment *Environment) startContainer(ctx context.Context, port string, args ...string) (string, error) {
+	id, err := docker(ctx, append([]string{"run", "--detach", "--rm", "--publish", port}, args...)...)
+	if err != nil {
+		return "", err
+	}
+	environment.containers = append(environment.containers, id)
+
+	// The first mapping is enough, like 0.0.0.0:49153
+	mapping, err := docker(ctx, "port", id, port)
+	if err != nil {
+		return "", err
+	}
+	mapping = strings.Split(mapping, "\n")[0]
+
+	return "127.0.0.1:" + mapping[strings.LastIndex(mapping, ":")+1:], nil
+}
+
+// writeOptions writes an options file pointing at the containers
+func (environment *Environment) writeOptions() (string, error) {
+	content, err := json.Marshal(map[string]interface{}{
+		"storage": map[string]string{
+			"server": environment.MinioEndpoint,
+			"key":    minioKey,
+			"secret": minioSecret},
+		"database": environment.MongoURI})
+	if err != nil {
+		return "", err
+	}
+
+	fileName := filepath.Join(environment.directory, "options.json")
+	return fileName, ioutil.WriteFile(fileName, content, 0600)
+}
+
+// connect creates the AppContext, retrying until both stores accept connections
+func (environment *Environment) connect(ctx context.Context, contextOptions []application.Option) error {
+	deadline := time.Now().Add(startTimeout)
+
+	for {
+		appContext, err := application.CreateAppContext(contextOptions...)
+		if err == nil {
+			var mongoClient *application.MongoClient
+			mongoClient, err = appContext.DBOpen()
+			if err == nil {
+				mongoClient.DBClose()
+				environment.AppContext = appContext
+				return nil
+			}
+			appContext.Destroy()
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("containers not ready: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// Start runs the containers and creates the AppContext, on an error everything started
+// so far is removed again
+func Start(ctx context.Context, options Options) (*Environment, error) {
+	if options.MongoImage == "" {
+		options.MongoImage = DefaultMongoImage
+	}
+	if options.MinioImage == "" {
+		options.MinioImage = DefaultMinioImage
+	}
+
+	directory, err := ioutil.TempDir("", "apptest-")
+	if err != nil {
+		return nil, err
+	}
+	environment := Environment{directory: directory}
+
+	mongoAddress, err := environment.startContainer(ctx, "27017/tcp", options.MongoImage)
+	if err != nil {
+		environment.Close()
+		return nil, err
+	}
+	environment.MongoURI = "mongodb://" + mongoAddress + "/geography-test"
+
+	environment.MinioEndpoint, err = environment.startContainer(ctx, "9000/tcp",
+		"--env", "MINIO_ROOT_USER="+minioKey, "--env", "MINIO_ROOT_PASSWORD="+minioSecret,
+		options.MinioImage, "server", "/data")
+	if err != nil {
+		environment.Close()
+		return nil, err
+	}
+
+	fileName, err := environment.writeOptions()
+	if err != nil {
+		environment.Close()
+		return nil, err
+	}
+
+	contextOptions := append([]application.Option{application.WithOptionsFile(fileName)}, options.ContextOptions...)
+	err = environment.connect(ctx, contextOptions)
+	if err != nil {
+		environment.Close()
+		return nil, err
+	}
+
+	if options.Seed {
+		_, err = environment.AppContext.Seed(ctx)
+		if err != nil {
+			environment.Close()
+			return nil, err
+		}
+	}
+
+	return &environment, nil
+}
+
+// Close destroys the AppContext and removes the containers
+func (environment *Environment) Close() error {
+	var firstErr error
+
+	if environment.AppContext != nil {
+		environment.AppContext.Destroy()
+		environment.AppContext = nil
+	}
+
+	for _, id := range environment.containers {
+		_, err := docker(context.Background(), "rm", "--force", id)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	environment.containers = nil
+
+	if environment.directory != "" {
+		os.RemoveAll(environment.directory)
+		environment.directory = ""
+	}
+
+	return firstErr
+}
+
+// New starts an environment for the test, seeded with the sample data, and removes it when
+// the test ends. The test is skipped when Docker is not available.
+func New(t testing.TB, contextOptions ...application.Option) *Environment {
+	t.Helper()
+
+	ctx := context.Background()
+	if !Available(ctx) {
+		t.Skip("apptest: docker is not available")
+	}
+
+	environment, err := Start(ctx, Options{ContextOptions: contextOptions, Seed: true})
+	if err != nil {
+		t.Fatalf("apptest: %v", err)
+	}
+	t.Cleanup(func() {
+		environment.Close()
+	})
+
+	return environment
+}
@@ -0,0 +1,127 @@
+package application
+
+import (
+	"context"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// snapshotLayout is the date format in the names of the source snapshots
+const snapshotLayout = "20060102-150405"
+
+// snapshotAsOf finds the latest snapshot of a source taken at or before the given time
+func (appContext *AppContext) snapshotAsOf(ctx context.Context, source string, asOf time.Time) (string, error) {
+
+	snapshots, err := appContext.listObjects(ctx, "csv", source+"-", false)
+	if err != nil {
+		return "", err
+	}
+
+	latest := ""
+	latestTaken := time.Time{}
+	for _, snapshotInfo := range snapshots {
+		name := snapshotInfo.Key
+		stamp := strings.TrimPrefix(name, source+"-")
+		stamp = strings.TrimSuffix(stamp, path.Ext(stamp))
+		taken, err := time.ParseInLocation(snapshotLayout, stamp, time.Local)
+		if err != nil || taken.After(asOf) {
+			continue
+		}
+		if taken.After(latestTaken) {
+			latest = name
+			latestTaken = taken
+		}
+	}
+
+	if latest == "" {
+		return "", ErrNotFound
+	}
+
+	return latest, nil
+}
+
+// snapshotReader opens a snapshot of the source for streaming, the object must be closed after use
+func (appContext *AppContext) snapshotReader(ctx context.Context, source Source, name string) (io.ReadCloser, RecordReader, error) {
+
+	snapshotObject, err := appContext.getObject(ctx, "csv", name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reader, err := source.Parse(snapshotObject)
+	if err != nil {
+		snapshotObject.Close()
+		return nil, nil, err
+	}
+
+	return snapshotObject, reader, nil
+}
+
+// airportAsOf rebuilds an airport from the snapshots that were imported at the given time
+func (mongoClient *MongoClient) airportAsOf(ctx context.Context, column string, code string, asOf time.Time) (*Airport, error) {
+	appContext := mongoClient.appContext
+
+	code = NormalizeCode(code)
+	if code == "" {
+		return nil, ErrNotFound
+	}
+
+	source := appContext.AirportsSource
+	snapshot, err := appContext.snapshotAsOf(ctx, source.Name(), asOf)
+	if err != nil {
+		return nil, err
+	}
+
+	// Corrections kept in a CSV were snapshotted as well, so they are applied as they were
+	overrides := map[string]map[string]string{}
+	overridesSnapshot, err := appContext.snapshotAsOf(ctx, "overrides", asOf)
+	if err != nil && err != ErrNotFound {
+		return nil, err
+	}
+	if err == nil {
+		overridesObject, reader, err := appContext.snapshotReader(ctx, &CSVSource{SourceName: "overrides"}, overridesSnapshot)
+		if err != nil {
+			return nil, err
+		}
+		overrides, err = readOverrides(reader, nil)
+		overridesObject.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	snapshotObject, reader, err := appContext.snapshotReader(ctx, source, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	defer snapshotObject.Close()
+
+	for reader.Next() {
+		record := reader.Record()
+		if NormalizeCode(record[column]) != code {
+			continue
+		}
+		applyOverrides([]map[string]string{record}, overrides)
+		return airportFromRecord(record)
+	}
+	if reader.Err() != nil {
+		return nil, reader.Err()
+	}
+
+	return nil, ErrNotFound
+}
+
+// AirportByICAOAsOf finds an airport by its ICAO code as it was after the last import
+// at or before the given time. Corrections from the overrides collection are not versioned
+// and therefore not included.
+func (mongoClient *MongoClient) AirportByICAOAsOf(ctx context.Context, icao string, asOf time.Time) (*Airport, error) {
+	return mongoClient.airportAsOf(ctx, "icao_code", icao, asOf)
+}
+
+// AirportByIATAAsOf finds an airport by its IATA code as it was after the last import
+// at or before the given time
+func (mongoClient *MongoClient) AirportByIATAAsOf(ctx context.Context, iata string, asOf time.Time) (*Airport, error) {
+	return mongoClient.airportAsOf(ctx, "iata_code", iata, asOf)
+}
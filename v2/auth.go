@@ -0,0 +1,356 @@
+package application
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnauthenticated is returned when a credential is missing or not accepted
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// jwksTTL is how long the keys of the JWKS endpoint are used before fetching them again,
+// an unknown key id fetches them sooner but at most once per jwksRetry
+const (
+	jwksTTL   = time.Hour
+	jwksRetry = time.Minute
+)
+
+// jwtLeeway allows for clock differences with the token issuer
+const jwtLeeway = time.Minute
+
+// authOptions describes the auth section of the options file. API keys and their roles are
+// mapped by the name of the key, roles are mapped by the subject of the token; the two are kept
+// apart so a token can not claim the role of a key by taking its name as subject.
+type authOptions struct {
+	APIKeys     map[string]string `json:"api-keys"`
+	APIKeyRoles map[string]string `json:"api-key-roles"`
+	JWKSURL     string            `json:"jwks-url"`
+	Issuer      string            `json:"issuer"`
+	Audience    string            `json:"audience"`
+	Roles       map[string]string `json:"roles"`
+}
+
+// Principal is the caller a credential was accepted for
+type Principal struct {
+	Subject string                 `json:"subject"`
+	Method  string                 `json:"method"`
+	Claims  map[string]interface{} `json:"claims,omitempty"`
+}
+
+// Authenticator accepts or rejects the credential a caller presents, a bearer token or API key,
+// returning ErrUnauthenticated when it does not recognize it
+type Authenticator interface {
+	Authenticate(ctx context.Context, credential string) (*Principal, error)
+}
+
+// Authenticators tries each of its authenticators, the first accepting the credential wins
+type Authenticators []Authenticator
+
+// Authenticate returns the principal of the first authenticator accepting the credential
+func (authenticators Authenticators) Authenticate(ctx context.Context, credential string) (*Principal, error) {
+	for _, authenticator := range authenticators {
+		principal, err := authenticator.Authenticate(ctx, credential)
+		if err != ErrUnauthenticated {
+			return principal, err
+		}
+	}
+
+	return nil, ErrUnauthenticated
+}
+
+// APIKeyAuthenticator accepts a fixed set of API keys, each known by a name
+type APIKeyAuthenticator struct {
+	keys map[string]string
+}
+
+// NewAPIKeyAuthenticator accepts the given keys, mapped by the name reported as subject
+func NewAPIKeyAuthenticator(keys map[string]string) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{keys: keys}
+}
+
+// Authenticate compares the credential to every key in constant time
+func (authenticator *APIKeyAuthenticator) Authenticate(ctx context.Context, credential string) (*Principal, error) {
+	var subject string
+
+	for name, key := range authenticator.keys {
+		if key != "" && subtle.ConstantTimeCompare([]byte(key), []byte(credential)) == 1 {
+			subject = name
+		}
+	}
+	if subject == "" {
+		return nil, ErrUnauthenticated
+	}
+
+	return &Principal{Subject: subject, Method: "api-key"}, nil
+}
+
+// JWTAuthenticator accepts RS256 and ES256 signed JSON Web Tokens, verified with the keys
+// published at a JWKS URL
+type JWTAuthenticator struct {
+	JWKSURL  string
+	Issuer   string
+	Audience string
+	Clock    Clock
+	mutex    sync.Mutex
+	keys     map[string]crypto.PublicKey
+	fetched  time.Time
+}
+
+// NewJWTAuthenticator verifies tokens with the keys at the JWKS URL, the issuer and audience
+// are checked when not empty
+func NewJWTAuthenticator(jwksURL string, issuer string, audience string) *JWTAuthenticator {
+	return &JWTAuthenticator{JWKSURL: jwksURL, Issuer: issuer, Audience: audience, Clock: SystemClock{}}
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Subject   string      `json:"sub"`
+	Issuer    string      `json:"iss"`
+	Audience  interface{} `json:"aud"`
+	Expires   *int64      `json:"exp"`
+	NotBefore *int64      `json:"nbf"`
+}
+
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Curve   string `json:"crv"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+// decodeSegment decodes a base64url part of a token or key, with or without padding
+func decodeSegment(segment string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+}
+
+// publicKey converts the JSON web key, returning nil for key types not supported
+func (key *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch key.KeyType {
+	case "RSA":
+		n, err := decodeSegment(key.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeSegment(key.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if key.Curve != "P-256" {
+			return nil, nil
+		}
+		x, err := decodeSegment(key.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeSegment(key.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// fetchKeys reads the key set from the JWKS URL
+func (authenticator *JWTAuthenticator) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	reader, err := openSource(ctx, authenticator.JWKSURL)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var keySet struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	err = json.NewDecoder(reader).Decode(&keySet)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", authenticator.JWKSURL, err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, webKey := range keySet.Keys {
+		publicKey, err := webKey.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("%s: key %s: %v", authenticator.JWKSURL, webKey.KeyID, err)
+		}
+		if publicKey != nil {
+			keys[webKey.KeyID] = publicKey
+		}
+	}
+
+	return keys, nil
+}
+
+// key returns the key with the id, fetching the key set when it is stale or lacks the id
+func (authenticator *JWTAuthenticator) key(ctx context.Context, keyID string) (crypto.PublicKey, error) {
+	authenticator.mutex.Lock()
+	defer authenticator.mutex.Unlock()
+
+	now := authenticator.Clock.Now()
+	key, found := authenticator.keys[keyID]
+	age := now.Sub(authenticator.fetched)
+	if (found && age < jwksTTL) || (!found && age < jwksRetry) {
+		return key, nil
+	}
+
+	keys, err := authenticator.fetchKeys(ctx)
+	if err != nil {
+		// Keep using the keys we have rather than locking everybody out
+		if found {
+			return key, nil
+		}
+		return nil, err
+	}
+	authenticator.keys = keys
+	authenticator.fetched = now
+
+	return keys[keyID], nil
+}
+
+// verifySignature checks the signature over the signed part of the token
+func verifySignature(algorithm string, key crypto.PublicKey, signed string, signature []byte) bool {
+	digest := sha256.Sum256([]byte(signed))
+
+	switch publicKey := key.(type) {
+	case *rsa.PublicKey:
+		return algorithm == "RS256" && rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature) == nil
+	case *ecdsa.PublicKey:
+		if algorithm != "ES256" || len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(publicKey, digest[:], r, s)
+	default:
+		return false
+	}
+}
+
+// hasAudience tells whether the aud claim, a string or a list of them, contains the audience
+func hasAudience(claim interface{}, audience string) bool {
+	switch value := claim.(type) {
+	case string:
+		return value == audience
+	case []interface{}:
+		for _, item := range value {
+			if item == audience {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Authenticate verifies the token, anything not shaped like a JWT is left to other authenticators
+func (authenticator *JWTAuthenticator) Authenticate(ctx context.Context, credential string) (*Principal, error) {
+	parts := strings.Split(credential, ".")
+	if len(parts) != 3 {
+		return nil, ErrUnauthenticated
+	}
+
+	var header jwtHeader
+	data, err := decodeSegment(parts[0])
+	if err != nil || json.Unmarshal(data, &header) != nil {
+		return nil, ErrUnauthenticated
+	}
+
+	signature, err := decodeSegment(parts[2])
+	if err != nil {
+		return nil, ErrUnauthenticated
+	}
+
+	key, err := authenticator.key(ctx, header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil || !verifySignature(header.Algorithm, key, parts[0]+"."+parts[1], signature) {
+		return nil, ErrUnauthenticated
+	}
+
+	var claims jwtClaims
+	var allClaims map[string]interface{}
+	data, err = decodeSegment(parts[1])
+	if err != nil || json.Unmarshal(data, &claims) != nil || json.Unmarshal(data, &allClaims) != nil {
+		return nil, ErrUnauthenticated
+	}
+
+	now := authenticator.Clock.Now()
+	if claims.Expires != nil && now.After(time.Unix(*claims.Expires, 0).Add(jwtLeeway)) {
+		return nil, ErrUnauthenticated
+	}
+	if claims.NotBefore != nil && now.Before(time.Unix(*claims.NotBefore, 0).Add(-jwtLeeway)) {
+		return nil, ErrUnauthenticated
+	}
+	if authenticator.Issuer != "" && claims.Issuer != authenticator.Issuer {
+		return nil, ErrUnauthenticated
+	}
+	if authenticator.Audience != "" && !hasAudience(claims.Audience, authenticator.Audience) {
+		return nil, ErrUnauthenticated
+	}
+
+	return &Principal{Subject: claims.Subject, Method: "jwt", Claims: allClaims}, nil
+}
+
+// WithAuthenticator requires callers of the server to present a credential it accepts,
+// nil serves everybody
+func WithAuthenticator(authenticator Authenticator) Option {
+	return func(appContext *AppContext) {
+		appContext.Authenticator = authenticator
+	}
+}
+
+// newAuthenticator builds the authenticators configured in the options file, nil if none are
+func newAuthenticator(options authOptions) Authenticator {
+	authenticators := Authenticators{}
+
+	if len(options.APIKeys) > 0 {
+		authenticators = append(authenticators, NewAPIKeyAuthenticator(options.APIKeys))
+	}
+	if options.JWKSURL != "" {
+		authenticators = append(authenticators, NewJWTAuthenticator(options.JWKSURL, options.Issuer, options.Audience))
+	}
+
+	if len(authenticators) == 0 {
+		return nil
+	}
+
+	return authenticators
+}
+
+// principalKey is the context key of the authenticated principal
+type principalKey struct{}
+
+// WithPrincipal returns a context carrying the authenticated caller
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFrom returns the authenticated caller carried by the context, nil if there is none
+func PrincipalFrom(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
@@ -0,0 +1,141 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// DefaultBenchRows is the size of the synthetic airports file used by Bench
+const DefaultBenchRows = 100000
+
+// benchCollection is the scratch collection the upsert stage writes to, dropped afterwards
+const benchCollection = "bench"
+
+// The performance budget of the import path in rows per second, a stage running slower
+// than its budget fails the bench
+var benchBudgets = map[string]float64{
+	"parse":    200000,
+	"validate": 200000,
+	"upsert":   5000,
+}
+
+// BenchResult is the measurement of a single stage of the import path
+type BenchResult struct {
+	Stage         string        `json:"stage"`
+	Rows          int64         `json:"rows"`
+	Duration      time.Duration `json:"duration"`
+	RowsPerSecond float64       `json:"rows-per-second"`
+	BytesPerRow   float64       `json:"bytes-per-row"`
+	Budget        float64       `json:"budget"`
+	WithinBudget  bool          `json:"within-budget"`
+}
+
+// benchStage times the stage, counting the bytes it allocated
+func benchStage(stage string, run func() (int64, error)) (*BenchResult, error) {
+	var before, after runtime.MemStats
+
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	started := time.Now()
+	rows, err := run()
+	duration := time.Since(started)
+	runtime.ReadMemStats(&after)
+	if err != nil {
+		return nil, fmt.Errorf("bench %s: %v", stage, err)
+	}
+
+	result := BenchResult{Stage: stage, Rows: rows, Duration: duration, Budget: benchBudgets[stage]}
+	if rows > 0 {
+		result.RowsPerSecond = float64(rows) / duration.Seconds()
+		result.BytesPerRow = float64(after.TotalAlloc-before.TotalAlloc) / float64(rows)
+	}
+	result.WithinBudget = result.RowsPerSecond >= result.Budget
+
+	return &result, nil
+}
+
+// Bench measures the import path on a synthetic airports file: parsing the CSV, converting
+// and validating the records, and upserting them in a scratch collection of the database.
+// Without a database connection only the first two stages run.
+func (appContext *AppContext) Bench(ctx context.Context, mongoClient *MongoClient, rows int) ([]*BenchResult, error) {
+	if rows <= 0 {
+		rows = DefaultBenchRows
+	}
+
+	var data bytes.Buffer
+	err := WriteSyntheticAirports(&data, rows, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []*BenchResult{}
+	records := make([]map[string]string, 0, rows)
+	result, err := benchStage("parse", func() (int64, error) {
+		reader, err := NewCSVReader(bytes.NewReader(data.Bytes()))
+		if err != nil {
+			return 0, err
+		}
+		for reader.Next() {
+			records = append(records, reader.Record())
+		}
+		return int64(len(records)), reader.Err()
+	})
+	if err != nil {
+		return results, err
+	}
+	results = append(results, result)
+
+	documents := make([]keyedDocument, 0, rows)
+	result, err = benchStage("validate", func() (int64, error) {
+		for _, record := range records {
+			airport, err := airportFromRecord(record)
+			if err != nil {
+				return 0, err
+			}
+			documents = append(documents, keyedDocument{id: airport.AirportID, document: airport})
+		}
+		return int64(len(documents)), nil
+	})
+	if err != nil {
+		return results, err
+	}
+	results = append(results, result)
+
+	if mongoClient == nil {
+		return results, nil
+	}
+	err = appContext.CheckWritable()
+	if err != nil {
+		return results, err
+	}
+
+	// The documents are stored in the batches an import of the airports would hand over
+	collection := mongoClient.collection(benchCollection)
+	defer collection.Drop(context.Background())
+	report := appContext.ReportCreate("bench")
+	batchRows := appContext.sourceImport(appContext.AirportsSource.Name()).BatchRows
+	result, err = benchStage("upsert", func() (int64, error) {
+		var upserted int64
+		for start := 0; start < len(documents); start += batchRows {
+			end := start + batchRows
+			if end > len(documents) {
+				end = len(documents)
+			}
+			n, err := mongoClient.bulkUpsert(ctx, collection, documents[start:end], report)
+			upserted += n
+			if err != nil {
+				return upserted, err
+			}
+		}
+		return upserted, nil
+	})
+	if err != nil {
+		return results, err
+	}
+	results = append(results, result)
+
+	return results, nil
+}
@@ -0,0 +1,84 @@
+package application
+
+import (
+	"bytes"
+	"testing"
+)
+
+// benchRecords parses the synthetic airports file the stage benchmarks run on
+func benchRecords(b *testing.B) []map[string]string {
+	reader, err := NewCSVReader(bytes.NewReader(benchCSVData(b)))
+	if err != nil {
+		b.Fatal(err)
+	}
+	records := []map[string]string{}
+	for reader.Next() {
+		records = append(records, reader.Record())
+	}
+	if reader.Err() != nil {
+		b.Fatal(reader.Err())
+	}
+
+	return records
+}
+
+// BenchmarkParse is the parse stage of Bench: streaming the records out of the CSV file
+func BenchmarkParse(b *testing.B) {
+	data := benchCSVData(b)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		reader, err := NewCSVReader(bytes.NewReader(data))
+		if err != nil {
+			b.Fatal(err)
+		}
+		for reader.Next() {
+		}
+		if reader.Err() != nil {
+			b.Fatal(reader.Err())
+		}
+	}
+}
+
+// BenchmarkValidate is the validate stage of Bench: converting the records to airports
+func BenchmarkValidate(b *testing.B) {
+	records := benchRecords(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, record := range records {
+			_, err := airportFromRecord(record)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// BenchmarkHash is the part of the upsert stage that runs before the database is reached:
+// hashing the airports to skip the unchanged ones
+func BenchmarkHash(b *testing.B) {
+	records := benchRecords(b)
+	airports := make([]interface{}, 0, len(records))
+	for _, record := range records {
+		airport, err := airportFromRecord(record)
+		if err != nil {
+			b.Fatal(err)
+		}
+		airports = append(airports, airport)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, airport := range airports {
+			_, err := hashedDocument(airport)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// Package brokers provides the NATS and Kafka REST event sinks of the event-sinks section of the
+// options file. Importing it for its side effect registers them:
+//
+//	import _ "github.com/ralph-nijpels/geography-application/v2/brokers"
+package brokers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	application "github.com/ralph-nijpels/geography-application/v2"
+)
+
+// eventTimeout bounds the delivery of an event, a slow broker is not to hold up the import
+const eventTimeout = 10 * time.Second
+
+func init() {
+	application.RegisterEventSink("nats", func(sinkURL string, topic string, user string, password string) (application.EventSink, error) {
+		return NewNATSSink(sinkURL, topic, user, password)
+	})
+	application.RegisterEventSink("kafka-rest", func(sinkURL string, topic string, user string, password string) (application.EventSink, error) {
+		return NewKafkaRESTSink(sinkURL, topic), nil
+	})
+}
+
+// NATSSink publishes events as JSON messages on a NATS subject, connecting for every event as
+// imports are rare
+type NATSSink struct {
+	address  string
+	subject  string
+	user     string
+	password string
+}
+
+// NewNATSSink publishes on the subject of the NATS server at the nats://host:port URL, the
+// credentials are used when not empty
+func NewNATSSink(natsURL string, subject string, user string, password string) (*NATSSink, error) {
+	location, err := url.Parse(natsURL)
+	if err != nil {
+		return nil, err
+	}
+	if location.Scheme != "nats" || location.Host == "" {
+		return nil, fmt.Errorf("%s: expected nats://host:port", natsURL)
+	}
+	if subject == "" || strings.ContainsAny(subject, " \t\r\n") {
+		return nil, fmt.Errorf("%s: invalid subject %q", natsURL, subject)
+	}
+
+	address := location.Host
+	if location.Port() == "" {
+		address = net.JoinHostPort(location.Hostname(), "4222")
+	}
+
+	return &NATSSink{address: address, subject: subject, user: user, password: password}, nil
+}
+
+// Publish sends the event and waits for the server to answer a ping, so an error of the server
+// is reported rather than lost
+func (sink *NATSSink) Publish(event *application.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	connection, err := net.DialTimeout("tcp", sink.address, eventTimeout)
+	if err != nil {
+		return err
+	}
+	defer connection.Close()
+	connection.SetDeadline(time.Now().Add(eventTimeout))
+
+	// The server opens with its INFO line
+	reader := bufio.NewReader(connection)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("%s: unexpected greeting %q", sink.address, strings.TrimSpace(line))
+	}
+
+	options := map[string]interface{}{"verbose": false, "pedantic": false, "name": "geography"}
+	if sink.user != "" {
+		options["user"] = sink.user
+		options["pass"] = sink.password
+	}
+	connect, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "CONNECT %s\r\n", connect)
+	fmt.Fprintf(&message, "PUB %s %d\r\n%s\r\n", sink.subject, len(payload), payload)
+	message.WriteString("PING\r\n")
+	_, err = connection.Write(message.Bytes())
+	if err != nil {
+		return err
+	}
+
+	for {
+		line, err = reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("%s: %s", sink.address, line)
+		}
+	}
+}
+
+// KafkaRESTSink publishes events on a Kafka topic, keyed by the source so the events of a
+// source keep their order. It does not speak the Kafka protocol: the brokers have to be fronted
+// by a Confluent-compatible REST proxy (API v2), which the URL points at.
+type KafkaRESTSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewKafkaRESTSink publishes on the topic through the REST proxy at the URL
+func NewKafkaRESTSink(proxyURL string, topic string) *KafkaRESTSink {
+	return &KafkaRESTSink{
+		url:    strings.TrimRight(proxyURL, "/") + "/topics/" + url.PathEscape(topic),
+		client: &http.Client{Timeout: eventTimeout}}
+}
+
+// Publish posts the event as a JSON record
+func (sink *KafkaRESTSink) Publish(event *application.Event) error {
+	type record struct {
+		Key   string             `json:"key,omitempty"`
+		Value *application.Event `json:"value"`
+	}
+
+	key := ""
+	if event.Dataset != nil {
+		key = event.Dataset.Source
+	}
+	body, err := json.Marshal(map[string][]record{"records": {{Key: key, Value: event}}})
+	if err != nil {
+		return err
+	}
+
+	response, err := sink.client.Post(sink.url, "application/vnd.kafka.json.v2+json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+
+	if response.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("%s: %s", sink.url, response.Status)
+	}
+
+	return nil
+}
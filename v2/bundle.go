@@ -0,0 +1,384 @@
+package application
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BundlesBucket holds the dataset bundles built for distribution
+const BundlesBucket = "bundles"
+
+// bundleManifestName is the first entry of a bundle, describing the others
+const bundleManifestName = "manifest.json"
+
+// BundleFile describes a collection in a bundle, stored as newline delimited extended JSON
+type BundleFile struct {
+	Collection string `json:"collection"`
+	Name       string `json:"name"`
+	Documents  int64  `json:"documents"`
+	SHA256     string `json:"sha256"`
+}
+
+// BundleManifest describes a bundle: the versions of the sources it holds and a hash of every
+// file, so a consumer can check what it received
+type BundleManifest struct {
+	Name     string            `json:"name"`
+	Built    time.Time         `json:"built"`
+	Tag      string            `json:"tag"`
+	Datasets []*DatasetVersion `json:"datasets"`
+	Files    []*BundleFile     `json:"files"`
+}
+
+// exportCollection writes the documents of the collection to a file in the workspace, positioned
+// at the start
+func (mongoClient *MongoClient) exportCollection(ctx context.Context, workspace *Workspace, base string) (*sourceFile, *BundleFile, error) {
+	cursor, err := mongoClient.collection(base).Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cursor.Close(ctx)
+
+	file, err := workspace.TempFile(base + "-*.ndjson")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bundleFile := BundleFile{Collection: base, Name: base + ".ndjson"}
+	hash := sha256.New()
+	writer := bufio.NewWriter(io.MultiWriter(file, hash))
+	for cursor.Next(ctx) {
+		line, err := bson.MarshalExtJSON(cursor.Current, false, false)
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		writer.Write(line)
+		writer.WriteByte('\n')
+		bundleFile.Documents++
+	}
+	err = cursor.Err()
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	bundleFile.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	return file, &bundleFile, nil
+}
+
+// writeBundle writes the manifest and the files as a compressed archive
+func writeBundle(writer io.Writer, manifest *BundleManifest, files []*sourceFile) error {
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	zipper := gzip.NewWriter(writer)
+	archive := tar.NewWriter(zipper)
+	err = archive.WriteHeader(&tar.Header{Name: bundleManifestName, Mode: 0644, Size: int64(len(manifestData)),
+		ModTime: manifest.Built})
+	if err == nil {
+		_, err = archive.Write(manifestData)
+	}
+
+	for i := 0; err == nil && i < len(files); i++ {
+		var info os.FileInfo
+		info, err = files[i].Stat()
+		if err == nil {
+			err = archive.WriteHeader(&tar.Header{Name: manifest.Files[i].Name, Mode: 0644, Size: info.Size(),
+				ModTime: manifest.Built})
+		}
+		if err == nil {
+			_, err = io.Copy(archive, files[i])
+		}
+	}
+
+	if err == nil {
+		err = archive.Close()
+	}
+	if err == nil {
+		err = zipper.Close()
+	}
+
+	return err
+}
+
+// BuildBundle exports the imported data with a manifest of versions and hashes as a single
+// compressed archive in the bundles bucket, for edge devices to sync the whole dataset in one go
+func (appContext *AppContext) BuildBundle(ctx context.Context) (*BundleManifest, error) {
+	mongoClient, err := appContext.DBOpen()
+	if err != nil {
+		return nil, err
+	}
+	defer mongoClient.DBClose()
+
+	// The exports stay behind for inspection when the bundle fails
+	workspace := appContext.newWorkspace(appContext.newID().Hex())
+	built := false
+	defer func() {
+		appContext.closeWorkspace(context.Background(), workspace, built)
+	}()
+
+	manifest := BundleManifest{Built: appContext.now(), Files: []*BundleFile{}}
+	manifest.Name = fmt.Sprintf("geography-%s.tar.gz", manifest.Built.Format(snapshotLayout))
+	manifest.Datasets, err = mongoClient.DatasetVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	manifest.Tag, err = appContext.DatasetTag(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The manifest goes first but needs the hashes, so the collections are exported beforehand
+	files := []*sourceFile{}
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+	for _, base := range dataCollections {
+		file, bundleFile, err := mongoClient.exportCollection(ctx, workspace, base)
+		if err != nil {
+			return nil, fmt.Errorf("bundle %s: %v", base, err)
+		}
+		files = append(files, file)
+		manifest.Files = append(manifest.Files, bundleFile)
+	}
+
+	bundle, err := workspace.TempFile("geography-*.tar.gz")
+	if err != nil {
+		return nil, err
+	}
+	defer bundle.Close()
+
+	err = writeBundle(bundle, &manifest, files)
+	if err != nil {
+		return nil, err
+	}
+	size, err := bundle.Seek(0, io.SeekCurrent)
+	if err == nil {
+		_, err = bundle.Seek(0, io.SeekStart)
+	}
+	if err == nil {
+		err = appContext.ensureBucket(ctx, BundlesBucket)
+	}
+	if err == nil {
+		err = appContext.putObject(ctx, BundlesBucket, manifest.Name, bundle, size,
+			ObjectTags{TagVersion: manifest.Tag}.putOptions("application/gzip"))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	appContext.Logger().With("bundle", manifest.Name, "tag", manifest.Tag, "bytes", size).Println("Bundle: built")
+	built = true
+
+	return &manifest, nil
+}
+
+// bundleSuffix marks the collections a bundle loads into, apart from the shadows of imports
+const bundleSuffix = "_bundle"
+
+// loadBundleFile loads a file of the bundle into a fresh shadow collection of its own, checking
+// it against the manifest. The shadows of a running import or a pending staging are left alone.
+func (mongoClient *MongoClient) loadBundleFile(ctx context.Context, reader io.Reader, bundleFile *BundleFile) (*mongo.Collection, error) {
+	shadow := mongoClient.Database().Collection(mongoClient.appContext.CollectionName(bundleFile.Collection) + bundleSuffix)
+	err := shadow.Drop(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+	lines := bufio.NewReader(io.TeeReader(reader, hash))
+	batch := make([]interface{}, 0, importBatchSize)
+	var loaded int64
+	for {
+		// Airspace geometries make for long lines, too long for a scanner
+		line, err := lines.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			break
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		var document bson.D
+		err = bson.UnmarshalExtJSON(line, false, &document)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", loaded+1, err)
+		}
+		batch = append(batch, document)
+		loaded++
+
+		if len(batch) == importBatchSize {
+			_, err = shadow.InsertMany(ctx, batch)
+			if err != nil {
+				return nil, err
+			}
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		_, err = shadow.InsertMany(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if loaded != bundleFile.Documents || hex.EncodeToString(hash.Sum(nil)) != bundleFile.SHA256 {
+		shadow.Drop(context.Background())
+		return nil, fmt.Errorf("%d documents read, the manifest lists %d or a different hash", loaded, bundleFile.Documents)
+	}
+
+	err = mongoClient.ensureIndexes(ctx, bundleFile.Collection, shadow)
+	if err != nil {
+		return nil, err
+	}
+
+	return shadow, nil
+}
+
+// latestBundle returns the name of the most recent bundle
+func (appContext *AppContext) latestBundle(ctx context.Context) (string, error) {
+	bundles, err := appContext.listObjects(ctx, BundlesBucket, "geography-", false)
+	if err != nil {
+		return "", err
+	}
+	if len(bundles) == 0 {
+		return "", ErrNotFound
+	}
+
+	// Names are date-stamped, so the last one in lexical order is the latest
+	return bundles[len(bundles)-1].Key, nil
+}
+
+// LoadBundle replaces the imported data by that of the bundle, the latest when no name is given.
+// Every file is loaded aside and checked against the manifest before any collection is
+// replaced, the dataset versions are taken over from the bundle.
+func (appContext *AppContext) LoadBundle(ctx context.Context, name string) (*BundleManifest, error) {
+	err := appContext.CheckWritable()
+	if err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		name, err = appContext.latestBundle(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	object, err := appContext.getObject(ctx, BundlesBucket, name)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	zipped, err := gzip.NewReader(object)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	archive := tar.NewReader(zipped)
+
+	header, err := archive.Next()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if header.Name != bundleManifestName {
+		return nil, fmt.Errorf("%s: starts with %s rather than the manifest", name, header.Name)
+	}
+	var manifest BundleManifest
+	err = json.NewDecoder(archive).Decode(&manifest)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+
+	mongoClient, err := appContext.DBOpen()
+	if err != nil {
+		return nil, err
+	}
+	defer mongoClient.DBClose()
+
+	shadows := map[string]*mongo.Collection{}
+	defer func() {
+		for _, shadow := range shadows {
+			shadow.Drop(context.Background())
+		}
+	}()
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+
+		var bundleFile *BundleFile
+		for _, file := range manifest.Files {
+			if file.Name == path.Clean(header.Name) {
+				bundleFile = file
+			}
+		}
+		if bundleFile == nil || !isDataCollection(bundleFile.Collection) {
+			return nil, fmt.Errorf("%s: %s is not in the manifest", name, header.Name)
+		}
+
+		shadows[bundleFile.Collection], err = mongoClient.loadBundleFile(ctx, archive, bundleFile)
+		if err != nil {
+			delete(shadows, bundleFile.Collection)
+			return nil, fmt.Errorf("%s: %s: %v", name, header.Name, err)
+		}
+	}
+	for _, file := range manifest.Files {
+		if shadows[file.Collection] == nil {
+			return nil, fmt.Errorf("%s: %s is missing", name, file.Name)
+		}
+	}
+
+	for base, shadow := range shadows {
+		err = mongoClient.swapCollection(ctx, shadow.Name(), appContext.CollectionName(base))
+		if err != nil {
+			return nil, err
+		}
+		delete(shadows, base)
+	}
+
+	for _, dataset := range manifest.Datasets {
+		_, err = mongoClient.datasets().ReplaceOne(ctx, bson.M{"_id": dataset.Source}, dataset,
+			options.Replace().SetUpsert(true))
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = mongoClient.RefreshViews(ctx)
+	if err != nil {
+		return nil, err
+	}
+	appContext.CacheReset()
+
+	appContext.Logger().With("bundle", name, "tag", manifest.Tag).Println("Bundle: loaded")
+
+	return &manifest, nil
+}
@@ -0,0 +1,90 @@
+package application
+
+import (
+	"sync"
+	"time"
+)
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// maxCacheEntries bounds the memory a cache can take
+const maxCacheEntries = 10000
+
+// cache is a simple in-memory store with a fixed time to live
+type cache struct {
+	mutex   sync.Mutex
+	ttl     time.Duration
+	entries map[string]cacheEntry
+}
+
+func newCache(ttl time.Duration) *cache {
+	return &cache{
+		ttl:     ttl,
+		entries: map[string]cacheEntry{}}
+}
+
+func (c *cache) get(key string) (interface{}, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, found := c.entries[key]
+	if !found {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	return entry.value, true
+}
+
+func (c *cache) put(key string, value interface{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// When full, make room by dropping the expired entries or, failing that, everything
+	now := time.Now()
+	if len(c.entries) >= maxCacheEntries {
+		for key, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, key)
+			}
+		}
+		if len(c.entries) >= maxCacheEntries {
+			c.entries = map[string]cacheEntry{}
+		}
+	}
+
+	c.entries[key] = cacheEntry{value: value, expires: now.Add(c.ttl)}
+}
+
+func (c *cache) reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entries = map[string]cacheEntry{}
+}
+
+// CacheReset empties all query caches, typically called after an import
+func (appContext *AppContext) CacheReset() {
+	appContext.countryTrees.reset()
+	if appContext.negativeLookups != nil {
+		appContext.negativeLookups.reset()
+	}
+	if appContext.queryResults != nil {
+		appContext.queryResults.reset()
+	}
+	if appContext.datasetVersions != nil {
+		appContext.datasetVersions.reset()
+	}
+	if appContext.importMetrics != nil {
+		appContext.importMetrics.reset()
+	}
+	if appContext.dashboard != nil {
+		appContext.dashboard.reset()
+	}
+}
@@ -0,0 +1,120 @@
+package application
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// jobCancelPoll is how often a running job is checked for a cancellation
+const jobCancelPoll = 5 * time.Second
+
+// contextReader stops reading once the context is done, for sources that are not read over a
+// request bound to it, like local files
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (reader *contextReader) Read(p []byte) (int, error) {
+	err := reader.ctx.Err()
+	if err != nil {
+		return 0, err
+	}
+
+	return reader.reader.Read(p)
+}
+
+// runFilter selects the job of a run, by the run id it was given or else by its own id
+func runFilter(runID string) bson.M {
+	runFilter := []bson.M{{"params.run-id": runID}}
+	objectID, err := primitive.ObjectIDFromHex(runID)
+	if err == nil {
+		runFilter = append(runFilter, bson.M{"_id": objectID})
+	}
+
+	return bson.M{"$or": runFilter}
+}
+
+// CancelRun stops the job of the run: a queued job is cancelled right away, a running one once
+// its worker notices, within a few seconds. The run id is that of the job params or the job id.
+func (mongoClient *MongoClient) CancelRun(ctx context.Context, runID string) (*Job, error) {
+	err := mongoClient.appContext.CheckWritable()
+	if err != nil {
+		return nil, err
+	}
+
+	now := mongoClient.appContext.now()
+	filter := runFilter(runID)
+	var job Job
+
+	filter["status"] = JobQueued
+	err = mongoClient.jobs().FindOneAndUpdate(ctx, filter,
+		bson.M{"$set": bson.M{"status": JobCancelled, "cancel_requested": true, "updated": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&job)
+	if err != mongo.ErrNoDocuments {
+		return &job, err
+	}
+
+	filter["status"] = JobRunning
+	err = mongoClient.jobs().FindOneAndUpdate(ctx, filter,
+		bson.M{"$set": bson.M{"cancel_requested": true, "updated": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// watchJob cancels the context of the running job once a cancellation is requested, or has its
+// import pause when that is requested, until the returned function is called, after which the
+// job tells whether it was cancelled. It polls through the client that claimed the job.
+func (worker *JobWorker) watchJob(ctx context.Context, mongoClient *MongoClient, job *Job, cancel context.CancelFunc, control *jobControl) func() {
+	stop := make(chan struct{})
+	var done sync.WaitGroup
+
+	done.Add(1)
+	go func() {
+		defer done.Done()
+
+		ticker := time.NewTicker(jobCancelPoll)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			cancelRequested, pauseRequested, err := mongoClient.jobSignals(ctx, job.JobID)
+			if err != nil {
+				continue
+			}
+			if cancelRequested {
+				job.CancelRequested = true
+				cancel()
+				return
+			}
+			if pauseRequested {
+				control.requestPause()
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		done.Wait()
+	}
+}
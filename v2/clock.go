@@ -0,0 +1,125 @@
+package application
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Clock tells the time used for log names, run reports, snapshots and stored records
+type Clock interface {
+	Now() time.Time
+}
+
+// IDGenerator hands out the ids of jobs, run reports and other records
+type IDGenerator interface {
+	NewID() primitive.ObjectID
+}
+
+// SystemClock is the real time
+type SystemClock struct{}
+
+// Now returns the current time
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// ObjectIDGenerator hands out regular MongoDB object ids
+type ObjectIDGenerator struct{}
+
+// NewID returns a new object id
+func (ObjectIDGenerator) NewID() primitive.ObjectID {
+	return primitive.NewObjectID()
+}
+
+// FakeClock is a clock for tests, it stands still unless advanced or given a step
+type FakeClock struct {
+	mutex sync.Mutex
+	now   time.Time
+	step  time.Duration
+}
+
+// NewFakeClock returns a clock at the given time that moves the step forward every time it
+// is read, a zero step keeps it still
+func NewFakeClock(now time.Time, step time.Duration) *FakeClock {
+	return &FakeClock{now: now, step: step}
+}
+
+// Now returns the time of the clock and moves it a step forward
+func (clock *FakeClock) Now() time.Time {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	now := clock.now
+	clock.now = clock.now.Add(clock.step)
+
+	return now
+}
+
+// Set puts the clock at the given time
+func (clock *FakeClock) Set(now time.Time) {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	clock.now = now
+}
+
+// Advance moves the clock forward
+func (clock *FakeClock) Advance(duration time.Duration) {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	clock.now = clock.now.Add(duration)
+}
+
+// SequenceIDGenerator is an id generator for tests, handing out 000...001, 000...002 and so on
+type SequenceIDGenerator struct {
+	mutex sync.Mutex
+	next  uint64
+}
+
+// NewID returns the next id in the sequence
+func (generator *SequenceIDGenerator) NewID() primitive.ObjectID {
+	generator.mutex.Lock()
+	defer generator.mutex.Unlock()
+
+	generator.next++
+	var id primitive.ObjectID
+	binary.BigEndian.PutUint64(id[4:], generator.next)
+
+	return id
+}
+
+// WithClock replaces the system clock, typically by a FakeClock in tests
+func WithClock(clock Clock) Option {
+	return func(appContext *AppContext) {
+		appContext.Clock = clock
+	}
+}
+
+// WithIDGenerator replaces the object id generator, typically by a SequenceIDGenerator in tests
+func WithIDGenerator(generator IDGenerator) Option {
+	return func(appContext *AppContext) {
+		appContext.IDs = generator
+	}
+}
+
+// now reads the clock of the AppContext, the system clock when there is none
+func (appContext *AppContext) now() time.Time {
+	if appContext.Clock == nil {
+		return time.Now()
+	}
+
+	return appContext.Clock.Now()
+}
+
+// newID takes an id from the generator of the AppContext, an object id when there is none
+func (appContext *AppContext) newID() primitive.ObjectID {
+	if appContext.IDs == nil {
+		return primitive.NewObjectID()
+	}
+
+	return appContext.IDs.NewID()
+}
@@ -0,0 +1,116 @@
+package application
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ClosedPolicy decides what happens to the airports the source marks as closed
+type ClosedPolicy string
+
+// The closed-airport policies: keep stores them and returns them like any other airport,
+// exclude stores them but leaves them out of the searches unless asked for, drop does not
+// import them at all
+const (
+	ClosedKeep    ClosedPolicy = "keep"
+	ClosedExclude ClosedPolicy = "exclude"
+	ClosedDrop    ClosedPolicy = "drop"
+)
+
+// ParseClosedPolicy reads a closed-airport policy, empty is keep
+func ParseClosedPolicy(s string) (ClosedPolicy, error) {
+	switch ClosedPolicy(s) {
+	case "", ClosedKeep:
+		return ClosedKeep, nil
+	case ClosedExclude:
+		return ClosedExclude, nil
+	case ClosedDrop:
+		return ClosedDrop, nil
+	}
+
+	return "", fmt.Errorf("unknown closed-airport policy %q", s)
+}
+
+// WithClosedPolicy sets what happens to the airports marked closed
+func WithClosedPolicy(policy ClosedPolicy) Option {
+	return func(appContext *AppContext) {
+		appContext.ClosedPolicy = policy
+	}
+}
+
+// includeClosedKey is the context key of the include-closed flag
+type includeClosedKey struct{}
+
+// IncludeClosed returns a context under which the airport searches return the closed airports
+// the exclude policy leaves out by default
+func IncludeClosed(ctx context.Context) context.Context {
+	return context.WithValue(ctx, includeClosedKey{}, true)
+}
+
+// closedExcluded tells whether the searches under the context leave out the closed airports
+func (appContext *AppContext) closedExcluded(ctx context.Context) bool {
+	include, _ := ctx.Value(includeClosedKey{}).(bool)
+	return appContext.ClosedPolicy == ClosedExclude && !include
+}
+
+// excludeClosed adds the condition leaving out the closed airports to the query of a search
+// when the policy asks for it, unless the query already selects on the type
+func (appContext *AppContext) excludeClosed(ctx context.Context, query bson.M) bson.M {
+	if !appContext.closedExcluded(ctx) {
+		return query
+	}
+	if query == nil {
+		query = bson.M{}
+	}
+	_, found := query["type"]
+	if !found {
+		query["type"] = bson.M{"$ne": ClosedAirport}
+	}
+
+	return query
+}
+
+// dropsClosed tells whether the airport is not to be imported under the policy
+func (appContext *AppContext) dropsClosed(airport *Airport) bool {
+	return appContext.ClosedPolicy == ClosedDrop && airport.Type == ClosedAirport
+}
+
+// countAirports counts the airports of the collection that an import is expected to load again,
+// which under the drop policy are the ones not closed
+func (mongoClient *MongoClient) countAirports(ctx context.Context, collection *mongo.Collection) (int64, error) {
+	filter := bson.M{}
+	if mongoClient.appContext.ClosedPolicy == ClosedDrop {
+		filter["type"] = bson.M{"$ne": ClosedAirport}
+	}
+
+	return collection.CountDocuments(ctx, filter)
+}
+
+// removeClosed removes the closed airports an import under the drop policy left behind
+func (mongoClient *MongoClient) removeClosed(ctx context.Context, report *RunReport) error {
+	if mongoClient.appContext.ClosedPolicy != ClosedDrop {
+		return nil
+	}
+
+	// Recorded as removed first, so a sync takes them away from the mirrors
+	closed, err := mongoClient.airports().Distinct(ctx, "_id", bson.M{"type": ClosedAirport})
+	if err != nil {
+		return err
+	}
+	changes, err := mongoClient.recordRemovals(ctx, closed, report.Versions[mongoClient.appContext.AirportsSource.Name()])
+	if err != nil {
+		return err
+	}
+	report.AddCount("history", changes)
+
+	result, err := mongoClient.airports().DeleteMany(ctx, bson.M{"type": ClosedAirport})
+	if err != nil {
+		return err
+	}
+	report.AddCount("closed-removed", result.DeletedCount)
+
+	return nil
+}
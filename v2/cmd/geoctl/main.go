@@ -0,0 +1,724 @@
+// Command geoctl offers maintenance commands for the geography application
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	application "github.com/ralph-nijpels/geography-application/v2"
+	_ "github.com/ralph-nijpels/geography-application/v2/brokers"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: geoctl <command> [arguments]\n\n")
+	fmt.Fprintf(os.Stderr, "commands:\n")
+	fmt.Fprintf(os.Stderr, "  schema            print the JSON Schema of the options file\n")
+	fmt.Fprintf(os.Stderr, "  validate [file]   validate an options file (default options.json)\n")
+	fmt.Fprintf(os.Stderr, "  encrypt file out  encrypt an options file with the key in GEO_OPTIONS_KEY\n")
+	fmt.Fprintf(os.Stderr, "  migrate           run the database migrations not applied yet\n")
+	fmt.Fprintf(os.Stderr, "  seed              load the bundled sample data for development\n")
+	fmt.Fprintf(os.Stderr, "  bench [rows]      time the import path on synthetic airports (default 100000)\n")
+	fmt.Fprintf(os.Stderr, "  synth [flags] dir write synthetic countries, regions, airports, runways and frequencies\n")
+	fmt.Fprintf(os.Stderr, "  simulate [flags]  import synthetic data into a scratch database (-keep to inspect it)\n")
+	fmt.Fprintf(os.Stderr, "  approve run-id    put the airports staged by the run live\n")
+	fmt.Fprintf(os.Stderr, "  reject run-id     discard the airports staged by the run\n")
+	fmt.Fprintf(os.Stderr, "  cancel run-id     stop the job of the run, or the job with that id\n")
+	fmt.Fprintf(os.Stderr, "  pause run-id      pause the job of the run at the end of a batch\n")
+	fmt.Fprintf(os.Stderr, "  resume run-id     queue the paused job of the run again\n")
+	fmt.Fprintf(os.Stderr, "  logs [flags]      list the logs of a topic, with -grep the matching lines\n")
+	fmt.Fprintf(os.Stderr, "  artifacts [flags] bucket\n")
+	fmt.Fprintf(os.Stderr, "                    list the objects of a bucket with their tags, like -tag source=airports\n")
+	fmt.Fprintf(os.Stderr, "  link bucket object [ttl]\n")
+	fmt.Fprintf(os.Stderr, "                    print a download URL of a report or log, valid for ttl (default 15m)\n")
+	fmt.Fprintf(os.Stderr, "  bundle            export the dataset as a single archive in the bundles bucket\n")
+	fmt.Fprintf(os.Stderr, "  load-bundle [name]\n")
+	fmt.Fprintf(os.Stderr, "                    replace the dataset by that of a bundle (default the latest)\n")
+	fmt.Fprintf(os.Stderr, "  watch             import the source files uploaded to the csv bucket, until interrupted\n")
+	fmt.Fprintf(os.Stderr, "  worker            run the queued jobs, until interrupted\n")
+	fmt.Fprintf(os.Stderr, "  maintain [-queue [-priority p]] operation [collection]\n")
+	fmt.Fprintf(os.Stderr, "                    reindex or compact a collection, recompute or rebuild-caches,\n")
+	fmt.Fprintf(os.Stderr, "                    with -queue as a job\n")
+	fmt.Fprintf(os.Stderr, "  shard             shard the history on a sharded cluster\n")
+	fmt.Fprintf(os.Stderr, "  refresh ident     read the airport again from the latest snapshot, with its runways\n")
+	fmt.Fprintf(os.Stderr, "                    and frequencies\n")
+	os.Exit(2)
+}
+
+func schema() {
+	schema, err := application.OptionsSchema()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Println(string(schema))
+}
+
+func validate(args []string) {
+	fileName := "options.json"
+	if len(args) > 0 {
+		fileName = args[0]
+	}
+
+	content, err := application.ReadOptionsFile(fileName, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	errors := application.ValidateOptions(bytes.NewReader(content))
+	for _, err := range errors {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", fileName, err)
+	}
+	if len(errors) > 0 {
+		os.Exit(1)
+	}
+}
+
+func encrypt(args []string) {
+	if len(args) != 2 {
+		usage()
+	}
+
+	key, err := base64.StdEncoding.DecodeString(os.Getenv(application.OptionsKeyVariable))
+	if err == nil && len(key) == 0 {
+		err = application.ErrNoOptionsKey
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	content, err := ioutil.ReadFile(args[0])
+	if err == nil && application.IsEncryptedOptions(content) {
+		err = fmt.Errorf("%s: already encrypted", args[0])
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// Only valid options are worth encrypting, they can't be corrected in place
+	errors := application.ValidateOptions(bytes.NewReader(content))
+	for _, err := range errors {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+	}
+	if len(errors) > 0 {
+		os.Exit(1)
+	}
+
+	sealed, err := application.EncryptOptions(content, key)
+	if err == nil {
+		err = ioutil.WriteFile(args[1], sealed, 0600)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func migrate() {
+	appContext, err := application.CreateAppContext()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer appContext.Destroy()
+
+	err = appContext.Migrate(context.Background())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func seed() {
+	appContext, err := application.CreateAppContext()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer appContext.Destroy()
+
+	report, err := appContext.Seed(context.Background())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for name, count := range report.Counts {
+		fmt.Printf("%s: %d\n", name, count)
+	}
+}
+
+// syntheticFlags sizes the synthetic data, starting from the defaults
+func syntheticFlags(flags *flag.FlagSet) *application.SyntheticOptions {
+	options := application.DefaultSyntheticOptions
+
+	flags.IntVar(&options.Countries, "countries", options.Countries, "number of countries")
+	flags.IntVar(&options.RegionsPerCountry, "regions", options.RegionsPerCountry, "regions per country")
+	flags.IntVar(&options.Airports, "airports", options.Airports, "number of airports")
+	flags.IntVar(&options.RunwaysPerAirport, "runways", options.RunwaysPerAirport, "runways per airport")
+	flags.IntVar(&options.FrequenciesPerAirport, "frequencies", options.FrequenciesPerAirport, "frequencies per airport")
+	flags.Float64Var(&options.ErrorRate, "error-rate", options.ErrorRate, "fraction of rows with an injected fault")
+	flags.Int64Var(&options.Seed, "seed", options.Seed, "seed of the random data")
+
+	return &options
+}
+
+func synth(args []string) {
+	flags := flag.NewFlagSet("synth", flag.ExitOnError)
+	options := syntheticFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		usage()
+	}
+
+	err := application.WriteSyntheticFiles(flags.Arg(0), *options)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func simulate(args []string) {
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	options := syntheticFlags(flags)
+	keep := flags.Bool("keep", false, "keep the scratch database")
+	flags.Parse(args)
+
+	appContext, err := application.CreateAppContext()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer appContext.Destroy()
+
+	report, err := appContext.Simulate(context.Background(), *options, *keep)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for _, stage := range report.Stages {
+		fmt.Printf("%-9s %8d rows %v\n", stage.Name, stage.Rows, stage.Duration)
+	}
+	for name, count := range report.Counts {
+		fmt.Printf("%s: %d\n", name, count)
+	}
+	fmt.Printf("rejected: %d\n", report.Errors)
+}
+
+// bench returns its errors, rather than exiting, so the database is closed and the context
+// destroyed before geoctl exits
+func bench(args []string) error {
+	rows := application.DefaultBenchRows
+	if len(args) > 0 {
+		var err error
+		rows, err = strconv.Atoi(args[0])
+		if err != nil || rows <= 0 {
+			usage()
+		}
+	}
+
+	appContext, err := application.CreateAppContext()
+	if err != nil {
+		return err
+	}
+	defer appContext.Destroy()
+
+	mongoClient, err := appContext.DBOpen()
+	if err != nil {
+		return err
+	}
+	defer mongoClient.DBClose()
+
+	results, err := appContext.Bench(context.Background(), mongoClient, rows)
+	for _, result := range results {
+		verdict := "ok"
+		if !result.WithinBudget {
+			verdict = "OVER BUDGET"
+		}
+		fmt.Printf("%-9s %8d rows %10.0f rows/s %8.0f B/row  budget %8.0f rows/s  %s\n",
+			result.Stage, result.Rows, result.RowsPerSecond, result.BytesPerRow, result.Budget, verdict)
+	}
+	if err != nil {
+		return err
+	}
+	for _, result := range results {
+		if !result.WithinBudget {
+			return fmt.Errorf("bench %s: over budget", result.Stage)
+		}
+	}
+
+	return nil
+}
+
+func logs(args []string) {
+	var filter application.LogFilter
+	var from, to string
+
+	flags := flag.NewFlagSet("logs", flag.ExitOnError)
+	flags.StringVar(&filter.Topic, "topic", "", "topic of the logs")
+	flags.StringVar(&from, "from", "", "first date, like 2006-01-02")
+	flags.StringVar(&to, "to", "", "last date, like 2006-01-02")
+	flags.BoolVar(&filter.ErrorsOnly, "errors", false, "only the error logs")
+	flags.StringVar(&filter.Pattern, "grep", "", "regular expression to search the logs for")
+	flags.IntVar(&filter.MaxMatches, "max", 0, "maximum number of matching lines")
+	flags.Parse(args)
+
+	var err error
+	if from != "" {
+		filter.From, err = time.ParseInLocation("2006-01-02", from, time.Local)
+		if err != nil {
+			usage()
+		}
+	}
+	if to != "" {
+		filter.To, err = time.ParseInLocation("2006-01-02", to, time.Local)
+		if err != nil {
+			usage()
+		}
+		filter.To = filter.To.Add(24*time.Hour - time.Second)
+	}
+
+	appContext, err := application.CreateAppContext()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer appContext.Destroy()
+
+	result, err := appContext.Logs(context.Background(), &filter)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if filter.Pattern == "" {
+		for _, logObject := range result.Logs {
+			fmt.Printf("%s\t%d\n", logObject.Name, logObject.Size)
+		}
+		return
+	}
+	for _, match := range result.Matches {
+		fmt.Printf("%s:%d: %s\n", match.Log, match.Line, match.Text)
+	}
+	if result.Truncated {
+		fmt.Fprintln(os.Stderr, "more matches not shown")
+	}
+}
+
+// tagFlags collects repeated -tag key=value flags
+type tagFlags application.ObjectTags
+
+func (tags tagFlags) String() string {
+	return fmt.Sprint(map[string]string(tags))
+}
+
+func (tags tagFlags) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("expected key=value")
+	}
+	tags[parts[0]] = parts[1]
+	return nil
+}
+
+func artifacts(args []string) {
+	filter := application.ArtifactFilter{Tags: application.ObjectTags{}}
+	var from, to string
+
+	flags := flag.NewFlagSet("artifacts", flag.ExitOnError)
+	flags.StringVar(&filter.Prefix, "prefix", "", "start of the object names")
+	flags.StringVar(&from, "from", "", "first date, like 2006-01-02")
+	flags.StringVar(&to, "to", "", "last date, like 2006-01-02")
+	flags.Var(tagFlags(filter.Tags), "tag", "tag the objects must have, like run-id=..., may be repeated")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		usage()
+	}
+
+	var err error
+	if from != "" {
+		filter.From, err = time.ParseInLocation("2006-01-02", from, time.Local)
+		if err != nil {
+			usage()
+		}
+	}
+	if to != "" {
+		filter.To, err = time.ParseInLocation("2006-01-02", to, time.Local)
+		if err != nil {
+			usage()
+		}
+		filter.To = filter.To.Add(24*time.Hour - time.Second)
+	}
+
+	appContext, err := application.CreateAppContext()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer appContext.Destroy()
+
+	artifacts, err := appContext.Artifacts(context.Background(), flags.Arg(0), &filter)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	for _, artifact := range artifacts {
+		tags := []string{}
+		for key, value := range artifact.Tags {
+			tags = append(tags, key+"="+value)
+		}
+		sort.Strings(tags)
+		fmt.Printf("%s\t%d\t%s\t%s\n", artifact.Name, artifact.Size, artifact.Modified.Format(time.RFC3339), strings.Join(tags, " "))
+	}
+}
+
+func decide(args []string, approve bool) {
+	if len(args) != 1 {
+		usage()
+	}
+
+	appContext, err := application.CreateAppContext()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer appContext.Destroy()
+
+	mongoClient, err := appContext.DBOpen()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer mongoClient.DBClose()
+
+	// The staging records who decided, from the command line that is the user
+	ctx := application.WithPrincipal(context.Background(), &application.Principal{Subject: os.Getenv("USER"), Method: "cli"})
+	decision := mongoClient.Reject
+	if approve {
+		decision = mongoClient.Approve
+	}
+	staging, err := decision(ctx, args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%s %s: %d added, %d changed, %d removed\n", staging.RunID, staging.Status,
+		staging.Summary.Added, staging.Summary.Changed, staging.Summary.Removed)
+}
+
+func link(args []string) {
+	if len(args) < 2 {
+		usage()
+	}
+	ttl := application.DefaultLinkTTL
+	if len(args) > 2 {
+		var err error
+		ttl, err = time.ParseDuration(args[2])
+		if err != nil {
+			usage()
+		}
+	}
+
+	appContext, err := application.CreateAppContext()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer appContext.Destroy()
+
+	presigned, err := appContext.PresignedURL(context.Background(), args[0], args[1], ttl)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Println(presigned)
+}
+
+func bundle(args []string, load bool) {
+	if len(args) > 1 || (!load && len(args) > 0) {
+		usage()
+	}
+
+	appContext, err := application.CreateAppContext()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer appContext.Destroy()
+
+	var manifest *application.BundleManifest
+	if load {
+		name := ""
+		if len(args) > 0 {
+			name = args[0]
+		}
+		manifest, err = appContext.LoadBundle(context.Background(), name)
+	} else {
+		manifest, err = appContext.BuildBundle(context.Background())
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%s %s\n", manifest.Name, manifest.Tag)
+	for _, file := range manifest.Files {
+		fmt.Printf("%s: %d\n", file.Collection, file.Documents)
+	}
+}
+
+func watch() {
+	appContext, err := application.CreateAppContext()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer appContext.Destroy()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+	go func() {
+		<-interrupted
+		cancel()
+	}()
+
+	err = appContext.WatchUploads(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func worker() {
+	appContext, err := application.CreateAppContext()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer appContext.Destroy()
+
+	jobWorker := appContext.NewJobWorker(5 * time.Second)
+	jobWorker.HandleMaintenance()
+	jobWorker.HandleRefresh()
+	jobWorker.HandleImportSnapshot()
+	jobWorker.Start()
+	defer jobWorker.Stop()
+
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+	<-interrupted
+}
+
+func maintain(args []string) {
+	flags := flag.NewFlagSet("maintain", flag.ExitOnError)
+	queue := flags.Bool("queue", false, "enqueue a job rather than running it here")
+	priorityName := flags.String("priority", "", "priority of the job: low, normal or high")
+	flags.Parse(args)
+	if flags.NArg() < 1 || flags.NArg() > 2 || !application.IsMaintenanceJob(flags.Arg(0)) {
+		usage()
+	}
+	operation, collection := flags.Arg(0), flags.Arg(1)
+	priority, err := application.ParseJobPriority(*priorityName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	appContext, err := application.CreateAppContext()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer appContext.Destroy()
+
+	mongoClient, err := appContext.DBOpen()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer mongoClient.DBClose()
+
+	if *queue {
+		params := map[string]string{}
+		if collection != "" {
+			params["collection"] = collection
+		}
+		job, err := mongoClient.JobEnqueue(application.WithJobPriority(context.Background(), priority), operation, params)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println(job.JobID.Hex())
+		return
+	}
+
+	err = mongoClient.Maintain(context.Background(), operation, collection)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func controlRun(args []string, action string) {
+	if len(args) != 1 {
+		usage()
+	}
+
+	appContext, err := application.CreateAppContext()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer appContext.Destroy()
+
+	mongoClient, err := appContext.DBOpen()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer mongoClient.DBClose()
+
+	control := mongoClient.CancelRun
+	switch action {
+	case "pause":
+		control = mongoClient.PauseRun
+	case "resume":
+		control = mongoClient.ResumeRun
+	}
+	job, err := control(context.Background(), args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s %s\n", job.JobID.Hex(), job.Status)
+}
+
+func shard() {
+	appContext, err := application.CreateAppContext()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer appContext.Destroy()
+
+	mongoClient, err := appContext.DBOpen()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer mongoClient.DBClose()
+
+	err = mongoClient.Shard(context.Background())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func refresh(args []string) {
+	if len(args) != 1 {
+		usage()
+	}
+
+	appContext, err := application.CreateAppContext()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer appContext.Destroy()
+
+	mongoClient, err := appContext.DBOpen()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer mongoClient.DBClose()
+
+	refreshed, err := mongoClient.RefreshAirport(context.Background(), args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if refreshed.Airport == nil {
+		fmt.Printf("%s: dropped, see %s\n", refreshed.Ident, refreshed.Report)
+		return
+	}
+	fmt.Printf("%s: %d runways, %d frequencies from %s\n", refreshed.Ident, refreshed.Runways, refreshed.Frequencies, refreshed.Snapshot)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "schema":
+		schema()
+	case "validate":
+		validate(os.Args[2:])
+	case "encrypt":
+		encrypt(os.Args[2:])
+	case "migrate":
+		migrate()
+	case "seed":
+		seed()
+	case "bench":
+		err := bench(os.Args[2:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case "synth":
+		synth(os.Args[2:])
+	case "simulate":
+		simulate(os.Args[2:])
+	case "approve":
+		decide(os.Args[2:], true)
+	case "reject":
+		decide(os.Args[2:], false)
+	case "cancel":
+		controlRun(os.Args[2:], "cancel")
+	case "pause":
+		controlRun(os.Args[2:], "pause")
+	case "resume":
+		controlRun(os.Args[2:], "resume")
+	case "logs":
+		logs(os.Args[2:])
+	case "artifacts":
+		artifacts(os.Args[2:])
+	case "link":
+		link(os.Args[2:])
+	case "bundle":
+		bundle(os.Args[2:], false)
+	case "load-bundle":
+		bundle(os.Args[2:], true)
+	case "watch":
+		watch()
+	case "worker":
+		worker()
+	case "maintain":
+		maintain(os.Args[2:])
+	case "shard":
+		shard()
+	case "refresh":
+		refresh(os.Args[2:])
+	default:
+		usage()
+	}
+}
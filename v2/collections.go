@@ -0,0 +1,138 @@
+package application
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// The collections used by the application, by their base name
+const (
+	AirportsCollection        = "airports"
+	CountriesCollection       = "countries"
+	RegionsCollection         = "regions"
+	RunwaysCollection         = "runways"
+	FrequenciesCollection     = "frequencies"
+	StatsCollection           = "stats"
+	JobsCollection            = "jobs"
+	OverridesCollection       = "overrides"
+	HistoryCollection         = "history"
+	SelfTestCollection        = "selftest"
+	ReportingPointsCollection = "reporting_points"
+	NavaidsCollection         = "navaids"
+	FixesCollection           = "fixes"
+	AirspacesCollection       = "airspaces"
+	WeatherStationsCollection = "weather_stations"
+	MigrationsCollection      = "migrations"
+	DatasetsCollection        = "datasets"
+	StagingsCollection        = "stagings"
+	AirportPagesCollection    = "airport_pages"
+)
+
+// collectionIndexes create the indexes of a collection, by base name, on the given collection
+// so they can be built on a shadow before it is swapped in. Collections without indexes of
+// their own are missing.
+var collectionIndexes = map[string]func(mongoClient *MongoClient, ctx context.Context, collection *mongo.Collection) error{
+	AirportsCollection:        (*MongoClient).ensureAirportIndexes,
+	RunwaysCollection:         (*MongoClient).ensureRunwayIndexes,
+	NavaidsCollection:         (*MongoClient).ensureNavaidIndexes,
+	FixesCollection:           (*MongoClient).ensureFixIndexes,
+	AirspacesCollection:       (*MongoClient).ensureAirspaceIndexes,
+	ReportingPointsCollection: (*MongoClient).ensureReportingPointIndexes,
+	HistoryCollection:         (*MongoClient).ensureHistoryIndexes,
+	JobsCollection:            (*MongoClient).ensureJobIndexes,
+}
+
+// ensureIndexes creates the indexes of the base collection on the given collection
+func (mongoClient *MongoClient) ensureIndexes(ctx context.Context, base string, collection *mongo.Collection) error {
+	ensure, found := collectionIndexes[base]
+	if !found {
+		return nil
+	}
+
+	return ensure(mongoClient, ctx, collection)
+}
+
+// dataCollections are the collections holding imported data, rather than bookkeeping
+var dataCollections = []string{
+	AirportsCollection, RunwaysCollection, FrequenciesCollection, CountriesCollection, RegionsCollection,
+	NavaidsCollection, FixesCollection, AirspacesCollection, ReportingPointsCollection, WeatherStationsCollection}
+
+// isDataCollection tells whether the base name is that of a collection holding imported data
+func isDataCollection(base string) bool {
+	for _, dataCollection := range dataCollections {
+		if base == dataCollection {
+			return true
+		}
+	}
+
+	return false
+}
+
+// collectionOptions describes the collections section of the options file
+type collectionOptions struct {
+	Prefix string            `json:"prefix"`
+	Suffix string            `json:"suffix"`
+	Names  map[string]string `json:"names"`
+}
+
+// WithCollections puts a prefix and suffix around all collection names, like
+// a per-environment prefix or a suffix for a dataset under construction
+func WithCollections(prefix string, suffix string) Option {
+	return func(appContext *AppContext) {
+		appContext.CollectionPrefix = prefix
+		appContext.CollectionSuffix = suffix
+	}
+}
+
+// CollectionName returns the configured name for a base collection name, an explicit
+// name from the options file wins over the prefix and suffix
+func (appContext *AppContext) CollectionName(base string) string {
+	name, found := appContext.CollectionNames[base]
+	if found && name != "" {
+		return name
+	}
+
+	return appContext.CollectionPrefix + base + appContext.CollectionSuffix
+}
+
+// collection returns the collection with the configured name for the base name
+func (mongoClient *MongoClient) collection(base string) *mongo.Collection {
+	return mongoClient.Database().Collection(mongoClient.appContext.CollectionName(base))
+}
+
+// readCollection returns the collection for queries that can live with slightly stale data,
+// read with the query read preference so a replica set can serve them from its secondaries
+func (mongoClient *MongoClient) readCollection(base string) *mongo.Collection {
+	readPreference := mongoClient.appContext.QueryReadPreference
+	if readPreference == nil {
+		return mongoClient.collection(base)
+	}
+
+	return mongoClient.Database().Collection(mongoClient.appContext.CollectionName(base),
+		options.Collection().SetReadPreference(readPreference))
+}
+
+// WithQueryReadPreference reads the query APIs with the given read preference, like
+// readpref.SecondaryPreferred(), while imports keep using the primary
+func WithQueryReadPreference(readPreference *readpref.ReadPref) Option {
+	return func(appContext *AppContext) {
+		appContext.QueryReadPreference = readPreference
+	}
+}
+
+// parseReadPreference reads a read preference mode like secondaryPreferred, empty is the primary
+func parseReadPreference(mode string) (*readpref.ReadPref, error) {
+	if mode == "" {
+		return nil, nil
+	}
+
+	readMode, err := readpref.ModeFromString(mode)
+	if err != nil {
+		return nil, err
+	}
+
+	return readpref.New(readMode)
+}
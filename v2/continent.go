@@ -0,0 +1,47 @@
+package application
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Continent identifies a continent by its two-letter code as used in the source data
+type Continent string
+
+// The continents known in the source data
+const (
+	Africa       Continent = "AF"
+	Antarctica   Continent = "AN"
+	Asia         Continent = "AS"
+	Europe       Continent = "EU"
+	NorthAmerica Continent = "NA"
+	Oceania      Continent = "OC"
+	SouthAmerica Continent = "SA"
+)
+
+// Continents lists all known continents
+var Continents = []Continent{Africa, Antarctica, Asia, Europe, NorthAmerica, Oceania, SouthAmerica}
+
+// ParseContinent reads a continent code, forgiving case and whitespace
+func ParseContinent(s string) (Continent, error) {
+	code := Continent(strings.ToUpper(strings.TrimSpace(s)))
+	for _, continent := range Continents {
+		if continent == code {
+			return continent, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown continent %q", s)
+}
+
+// ParseScheduledService reads the yes/no scheduled service column as a boolean
+func ParseScheduledService(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "yes", "y", "true", "1":
+		return true, nil
+	case "no", "n", "false", "0", "":
+		return false, nil
+	}
+
+	return false, fmt.Errorf("invalid scheduled service %q", s)
+}
@@ -0,0 +1,151 @@
+package application
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// ErrNoCoordinate is returned when a coordinate is missing from the source
+var ErrNoCoordinate = errors.New("no coordinate")
+
+// Coordinate is a position in decimal degrees, stored as a GeoJSON point
+type Coordinate struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// geoJSONPoint is the GeoJSON representation of a coordinate
+type geoJSONPoint struct {
+	Type        string     `bson:"type" json:"type"`
+	Coordinates [2]float64 `bson:"coordinates" json:"coordinates"`
+}
+
+// parseDegrees reads decimal degrees, allowing a comma as decimal separator, a degree sign
+// and a hemisphere letter, where S and W make the value negative
+func parseDegrees(s string, negative string, positive string) (float64, error) {
+	text := strings.ToUpper(strings.TrimSpace(s))
+	if text == "" {
+		return 0, ErrNoCoordinate
+	}
+
+	sign := 1.0
+	if strings.HasSuffix(text, negative) {
+		sign = -1.0
+		text = strings.TrimSuffix(text, negative)
+	} else {
+		text = strings.TrimSuffix(text, positive)
+	}
+	text = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "°"))
+	text = strings.Replace(text, ",", ".", 1)
+	text = strings.Replace(text, " ", "", -1)
+
+	degrees, err := strconv.ParseFloat(text, 64)
+	if err != nil || math.IsNaN(degrees) || math.IsInf(degrees, 0) {
+		return 0, fmt.Errorf("invalid degrees %q", s)
+	}
+
+	return sign * degrees, nil
+}
+
+// ParseCoordinate reads a coordinate from its latitude and longitude columns,
+// returning it validated and normalized
+func ParseCoordinate(latitude string, longitude string) (Coordinate, error) {
+	var coordinate Coordinate
+	var err error
+
+	coordinate.Latitude, err = parseDegrees(latitude, "S", "N")
+	if err != nil {
+		return coordinate, err
+	}
+	coordinate.Longitude, err = parseDegrees(longitude, "W", "E")
+	if err != nil {
+		return coordinate, err
+	}
+
+	coordinate = coordinate.Normalize()
+
+	return coordinate, coordinate.Validate()
+}
+
+// Normalize brings the longitude in the range [-180, 180)
+func (coordinate Coordinate) Normalize() Coordinate {
+	if coordinate.Longitude >= -180 && coordinate.Longitude < 180 {
+		return coordinate
+	}
+
+	longitude := math.Mod(coordinate.Longitude+180, 360)
+	if longitude < 0 {
+		longitude += 360
+	}
+	coordinate.Longitude = longitude - 180
+
+	return coordinate
+}
+
+// Validate checks the coordinate lies on the globe
+func (coordinate Coordinate) Validate() error {
+	if coordinate.Latitude < -90 || coordinate.Latitude > 90 {
+		return fmt.Errorf("latitude %v out of range", coordinate.Latitude)
+	}
+	if coordinate.Longitude < -180 || coordinate.Longitude >= 180 {
+		return fmt.Errorf("longitude %v out of range", coordinate.Longitude)
+	}
+
+	return nil
+}
+
+func (coordinate Coordinate) point() geoJSONPoint {
+	return geoJSONPoint{Type: "Point", Coordinates: [2]float64{coordinate.Longitude, coordinate.Latitude}}
+}
+
+func (coordinate *Coordinate) fromPoint(point geoJSONPoint) error {
+	if point.Type != "Point" {
+		return fmt.Errorf("expected a GeoJSON Point, got %q", point.Type)
+	}
+
+	coordinate.Longitude = point.Coordinates[0]
+	coordinate.Latitude = point.Coordinates[1]
+
+	return nil
+}
+
+// MarshalBSONValue stores the coordinate as a GeoJSON point, ready for a 2dsphere index
+func (coordinate Coordinate) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bson.MarshalValue(coordinate.point())
+}
+
+// UnmarshalBSONValue reads the coordinate from a GeoJSON point
+func (coordinate *Coordinate) UnmarshalBSONValue(valueType bsontype.Type, data []byte) error {
+	var point geoJSONPoint
+
+	err := bson.RawValue{Type: valueType, Value: data}.Unmarshal(&point)
+	if err != nil {
+		return err
+	}
+
+	return coordinate.fromPoint(point)
+}
+
+// MarshalJSON writes the coordinate as a GeoJSON point
+func (coordinate Coordinate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(coordinate.point())
+}
+
+// UnmarshalJSON reads the coordinate from a GeoJSON point
+func (coordinate *Coordinate) UnmarshalJSON(data []byte) error {
+	var point geoJSONPoint
+
+	err := json.Unmarshal(data, &point)
+	if err != nil {
+		return err
+	}
+
+	return coordinate.fromPoint(point)
+}
@@ -0,0 +1,191 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// countryTreeTTL is how long a computed country tree is served from cache
+const countryTreeTTL = time.Hour
+
+// Country describes a country as stored in the countries collection
+type Country struct {
+	Code          string `bson:"_id" json:"code"`
+	Name          string `bson:"name" json:"name"`
+	Continent     string `bson:"continent" json:"continent"`
+	WikipediaLink string `bson:"wikipedia_link,omitempty" json:"wikipedia-link,omitempty"`
+	Keywords      string `bson:"keywords,omitempty" json:"keywords,omitempty"`
+}
+
+// Region describes a region as stored in the regions collection
+type Region struct {
+	Code          string `bson:"_id" json:"code"`
+	LocalCode     string `bson:"local_code" json:"local-code"`
+	Name          string `bson:"name" json:"name"`
+	Continent     string `bson:"continent" json:"continent"`
+	Country       string `bson:"iso_country" json:"country"`
+	WikipediaLink string `bson:"wikipedia_link,omitempty" json:"wikipedia-link,omitempty"`
+	Keywords      string `bson:"keywords,omitempty" json:"keywords,omitempty"`
+}
+
+// RegionNode is a region in the country tree together with its airport count
+type RegionNode struct {
+	Region   `bson:",inline"`
+	Airports int64 `bson:"airports" json:"airports"`
+}
+
+// CountryTree is a country with its regions and airport counts
+type CountryTree struct {
+	Country  `bson:",inline"`
+	Airports int64         `json:"airports"`
+	Regions  []*RegionNode `json:"regions"`
+}
+
+func (mongoClient *MongoClient) countries() *mongo.Collection {
+	return mongoClient.collection(CountriesCollection)
+}
+
+func (mongoClient *MongoClient) regions() *mongo.Collection {
+	return mongoClient.collection(RegionsCollection)
+}
+
+// countryFromRecord converts a row of the OurAirports countries file
+func countryFromRecord(record map[string]string) (*Country, error) {
+	country := Country{
+		Code:          NormalizeCode(record["code"]),
+		Name:          record["name"],
+		Continent:     NormalizeCode(record["continent"]),
+		WikipediaLink: record["wikipedia_link"],
+		Keywords:      record["keywords"]}
+	if country.Code == "" {
+		return nil, fmt.Errorf("country without code")
+	}
+
+	return &country, nil
+}
+
+// regionFromRecord converts a row of the OurAirports regions file
+func regionFromRecord(record map[string]string) (*Region, error) {
+	region := Region{
+		Code:          NormalizeCode(record["code"]),
+		LocalCode:     NormalizeCode(record["local_code"]),
+		Name:          record["name"],
+		Continent:     NormalizeCode(record["continent"]),
+		Country:       NormalizeCode(record["iso_country"]),
+		WikipediaLink: record["wikipedia_link"],
+		Keywords:      record["keywords"]}
+	if region.Code == "" {
+		return nil, fmt.Errorf("region without code")
+	}
+
+	return &region, nil
+}
+
+// Country finds a country by its ISO code
+func (mongoClient *MongoClient) Country(ctx context.Context, code string) (*Country, error) {
+
+	var country Country
+	err := mongoClient.readCollection(CountriesCollection).FindOne(ctx, bson.M{"_id": NormalizeCode(code)}).Decode(&country)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &country, nil
+}
+
+// Region finds a region by its ISO code
+func (mongoClient *MongoClient) Region(ctx context.Context, code string) (*Region, error) {
+
+	var region Region
+	err := mongoClient.readCollection(RegionsCollection).FindOne(ctx, bson.M{"_id": NormalizeCode(code)}).Decode(&region)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &region, nil
+}
+
+// RegionsByCountry returns the regions of the given country
+func (mongoClient *MongoClient) RegionsByCountry(ctx context.Context, code string) ([]*Region, error) {
+
+	cursor, err := mongoClient.readCollection(RegionsCollection).Find(ctx, bson.M{"iso_country": NormalizeCode(code)},
+		options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	regions := []*Region{}
+	err = cursor.All(ctx, &regions)
+	if err != nil {
+		return nil, err
+	}
+
+	return regions, nil
+}
+
+// CountryTree returns the country with its regions and their airport counts
+func (mongoClient *MongoClient) CountryTree(ctx context.Context, code string) (*CountryTree, error) {
+
+	code = NormalizeCode(code)
+
+	// Served from cache if possible
+	appContext := mongoClient.appContext
+	cached, found := appContext.countryTrees.get(code)
+	if found {
+		return cached.(*CountryTree), nil
+	}
+
+	// The country itself
+	var tree CountryTree
+	err := mongoClient.readCollection(CountriesCollection).FindOne(ctx, bson.M{"_id": code}).Decode(&tree)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The regions, each with the number of airports in it
+	pipeline := NewPipeline().
+		Match(bson.M{"iso_country": code}).
+		Lookup(appContext, Lookup{
+			From: AirportsCollection,
+			Let:  bson.M{"region": "$_id"},
+			Pipeline: NewPipeline().
+				MatchExpr(bson.M{"$eq": bson.A{"$iso_region", "$$region"}}).
+				Count("count"),
+			As: "airports"}).
+		AddFields(bson.M{
+			"airports": bson.M{"$ifNull": bson.A{bson.M{"$arrayElemAt": bson.A{"$airports.count", 0}}, 0}}}).
+		Sort(bson.D{{Key: "name", Value: 1}})
+
+	cursor, err := mongoClient.readCollection(RegionsCollection).Aggregate(ctx, pipeline.Stages())
+	if err != nil {
+		return nil, err
+	}
+
+	tree.Regions = []*RegionNode{}
+	err = cursor.All(ctx, &tree.Regions)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, region := range tree.Regions {
+		tree.Airports += region.Airports
+	}
+
+	appContext.countryTrees.put(code, &tree)
+
+	return &tree, nil
+}
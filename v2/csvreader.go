@@ -0,0 +1,84 @@
+package application
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+)
+
+// CSVReader streams the records of a CSV file with a header, holding only the current row
+// in memory. Use it like a cursor:
+//
+//	for reader.Next() {
+//		record := reader.Record()
+//	}
+//	err := reader.Err()
+type CSVReader struct {
+	reader *csv.Reader
+	header []string
+	record map[string]string
+	line   int
+	err    error
+}
+
+// NewCSVReader reads the header and prepares to stream the records that follow it
+func NewCSVReader(input io.Reader) (*CSVReader, error) {
+	reader := csv.NewReader(input)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	// The header is kept, so it must not be reused
+	columns := make([]string, len(header))
+	for i, column := range header {
+		columns[i] = strings.TrimSpace(column)
+	}
+
+	return &CSVReader{reader: reader, header: columns, line: 1}, nil
+}
+
+// Next moves to the next record, returning false at the end or on an error
+func (csvReader *CSVReader) Next() bool {
+	if csvReader.err != nil {
+		return false
+	}
+
+	row, err := csvReader.reader.Read()
+	if err == io.EOF {
+		return false
+	}
+	if err != nil {
+		csvReader.err = err
+		return false
+	}
+
+	record := make(map[string]string, len(csvReader.header))
+	for i, column := range csvReader.header {
+		if i < len(row) {
+			record[column] = strings.TrimSpace(row[i])
+		}
+	}
+	csvReader.record = record
+	csvReader.line++
+
+	return true
+}
+
+// Record returns the current record keyed by the column names of the header
+func (csvReader *CSVReader) Record() map[string]string {
+	return csvReader.record
+}
+
+// Line returns the position of the current record in the file, counting the header as 1
+func (csvReader *CSVReader) Line() int {
+	return csvReader.line
+}
+
+// Err returns the error that ended the iteration, if any
+func (csvReader *CSVReader) Err() error {
+	return csvReader.err
+}
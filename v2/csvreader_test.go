@@ -0,0 +1,105 @@
+package application
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// benchCSVRows is the size of the synthetic airports file the parsers are compared on
+const benchCSVRows = 50000
+
+func benchCSVData(b *testing.B) []byte {
+	var data bytes.Buffer
+	err := WriteSyntheticAirports(&data, benchCSVRows, 1)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return data.Bytes()
+}
+
+// readAllCSV is the parser the streaming reader replaced: the whole file and all its records
+// are held in memory before the first one is converted
+func readAllCSV(input io.Reader) ([]map[string]string, error) {
+	data, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	records := []map[string]string{}
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		record := make(map[string]string, len(header))
+		for i, column := range header {
+			if i < len(row) {
+				record[column] = strings.TrimSpace(row[i])
+			}
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// BenchmarkCSVReader converts the records as they are streamed, holding one at a time
+func BenchmarkCSVReader(b *testing.B) {
+	data := benchCSVData(b)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		reader, err := NewCSVReader(bytes.NewReader(data))
+		if err != nil {
+			b.Fatal(err)
+		}
+		for reader.Next() {
+			_, err = airportFromRecord(reader.Record())
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+		if reader.Err() != nil {
+			b.Fatal(reader.Err())
+		}
+	}
+}
+
+// BenchmarkReadAllCSV converts the records once all of them are read, as imports did before
+func BenchmarkReadAllCSV(b *testing.B) {
+	data := benchCSVData(b)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		records, err := readAllCSV(bytes.NewReader(data))
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, record := range records {
+			_, err = airportFromRecord(record)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package application
+
+import (
+	"context"
+	"time"
+)
+
+// dashboardTTL is how long the dashboard figures are reused, sizing the buckets lists every
+// object in them
+const dashboardTTL = 5 * time.Minute
+
+// CollectionCount is the number of documents in a collection
+type CollectionCount struct {
+	Collection string `json:"collection"`
+	Documents  int64  `json:"documents"`
+}
+
+// BucketUsage is the storage taken by a bucket
+type BucketUsage struct {
+	Bucket  string `json:"bucket"`
+	Objects int64  `json:"objects"`
+	Bytes   int64  `json:"bytes"`
+}
+
+// Dashboard holds the figures of a simple dashboard, flat lists so a JSON data source can
+// plot them without transformations
+type Dashboard struct {
+	Generated   time.Time          `json:"generated"`
+	Collections []*CollectionCount `json:"collections"`
+	Imports     []*SourceMetrics   `json:"imports"`
+	Buckets     []*BucketUsage     `json:"buckets"`
+}
+
+// bucketUsage counts the objects and bytes of the tenant in every bucket
+func (appContext *AppContext) bucketUsage(ctx context.Context) ([]*BucketUsage, error) {
+	buckets, err := appContext.listBuckets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := []*BucketUsage{}
+	for _, bucket := range buckets {
+		bucketUsage := BucketUsage{Bucket: bucket}
+
+		objects, err := appContext.listObjects(ctx, bucket, "", true)
+		if err != nil {
+			return nil, err
+		}
+		for _, objectInfo := range objects {
+			bucketUsage.Objects++
+			bucketUsage.Bytes += objectInfo.Size
+		}
+
+		usage = append(usage, &bucketUsage)
+	}
+
+	return usage, nil
+}
+
+// Dashboard returns the document counts of the data collections, the last import of every
+// source and the storage used per bucket. It complements the Prometheus metrics where there
+// is no Prometheus.
+func (mongoClient *MongoClient) Dashboard(ctx context.Context) (*Dashboard, error) {
+	appContext := mongoClient.appContext
+	if appContext.dashboard != nil {
+		cached, found := appContext.dashboard.get("")
+		if found {
+			return cached.(*Dashboard), nil
+		}
+	}
+
+	dashboard := Dashboard{Generated: appContext.now(), Collections: []*CollectionCount{}}
+	for _, base := range dataCollections {
+		count, err := mongoClient.readCollection(base).EstimatedDocumentCount(ctx)
+		if err != nil {
+			return nil, err
+		}
+		dashboard.Collections = append(dashboard.Collections, &CollectionCount{Collection: base, Documents: count})
+	}
+
+	metrics, err := appContext.ImportMetrics(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dashboard.Imports = metrics.Sources
+
+	dashboard.Buckets, err = appContext.bucketUsage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if appContext.dashboard != nil {
+		appContext.dashboard.put("", &dashboard)
+	}
+
+	return &dashboard, nil
+}
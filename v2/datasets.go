@@ -0,0 +1,164 @@
+package application
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// datasetTTL is how long the dataset versions are reused by the serving layer, it asks for
+// them on every request
+const datasetTTL = time.Minute
+
+// datasetImportsKept is the number of imports of a source remembered with its version, a
+// mirror holding an older version has to resync
+const datasetImportsKept = 100
+
+// DatasetImport is the time a version of a source was imported
+type DatasetImport struct {
+	Version  string    `bson:"version" json:"version"`
+	Imported time.Time `bson:"imported" json:"imported"`
+}
+
+// DatasetVersion records the last successful import of a source, the version is the hash of
+// the source data and the run the report of the import. The recent imports are kept along,
+// oldest first, so the sync can tell when a version went live.
+type DatasetVersion struct {
+	Source   string          `bson:"_id" json:"source"`
+	Version  string          `bson:"version" json:"version"`
+	RunID    string          `bson:"run_id" json:"run-id"`
+	Imported time.Time       `bson:"imported" json:"imported"`
+	Imports  []DatasetImport `bson:"imports,omitempty" json:"-"`
+}
+
+// ImportedAt returns the first time the version was imported, nil when it is not among the
+// imports kept
+func (dataset *DatasetVersion) ImportedAt(version string) *time.Time {
+	for _, imported := range dataset.Imports {
+		if imported.Version == version {
+			return &imported.Imported
+		}
+	}
+
+	return nil
+}
+
+func (mongoClient *MongoClient) datasets() *mongo.Collection {
+	return mongoClient.collection(DatasetsCollection)
+}
+
+// recordDataset registers the import of the source by the run, once it succeeded. The caller
+// resets the caches afterwards, the cached versions included, an import refreshes the views first.
+func (mongoClient *MongoClient) recordDataset(ctx context.Context, source string, report *RunReport) error {
+	return mongoClient.storeDataset(ctx, source, report.Versions[source], report.RunID)
+}
+
+// storeDataset registers the version of the source as imported by the run
+func (mongoClient *MongoClient) storeDataset(ctx context.Context, source string, version string, runID string) error {
+	dataset := DatasetVersion{
+		Source:   source,
+		Version:  version,
+		RunID:    runID,
+		Imported: mongoClient.appContext.now()}
+
+	_, err := mongoClient.datasets().UpdateOne(ctx, bson.M{"_id": source}, bson.M{
+		"$set": bson.M{"version": dataset.Version, "run_id": dataset.RunID, "imported": dataset.Imported},
+		"$push": bson.M{"imports": bson.M{
+			"$each":  bson.A{DatasetImport{Version: dataset.Version, Imported: dataset.Imported}},
+			"$slice": -datasetImportsKept}}},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+
+	mongoClient.appContext.publish(&Event{Type: EventImported, Time: dataset.Imported, Dataset: &dataset})
+
+	return nil
+}
+
+// DatasetVersions returns the last import of every source, by source
+func (mongoClient *MongoClient) DatasetVersions(ctx context.Context) ([]*DatasetVersion, error) {
+	cursor, err := mongoClient.datasets().Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	datasets := []*DatasetVersion{}
+	err = cursor.All(ctx, &datasets)
+	if err != nil {
+		return nil, err
+	}
+
+	return datasets, nil
+}
+
+// cachedDatasets returns the dataset versions, reused for a while as every request asks
+func (appContext *AppContext) cachedDatasets(ctx context.Context) ([]*DatasetVersion, error) {
+	if appContext.datasetVersions != nil {
+		cached, found := appContext.datasetVersions.get("")
+		if found {
+			return cached.([]*DatasetVersion), nil
+		}
+	}
+
+	mongoClient, err := appContext.DBOpen()
+	if err != nil {
+		return nil, err
+	}
+	defer mongoClient.DBClose()
+
+	datasets, err := mongoClient.DatasetVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if appContext.datasetVersions != nil {
+		appContext.datasetVersions.put("", datasets)
+	}
+
+	return datasets, nil
+}
+
+// LastImport returns the time of the latest import of any source, zero if nothing was imported
+func (appContext *AppContext) LastImport(ctx context.Context) (time.Time, error) {
+	var last time.Time
+
+	datasets, err := appContext.cachedDatasets(ctx)
+	if err != nil {
+		return last, err
+	}
+
+	for _, dataset := range datasets {
+		if dataset.Imported.After(last) {
+			last = dataset.Imported
+		}
+	}
+
+	return last, nil
+}
+
+// DatasetTag returns a tag that changes with every import, derived from the versions of all
+// sources, empty if nothing was imported
+func (appContext *AppContext) DatasetTag(ctx context.Context) (string, error) {
+	datasets, err := appContext.cachedDatasets(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(datasets) == 0 {
+		return "", nil
+	}
+
+	// The datasets are sorted by source, so the tag does not depend on the order of storage
+	hash := sha256.New()
+	for _, dataset := range datasets {
+		fmt.Fprintf(hash, "%s:%s:%s\n", dataset.Source, dataset.Version, dataset.RunID)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))[:20], nil
+}
@@ -0,0 +1,140 @@
+package application
+
+import "sync"
+
+// ContextOverrides are the settings a derived AppContext changes, zero values keep those of the
+// AppContext it is derived from
+type ContextOverrides struct {
+	MaxResults int64
+	DBName     string
+	LogTopic   string
+}
+
+// WithOverrides returns an AppContext sharing the connections, log and caches of this one with
+// some settings changed, to handle the requests of a tenant without reading the options again or
+// reconnecting. A different database gets caches of its own. The log topic is added to the lines
+// logged through the derived context, the log itself stays open under the topic it was opened
+// with, so closing it and Destroy are left to the original. The maps and lists of the settings
+// are copied, changing them on the derived context leaves this one alone.
+func (appContext *AppContext) WithOverrides(overrides ContextOverrides) *AppContext {
+	derived := *appContext
+
+	derived.CollectionNames = copyStringMap(appContext.CollectionNames)
+	derived.Roles = copyRoleMap(appContext.Roles)
+	derived.APIKeyRoles = copyRoleMap(appContext.APIKeyRoles)
+	derived.RunwaySurfaces = copySurfaceMap(appContext.RunwaySurfaces)
+	derived.SourceImports = copySourceImportMap(appContext.SourceImports)
+	derived.Enrichers = copyEnricherMap(appContext.Enrichers)
+	derived.LogSinks = append([]LogSink(nil), appContext.LogSinks...)
+	derived.EventSinks = append([]EventSink(nil), appContext.EventSinks...)
+	derived.Notifiers = append([]Notifier(nil), appContext.Notifiers...)
+	derived.MaterializedViews = append([]MaterializedView(nil), appContext.MaterializedViews...)
+	derived.CORSOrigins = append([]string(nil), appContext.CORSOrigins...)
+	derived.MongoOptions = append(derived.MongoOptions[:0:0], appContext.MongoOptions...)
+
+	// The log is written through the logger of the original, the derived context has no log,
+	// flusher, spooler or health checks of its own to stop
+	derived.logMutex = new(sync.Mutex)
+	derived.logBuffer = nil
+	derived.errorBuffer = nil
+	derived.logOutput = nil
+	derived.logFlushCancel = nil
+	derived.logSpoolCancel = nil
+	derived.healthCancel = nil
+	derived.healthMutex = new(sync.Mutex)
+	derived.health = appContext.healthSnapshot()
+
+	if overrides.MaxResults > 0 {
+		derived.MaxResults = overrides.MaxResults
+	}
+	if overrides.LogTopic != "" {
+		derived.logTopicOverride = overrides.LogTopic
+	}
+	if overrides.DBName != "" && overrides.DBName != appContext.DBName {
+		derived.DBName = overrides.DBName
+		derived.countryTrees = newCache(countryTreeTTL)
+		derived.datasetVersions = newCache(datasetTTL)
+		derived.importMetrics = newCache(metricsTTL)
+		derived.dashboard = newCache(dashboardTTL)
+		if appContext.negativeLookups != nil {
+			derived.negativeLookups = newCache(appContext.NegativeCacheTTL)
+		}
+		if appContext.queryResults != nil {
+			derived.queryResults = newCache(appContext.QueryCacheTTL)
+		}
+	}
+
+	return &derived
+}
+
+// healthSnapshot copies the health of the components as last checked
+func (appContext *AppContext) healthSnapshot() map[string]*ComponentHealth {
+	appContext.healthMutex.Lock()
+	defer appContext.healthMutex.Unlock()
+
+	if appContext.health == nil {
+		return nil
+	}
+	health := make(map[string]*ComponentHealth, len(appContext.health))
+	for name, component := range appContext.health {
+		state := *component
+		health[name] = &state
+	}
+
+	return health
+}
+
+func copyStringMap(source map[string]string) map[string]string {
+	if source == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(source))
+	for key, value := range source {
+		copied[key] = value
+	}
+	return copied
+}
+
+func copyRoleMap(source map[string]Role) map[string]Role {
+	if source == nil {
+		return nil
+	}
+	copied := make(map[string]Role, len(source))
+	for key, value := range source {
+		copied[key] = value
+	}
+	return copied
+}
+
+func copySurfaceMap(source map[string]RunwaySurface) map[string]RunwaySurface {
+	if source == nil {
+		return nil
+	}
+	copied := make(map[string]RunwaySurface, len(source))
+	for key, value := range source {
+		copied[key] = value
+	}
+	return copied
+}
+
+func copySourceImportMap(source map[string]SourceImport) map[string]SourceImport {
+	if source == nil {
+		return nil
+	}
+	copied := make(map[string]SourceImport, len(source))
+	for key, value := range source {
+		copied[key] = value
+	}
+	return copied
+}
+
+func copyEnricherMap(source map[string][]Enricher) map[string][]Enricher {
+	if source == nil {
+		return nil
+	}
+	copied := make(map[string][]Enricher, len(source))
+	for key, value := range source {
+		copied[key] = append([]Enricher(nil), value...)
+	}
+	return copied
+}
@@ -0,0 +1,53 @@
+package application
+
+import (
+	"runtime"
+	"time"
+)
+
+// RuntimeStats is a snapshot of the goroutines, heap and garbage collector of the process
+type RuntimeStats struct {
+	Taken         time.Time     `json:"taken"`
+	Goroutines    int           `json:"goroutines"`
+	HeapAlloc     uint64        `json:"heap-alloc"`
+	HeapInuse     uint64        `json:"heap-inuse"`
+	HeapObjects   uint64        `json:"heap-objects"`
+	TotalAlloc    uint64        `json:"total-alloc"`
+	Sys           uint64        `json:"sys"`
+	NumGC         uint32        `json:"num-gc"`
+	LastGC        time.Time     `json:"last-gc"`
+	LastPause     time.Duration `json:"last-pause"`
+	PauseTotal    time.Duration `json:"pause-total"`
+	GCCPUFraction float64       `json:"gc-cpu-fraction"`
+}
+
+// WithDiagnostics exposes the runtime statistics and pprof profiles on the server
+func WithDiagnostics(enabled bool) Option {
+	return func(appContext *AppContext) {
+		appContext.Diagnostics = enabled
+	}
+}
+
+// ReadRuntimeStats takes a snapshot of the runtime, it briefly stops the world
+func ReadRuntimeStats() *RuntimeStats {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+
+	stats := RuntimeStats{
+		Taken:         time.Now(),
+		Goroutines:    runtime.NumGoroutine(),
+		HeapAlloc:     memStats.HeapAlloc,
+		HeapInuse:     memStats.HeapInuse,
+		HeapObjects:   memStats.HeapObjects,
+		TotalAlloc:    memStats.TotalAlloc,
+		Sys:           memStats.Sys,
+		NumGC:         memStats.NumGC,
+		PauseTotal:    time.Duration(memStats.PauseTotalNs),
+		GCCPUFraction: memStats.GCCPUFraction}
+	if memStats.NumGC > 0 {
+		stats.LastGC = time.Unix(0, int64(memStats.LastGC))
+		stats.LastPause = time.Duration(memStats.PauseNs[(memStats.NumGC+255)%256])
+	}
+
+	return &stats
+}
@@ -0,0 +1,45 @@
+package application
+
+import (
+	"context"
+)
+
+// Enricher adds company-specific fields to, or corrects, a parsed record before it is stored.
+// For the airports source the record is an *Airport, of which the Extra fields are meant for
+// this. Returning a nil record drops it from the import, returning an error reports and skips it.
+type Enricher interface {
+	Enrich(ctx context.Context, record interface{}) (interface{}, error)
+}
+
+// EnricherFunc is a function acting as an Enricher
+type EnricherFunc func(ctx context.Context, record interface{}) (interface{}, error)
+
+// Enrich calls the function
+func (enricher EnricherFunc) Enrich(ctx context.Context, record interface{}) (interface{}, error) {
+	return enricher(ctx, record)
+}
+
+// WithEnricher registers an enricher for the named source, like "airports". Enrichers of a
+// source run in the order they are registered.
+func WithEnricher(source string, enricher Enricher) Option {
+	return func(appContext *AppContext) {
+		if appContext.Enrichers == nil {
+			appContext.Enrichers = map[string][]Enricher{}
+		}
+		appContext.Enrichers[source] = append(appContext.Enrichers[source], enricher)
+	}
+}
+
+// enrich runs the enrichers of the source on the record
+func (appContext *AppContext) enrich(ctx context.Context, source string, record interface{}) (interface{}, error) {
+	var err error
+
+	for _, enricher := range appContext.Enrichers[source] {
+		record, err = enricher.Enrich(ctx, record)
+		if err != nil || record == nil {
+			return nil, err
+		}
+	}
+
+	return record, nil
+}
@@ -0,0 +1,89 @@
+package application
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// EventImported is the type of the event published once the import of a source has landed
+const EventImported = "dataset.imported"
+
+// Event tells other systems about a change of the dataset, like an import that landed
+type Event struct {
+	Type    string          `json:"type"`
+	Time    time.Time       `json:"time"`
+	Dataset *DatasetVersion `json:"dataset,omitempty"`
+}
+
+// EventSink publishes events to a broker for other systems to subscribe to
+type EventSink interface {
+	Publish(event *Event) error
+}
+
+// EventSinkFactory creates a sink of a type from an entry of the event-sinks section of the
+// options file
+type EventSinkFactory func(sinkURL string, topic string, user string, password string) (EventSink, error)
+
+var (
+	eventSinkMutex     sync.Mutex
+	eventSinkFactories = map[string]EventSinkFactory{}
+)
+
+// RegisterEventSink makes a type of sink available to the event-sinks section of the options
+// file. The brokers package registers "nats" and "kafka-rest", a binary imports it for them.
+func RegisterEventSink(sinkType string, factory EventSinkFactory) {
+	eventSinkMutex.Lock()
+	defer eventSinkMutex.Unlock()
+
+	eventSinkFactories[sinkType] = factory
+}
+
+// eventSinkOptions describes an entry of the event-sinks section of the options file, of a type
+// registered with RegisterEventSink. For the brokers package the topic is the NATS subject or
+// Kafka topic; a kafka-rest URL is that of a Kafka REST proxy, not of a broker.
+type eventSinkOptions struct {
+	Type     string `json:"type"`
+	URL      string `json:"url"`
+	Topic    string `json:"topic"`
+	User     string `json:"user"`
+	Password string `json:"password"`
+}
+
+func createEventSinks(sinkOptions []eventSinkOptions) ([]EventSink, error) {
+	eventSinkMutex.Lock()
+	defer eventSinkMutex.Unlock()
+
+	sinks := []EventSink{}
+	for _, sinkOption := range sinkOptions {
+		factory, found := eventSinkFactories[sinkOption.Type]
+		if !found {
+			return nil, fmt.Errorf("event sink %s: not registered", sinkOption.Type)
+		}
+		sink, err := factory(sinkOption.URL, sinkOption.Topic, sinkOption.User, sinkOption.Password)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	return sinks, nil
+}
+
+// WithEventSink publishes the events of the application to the sink as well
+func WithEventSink(sink EventSink) Option {
+	return func(appContext *AppContext) {
+		appContext.EventSinks = append(appContext.EventSinks, sink)
+	}
+}
+
+// publish passes the event to all sinks, a broker that is down is logged rather than failing
+// what caused the event
+func (appContext *AppContext) publish(event *Event) {
+	for _, sink := range appContext.EventSinks {
+		err := sink.Publish(event)
+		if err != nil {
+			appContext.LogError(fmt.Errorf("event %s: %v", event.Type, err))
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package application
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/ralph-nijpels/geography-application/v2/units"
+)
+
+// NearbyAirport is an airport with its distance from the search location
+type NearbyAirport struct {
+	Airport  *Airport         `bson:"airport" json:"airport"`
+	Distance units.DistanceKm `bson:"-" json:"distance-km"`
+	Meters   float64          `bson:"distance_m" json:"-"`
+}
+
+// BoundingBox is the area between two parallels and two meridians. A box with its west side
+// east of its east side crosses the antimeridian.
+type BoundingBox struct {
+	SouthWest Coordinate
+	NorthEast Coordinate
+}
+
+// Validate checks the corners lie on the globe and the south side is not north of the north side
+func (box BoundingBox) Validate() error {
+	for _, corner := range []Coordinate{box.SouthWest, box.NorthEast} {
+		err := corner.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	if box.SouthWest.Latitude > box.NorthEast.Latitude {
+		return fmt.Errorf("south %v is north of north %v", box.SouthWest.Latitude, box.NorthEast.Latitude)
+	}
+
+	return nil
+}
+
+// query selects the positions inside the box on the GeoJSON coordinates, as the sides of a box
+// follow the parallels rather than the great circles of a GeoJSON polygon
+func (box BoundingBox) query(field string) bson.M {
+	longitude := field + ".coordinates.0"
+	latitude := field + ".coordinates.1"
+
+	query := bson.M{latitude: bson.M{"$gte": box.SouthWest.Latitude, "$lte": box.NorthEast.Latitude}}
+	if box.SouthWest.Longitude <= box.NorthEast.Longitude {
+		query[longitude] = bson.M{"$gte": box.SouthWest.Longitude, "$lte": box.NorthEast.Longitude}
+		return query
+	}
+	query["$or"] = bson.A{
+		bson.M{longitude: bson.M{"$gte": box.SouthWest.Longitude}},
+		bson.M{longitude: bson.M{"$lte": box.NorthEast.Longitude}}}
+
+	return query
+}
+
+// NearestOfType returns the airports of the given types within the radius of the location,
+// nearest first and limited to MaxResults
+func (mongoClient *MongoClient) NearestOfType(ctx context.Context, types []AirportType, location Coordinate, radius units.DistanceKm, limit int64) ([]*NearbyAirport, error) {
+	appContext := mongoClient.appContext
+
+	pipeline := NewGeoNearPipeline(GeoNear{
+		Near:          location,
+		Key:           "location",
+		DistanceField: "distance_m",
+		MaxDistance:   radius,
+		Query:         bson.M{"type": bson.M{"$in": types}}})
+	limit = appContext.PageLimit(limit)
+	if limit > 0 {
+		pipeline.Limit(limit)
+	}
+	pipeline.Project(bson.M{"_id": 0, "airport": "$$ROOT", "distance_m": 1})
+
+	cursor, err := mongoClient.readCollection(AirportsCollection).Aggregate(ctx, pipeline.Stages())
+	if err != nil {
+		return nil, err
+	}
+
+	airports := []*NearbyAirport{}
+	err = cursor.All(ctx, &airports)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, airport := range airports {
+		airport.Distance = units.LengthMeters(airport.Meters).Kilometers()
+	}
+
+	return airports, nil
+}
+
+// NearestHeliports returns the heliports within the radius of the location, nearest first
+func (mongoClient *MongoClient) NearestHeliports(ctx context.Context, location Coordinate, radius units.DistanceKm, limit int64) ([]*NearbyAirport, error) {
+	return mongoClient.NearestOfType(ctx, []AirportType{Heliport}, location, radius, limit)
+}
+
+// AirportsWithin returns the airports of the given types inside the box, by country and name
+// and limited to MaxResults
+func (mongoClient *MongoClient) AirportsWithin(ctx context.Context, types []AirportType, box BoundingBox) ([]*Airport, error) {
+	err := box.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	query := box.query("location")
+	query["type"] = bson.M{"$in": types}
+	cursor, err := mongoClient.readCollection(AirportsCollection).Find(ctx, query,
+		options.Find().
+			SetSort(bson.D{{Key: "iso_country", Value: 1}, {Key: "name", Value: 1}}).
+			SetLimit(mongoClient.appContext.PageLimit(0)))
+	if err != nil {
+		return nil, err
+	}
+
+	airports := []*Airport{}
+	err = cursor.All(ctx, &airports)
+	if err != nil {
+		return nil, err
+	}
+
+	return airports, nil
+}
+
+// SeaplaneBasesWithin returns the seaplane bases inside the box
+func (mongoClient *MongoClient) SeaplaneBasesWithin(ctx context.Context, box BoundingBox) ([]*Airport, error) {
+	return mongoClient.AirportsWithin(ctx, []AirportType{SeaplaneBase}, box)
+}
@@ -0,0 +1,109 @@
+package application
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// FieldMask lists the fields, by their json names, a caller is interested in. An empty mask
+// selects all fields.
+type FieldMask []string
+
+// ParseFieldMask reads a comma separated list of field names
+func ParseFieldMask(s string) FieldMask {
+	mask := FieldMask{}
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field != "" {
+			mask = append(mask, field)
+		}
+	}
+
+	return mask
+}
+
+// tagName returns the name in the json or bson tag of the struct field
+func tagName(field reflect.StructField, key string) string {
+	return strings.Split(field.Tag.Get(key), ",")[0]
+}
+
+// projection translates the mask into a Mongo projection for documents of the given type,
+// the id is always included
+func (mask FieldMask) projection(document interface{}) (bson.M, error) {
+	if len(mask) == 0 {
+		return nil, nil
+	}
+
+	names := map[string]string{}
+	goType := reflect.TypeOf(document)
+	for i := 0; i < goType.NumField(); i++ {
+		names[tagName(goType.Field(i), "json")] = tagName(goType.Field(i), "bson")
+	}
+
+	projection := bson.M{"_id": 1}
+	for _, field := range mask {
+		name, found := names[field]
+		if !found || name == "" || name == "-" {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+		projection[name] = 1
+	}
+
+	return projection, nil
+}
+
+// Validate checks all fields in the mask exist on the document type
+func (mask FieldMask) Validate(document interface{}) error {
+	_, err := mask.projection(document)
+	return err
+}
+
+// Apply reduces the value, or each element of a slice, to the fields in the mask, so fields
+// left out by the projection don't show up as zero values
+func (mask FieldMask) Apply(value interface{}) (interface{}, error) {
+	if len(mask) == 0 {
+		return value, nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded interface{}
+	err = json.Unmarshal(data, &decoded)
+	if err != nil {
+		return nil, err
+	}
+
+	keep := map[string]bool{"id": true}
+	for _, field := range mask {
+		keep[field] = true
+	}
+	reduce := func(object interface{}) {
+		fields, isObject := object.(map[string]interface{})
+		if !isObject {
+			return
+		}
+		for name := range fields {
+			if !keep[name] {
+				delete(fields, name)
+			}
+		}
+	}
+
+	list, isList := decoded.([]interface{})
+	if !isList {
+		reduce(decoded)
+		return decoded, nil
+	}
+	for _, element := range list {
+		reduce(element)
+	}
+
+	return list, nil
+}
@@ -0,0 +1,147 @@
+package application
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/ralph-nijpels/geography-application/v2/units"
+)
+
+// Fix describes a named en-route waypoint as stored in the fixes collection. Fix names are
+// only unique per country, so the key combines both.
+type Fix struct {
+	FixID    string     `bson:"_id" json:"id"`
+	Ident    string     `bson:"ident" json:"ident"`
+	Country  string     `bson:"iso_country" json:"country"`
+	Location Coordinate `bson:"location" json:"location"`
+}
+
+func (mongoClient *MongoClient) fixes() *mongo.Collection {
+	return mongoClient.collection(FixesCollection)
+}
+
+// fixKey is the key of a fix in the fixes source and collection
+func fixKey(record map[string]string) string {
+	return NormalizeCode(record["ident"]) + ":" + NormalizeCode(record["iso_country"])
+}
+
+// fixFromRecord converts a row of the fixes source, having ident, iso_country,
+// latitude_deg and longitude_deg columns
+func fixFromRecord(record map[string]string) (*Fix, error) {
+	var err error
+	fix := Fix{
+		FixID:   fixKey(record),
+		Ident:   NormalizeCode(record["ident"]),
+		Country: NormalizeCode(record["iso_country"])}
+
+	fix.Location, err = ParseCoordinate(record["latitude_deg"], record["longitude_deg"])
+	if err != nil {
+		return nil, err
+	}
+
+	return &fix, nil
+}
+
+// fixSource is a CSV source keyed on ident and country
+type fixSource struct {
+	CSVSource
+}
+
+// Key combines the ident and country of the fix
+func (source *fixSource) Key(record map[string]string) string {
+	return fixKey(record)
+}
+
+// EnsureFixIndexes creates the indexes backing the lookups by ident and the geo queries
+func (mongoClient *MongoClient) EnsureFixIndexes(ctx context.Context) error {
+	return mongoClient.ensureFixIndexes(ctx, mongoClient.fixes())
+}
+
+// ensureFixIndexes creates the fix indexes on the given collection, which may be a shadow
+// collection that is swapped in later
+func (mongoClient *MongoClient) ensureFixIndexes(ctx context.Context, collection *mongo.Collection) error {
+	err := mongoClient.appContext.CheckWritable()
+	if err != nil {
+		return err
+	}
+
+	_, err = collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "location", Value: "2dsphere"}}},
+		{Keys: bson.D{{Key: "ident", Value: 1}}},
+	})
+
+	return err
+}
+
+// ImportFixes downloads the fixes source and upserts all fixes
+func (mongoClient *MongoClient) ImportFixes(ctx context.Context, report *RunReport) error {
+	appContext := mongoClient.appContext
+
+	err := appContext.CheckWritable()
+	if err != nil {
+		return err
+	}
+	if appContext.FixesURL == "" {
+		return ErrNoSource
+	}
+
+	err = mongoClient.EnsureFixIndexes(ctx)
+	if err != nil {
+		return err
+	}
+
+	source := &fixSource{CSVSource{SourceName: "fixes", URL: appContext.FixesURL}}
+	live, err := mongoClient.fixes().CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	_, err = appContext.importSource(ctx, report, source, live,
+		func(record map[string]string) (*keyedDocument, error) {
+			fix, err := fixFromRecord(record)
+			if err != nil {
+				return nil, err
+			}
+			return &keyedDocument{id: fix.FixID, document: fix}, nil
+		},
+		func(batch []keyedDocument) (int64, error) {
+			return mongoClient.bulkUpsert(ctx, mongoClient.fixes(), batch, report)
+		})
+	if err != nil {
+		return err
+	}
+
+	err = mongoClient.recordDataset(ctx, source.Name(), report)
+	if err != nil {
+		return err
+	}
+	err = mongoClient.RefreshViews(ctx)
+	if err != nil {
+		return err
+	}
+	appContext.CacheReset()
+
+	return nil
+}
+
+// FixesNear returns the fixes within the radius of the location, nearest first
+func (mongoClient *MongoClient) FixesNear(ctx context.Context, location Coordinate, radius units.DistanceKm) ([]*Fix, error) {
+	filter := bson.M{"location": bson.M{"$nearSphere": bson.M{
+		"$geometry":    location,
+		"$maxDistance": float64(radius.Meters())}}}
+
+	cursor, err := mongoClient.readCollection(FixesCollection).Find(ctx, filter, options.Find().SetLimit(mongoClient.appContext.PageLimit(0)))
+	if err != nil {
+		return nil, err
+	}
+
+	fixes := []*Fix{}
+	err = cursor.All(ctx, &fixes)
+	if err != nil {
+		return nil, err
+	}
+
+	return fixes, nil
+}
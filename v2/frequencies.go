@@ -0,0 +1,68 @@
+package application
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/ralph-nijpels/geography-application/v2/units"
+)
+
+// Frequency describes a radio frequency as stored in the frequencies collection
+type Frequency struct {
+	FrequencyID  int64              `bson:"_id" json:"id"`
+	AirportID    int64              `bson:"airport_ref" json:"airport-id"`
+	AirportIdent string             `bson:"airport_ident" json:"airport-ident"`
+	Type         string             `bson:"type" json:"type"`
+	Description  string             `bson:"description,omitempty" json:"description,omitempty"`
+	Frequency    units.FrequencyMHz `bson:"frequency_mhz" json:"frequency-mhz"`
+}
+
+func (mongoClient *MongoClient) frequencies() *mongo.Collection {
+	return mongoClient.collection(FrequenciesCollection)
+}
+
+// frequencyFromRecord converts a row of the OurAirports airport-frequencies file
+func frequencyFromRecord(record map[string]string) (*Frequency, error) {
+	var err error
+	frequency := Frequency{
+		AirportIdent: record["airport_ident"],
+		Type:         NormalizeCode(record["type"]),
+		Description:  record["description"]}
+
+	frequency.FrequencyID, err = parseInt(record, "id")
+	if err != nil {
+		return nil, err
+	}
+	frequency.AirportID, err = parseInt(record, "airport_ref")
+	if err != nil {
+		return nil, err
+	}
+	mhz, err := parseFloat(record, "frequency_mhz")
+	if err != nil {
+		return nil, err
+	}
+	frequency.Frequency = units.FrequencyMHz(mhz)
+
+	return &frequency, nil
+}
+
+// FrequenciesByAirport returns the frequencies of the given airport
+func (mongoClient *MongoClient) FrequenciesByAirport(ctx context.Context, airportID int64) ([]*Frequency, error) {
+
+	cursor, err := mongoClient.readCollection(FrequenciesCollection).Find(ctx, bson.M{"airport_ref": airportID},
+		options.Find().SetSort(bson.M{"type": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	frequencies := []*Frequency{}
+	err = cursor.All(ctx, &frequencies)
+	if err != nil {
+		return nil, err
+	}
+
+	return frequencies, nil
+}
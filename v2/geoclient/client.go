@@ -0,0 +1,220 @@
+// Package geoclient is a typed client for the geography HTTP API
+package geoclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	application "github.com/ralph-nijpels/geography-application/v2"
+	"github.com/ralph-nijpels/geography-application/v2/server"
+)
+
+// ErrNotFound is returned when the API has no such resource
+var ErrNotFound = errors.New("not found")
+
+// Client calls the geography API, retrying transient failures
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	Retries    int
+	Backoff    time.Duration
+}
+
+// New creates a client for the API at the given base URL
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    baseURL,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		Retries:    3,
+		Backoff:    500 * time.Millisecond}
+}
+
+// retryable tells whether a status is worth another attempt
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// get fetches the path and decodes the JSON response into result
+func (client *Client) get(ctx context.Context, path string, query url.Values, result interface{}) error {
+
+	target := client.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= client.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(client.Backoff * time.Duration(1<<(attempt-1))):
+			}
+		}
+
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+		if err != nil {
+			return err
+		}
+
+		response, err := client.HTTPClient.Do(request)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			lastErr = err
+			continue
+		}
+
+		err = client.decode(response, result)
+		if err == nil || !retryable(response.StatusCode) {
+			return err
+		}
+		lastErr = err
+	}
+
+	return lastErr
+}
+
+func (client *Client) decode(response *http.Response, result interface{}) error {
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if response.StatusCode != http.StatusOK {
+		var errorResponse server.ErrorResponse
+		json.NewDecoder(response.Body).Decode(&errorResponse)
+		return fmt.Errorf("geoclient: %s: %s", response.Status, errorResponse.Error)
+	}
+
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+// Airport looks up an airport by ICAO, IATA or local code
+func (client *Client) Airport(ctx context.Context, ident string) (*application.Airport, error) {
+	var airport application.Airport
+
+	err := client.get(ctx, "/airports/"+url.PathEscape(ident), nil, &airport)
+	if err != nil {
+		return nil, err
+	}
+
+	return &airport, nil
+}
+
+// Country returns the country with its regions and airport counts
+func (client *Client) Country(ctx context.Context, code string) (*application.CountryTree, error) {
+	var country application.CountryTree
+
+	err := client.get(ctx, "/countries/"+url.PathEscape(code), nil, &country)
+	if err != nil {
+		return nil, err
+	}
+
+	return &country, nil
+}
+
+// Stat returns a statistic by name
+func (client *Client) Stat(ctx context.Context, name string) (*application.Statistic, error) {
+	var statistic application.Statistic
+
+	err := client.get(ctx, "/stats/"+url.PathEscape(name), nil, &statistic)
+	if err != nil {
+		return nil, err
+	}
+
+	return &statistic, nil
+}
+
+// Job returns the status of a job
+func (client *Client) Job(ctx context.Context, jobID string) (*application.Job, error) {
+	var job application.Job
+
+	err := client.get(ctx, "/jobs/"+url.PathEscape(jobID), nil, &job)
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// AirportIterator walks through all pages of an airport search
+type AirportIterator struct {
+	client   *Client
+	query    url.Values
+	airports []*application.Airport
+	current  *application.Airport
+	next     string
+	done     bool
+	err      error
+}
+
+// Airports searches airports, the iterator fetches further pages as needed
+func (client *Client) Airports(filter *application.AirportFilter, pageSize int64) *AirportIterator {
+	query := url.Values{}
+	if filter.Continent != "" {
+		query.Set("continent", string(filter.Continent))
+	}
+	if filter.ScheduledService != nil {
+		query.Set("scheduled-service", strconv.FormatBool(*filter.ScheduledService))
+	}
+	if filter.Country != "" {
+		query.Set("country", filter.Country)
+	}
+	if filter.Region != "" {
+		query.Set("region", filter.Region)
+	}
+	for _, airportType := range filter.Types {
+		query.Add("type", string(airportType))
+	}
+	if filter.Name != "" {
+		query.Set("name", filter.Name)
+	}
+	if pageSize > 0 {
+		query.Set("limit", strconv.FormatInt(pageSize, 10))
+	}
+
+	return &AirportIterator{client: client, query: query, next: "0"}
+}
+
+// Next moves to the next airport, returning false at the end or on an error
+func (iterator *AirportIterator) Next(ctx context.Context) bool {
+	for len(iterator.airports) == 0 {
+		if iterator.done || iterator.err != nil {
+			return false
+		}
+
+		iterator.query.Set("offset", iterator.next)
+		var page server.AirportPage
+		iterator.err = iterator.client.get(ctx, "/airports", iterator.query, &page)
+		if iterator.err != nil {
+			return false
+		}
+
+		iterator.airports = page.Airports
+		iterator.next = page.Next
+		iterator.done = page.Next == ""
+	}
+
+	iterator.current = iterator.airports[0]
+	iterator.airports = iterator.airports[1:]
+
+	return true
+}
+
+// Airport returns the current airport
+func (iterator *AirportIterator) Airport() *application.Airport {
+	return iterator.current
+}
+
+// Err returns the error that ended the iteration, if any
+func (iterator *AirportIterator) Err() error {
+	return iterator.err
+}
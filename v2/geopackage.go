@@ -0,0 +1,234 @@
+package application
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GeoPackageSource is a table of a GeoPackage file, like a layer exported from a GIS. The
+// columns become the record, see geoPackageGeometry for the geometry.
+type GeoPackageSource struct {
+	SourceName string
+	URL        string
+	Table      string
+	KeyColumn  string
+}
+
+// Name identifies the source
+func (source *GeoPackageSource) Name() string {
+	return source.SourceName
+}
+
+// Fetch downloads the file
+func (source *GeoPackageSource) Fetch(ctx context.Context, appContext *AppContext, report *RunReport) (io.ReadCloser, error) {
+	return appContext.fetchSource(ctx, source.SourceName, source.URL, ".gpkg", report)
+}
+
+// Parse streams the rows of the table. SQLite needs a file, so data that is not read from one
+// is copied to a temporary file first.
+func (source *GeoPackageSource) Parse(input io.Reader) (RecordReader, error) {
+	path := ""
+	var temporary string
+	named, isNamed := input.(interface{ Name() string })
+	if isNamed {
+		path = named.Name()
+	} else {
+		file, err := ioutil.TempFile("", "geopackage-*.gpkg")
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(file, input)
+		file.Close()
+		if err != nil {
+			os.Remove(file.Name())
+			return nil, err
+		}
+		path = file.Name()
+		temporary = path
+	}
+
+	reader, err := newGeoPackageReader(path, source.Table)
+	if err != nil {
+		if temporary != "" {
+			os.Remove(temporary)
+		}
+		return nil, err
+	}
+	reader.temporary = temporary
+
+	return reader, nil
+}
+
+// Key returns the key column of the record
+func (source *GeoPackageSource) Key(record map[string]string) string {
+	return record[source.KeyColumn]
+}
+
+// geoPackageReader streams the rows of a GeoPackage table, releasing the database once the rows
+// are done
+type geoPackageReader struct {
+	db        *sql.DB
+	rows      *sql.Rows
+	columns   []string
+	geometry  string
+	temporary string
+	record    map[string]string
+	line      int
+	err       error
+}
+
+func newGeoPackageReader(path string, table string) (*geoPackageReader, error) {
+	db, err := sql.Open(SQLiteDriver, path)
+	if err != nil {
+		return nil, err
+	}
+
+	// The geometry column is registered with the table, a table without one is read all the same
+	var geometry string
+	err = db.QueryRow("SELECT column_name FROM gpkg_geometry_columns WHERE table_name = ?", table).Scan(&geometry)
+	if err != nil && err != sql.ErrNoRows {
+		db.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	rows, err := db.Query(`SELECT * FROM "` + strings.ReplaceAll(table, `"`, `""`) + `"`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		db.Close()
+		return nil, err
+	}
+
+	return &geoPackageReader{db: db, rows: rows, columns: columns, geometry: geometry}, nil
+}
+
+// close releases the rows, the database and the temporary copy of the file
+func (reader *geoPackageReader) close() {
+	if reader.db == nil {
+		return
+	}
+	reader.rows.Close()
+	reader.db.Close()
+	reader.db = nil
+	if reader.temporary != "" {
+		os.Remove(reader.temporary)
+	}
+}
+
+// Next moves to the next row, returning false at the end or on an error
+func (reader *geoPackageReader) Next() bool {
+	if reader.err != nil || reader.db == nil {
+		return false
+	}
+	if !reader.rows.Next() {
+		reader.err = reader.rows.Err()
+		reader.close()
+		return false
+	}
+
+	values := make([]interface{}, len(reader.columns))
+	pointers := make([]interface{}, len(values))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	reader.err = reader.rows.Scan(pointers...)
+	if reader.err != nil {
+		reader.close()
+		return false
+	}
+
+	record := make(map[string]string, len(reader.columns))
+	for i, column := range reader.columns {
+		if column == reader.geometry {
+			data, _ := values[i].([]byte)
+			geoPackageGeometry(data, record)
+			continue
+		}
+		record[column] = sqlText(values[i])
+	}
+	reader.record = record
+	reader.line++
+
+	return true
+}
+
+// Record returns the current record
+func (reader *geoPackageReader) Record() map[string]string {
+	return reader.record
+}
+
+// Line returns the position of the current row in the table, starting at 1
+func (reader *geoPackageReader) Line() int {
+	return reader.line
+}
+
+// Err returns the error that ended the iteration, if any
+func (reader *geoPackageReader) Err() error {
+	return reader.err
+}
+
+// sqlText renders a column value as the text it would have in a CSV file
+func sqlText(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return strings.TrimSpace(string(value))
+	case string:
+		return strings.TrimSpace(value)
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	case time.Time:
+		return value.Format(time.RFC3339)
+	}
+
+	return fmt.Sprint(value)
+}
+
+// geoPackageEnvelopes are the sizes of the envelope in the header of a geometry, by indicator
+var geoPackageEnvelopes = []int{0, 32, 48, 48, 64}
+
+// geoPackageGeometry adds a geometry in the GeoPackage binary format to the record. A point
+// becomes latitude_deg and longitude_deg, any other geometry is kept as hex WKB in geometry.
+func geoPackageGeometry(data []byte, record map[string]string) {
+	if len(data) < 8 || data[0] != 'G' || data[1] != 'P' {
+		return
+	}
+	indicator := int(data[3]>>1) & 0x07
+	if indicator >= len(geoPackageEnvelopes) || len(data) < 8+geoPackageEnvelopes[indicator] {
+		return
+	}
+	wkb := data[8+geoPackageEnvelopes[indicator]:]
+
+	// A point is the byte order, the type and two doubles, possibly followed by Z and M
+	if len(wkb) >= 21 {
+		var order binary.ByteOrder = binary.BigEndian
+		if wkb[0] == 1 {
+			order = binary.LittleEndian
+		}
+		if order.Uint32(wkb[1:5])%1000 == 1 {
+			record["longitude_deg"] = strconv.FormatFloat(math.Float64frombits(order.Uint64(wkb[5:13])), 'f', -1, 64)
+			record["latitude_deg"] = strconv.FormatFloat(math.Float64frombits(order.Uint64(wkb[13:21])), 'f', -1, 64)
+			return
+		}
+	}
+	record["geometry"] = hex.EncodeToString(wkb)
+}
@@ -0,0 +1,22 @@
+package application
+
+import (
+	"context"
+
+	"github.com/ralph-nijpels/geography-application/v2/units"
+)
+
+// GeoStore answers the airport lookups and geo queries. MongoClient keeps the airports in
+// MongoDB; SQLiteStore keeps them in a single file, so the queries run without a database
+// server for offline or edge use.
+type GeoStore interface {
+	AirportByICAO(ctx context.Context, icao string, fields ...string) (*Airport, error)
+	AirportByIATA(ctx context.Context, iata string, fields ...string) (*Airport, error)
+	AirportsWithin(ctx context.Context, types []AirportType, box BoundingBox) ([]*Airport, error)
+	NearestOfType(ctx context.Context, types []AirportType, location Coordinate, radius units.DistanceKm, limit int64) ([]*NearbyAirport, error)
+}
+
+var (
+	_ GeoStore = (*MongoClient)(nil)
+	_ GeoStore = (*SQLiteStore)(nil)
+)
@@ -3,10 +3,6 @@ module github.com/ralph-nijpels/geography-application/v2
 go 1.16
 
 require (
-	github.com/go-ini/ini v1.62.0 // indirect
-	github.com/minio/minio-go v6.0.14+incompatible
-	github.com/mitchellh/go-homedir v1.1.0 // indirect
-	github.com/smartystreets/goconvey v1.6.4 // indirect
+	github.com/minio/minio-go/v7 v7.0.12
 	go.mongodb.org/mongo-driver v1.7.1
-	gopkg.in/ini.v1 v1.62.0 // indirect
 )
@@ -0,0 +1,100 @@
+// Package graphql offers an optional GraphQL layer over the geography queries, so
+// clients can fetch exactly the fields they need in a single round trip
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	application "github.com/ralph-nijpels/geography-application/v2"
+)
+
+// Request is a GraphQL request as posted by clients
+type Request struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+// ResponseError describes a single error in a GraphQL response
+type ResponseError struct {
+	Message string `json:"message"`
+}
+
+// Response is the GraphQL response envelope
+type Response struct {
+	Data   map[string]interface{} `json:"data"`
+	Errors []ResponseError        `json:"errors,omitempty"`
+}
+
+// Execute runs the query against the geography database
+func Execute(ctx context.Context, mongoClient *application.MongoClient, request *Request) *Response {
+
+	fields, err := parse(request.Query, request.Variables)
+	if err != nil {
+		return &Response{Errors: []ResponseError{{Message: err.Error()}}}
+	}
+
+	data, err := execute(ctx, mongoClient, "Query", nil, fields)
+	if err != nil {
+		return &Response{Errors: []ResponseError{{Message: err.Error()}}}
+	}
+
+	return &Response{Data: data}
+}
+
+// errorBody mirrors the error body of the server, so clients see the same shape for every
+// request that did not get as far as a GraphQL response
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&errorBody{Error: application.Redact(message)})
+}
+
+// Handler serves GraphQL requests, either posted as JSON or passed in the query parameter.
+// The query is parsed before the database is opened, a bad query costs no connection.
+func Handler(appContext *application.AppContext) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		var request Request
+		switch r.Method {
+		case http.MethodGet:
+			request.Query = r.URL.Query().Get("query")
+		case http.MethodPost:
+			err := json.NewDecoder(r.Body).Decode(&request)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		fields, err := parse(request.Query, request.Variables)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		mongoClient, err := appContext.DBOpen()
+		if err != nil {
+			writeError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		defer mongoClient.DBClose()
+
+		response := &Response{}
+		response.Data, err = execute(r.Context(), mongoClient, "Query", nil, fields)
+		if err != nil {
+			response = &Response{Errors: []ResponseError{{Message: err.Error()}}}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	})
+}
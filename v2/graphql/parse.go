@@ -0,0 +1,254 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// selection is a single field in a query, with its arguments and sub-selection
+type selection struct {
+	alias     string
+	name      string
+	arguments map[string]interface{}
+	fields    []*selection
+}
+
+type parser struct {
+	query     string
+	pos       int
+	variables map[string]interface{}
+}
+
+// parse reads a query document, supporting fields, aliases, arguments and variables
+func parse(query string, variables map[string]interface{}) ([]*selection, error) {
+	p := parser{query: query, variables: variables}
+
+	// An optional operation header: query Name($var: Type, ...)
+	if p.peekName() == "query" {
+		p.readName()
+		if p.peekName() != "" {
+			p.readName()
+		}
+		p.skip()
+		if p.peek() == '(' {
+			err := p.skipDefinitions()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	fields, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skip()
+	if p.pos < len(p.query) {
+		return nil, p.errorf("unexpected %q", p.query[p.pos])
+	}
+
+	return fields, nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("graphql: position %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+// skip moves past whitespace, commas and comments, which are all insignificant
+func (p *parser) skip() {
+	for p.pos < len(p.query) {
+		c := p.query[p.pos]
+		switch {
+		case c == '#':
+			for p.pos < len(p.query) && p.query[p.pos] != '\n' {
+				p.pos++
+			}
+		case c == ',' || unicode.IsSpace(rune(c)):
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) peek() byte {
+	p.skip()
+	if p.pos >= len(p.query) {
+		return 0
+	}
+
+	return p.query[p.pos]
+}
+
+func (p *parser) expect(c byte) error {
+	if p.peek() != c {
+		return p.errorf("expected %q", c)
+	}
+	p.pos++
+
+	return nil
+}
+
+func isNameChar(c byte, first bool) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (!first && c >= '0' && c <= '9')
+}
+
+func (p *parser) peekName() string {
+	p.skip()
+	end := p.pos
+	for end < len(p.query) && isNameChar(p.query[end], end == p.pos) {
+		end++
+	}
+
+	return p.query[p.pos:end]
+}
+
+func (p *parser) readName() string {
+	name := p.peekName()
+	p.pos += len(name)
+
+	return name
+}
+
+// skipDefinitions ignores the variable definitions, the values come from the request
+func (p *parser) skipDefinitions() error {
+	end := strings.IndexByte(p.query[p.pos:], ')')
+	if end < 0 {
+		return p.errorf("unterminated variable definitions")
+	}
+	p.pos += end + 1
+
+	return nil
+}
+
+func (p *parser) selectionSet() ([]*selection, error) {
+	err := p.expect('{')
+	if err != nil {
+		return nil, err
+	}
+
+	fields := []*selection{}
+	for p.peek() != '}' {
+		if p.peek() == 0 {
+			return nil, p.errorf("unterminated selection set")
+		}
+
+		field, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+	p.pos++
+
+	return fields, nil
+}
+
+func (p *parser) selection() (*selection, error) {
+	name := p.readName()
+	if name == "" {
+		return nil, p.errorf("expected field name")
+	}
+
+	field := selection{alias: name, name: name, arguments: map[string]interface{}{}}
+	if p.peek() == ':' {
+		p.pos++
+		field.name = p.readName()
+		if field.name == "" {
+			return nil, p.errorf("expected field name after alias")
+		}
+	}
+
+	if p.peek() == '(' {
+		p.pos++
+		for p.peek() != ')' {
+			argument := p.readName()
+			if argument == "" {
+				return nil, p.errorf("expected argument name")
+			}
+			err := p.expect(':')
+			if err != nil {
+				return nil, err
+			}
+			value, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			field.arguments[argument] = value
+		}
+		p.pos++
+	}
+
+	if p.peek() == '{' {
+		fields, err := p.selectionSet()
+		if err != nil {
+			return nil, err
+		}
+		field.fields = fields
+	}
+
+	return &field, nil
+}
+
+func (p *parser) value() (interface{}, error) {
+	c := p.peek()
+	switch {
+	case c == '$':
+		p.pos++
+		name := p.readName()
+		value, found := p.variables[name]
+		if !found {
+			return nil, p.errorf("undefined variable $%s", name)
+		}
+		return value, nil
+
+	case c == '"':
+		end := p.pos + 1
+		for end < len(p.query) && p.query[end] != '"' {
+			if p.query[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(p.query) {
+			return nil, p.errorf("unterminated string")
+		}
+		value, err := strconv.Unquote(p.query[p.pos : end+1])
+		if err != nil {
+			return nil, p.errorf("invalid string")
+		}
+		p.pos = end + 1
+		return value, nil
+
+	case c == '-' || (c >= '0' && c <= '9'):
+		end := p.pos + 1
+		for end < len(p.query) && strings.IndexByte("0123456789.eE+-", p.query[end]) >= 0 {
+			end++
+		}
+		number := p.query[p.pos:end]
+		p.pos = end
+		value, err := strconv.ParseFloat(number, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %s", number)
+		}
+		return value, nil
+
+	default:
+		name := p.readName()
+		switch name {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		case "":
+			return nil, p.errorf("expected value")
+		}
+		// Enum values are passed as plain strings
+		return name, nil
+	}
+}
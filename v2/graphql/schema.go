@@ -0,0 +1,294 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	application "github.com/ralph-nijpels/geography-application/v2"
+)
+
+// resolver produces the value of an object field from its parent
+type resolver func(ctx context.Context, mongoClient *application.MongoClient, parent interface{},
+	arguments map[string]interface{}) (interface{}, error)
+
+// objectField is a field that refers to another type and needs a resolver
+type objectField struct {
+	typeName  string
+	list      bool
+	arguments string
+	resolve   resolver
+}
+
+// objectTypes lists the Go type behind each GraphQL type, scalars are derived from its json tags
+var objectTypes = map[string]reflect.Type{
+	"Airport":   reflect.TypeOf(application.Airport{}),
+	"Runway":    reflect.TypeOf(application.Runway{}),
+	"Frequency": reflect.TypeOf(application.Frequency{}),
+	"Country":   reflect.TypeOf(application.Country{}),
+	"Region":    reflect.TypeOf(application.Region{}),
+	"Weather":   reflect.TypeOf(application.WeatherReport{}),
+}
+
+// objectFields lists the nested fields per type, with Query as the root
+var objectFields = map[string]map[string]objectField{
+	"Query": {
+		"airport": {typeName: "Airport", arguments: "(icao: String, iata: String, ident: String)", resolve: resolveAirport},
+		"country": {typeName: "Country", arguments: "(code: String!)", resolve: resolveCountry},
+		"region":  {typeName: "Region", arguments: "(code: String!)", resolve: resolveRegion},
+	},
+	"Airport": {
+		"runways":     {typeName: "Runway", list: true, resolve: resolveRunways},
+		"frequencies": {typeName: "Frequency", list: true, resolve: resolveFrequencies},
+		"country":     {typeName: "Country", resolve: resolveCountry},
+		"region":      {typeName: "Region", resolve: resolveRegion},
+		"metar":       {typeName: "Weather", resolve: resolveMETAR},
+		"taf":         {typeName: "Weather", resolve: resolveTAF},
+	},
+	"Country": {
+		"regions": {typeName: "Region", list: true, resolve: resolveRegions},
+	},
+	"Region": {
+		"country": {typeName: "Country", resolve: resolveCountry},
+	},
+}
+
+// camelCase turns a json tag like iata-code into the GraphQL field name iataCode
+func camelCase(tag string) string {
+	parts := strings.Split(tag, "-")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+
+	return strings.Join(parts, "")
+}
+
+// scalarFields maps the GraphQL scalar field names of a type to their json key and GraphQL type
+func scalarFields(typeName string) map[string][2]string {
+	fields := map[string][2]string{}
+
+	goType := objectTypes[typeName]
+	for i := 0; i < goType.NumField(); i++ {
+		tag := strings.Split(goType.Field(i).Tag.Get("json"), ",")[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+
+		scalar := "String"
+		switch goType.Field(i).Type.Kind() {
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			scalar = "Int"
+		case reflect.Float32, reflect.Float64:
+			scalar = "Float"
+		case reflect.Bool:
+			scalar = "Boolean"
+		case reflect.Struct:
+			if goType.Field(i).Type != reflect.TypeOf(time.Time{}) {
+				scalar = "GeoJSON"
+			}
+		case reflect.Map, reflect.Slice:
+			scalar = "JSON"
+		}
+
+		fields[camelCase(tag)] = [2]string{tag, scalar}
+	}
+
+	return fields
+}
+
+// Schema returns the schema in the GraphQL schema definition language
+func Schema() string {
+	var schema strings.Builder
+	fmt.Fprintf(&schema, "scalar GeoJSON\n\n")
+	fmt.Fprintf(&schema, "scalar JSON\n\n")
+
+	typeNames := []string{"Query"}
+	for typeName := range objectTypes {
+		typeNames = append(typeNames, typeName)
+	}
+	sort.Strings(typeNames[1:])
+
+	for _, typeName := range typeNames {
+		lines := []string{}
+		if typeName != "Query" {
+			for name, field := range scalarFields(typeName) {
+				lines = append(lines, fmt.Sprintf("  %s: %s", name, field[1]))
+			}
+		}
+		for name, field := range objectFields[typeName] {
+			fieldType := field.typeName
+			if field.list {
+				fieldType = "[" + fieldType + "!]!"
+			}
+			lines = append(lines, fmt.Sprintf("  %s%s: %s", name, field.arguments, fieldType))
+		}
+		sort.Strings(lines)
+
+		fmt.Fprintf(&schema, "type %s {\n%s\n}\n\n", typeName, strings.Join(lines, "\n"))
+	}
+
+	return schema.String()
+}
+
+// execute resolves the selected fields on the parent value of the given type
+func execute(ctx context.Context, mongoClient *application.MongoClient, typeName string,
+	parent interface{}, fields []*selection) (map[string]interface{}, error) {
+
+	result := map[string]interface{}{}
+	var scalars map[string]interface{}
+
+	for _, field := range fields {
+		if field.name == "__typename" {
+			result[field.alias] = typeName
+			continue
+		}
+
+		// Object fields are resolved and executed recursively
+		object, found := objectFields[typeName][field.name]
+		if found {
+			if len(field.fields) == 0 {
+				return nil, fmt.Errorf("field %s on %s needs a selection", field.name, typeName)
+			}
+
+			value, err := object.resolve(ctx, mongoClient, parent, field.arguments)
+			if err == application.ErrNotFound || (err == nil && (value == nil || reflect.ValueOf(value).IsNil())) {
+				result[field.alias] = nil
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			if !object.list {
+				result[field.alias], err = execute(ctx, mongoClient, object.typeName, value, field.fields)
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			values := reflect.ValueOf(value)
+			list := make([]interface{}, values.Len())
+			for i := range list {
+				list[i], err = execute(ctx, mongoClient, object.typeName, values.Index(i).Interface(), field.fields)
+				if err != nil {
+					return nil, err
+				}
+			}
+			result[field.alias] = list
+			continue
+		}
+
+		// Scalars are taken from the json representation of the parent
+		scalar, found := [2]string{}, false
+		if typeName != "Query" {
+			scalar, found = scalarFields(typeName)[field.name]
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown field %s on %s", field.name, typeName)
+		}
+		if scalars == nil {
+			data, err := json.Marshal(parent)
+			if err != nil {
+				return nil, err
+			}
+			err = json.Unmarshal(data, &scalars)
+			if err != nil {
+				return nil, err
+			}
+		}
+		result[field.alias] = scalars[scalar[0]]
+	}
+
+	return result, nil
+}
+
+func stringArgument(arguments map[string]interface{}, name string) string {
+	value, _ := arguments[name].(string)
+	return value
+}
+
+func resolveAirport(ctx context.Context, mongoClient *application.MongoClient, parent interface{},
+	arguments map[string]interface{}) (interface{}, error) {
+
+	if icao := stringArgument(arguments, "icao"); icao != "" {
+		return mongoClient.AirportByICAO(ctx, icao)
+	}
+	if iata := stringArgument(arguments, "iata"); iata != "" {
+		return mongoClient.AirportByIATA(ctx, iata)
+	}
+	if ident := stringArgument(arguments, "ident"); ident != "" {
+		return mongoClient.LookupIdent(ctx, ident)
+	}
+
+	return nil, fmt.Errorf("airport needs an icao, iata or ident argument")
+}
+
+func resolveCountry(ctx context.Context, mongoClient *application.MongoClient, parent interface{},
+	arguments map[string]interface{}) (interface{}, error) {
+
+	switch parent := parent.(type) {
+	case *application.Airport:
+		return mongoClient.Country(ctx, parent.Country)
+	case *application.Region:
+		return mongoClient.Country(ctx, parent.Country)
+	}
+
+	return mongoClient.Country(ctx, stringArgument(arguments, "code"))
+}
+
+func resolveRegion(ctx context.Context, mongoClient *application.MongoClient, parent interface{},
+	arguments map[string]interface{}) (interface{}, error) {
+
+	airport, isAirport := parent.(*application.Airport)
+	if isAirport {
+		return mongoClient.Region(ctx, airport.Region)
+	}
+
+	return mongoClient.Region(ctx, stringArgument(arguments, "code"))
+}
+
+func resolveRegions(ctx context.Context, mongoClient *application.MongoClient, parent interface{},
+	arguments map[string]interface{}) (interface{}, error) {
+	return mongoClient.RegionsByCountry(ctx, parent.(*application.Country).Code)
+}
+
+func resolveRunways(ctx context.Context, mongoClient *application.MongoClient, parent interface{},
+	arguments map[string]interface{}) (interface{}, error) {
+	return mongoClient.RunwaysByAirport(ctx, parent.(*application.Airport).AirportID)
+}
+
+func resolveFrequencies(ctx context.Context, mongoClient *application.MongoClient, parent interface{},
+	arguments map[string]interface{}) (interface{}, error) {
+	return mongoClient.FrequenciesByAirport(ctx, parent.(*application.Airport).AirportID)
+}
+
+// resolveMETAR returns no report rather than an error when the weather is not configured
+func resolveMETAR(ctx context.Context, mongoClient *application.MongoClient, parent interface{},
+	arguments map[string]interface{}) (interface{}, error) {
+
+	report, err := mongoClient.METAR(ctx, parent.(*application.Airport))
+	if err == application.ErrNoSource {
+		return nil, nil
+	}
+
+	return report, err
+}
+
+// resolveTAF returns no report rather than an error when the weather is not configured
+func resolveTAF(ctx context.Context, mongoClient *application.MongoClient, parent interface{},
+	arguments map[string]interface{}) (interface{}, error) {
+
+	report, err := mongoClient.TAF(ctx, parent.(*application.Airport))
+	if err == application.ErrNoSource {
+		return nil, nil
+	}
+
+	return report, err
+}
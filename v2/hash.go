@@ -0,0 +1,188 @@
+package application
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// hashField is the field every imported document keeps its hash in
+const hashField = "hash"
+
+// hashSamples is the number of documents whose hash the integrity check recomputes
+const hashSamples = 100
+
+// writeCanonical writes the value in a form that does not depend on the order of the fields or
+// on how a number happens to be typed: fields are sorted, missing and null fields are the same,
+// integral numbers are written as integers whatever their type and times in UTC
+func writeCanonical(writer io.Writer, value interface{}) {
+	switch typed := value.(type) {
+	case nil:
+		io.WriteString(writer, "null")
+	case bson.M:
+		fields := make([]string, 0, len(typed))
+		for field, fieldValue := range typed {
+			if fieldValue != nil && field != hashField {
+				fields = append(fields, field)
+			}
+		}
+		sort.Strings(fields)
+		io.WriteString(writer, "{")
+		for _, field := range fields {
+			io.WriteString(writer, strconv.Quote(field)+":")
+			writeCanonical(writer, typed[field])
+			io.WriteString(writer, ",")
+		}
+		io.WriteString(writer, "}")
+	case bson.D:
+		writeCanonical(writer, typed.Map())
+	case bson.A:
+		io.WriteString(writer, "[")
+		for _, element := range typed {
+			writeCanonical(writer, element)
+			io.WriteString(writer, ",")
+		}
+		io.WriteString(writer, "]")
+	case string:
+		io.WriteString(writer, strconv.Quote(typed))
+	case int32:
+		io.WriteString(writer, strconv.FormatInt(int64(typed), 10))
+	case int64:
+		io.WriteString(writer, strconv.FormatInt(typed, 10))
+	case float64:
+		if typed == math.Trunc(typed) && math.Abs(typed) < 1<<53 {
+			io.WriteString(writer, strconv.FormatInt(int64(typed), 10))
+		} else {
+			io.WriteString(writer, strconv.FormatFloat(typed, 'g', -1, 64))
+		}
+	case bool:
+		io.WriteString(writer, strconv.FormatBool(typed))
+	case primitive.DateTime:
+		io.WriteString(writer, typed.Time().UTC().Format(time.RFC3339Nano))
+	default:
+		fmt.Fprintf(writer, "%v", typed)
+	}
+}
+
+// documentHash returns the hash of the document in its canonical form, the hash field left out
+func documentHash(document bson.M) string {
+	hash := sha256.New()
+	writeCanonical(hash, document)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// hashedDocument returns the document as stored, with its hash
+func hashedDocument(document interface{}) (bson.M, error) {
+	hashed, err := roundTrip(document)
+	if err != nil {
+		return nil, err
+	}
+	hashed[hashField] = documentHash(hashed)
+
+	return hashed, nil
+}
+
+// storedHashes reads the hashes of the documents stored in the collection under the ids of the
+// batch, by id
+func storedHashes(ctx context.Context, collection *mongo.Collection, documents []keyedDocument) (map[interface{}]string, error) {
+	ids := make([]interface{}, 0, len(documents))
+	for _, document := range documents {
+		ids = append(ids, document.id)
+	}
+
+	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}, hashField: bson.M{"$exists": true}},
+		options.Find().SetProjection(bson.M{hashField: 1}))
+	if err != nil {
+		return nil, err
+	}
+	stored := []bson.M{}
+	err = cursor.All(ctx, &stored)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make(map[interface{}]string, len(stored))
+	for _, document := range stored {
+		hash, _ := document[hashField].(string)
+		hashes[document["_id"]] = hash
+	}
+
+	return hashes, nil
+}
+
+// checkHashes recomputes the hash of a sample of the documents in the collection, a document
+// lacking its hash or not matching it was not stored the way it was imported
+func checkHashes(ctx context.Context, collection *mongo.Collection) error {
+	cursor, err := collection.Aggregate(ctx, NewPipeline().Stage("$sample", bson.M{"size": hashSamples}).Stages())
+	if err != nil {
+		return err
+	}
+	sampled := []bson.M{}
+	err = cursor.All(ctx, &sampled)
+	if err != nil {
+		return err
+	}
+
+	for _, document := range sampled {
+		if document[hashField] != documentHash(document) {
+			return fmt.Errorf("%s: document %v does not match its hash", collection.Name(), document["_id"])
+		}
+	}
+
+	return nil
+}
+
+// hashedCollections are the imported collections whose documents carry their hash
+var hashedCollections = []string{AirportsCollection, RunwaysCollection, FrequenciesCollection,
+	ReportingPointsCollection, NavaidsCollection, FixesCollection, AirspacesCollection}
+
+// hashDocuments stores the hash of the documents imported before they were hashed, in batches
+func (mongoClient *MongoClient) hashDocuments(ctx context.Context, base string) error {
+	collection := mongoClient.collection(base)
+
+	cursor, err := collection.Find(ctx, bson.M{hashField: bson.M{"$exists": false}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	models := []mongo.WriteModel{}
+	for cursor.Next(ctx) {
+		document := bson.M{}
+		err = cursor.Decode(&document)
+		if err != nil {
+			return err
+		}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": document["_id"]}).
+			SetUpdate(bson.M{"$set": bson.M{hashField: documentHash(document)}}))
+
+		if len(models) == importBatchSize {
+			_, err = collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+			if err != nil {
+				return err
+			}
+			models = []mongo.WriteModel{}
+		}
+	}
+	if cursor.Err() != nil {
+		return cursor.Err()
+	}
+	if len(models) > 0 {
+		_, err = collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	}
+
+	return err
+}
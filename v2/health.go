@@ -0,0 +1,247 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// healthReconnectFailures is the number of failed checks in a row after which the client of
+// the component is rebuilt
+const healthReconnectFailures = 3
+
+// The components watched by the health monitor
+const (
+	HealthDatabase = "database"
+	HealthStorage  = "storage"
+)
+
+// ComponentHealth is the state of a connection as last seen by the health monitor
+type ComponentHealth struct {
+	Name        string    `json:"name"`
+	Healthy     bool      `json:"healthy"`
+	Since       time.Time `json:"since"`
+	Checked     time.Time `json:"checked"`
+	Failures    int       `json:"failures"`
+	Transitions int64     `json:"transitions"`
+	Reconnects  int64     `json:"reconnects"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// healthCheck probes a component, reconnect rebuilds its client and may be nil
+type healthCheck struct {
+	name      string
+	check     func(ctx context.Context) error
+	reconnect func() error
+}
+
+func (appContext *AppContext) healthChecks(database *databaseCheck) []healthCheck {
+	return []healthCheck{
+		{HealthDatabase, database.check, database.reconnect},
+		{HealthStorage, appContext.healthStorage, func() error {
+			return appContext.connectMinio(appContext.storageOptions)
+		}},
+	}
+}
+
+// databaseCheck keeps the client of the database check from one check to the next, it is only
+// rebuilt once the check keeps failing
+type databaseCheck struct {
+	appContext  *AppContext
+	mongoClient *MongoClient
+}
+
+// check connects on the first check and pings
+func (database *databaseCheck) check(ctx context.Context) error {
+	if database.mongoClient == nil {
+		mongoClient, err := database.appContext.DBOpen()
+		if err != nil {
+			return err
+		}
+		database.mongoClient = mongoClient
+	}
+
+	return database.mongoClient.DBClient.Ping(ctx, nil)
+}
+
+func (database *databaseCheck) reconnect() error {
+	database.close()
+
+	mongoClient, err := database.appContext.DBOpen()
+	if err != nil {
+		return err
+	}
+	database.mongoClient = mongoClient
+
+	return nil
+}
+
+func (database *databaseCheck) close() {
+	if database.mongoClient != nil {
+		database.mongoClient.DBClose()
+		database.mongoClient = nil
+	}
+}
+
+// healthStorage checks the csv bucket is there, or the storage folder without an object store
+func (appContext *AppContext) healthStorage(ctx context.Context) error {
+	if appContext.S3Client() == nil {
+		if appContext.StorageDir == "" {
+			return nil
+		}
+		_, err := os.Stat(appContext.StorageDir)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	_, err := appContext.S3Client().BucketExists(ctx, "csv")
+	return err
+}
+
+// healthRecord stores the outcome of a check, returning the state when it changed
+func (appContext *AppContext) healthRecord(name string, err error) (*ComponentHealth, bool) {
+	appContext.healthMutex.Lock()
+	defer appContext.healthMutex.Unlock()
+
+	if appContext.health == nil {
+		appContext.health = map[string]*ComponentHealth{}
+	}
+
+	now := appContext.now()
+	health, found := appContext.health[name]
+	if !found {
+		health = &ComponentHealth{Name: name, Healthy: true, Since: now}
+		appContext.health[name] = health
+	}
+
+	health.Checked = now
+	health.Error = ""
+	if err != nil {
+		health.Failures++
+		health.Error = Redact(err.Error())
+	} else {
+		health.Failures = 0
+	}
+
+	changed := health.Healthy != (err == nil)
+	if changed {
+		health.Healthy = err == nil
+		health.Since = now
+		health.Transitions++
+	}
+
+	state := *health
+	return &state, changed
+}
+
+// healthCheckAll runs all checks once, reporting changes and rebuilding clients that keep failing
+func (appContext *AppContext) healthCheckAll(ctx context.Context, timeout time.Duration, database *databaseCheck) {
+	for _, check := range appContext.healthChecks(database) {
+		checkContext, cancel := context.WithTimeout(ctx, timeout)
+		err := check.check(checkContext)
+		cancel()
+
+		health, changed := appContext.healthRecord(check.name, err)
+		if changed {
+			appContext.healthChanged(health)
+		}
+
+		if err != nil && check.reconnect != nil && health.Failures%healthReconnectFailures == 0 {
+			logger := appContext.Logger().With("component", check.name)
+			err = check.reconnect()
+			if err != nil {
+				logger.With("error", err).Println("Health: reconnect failed")
+			} else {
+				logger.Println("Health: reconnected")
+			}
+
+			appContext.healthMutex.Lock()
+			appContext.health[check.name].Reconnects++
+			appContext.healthMutex.Unlock()
+		}
+	}
+}
+
+// healthChanged logs the new state and notifies the operators
+func (appContext *AppContext) healthChanged(health *ComponentHealth) {
+	state := "healthy"
+	if !health.Healthy {
+		state = "unhealthy"
+	}
+	appContext.Logger().With("component", health.Name, "state", state, "error", health.Error).Println("Health: state changed")
+
+	err := appContext.Notify(&Notification{
+		Topic:   "health",
+		Subject: fmt.Sprintf("%s is %s", health.Name, state),
+		Message: health.Error})
+	if err != nil {
+		appContext.LogError(err)
+	}
+}
+
+// HealthStart checks the database and object store at the given interval in the background
+func (appContext *AppContext) HealthStart(interval time.Duration) {
+	appContext.HealthStop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	appContext.healthCancel = cancel
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		// The client of the database check lives as long as the checks
+		database := &databaseCheck{appContext: appContext}
+		defer database.close()
+
+		appContext.healthCheckAll(ctx, interval, database)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				appContext.healthCheckAll(ctx, interval, database)
+			}
+		}
+	}()
+}
+
+// HealthStop ends the background checks
+func (appContext *AppContext) HealthStop() {
+	if appContext.healthCancel != nil {
+		appContext.healthCancel()
+		appContext.healthCancel = nil
+	}
+}
+
+// Health returns the state of the components as last checked, empty before the first check
+func (appContext *AppContext) Health() []*ComponentHealth {
+	appContext.healthMutex.Lock()
+	defer appContext.healthMutex.Unlock()
+
+	components := []*ComponentHealth{}
+	for _, health := range appContext.health {
+		state := *health
+		components = append(components, &state)
+	}
+	sort.Slice(components, func(i, j int) bool {
+		return components[i].Name < components[j].Name
+	})
+
+	return components
+}
+
+// Healthy tells whether all components passed their last check
+func (appContext *AppContext) Healthy() bool {
+	for _, health := range appContext.Health() {
+		if !health.Healthy {
+			return false
+		}
+	}
+
+	return true
+}
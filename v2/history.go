@@ -0,0 +1,296 @@
+package application
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AirportChange is a single field of an airport changed by an import, as stored in the history collection
+type AirportChange struct {
+	ChangeID  primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	AirportID int64              `bson:"airport_ref" json:"airport-id"`
+	Field     string             `bson:"field" json:"field"`
+	OldValue  interface{}        `bson:"old_value,omitempty" json:"old-value,omitempty"`
+	NewValue  interface{}        `bson:"new_value,omitempty" json:"new-value,omitempty"`
+	Version   string             `bson:"version" json:"version"`
+	Changed   time.Time          `bson:"changed" json:"changed"`
+}
+
+// FieldAdded is the field of the change recording an airport new to the dataset
+const FieldAdded = "(added)"
+
+// FieldRemoved is the field of the change recording an airport dropped from the dataset
+const FieldRemoved = "(removed)"
+
+func (mongoClient *MongoClient) history() *mongo.Collection {
+	return mongoClient.collection(HistoryCollection)
+}
+
+// diffDocuments lists the fields that differ between two documents in a stable order, leaving
+// out their hashes
+func diffDocuments(oldDocument bson.M, newDocument bson.M) []string {
+	fields := []string{}
+
+	for field, oldValue := range oldDocument {
+		if field != hashField && !reflect.DeepEqual(oldValue, newDocument[field]) {
+			fields = append(fields, field)
+		}
+	}
+	for field := range newDocument {
+		_, found := oldDocument[field]
+		if !found && field != hashField {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	return fields
+}
+
+// ensureHistoryIndexes creates the indexes of the history on the collection, for the timeline
+// of an airport and for the changes since an import
+func (mongoClient *MongoClient) ensureHistoryIndexes(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "airport_ref", Value: 1}, {Key: "changed", Value: 1}}},
+		{Keys: bson.D{{Key: "changed", Value: 1}}}})
+
+	return err
+}
+
+// recordHistory compares the imported airports with those stored and keeps the differences,
+// it returns the number of changes recorded. New airports are recorded as added, except by
+// the first import, which adds them all.
+func (mongoClient *MongoClient) recordHistory(ctx context.Context, documents []keyedDocument, version string) (int64, error) {
+	changes, err := mongoClient.airportChanges(ctx, documents, version)
+	if err != nil {
+		return 0, err
+	}
+
+	return mongoClient.insertChanges(ctx, changes)
+}
+
+// airportChanges compares the airports with those stored and returns the differences as
+// changes, to be inserted once the airports are in
+func (mongoClient *MongoClient) airportChanges(ctx context.Context, documents []keyedDocument, version string) ([]interface{}, error) {
+	imported, err := mongoClient.datasets().CountDocuments(ctx, bson.M{"_id": mongoClient.appContext.AirportsSource.Name()})
+	if err != nil {
+		return nil, err
+	}
+
+	changed := mongoClient.appContext.now()
+	changes := []interface{}{}
+	for start := 0; start < len(documents); start += importBatchSize {
+		end := start + importBatchSize
+		if end > len(documents) {
+			end = len(documents)
+		}
+
+		storedByID, err := mongoClient.storedAirports(ctx, documents[start:end])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, document := range documents[start:end] {
+			airportID, _ := document.id.(int64)
+			oldDocument, found := storedByID[document.id]
+			if !found {
+				if imported > 0 {
+					changes = append(changes, &AirportChange{
+						AirportID: airportID, Field: FieldAdded, Version: version, Changed: changed})
+				}
+				continue
+			}
+			newDocument, err := hashedDocument(document.document)
+			if err != nil {
+				return nil, err
+			}
+
+			// An airport with the hash it was stored with did not change
+			if oldDocument[hashField] == newDocument[hashField] {
+				continue
+			}
+
+			for _, field := range diffDocuments(oldDocument, newDocument) {
+				changes = append(changes, &AirportChange{
+					AirportID: airportID,
+					Field:     field,
+					OldValue:  oldDocument[field],
+					NewValue:  newDocument[field],
+					Version:   version,
+					Changed:   changed})
+			}
+		}
+	}
+
+	return changes, nil
+}
+
+// insertChanges stores the changes in the history in batches, it returns the number of
+// changes recorded
+func (mongoClient *MongoClient) insertChanges(ctx context.Context, changes []interface{}) (int64, error) {
+	var recorded int64
+
+	if len(changes) == 0 {
+		return 0, nil
+	}
+	err := mongoClient.ensureHistoryIndexes(ctx, mongoClient.history())
+	if err != nil {
+		return 0, err
+	}
+
+	for start := 0; start < len(changes); start += importBatchSize {
+		end := start + importBatchSize
+		if end > len(changes) {
+			end = len(changes)
+		}
+
+		_, err = mongoClient.history().InsertMany(ctx, changes[start:end])
+		if err != nil {
+			return recorded, err
+		}
+		recorded += int64(end - start)
+	}
+
+	return recorded, nil
+}
+
+// removalChanges returns the changes recording the airports as removed from the dataset
+func (mongoClient *MongoClient) removalChanges(airportIDs []interface{}, version string) []interface{} {
+	changed := mongoClient.appContext.now()
+	changes := make([]interface{}, 0, len(airportIDs))
+	for _, id := range airportIDs {
+		airportID, _ := id.(int64)
+		changes = append(changes, &AirportChange{
+			AirportID: airportID, Field: FieldRemoved, Version: version, Changed: changed})
+	}
+
+	return changes
+}
+
+// recordRemovals records the airports as removed from the dataset, it returns the number of
+// changes recorded
+func (mongoClient *MongoClient) recordRemovals(ctx context.Context, airportIDs []interface{}, version string) (int64, error) {
+	return mongoClient.insertChanges(ctx, mongoClient.removalChanges(airportIDs, version))
+}
+
+// shadowRemovals returns the ids of the live airports missing from the shadow collection
+func (mongoClient *MongoClient) shadowRemovals(ctx context.Context, shadow *mongo.Collection) ([]interface{}, error) {
+	removed := []interface{}{}
+
+	cursor, err := mongoClient.airports().Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	ids := make([]interface{}, 0, importBatchSize)
+	flush := func() error {
+		kept, err := shadow.Distinct(ctx, "_id", bson.M{"_id": bson.M{"$in": ids}})
+		if err != nil {
+			return err
+		}
+		found := make(map[interface{}]bool, len(kept))
+		for _, id := range kept {
+			found[id] = true
+		}
+		for _, id := range ids {
+			if !found[id] {
+				removed = append(removed, id)
+			}
+		}
+		ids = ids[:0]
+
+		return nil
+	}
+
+	for cursor.Next(ctx) {
+		var document struct {
+			ID interface{} `bson:"_id"`
+		}
+		err = cursor.Decode(&document)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, document.ID)
+		if len(ids) == importBatchSize {
+			err = flush()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if cursor.Err() != nil {
+		return nil, cursor.Err()
+	}
+	if len(ids) > 0 {
+		err = flush()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return removed, nil
+}
+
+// storedAirports reads the live airports with the ids of the documents, by id
+func (mongoClient *MongoClient) storedAirports(ctx context.Context, documents []keyedDocument) (map[interface{}]bson.M, error) {
+	ids := make([]interface{}, 0, len(documents))
+	for _, document := range documents {
+		ids = append(ids, document.id)
+	}
+
+	cursor, err := mongoClient.airports().Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	stored := []bson.M{}
+	err = cursor.All(ctx, &stored)
+	if err != nil {
+		return nil, err
+	}
+
+	storedByID := make(map[interface{}]bson.M, len(stored))
+	for _, document := range stored {
+		storedByID[document["_id"]] = document
+	}
+
+	return storedByID, nil
+}
+
+// roundTrip gives a document the same shape as one read back from the database
+func roundTrip(document interface{}) (bson.M, error) {
+	data, err := bson.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+
+	result := bson.M{}
+	err = bson.Unmarshal(data, &result)
+
+	return result, err
+}
+
+// History returns the timeline of changes made to an airport by the imports, oldest first
+func (mongoClient *MongoClient) History(ctx context.Context, airportID int64) ([]*AirportChange, error) {
+
+	cursor, err := mongoClient.history().Find(ctx, bson.M{"airport_ref": airportID},
+		options.Find().SetSort(bson.D{{Key: "changed", Value: 1}, {Key: "field", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*AirportChange{}
+	err = cursor.All(ctx, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
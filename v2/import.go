@@ -0,0 +1,617 @@
+package application
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/ralph-nijpels/geography-application/v2/units"
+)
+
+// importBatchSize is the number of documents written to Mongo in one go, and the default
+// number of rows an import holds in memory
+const importBatchSize = 1000
+
+// keyedDocument is a document to upsert together with its key
+type keyedDocument struct {
+	id       interface{}
+	document interface{}
+}
+
+// sourceFile is a downloaded source, kept in a temporary file so it can be streamed, with the
+// name of the snapshot kept of it if there is one. A file in a workspace is kept when closed,
+// the workspace removes it.
+type sourceFile struct {
+	*os.File
+	snapshot string
+	keep     bool
+}
+
+// Close closes and removes the temporary file
+func (file *sourceFile) Close() error {
+	err := file.File.Close()
+	if !file.keep {
+		os.Remove(file.Name())
+	}
+
+	return err
+}
+
+// openSource opens a source at a http(s) URL, or a local file given by path or file URL
+func openSource(ctx context.Context, sourceURL string) (io.ReadCloser, error) {
+
+	location, err := url.Parse(sourceURL)
+	if err != nil {
+		return nil, err
+	}
+	if location.Scheme == "" || location.Scheme == "file" {
+		if location.Scheme == "file" {
+			return os.Open(location.Path)
+		}
+		return os.Open(sourceURL)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, fmt.Errorf("%s: %s", sourceURL, response.Status)
+	}
+
+	return response.Body, nil
+}
+
+// fetchSource downloads a source file and keeps a snapshot of it in the csv bucket
+func (appContext *AppContext) fetchSource(ctx context.Context, source string, sourceURL string, extension string, report *RunReport) (*sourceFile, error) {
+
+	body, err := openSource(ctx, sourceURL)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return appContext.storeSource(ctx, source, extension, body, report)
+}
+
+// storeSource keeps the data of a source in a temporary file and a snapshot of it in the csv
+// bucket, so the source is never held in memory. The file is positioned at the start.
+func (appContext *AppContext) storeSource(ctx context.Context, source string, extension string, data io.Reader, report *RunReport) (*sourceFile, error) {
+
+	file, err := report.Workspace().TempFile(source + "-*" + extension)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+	var lines lineCounter
+	size, err := io.Copy(io.MultiWriter(file, hash, &lines), &contextReader{ctx: ctx, reader: data})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	version := hex.EncodeToString(hash.Sum(nil))
+	report.setVersion(source, version)
+	report.AddUsage(source, ResourceUsage{Downloaded: size})
+
+	tags := ObjectTags{TagRunID: report.RunID, TagSource: source, TagVersion: version}
+	if extension == ".csv" && lines > 0 {
+		// Lines rather than records, a quoted field may span lines but the sources rarely do
+		tags[TagRows] = strconv.FormatInt(int64(lines)-1, 10)
+	}
+
+	snapshotName := fmt.Sprintf("%s-%s%s", source, appContext.now().Format(snapshotLayout), extension)
+	_, err = file.Seek(0, io.SeekStart)
+	if err == nil {
+		err = appContext.putObject(ctx, "csv", snapshotName, file, size, tags.putOptions(mime.TypeByExtension(extension)))
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	file.snapshot = snapshotName
+	// The snapshot was stored under the key, so the tenant is known to be fine
+	key, _ := appContext.objectKey(ctx, snapshotName)
+	report.addObject("csv", key)
+	report.AddUsage(source, ResourceUsage{Uploaded: size})
+
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// parseInt reads an optional integer column
+func parseInt(record map[string]string, column string) (int64, error) {
+	if record[column] == "" {
+		return 0, nil
+	}
+
+	value, err := strconv.ParseInt(record[column], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", column, record[column])
+	}
+
+	return value, nil
+}
+
+// parseFloat reads an optional decimal column
+func parseFloat(record map[string]string, column string) (float64, error) {
+	if record[column] == "" {
+		return 0, nil
+	}
+
+	value, err := strconv.ParseFloat(record[column], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", column, record[column])
+	}
+
+	return value, nil
+}
+
+// parseFlag reads an optional 0/1 column
+func parseFlag(record map[string]string, column string) (bool, error) {
+	if record[column] == "" {
+		return false, nil
+	}
+
+	value, err := strconv.ParseBool(record[column])
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q", column, record[column])
+	}
+
+	return value, nil
+}
+
+// airportFromRecord converts a row of the airports source, deriving the normalized fields
+func airportFromRecord(record map[string]string) (*Airport, error) {
+	var err error
+	airport := Airport{
+		Ident:         record["ident"],
+		Name:          record["name"],
+		Country:       NormalizeCode(record["iso_country"]),
+		Region:        NormalizeCode(record["iso_region"]),
+		Municipality:  record["municipality"],
+		GPSCode:       NormalizeCode(record["gps_code"]),
+		ICAOCode:      NormalizeCode(record["icao_code"]),
+		IATACode:      NormalizeCode(record["iata_code"]),
+		LocalCode:     NormalizeCode(record["local_code"]),
+		HomeLink:      record["home_link"],
+		WikipediaLink: record["wikipedia_link"],
+		Keywords:      record["keywords"]}
+
+	airport.Names = alternateNames(airport.Name, airport.Keywords)
+	airport.Tokens = keywordTokens(airport.Keywords)
+
+	airport.AirportID, err = parseInt(record, "id")
+	if err != nil {
+		return nil, err
+	}
+	airport.Type, err = ParseAirportType(record["type"])
+	if err != nil {
+		return nil, err
+	}
+	airport.Location, err = ParseCoordinate(record["latitude_deg"], record["longitude_deg"])
+	if err != nil {
+		return nil, err
+	}
+	elevation, err := parseFloat(record, "elevation_ft")
+	if err != nil {
+		return nil, err
+	}
+	airport.Elevation = units.LengthFeet(elevation)
+	airport.Continent, err = ParseContinent(record["continent"])
+	if err != nil {
+		return nil, err
+	}
+	airport.ScheduledService, err = ParseScheduledService(record["scheduled_service"])
+	if err != nil {
+		return nil, err
+	}
+
+	return &airport, nil
+}
+
+// bulkUpsert replaces or inserts the documents in batches, reporting rejected documents as errors.
+// Every document is stored with its hash, those whose hash did not change are not written again
+// but count as upserted. The batches are slowed down by the import throttle while the database
+// is slow.
+func (mongoClient *MongoClient) bulkUpsert(ctx context.Context, collection *mongo.Collection, documents []keyedDocument, report *RunReport) (int64, error) {
+	appContext := mongoClient.appContext
+	var upserted int64
+
+	for start := 0; start < len(documents); start += importBatchSize {
+		if ctx.Err() != nil {
+			return upserted, ctx.Err()
+		}
+		end := start + importBatchSize
+		if end > len(documents) {
+			end = len(documents)
+		}
+
+		hashes, err := storedHashes(ctx, collection, documents[start:end])
+		if err != nil {
+			return upserted, err
+		}
+		models := make([]mongo.WriteModel, 0, end-start)
+		for _, document := range documents[start:end] {
+			hashed, err := hashedDocument(document.document)
+			if err != nil {
+				return upserted, err
+			}
+			if hashes[document.id] == hashed[hashField] {
+				upserted++
+				continue
+			}
+			models = append(models, mongo.NewReplaceOneModel().
+				SetFilter(bson.M{"_id": document.id}).
+				SetReplacement(hashed).
+				SetUpsert(true))
+		}
+		if len(models) == 0 {
+			continue
+		}
+
+		err = appContext.throttleBatch(ctx, report)
+		if err != nil {
+			return upserted, err
+		}
+
+		started := time.Now()
+		result, err := collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+		appContext.observeBatch(collection.Name(), time.Since(started))
+		if result != nil {
+			upserted += result.MatchedCount + result.UpsertedCount
+		}
+
+		// Documents violating a unique index are reported, the rest of the batch stands
+		bulkErr, isBulkErr := err.(mongo.BulkWriteException)
+		if isBulkErr && bulkErr.WriteConcernError == nil {
+			for _, writeErr := range bulkErr.WriteErrors {
+				report.AddError(fmt.Errorf("%s: %s", collection.Name(), writeErr.Message))
+			}
+			report.AddCount(countRefused+collection.Name(), int64(len(bulkErr.WriteErrors)))
+			continue
+		}
+		if err != nil {
+			return upserted, err
+		}
+	}
+
+	return upserted, nil
+}
+
+// maxImportKeys bounds the keys an import remembers to find duplicates, a source with more
+// records has its later duplicates upserted over the earlier ones instead
+const maxImportKeys = 250000
+
+// keySet remembers the keys of the records read so far by their hash, up to maxImportKeys
+type keySet map[uint64]struct{}
+
+// seen tells whether the key was seen before, remembering it if there is room
+func (keys keySet) seen(key string) bool {
+	hash := fnv.New64a()
+	hash.Write([]byte(key))
+	sum := hash.Sum64()
+
+	_, found := keys[sum]
+	if !found && len(keys) < maxImportKeys {
+		keys[sum] = struct{}{}
+	}
+
+	return found
+}
+
+// importSource streams a source and hands the converted records to store in batches, so only
+// a few batches are held in memory. A record converted to nil is left out. Records that cannot
+// be converted are reported and skipped, or abort the import when too many are rejected; the
+// batches stored before stay, which is why the airports can be imported into a shadow
+// collection. With strict validation the batches are held until the whole source passed, so
+// a bad record aborts the import before anything is stored, and the import does not pause. The
+// enrichers of the source run on the converted documents. The batch size, number of batches
+// stored at the same time and validation are set per source. Run by a job the import pauses at
+// the end of a batch when asked to, and resumes after the records stored before the pause.
+// Live is the number of records in the collection imported into, nothing is stored when the
+// source shrank too much compared to it.
+func (appContext *AppContext) importSource(ctx context.Context, report *RunReport, source Source, live int64,
+	convert func(record map[string]string) (*keyedDocument, error), store func(batch []keyedDocument) (int64, error)) (int64, error) {
+	var stored int64
+	settings := appContext.sourceImport(source.Name())
+	started := time.Now()
+	defer func() {
+		report.AddUsage(source.Name(), ResourceUsage{Duration: time.Since(started)})
+	}()
+
+	report.StageStart("download")
+	file, err := source.Fetch(ctx, appContext, report)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	report.StageEnd("download", 0)
+
+	err = checkShrink(ctx, source, file, settings.MaxShrinkPercent, live)
+	if err != nil {
+		return 0, err
+	}
+
+	report.StageStart("import")
+	reader, err := source.Parse(file)
+	if err != nil {
+		return 0, err
+	}
+
+	// A resumed import skips what it read before, which is the same as long as the version is
+	control := jobControlFrom(ctx)
+	var skip int64
+	checkpoint := control.checkpoint(source.Name(), report.Versions[source.Name()])
+	if checkpoint != nil {
+		skip = checkpoint.Read
+		stored = checkpoint.Stored
+		report.AddCount("resumed:"+source.Name(), skip)
+	}
+
+	// Batches are stored in line unless the source has more workers
+	var group *WorkerGroup
+	if settings.Workers > 1 {
+		group, ctx = appContext.NewWorkerGroup(ctx, source.Name()+"-import", settings.Workers)
+	}
+	flush := func(batch []keyedDocument) error {
+		report.AddUsage(source.Name(), ResourceUsage{MongoOps: int64(len(batch))})
+		if group == nil {
+			n, err := store(batch)
+			atomic.AddInt64(&stored, n)
+			return err
+		}
+		group.Go(func(ctx context.Context) error {
+			n, err := store(batch)
+			atomic.AddInt64(&stored, n)
+			return err
+		})
+		return ctx.Err()
+	}
+	var read, rejected, accepted int64
+	finish := func(err error) (int64, error) {
+		report.AddCount(countRead+source.Name(), read)
+		report.AddCount(countRejected+source.Name(), rejected)
+		report.AddCount(countAccepted+source.Name(), accepted)
+		if group != nil {
+			groupErr := group.Wait()
+			if groupErr != nil {
+				err = groupErr
+			}
+		}
+		return atomic.LoadInt64(&stored), err
+	}
+	tooManyRejected := func() error {
+		return fmt.Errorf("%s: %d of %d records rejected, more than %g%%",
+			source.Name(), rejected, read, settings.MaxRejectedPercent)
+	}
+	reject := func(err error) error {
+		report.AddError(err)
+		rejected++
+		if settings.Validation == ValidationStrict {
+			return fmt.Errorf("strict validation: %v", err)
+		}
+		if settings.tooManyRejected(rejected, read, false) {
+			return tooManyRejected()
+		}
+		return nil
+	}
+
+	strict := settings.Validation == ValidationStrict
+	held := [][]keyedDocument{}
+	batch := make([]keyedDocument, 0, settings.BatchRows)
+	keys := keySet{}
+	for reader.Next() {
+		if ctx.Err() != nil {
+			return finish(ctx.Err())
+		}
+		read++
+		record := reader.Record()
+		key := source.Key(record)
+		if keys.seen(key) {
+			err = reject(fmt.Errorf("%s line %d: duplicate key %s", source.Name(), reader.Line(), key))
+			if err != nil {
+				return finish(err)
+			}
+			continue
+		}
+		if read <= skip {
+			continue
+		}
+
+		document, err := convert(record)
+		if err != nil {
+			err = reject(fmt.Errorf("%s line %d: %v", source.Name(), reader.Line(), err))
+			if err != nil {
+				return finish(err)
+			}
+			continue
+		}
+		if document == nil {
+			continue
+		}
+		enriched, err := appContext.enrich(ctx, source.Name(), document.document)
+		if err != nil {
+			err = reject(fmt.Errorf("%s line %d: %v", source.Name(), reader.Line(), err))
+			if err != nil {
+				return finish(err)
+			}
+			continue
+		}
+		if enriched == nil {
+			report.AddCount("dropped", 1)
+			continue
+		}
+		if reflect.TypeOf(enriched) != reflect.TypeOf(document.document) {
+			return finish(fmt.Errorf("%s enricher returned %T instead of %T", source.Name(), enriched, document.document))
+		}
+		batch = append(batch, keyedDocument{id: document.id, document: enriched})
+		accepted++
+
+		if len(batch) == settings.BatchRows && strict {
+			held = append(held, batch)
+			batch = make([]keyedDocument, 0, settings.BatchRows)
+			continue
+		}
+		if len(batch) == settings.BatchRows {
+			err = flush(batch)
+			if err != nil {
+				return finish(err)
+			}
+			batch = make([]keyedDocument, 0, settings.BatchRows)
+
+			if control.pauseRequested() {
+				n, err := finish(ErrPaused)
+				if err == ErrPaused {
+					control.stop(source.Name(), &ImportCheckpoint{Version: report.Versions[source.Name()], Read: read, Stored: n})
+				}
+				return n, err
+			}
+		}
+	}
+	if reader.Err() != nil {
+		return finish(reader.Err())
+	}
+	if settings.tooManyRejected(rejected, read, true) {
+		return finish(tooManyRejected())
+	}
+	for _, heldBatch := range held {
+		err = flush(heldBatch)
+		if err != nil {
+			return finish(err)
+		}
+	}
+	if len(batch) > 0 {
+		err = flush(batch)
+		if err != nil {
+			return finish(err)
+		}
+	}
+	n, err := finish(nil)
+	if err != nil {
+		return n, err
+	}
+	report.StageEnd("import", n)
+
+	return n, nil
+}
+
+// importAirports streams the airports source with the local overrides applied and hands the
+// airports to store in batches, unless the source shrank too much compared to the live count
+func (mongoClient *MongoClient) importAirports(ctx context.Context, report *RunReport, live int64, store func(batch []keyedDocument) (int64, error)) (int64, error) {
+	appContext := mongoClient.appContext
+
+	// Local corrections go on top, so an import never undoes them
+	overrides, err := mongoClient.airportOverrides(ctx, report)
+	if err != nil {
+		return 0, err
+	}
+
+	return appContext.importSource(ctx, report, appContext.AirportsSource, live, func(record map[string]string) (*keyedDocument, error) {
+		report.AddCount("overrides", applyOverrides([]map[string]string{record}, overrides))
+		airport, err := airportFromRecord(record)
+		if err != nil {
+			return nil, err
+		}
+		if appContext.dropsClosed(airport) {
+			report.AddCount("closed-dropped", 1)
+			return nil, nil
+		}
+		report.AddAirportType(airport.Type)
+
+		return &keyedDocument{id: airport.AirportID, document: airport}, nil
+	}, store)
+}
+
+// storeAirports returns a store function for importAirports that records the history
+// of the airports and upserts them in the given collection
+func (mongoClient *MongoClient) storeAirports(ctx context.Context, report *RunReport, collection *mongo.Collection) func(batch []keyedDocument) (int64, error) {
+	return func(batch []keyedDocument) (int64, error) {
+		changes, err := mongoClient.recordHistory(ctx, batch, report.Versions[mongoClient.appContext.AirportsSource.Name()])
+		if err != nil {
+			return 0, err
+		}
+		report.AddCount("history", changes)
+
+		return mongoClient.bulkUpsert(ctx, collection, batch, report)
+	}
+}
+
+// ImportAirports downloads the airports source, keeps a snapshot in the csv bucket and upserts
+// all airports, with the local overrides applied and the scheduled service and continent
+// normalized on the way. When approval is required the load is only staged, like with
+// ImportAirportsSwap, Approve puts it live.
+func (mongoClient *MongoClient) ImportAirports(ctx context.Context, report *RunReport) error {
+	appContext := mongoClient.appContext
+
+	if appContext.RequireApproval {
+		_, err := mongoClient.StageAirports(ctx, report)
+		return err
+	}
+
+	err := appContext.CheckWritable()
+	if err != nil {
+		return err
+	}
+
+	err = mongoClient.EnsureAirportIndexes(ctx)
+	if err != nil {
+		return err
+	}
+	err = mongoClient.EnsureRunwayIndexes(ctx)
+	if err != nil {
+		return err
+	}
+	// A truncated download is measured against the airports there are now
+	live, err := mongoClient.countAirports(ctx, mongoClient.airports())
+	if err != nil {
+		return err
+	}
+	_, err = mongoClient.importAirports(ctx, report, live, mongoClient.storeAirports(ctx, report, mongoClient.airports()))
+	if err != nil {
+		return err
+	}
+	err = mongoClient.removeClosed(ctx, report)
+	if err != nil {
+		return err
+	}
+
+	err = mongoClient.recordDataset(ctx, appContext.AirportsSource.Name(), report)
+	if err != nil {
+		return err
+	}
+	err = mongoClient.RefreshViews(ctx)
+	if err != nil {
+		return err
+	}
+	appContext.CacheReset()
+
+	return nil
+}
@@ -0,0 +1,357 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// JobStatus is the state of a job in the queue
+type JobStatus string
+
+// The states a job moves through
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobCancelled JobStatus = "cancelled"
+	JobPaused    JobStatus = "paused"
+)
+
+// defaultJobAttempts is the number of times a job is tried before it fails
+const defaultJobAttempts = 3
+
+// ErrIdempotencyConflict is returned when an idempotency key is reused for a different job
+var ErrIdempotencyConflict = errors.New("idempotency key used for a different job")
+
+// Job describes a long running operation as stored in the jobs collection
+type Job struct {
+	JobID           primitive.ObjectID           `bson:"_id" json:"id"`
+	Kind            string                       `bson:"kind" json:"kind"`
+	Params          map[string]string            `bson:"params" json:"params"`
+	Status          JobStatus                    `bson:"status" json:"status"`
+	Attempts        int                          `bson:"attempts" json:"attempts"`
+	MaxAttempts     int                          `bson:"max_attempts" json:"max-attempts"`
+	Priority        JobPriority                  `bson:"priority" json:"priority"`
+	Error           string                       `bson:"error,omitempty" json:"error,omitempty"`
+	Key             string                       `bson:"idempotency_key,omitempty" json:"idempotency-key,omitempty"`
+	CancelRequested bool                         `bson:"cancel_requested,omitempty" json:"cancel-requested,omitempty"`
+	PauseRequested  bool                         `bson:"pause_requested,omitempty" json:"pause-requested,omitempty"`
+	Checkpoints     map[string]*ImportCheckpoint `bson:"checkpoints,omitempty" json:"checkpoints,omitempty"`
+	Created         time.Time                    `bson:"created" json:"created"`
+	Updated         time.Time                    `bson:"updated" json:"updated"`
+}
+
+// JobHandler executes a job of a specific kind
+type JobHandler func(ctx context.Context, job *Job) error
+
+// JobWorker polls the jobs collection and executes the jobs it has handlers for
+type JobWorker struct {
+	appContext *AppContext
+	handlers   map[string]JobHandler
+	interval   time.Duration
+	cancel     context.CancelFunc
+	done       sync.WaitGroup
+}
+
+func (mongoClient *MongoClient) jobs() *mongo.Collection {
+	return mongoClient.collection(JobsCollection)
+}
+
+// JobEnqueue adds a job of the given kind to the queue
+func (mongoClient *MongoClient) JobEnqueue(ctx context.Context, kind string, params map[string]string) (*Job, error) {
+
+	err := mongoClient.appContext.CheckWritable()
+	if err != nil {
+		return nil, err
+	}
+
+	return mongoClient.enqueue(ctx, kind, params, "")
+}
+
+// enqueue inserts a queued job with the priority of the context, under the idempotency key
+// when not empty
+func (mongoClient *MongoClient) enqueue(ctx context.Context, kind string, params map[string]string, key string) (*Job, error) {
+	now := mongoClient.appContext.now()
+	job := Job{
+		JobID:       mongoClient.appContext.newID(),
+		Kind:        kind,
+		Params:      params,
+		Status:      JobQueued,
+		MaxAttempts: defaultJobAttempts,
+		Priority:    jobPriority(ctx),
+		Key:         key,
+		Created:     now,
+		Updated:     now}
+
+	_, err := mongoClient.jobs().InsertOne(ctx, &job)
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// EnsureJobIndexes creates the index making idempotency keys unique, and the one the workers
+// claim jobs by. The server creates them when it starts, geoctl migrate otherwise.
+func (mongoClient *MongoClient) EnsureJobIndexes(ctx context.Context) error {
+	err := mongoClient.appContext.CheckWritable()
+	if err != nil {
+		return err
+	}
+
+	return mongoClient.ensureJobIndexes(ctx, mongoClient.jobs())
+}
+
+// ensureJobIndexes creates the indexes of the jobs on the collection
+func (mongoClient *MongoClient) ensureJobIndexes(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "idempotency_key", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"idempotency_key": bson.M{"$gt": ""}})},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "priority", Value: -1}, {Key: "created", Value: 1}}},
+	})
+
+	return err
+}
+
+// sameParams compares job parameters, where nil and empty are the same
+func sameParams(a map[string]string, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		other, found := b[key]
+		if !found || other != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// JobEnqueueOnce adds a job unless one with the same idempotency key exists, in which case that
+// job is returned, so retried or concurrent triggers of the same import start it only once.
+// The boolean tells whether the job was added.
+func (mongoClient *MongoClient) JobEnqueueOnce(ctx context.Context, kind string, params map[string]string, key string) (*Job, bool, error) {
+	if key == "" {
+		job, err := mongoClient.JobEnqueue(ctx, kind, params)
+		return job, err == nil, err
+	}
+
+	err := mongoClient.appContext.CheckWritable()
+	if err != nil {
+		return nil, false, err
+	}
+
+	job, err := mongoClient.enqueue(ctx, kind, params, key)
+	if err == nil {
+		return job, true, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil, false, err
+	}
+
+	var existing Job
+	err = mongoClient.jobs().FindOne(ctx, bson.M{"idempotency_key": key}).Decode(&existing)
+	if err != nil {
+		return nil, false, err
+	}
+	if existing.Kind != kind || !sameParams(existing.Params, params) {
+		return nil, false, ErrIdempotencyConflict
+	}
+
+	return &existing, false, nil
+}
+
+// Job retrieves a job by its ID, so clients can poll its status
+func (mongoClient *MongoClient) Job(ctx context.Context, jobID string) (*Job, error) {
+
+	objectID, err := primitive.ObjectIDFromHex(jobID)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	var job Job
+	err = mongoClient.jobs().FindOne(ctx, bson.M{"_id": objectID}).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// jobClaim marks the oldest queued job of the given kinds with the highest priority as running
+func (mongoClient *MongoClient) jobClaim(ctx context.Context, kinds []string) (*Job, error) {
+
+	var job Job
+	err := mongoClient.jobs().FindOneAndUpdate(ctx,
+		bson.M{"status": JobQueued, "kind": bson.M{"$in": kinds}},
+		bson.M{
+			"$set": bson.M{"status": JobRunning, "updated": mongoClient.appContext.now()},
+			"$inc": bson.M{"attempts": 1}},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "priority", Value: -1}, {Key: "created", Value: 1}}).
+			SetReturnDocument(options.After)).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// jobFinish registers the outcome of a job, requeueing it if it has attempts left unless it was
+// cancelled. A paused job keeps its checkpoints and gets its attempt back.
+func (mongoClient *MongoClient) jobFinish(ctx context.Context, job *Job, jobErr error, control *jobControl) error {
+
+	job.Status = JobSucceeded
+	job.Error = ""
+	job.PauseRequested = false
+	job.Checkpoints = nil
+	if jobErr != nil {
+		job.Error = jobErr.Error()
+		job.Status = JobFailed
+		if job.CancelRequested {
+			job.Status = JobCancelled
+		} else if job.Attempts < job.MaxAttempts {
+			job.Status = JobQueued
+		}
+	}
+	if jobErr != nil && !job.CancelRequested && control.paused {
+		job.Status = JobPaused
+		job.Attempts--
+		job.Checkpoints = control.checkpoints
+	}
+	job.Updated = mongoClient.appContext.now()
+
+	_, err := mongoClient.jobs().UpdateOne(ctx,
+		bson.M{"_id": job.JobID},
+		bson.M{"$set": bson.M{"status": job.Status, "error": job.Error, "updated": job.Updated, "attempts": job.Attempts,
+			"pause_requested": false, "checkpoints": job.Checkpoints}})
+
+	return err
+}
+
+// NewJobWorker creates a worker polling the queue at the given interval
+func (appContext *AppContext) NewJobWorker(interval time.Duration) *JobWorker {
+	return &JobWorker{
+		appContext: appContext,
+		handlers:   map[string]JobHandler{},
+		interval:   interval}
+}
+
+// Handle registers the handler for a kind of job, before the worker is started
+func (worker *JobWorker) Handle(kind string, handler JobHandler) {
+	worker.handlers[kind] = handler
+}
+
+// Start runs the worker loop in the background
+func (worker *JobWorker) Start() {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	worker.cancel = cancel
+
+	worker.done.Add(1)
+	go func() {
+		defer worker.done.Done()
+
+		ticker := time.NewTicker(worker.interval)
+		defer ticker.Stop()
+
+		for {
+			// Keep going while there is work
+			for worker.runNext(ctx) {
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop ends the worker loop and waits for the running job to finish
+func (worker *JobWorker) Stop() {
+	if worker.cancel == nil {
+		return
+	}
+
+	worker.cancel()
+	worker.done.Wait()
+	worker.cancel = nil
+}
+
+// runNext executes one job, returning false if there was nothing to do
+func (worker *JobWorker) runNext(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	kinds := make([]string, 0, len(worker.handlers))
+	for kind := range worker.handlers {
+		kinds = append(kinds, kind)
+	}
+
+	// The client claiming the job watches it and records the outcome as well
+	mongoClient, err := worker.appContext.DBOpen()
+	if err != nil {
+		log.Printf("Job worker: %v\n", err)
+		return false
+	}
+	defer mongoClient.DBClose()
+
+	job, err := mongoClient.jobClaim(ctx, kinds)
+	if err != nil {
+		log.Printf("Job worker: %v\n", err)
+		return false
+	}
+	if job == nil {
+		return false
+	}
+
+	// The handler stops when the job is cancelled, its context is done then, and its import
+	// pauses through the control, picking up from the checkpoints of an earlier pause
+	control := &jobControl{checkpoints: job.Checkpoints}
+	jobCtx, cancelJob := context.WithCancel(withJobControl(ctx, control))
+	stopWatch := worker.watchJob(jobCtx, mongoClient, job, cancelJob, control)
+	jobErr := worker.execute(jobCtx, job)
+	stopWatch()
+	cancelJob()
+
+	err = mongoClient.jobFinish(context.Background(), job, jobErr, control)
+	if err != nil {
+		log.Printf("Job worker: %v\n", err)
+		return false
+	}
+
+	return true
+}
+
+// execute runs the handler, turning a panic into an error
+func (worker *JobWorker) execute(ctx context.Context, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job %s panicked: %v", job.Kind, r)
+		}
+	}()
+
+	return worker.handlers[job.Kind](ctx, job)
+}
@@ -0,0 +1,72 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// errorMarker tags the lines written as errors, the error log collects those
+const errorMarker = "level=error"
+
+// logErrorsOptions describes the log-errors section of the options file
+type logErrorsOptions struct {
+	Enabled bool   `json:"enabled"`
+	Bucket  string `json:"bucket"`
+}
+
+// WithErrorLog keeps the error lines of a run in an errors object next to the full log, or
+// in the given bucket instead of the log bucket
+func WithErrorLog(bucket string) Option {
+	return func(appContext *AppContext) {
+		appContext.LogErrors = true
+		appContext.LogErrorsBucket = bucket
+	}
+}
+
+// logErrorLines copies the error lines to the error buffer, the log mutex must be held
+func (appContext *AppContext) logErrorLines(p []byte) {
+	if appContext.errorBuffer == nil {
+		return
+	}
+
+	for _, line := range strings.SplitAfter(string(p), "\n") {
+		if strings.Contains(line, errorMarker) {
+			appContext.errorBuffer.WriteString(line)
+		}
+	}
+}
+
+// logCloseErrors stores the error lines of the run as <log>-errors.txt, in the log bucket unless
+// configured otherwise, the log mutex must be held
+func (appContext *AppContext) logCloseErrors(logBase string) error {
+	errorBuffer := appContext.errorBuffer
+	appContext.errorBuffer = nil
+	if errorBuffer == nil || errorBuffer.Len() == 0 {
+		return nil
+	}
+
+	// A log written to stderr holds the error lines already
+	if appContext.S3Client() == nil && appContext.StorageDir == "" {
+		return nil
+	}
+
+	bucket := appContext.LogErrorsBucket
+	if bucket == "" {
+		bucket = "log"
+	}
+
+	err := appContext.ensureBucket(context.Background(), bucket)
+	logName := fmt.Sprintf("%s-errors.txt", logBase)
+	logData := errorBuffer.Bytes()
+	if err == nil {
+		err = appContext.storeLog(bucket, logName, logData)
+	}
+
+	// The spool only knows the log bucket, that beats losing the errors
+	if err != nil {
+		err = appContext.logSpool(logName, logData)
+	}
+
+	return err
+}
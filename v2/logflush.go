@@ -0,0 +1,118 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+)
+
+type logFlushOptions struct {
+	Minutes   int64 `json:"minutes"`
+	Megabytes int   `json:"megabytes"`
+}
+
+// logWriter collects the log in the buffer, flushing a part once it grows too large,
+// and passes every line on to the log sinks
+type logWriter struct {
+	appContext *AppContext
+}
+
+// WithLogFlush uploads the log in numbered parts every interval or whenever it exceeds
+// the given size, so a crashing run still leaves most of its log behind; zero disables either
+func WithLogFlush(interval time.Duration, size int) Option {
+	return func(appContext *AppContext) {
+		appContext.LogFlushInterval = interval
+		appContext.LogFlushBytes = size
+	}
+}
+
+func (writer *logWriter) Write(p []byte) (int, error) {
+	appContext := writer.appContext
+	written := len(p)
+	p = []byte(Redact(string(p)))
+	appContext.logSinkLines(p)
+
+	appContext.logMutex.Lock()
+	defer appContext.logMutex.Unlock()
+
+	if appContext.logBuffer == nil {
+		return written, nil
+	}
+
+	_, err := appContext.logBuffer.Write(p)
+	if err != nil {
+		return 0, err
+	}
+	appContext.logErrorLines(p)
+
+	if appContext.LogFlushBytes > 0 && appContext.logBuffer.Len() >= appContext.LogFlushBytes {
+		err = appContext.logFlushPart()
+	}
+
+	return written, err
+}
+
+// logFlushPart uploads the buffer as the next part, the log mutex must be held. A part that
+// can neither be stored nor spooled stays in the buffer, to go with the next part.
+func (appContext *AppContext) logFlushPart() error {
+	logName := fmt.Sprintf("%s-%s-%03d.txt",
+		appContext.logTopic, appContext.logStarted.Format("20060102-150405"), appContext.logPart+1)
+
+	logData := appContext.logBuffer.Bytes()
+	err := appContext.storeLog("log", logName, logData)
+	if err != nil {
+		err = appContext.logSpool(logName, logData)
+	}
+	if err != nil {
+		return err
+	}
+	appContext.logPart++
+
+	appContext.logBuffer = new(bytes.Buffer)
+	appContext.logName = logName
+
+	return nil
+}
+
+// logFlushStart flushes a part at every interval while the log is open
+func (appContext *AppContext) logFlushStart() {
+	appContext.logFlushStop()
+	if appContext.LogFlushInterval <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	appContext.logFlushCancel = cancel
+
+	go func() {
+		ticker := time.NewTicker(appContext.LogFlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				var err error
+				appContext.logMutex.Lock()
+				if appContext.logBuffer != nil && appContext.logBuffer.Len() > 0 {
+					err = appContext.logFlushPart()
+				}
+				appContext.logMutex.Unlock()
+
+				// Logged once the mutex is released, the line goes into the log itself
+				if err != nil {
+					appContext.LogError(fmt.Errorf("log flush: %v", err))
+				}
+			}
+		}
+	}()
+}
+
+func (appContext *AppContext) logFlushStop() {
+	if appContext.logFlushCancel != nil {
+		appContext.logFlushCancel()
+		appContext.logFlushCancel = nil
+	}
+}
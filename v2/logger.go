@@ -0,0 +1,86 @@
+package application
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Logger writes to the logfile, adding its fields to every line as key=value pairs
+type Logger struct {
+	fields     []string
+	markErrors bool
+}
+
+// Logger returns a logger without fields, or with the topic of a derived AppContext
+func (appContext *AppContext) Logger() *Logger {
+	logger := &Logger{fields: []string{}, markErrors: appContext.LogErrors}
+	if appContext.logTopicOverride != "" {
+		return logger.With("topic", appContext.logTopicOverride)
+	}
+
+	return logger
+}
+
+// formatField renders a value, quoting it when it would not survive splitting on spaces
+func formatField(value interface{}) string {
+	text := fmt.Sprint(value)
+	if text == "" || strings.ContainsAny(text, " \t\n\"=") {
+		return strconv.Quote(text)
+	}
+
+	return text
+}
+
+// With returns a logger adding the given key/value pairs to those it already has
+func (logger *Logger) With(keyValues ...interface{}) *Logger {
+	fields := make([]string, len(logger.fields), len(logger.fields)+len(keyValues)/2+1)
+	copy(fields, logger.fields)
+
+	for i := 0; i < len(keyValues); i += 2 {
+		key := fmt.Sprint(keyValues[i])
+		var value interface{} = "(missing)"
+		if i+1 < len(keyValues) {
+			value = keyValues[i+1]
+		}
+		fields = append(fields, key+"="+formatField(value))
+	}
+
+	return &Logger{fields: fields, markErrors: logger.markErrors}
+}
+
+func (logger *Logger) output(message string) {
+	if len(logger.fields) == 0 {
+		log.Println(message)
+		return
+	}
+
+	log.Println(message + " " + strings.Join(logger.fields, " "))
+}
+
+// Println inserts a message in the logfile
+func (logger *Logger) Println(s string) {
+	if len(s) != 0 {
+		logger.output(s)
+	}
+}
+
+// Printf inserts a formatted message in the logfile
+func (logger *Logger) Printf(format string, args ...interface{}) {
+	logger.output(strings.TrimRight(fmt.Sprintf(format, args...), "\n"))
+}
+
+// Error inserts an error in the logfile if there is one, marked so it ends up in the error log
+// when that is kept
+func (logger *Logger) Error(err error) {
+	if err == nil {
+		return
+	}
+	if logger.markErrors {
+		logger.output(err.Error() + " " + errorMarker)
+		return
+	}
+
+	logger.output(err.Error())
+}
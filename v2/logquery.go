@@ -0,0 +1,192 @@
+package application
+
+import (
+	"bufio"
+	"context"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// defaultLogMatches bounds the matches returned when the filter does not
+const defaultLogMatches = 1000
+
+// logObjectName splits the name of a log object into topic, date, part and errors suffix
+var logObjectName = regexp.MustCompile(`^(.+)-(\d{8}-\d{6})(?:-(\d{3}))?(-errors)?\.txt$`)
+
+// LogFilter selects log objects by topic and date, a pattern searches their lines
+type LogFilter struct {
+	Topic      string
+	From       time.Time
+	To         time.Time
+	ErrorsOnly bool
+	Pattern    string
+	MaxMatches int
+}
+
+// LogObject describes a log, or part of one, in the log bucket or the error log bucket
+type LogObject struct {
+	Name    string    `json:"name"`
+	Bucket  string    `json:"bucket"`
+	Topic   string    `json:"topic"`
+	Date    time.Time `json:"date"`
+	Part    int       `json:"part,omitempty"`
+	Errors  bool      `json:"errors,omitempty"`
+	Size    int64     `json:"size"`
+	Matches int       `json:"matches,omitempty"`
+}
+
+// LogMatch is a line of a log matching the pattern
+type LogMatch struct {
+	Log  string `json:"log"`
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// LogResult lists the selected logs and, with a pattern, the matching lines; Truncated is set
+// when there were more matches than returned
+type LogResult struct {
+	Logs      []*LogObject `json:"logs"`
+	Matches   []*LogMatch  `json:"matches,omitempty"`
+	Truncated bool         `json:"truncated,omitempty"`
+}
+
+// parseLogObject describes the object in the bucket if its name is that of a log
+func parseLogObject(bucket string, info minio.ObjectInfo) *LogObject {
+	parts := logObjectName.FindStringSubmatch(info.Key)
+	if parts == nil {
+		return nil
+	}
+
+	date, err := time.ParseInLocation(snapshotLayout, parts[2], time.Local)
+	if err != nil {
+		return nil
+	}
+	part, _ := strconv.Atoi(parts[3])
+
+	return &LogObject{
+		Name:   info.Key,
+		Bucket: bucket,
+		Topic:  parts[1],
+		Date:   date,
+		Part:   part,
+		Errors: parts[4] != "",
+		Size:   info.Size}
+}
+
+// selects tells whether the log passes the topic, date and errors conditions of the filter
+func (filter *LogFilter) selects(logObject *LogObject) bool {
+	if filter.Topic != "" && logObject.Topic != filter.Topic {
+		return false
+	}
+	if !filter.From.IsZero() && logObject.Date.Before(filter.From) {
+		return false
+	}
+	if !filter.To.IsZero() && logObject.Date.After(filter.To) {
+		return false
+	}
+	if filter.ErrorsOnly && !logObject.Errors {
+		return false
+	}
+
+	return true
+}
+
+// grepLog adds the lines of the log matching the pattern, returning false once the maximum
+// number of matches is reached
+func (appContext *AppContext) grepLog(ctx context.Context, logObject *LogObject, pattern *regexp.Regexp,
+	result *LogResult, maxMatches int) (bool, error) {
+
+	object, err := appContext.getObject(ctx, logObject.Bucket, logObject.Name)
+	if err != nil {
+		return false, err
+	}
+	defer object.Close()
+
+	scanner := bufio.NewScanner(object)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if !pattern.MatchString(scanner.Text()) {
+			continue
+		}
+		if len(result.Matches) == maxMatches {
+			result.Truncated = true
+			return false, nil
+		}
+		logObject.Matches++
+		result.Matches = append(result.Matches, &LogMatch{Log: logObject.Name, Line: line, Text: scanner.Text()})
+	}
+
+	return true, scanner.Err()
+}
+
+// Logs lists the logs in the log buckets selected by the filter, oldest first, the error logs
+// included when they are kept in a bucket of their own. With a pattern, a regular expression,
+// the logs are read and the matching lines returned as well.
+func (appContext *AppContext) Logs(ctx context.Context, filter *LogFilter) (*LogResult, error) {
+	var pattern *regexp.Regexp
+
+	if filter.Pattern != "" {
+		var err error
+		pattern, err = regexp.Compile(filter.Pattern)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	prefix := ""
+	if filter.Topic != "" {
+		prefix = filter.Topic + "-"
+	}
+
+	result := LogResult{Logs: []*LogObject{}}
+	for _, bucket := range appContext.LogBuckets() {
+		objects, err := appContext.listObjects(ctx, bucket, prefix, false)
+		// The error log bucket is only created once a run logged an error
+		if bucket != "log" && minio.ToErrorResponse(err).Code == "NoSuchBucket" {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, objectInfo := range objects {
+			logObject := parseLogObject(bucket, objectInfo)
+			if logObject != nil && filter.selects(logObject) {
+				result.Logs = append(result.Logs, logObject)
+			}
+		}
+	}
+
+	sort.Slice(result.Logs, func(i, j int) bool {
+		if !result.Logs[i].Date.Equal(result.Logs[j].Date) {
+			return result.Logs[i].Date.Before(result.Logs[j].Date)
+		}
+		return result.Logs[i].Name < result.Logs[j].Name
+	})
+
+	if pattern == nil {
+		return &result, nil
+	}
+
+	maxMatches := filter.MaxMatches
+	if maxMatches <= 0 {
+		maxMatches = defaultLogMatches
+	}
+	for _, logObject := range result.Logs {
+		more, err := appContext.grepLog(ctx, logObject, pattern, &result, maxMatches)
+		if err != nil {
+			return nil, err
+		}
+		if !more {
+			break
+		}
+	}
+
+	return &result, nil
+}
@@ -0,0 +1,281 @@
+package application
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxSinkBatch is the number of lines an HTTP sink collects before pushing them
+const maxSinkBatch = 500
+
+// LogSink receives every line written to the logfile, next to the S3 copy
+type LogSink interface {
+	WriteLine(topic string, line string) error
+	Flush() error
+}
+
+type logSinkOptions struct {
+	Type    string            `json:"type"`
+	Address string            `json:"address"`
+	Tag     string            `json:"tag"`
+	URL     string            `json:"url"`
+	Labels  map[string]string `json:"labels"`
+}
+
+func createLogSinks(sinkOptions []logSinkOptions) ([]LogSink, error) {
+	sinks := []LogSink{}
+
+	for _, sinkOption := range sinkOptions {
+		switch sinkOption.Type {
+		case "syslog":
+			sink, err := NewSyslogSink(sinkOption.Address, sinkOption.Tag)
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		case "loki":
+			sinks = append(sinks, NewLokiSink(sinkOption.URL, sinkOption.Labels))
+		case "otlp":
+			sinks = append(sinks, NewOTLPSink(sinkOption.URL, sinkOption.Labels))
+		default:
+			return nil, fmt.Errorf("unknown log sink type %s", sinkOption.Type)
+		}
+	}
+
+	return sinks, nil
+}
+
+// logSinkLines passes the written lines to all sinks, problems go to stderr as the log itself can't take them
+func (appContext *AppContext) logSinkLines(p []byte) {
+	if len(appContext.LogSinks) == 0 {
+		return
+	}
+
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		for _, sink := range appContext.LogSinks {
+			err := sink.WriteLine(appContext.logTopic, line)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Log sink: %v\n", err)
+			}
+		}
+	}
+}
+
+// logSinkFlush pushes whatever the sinks still hold
+func (appContext *AppContext) logSinkFlush() {
+	for _, sink := range appContext.LogSinks {
+		err := sink.Flush()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Log sink: %v\n", err)
+		}
+	}
+}
+
+type sinkLine struct {
+	topic string
+	time  time.Time
+	line  string
+}
+
+// sinkTimeout bounds a single push to an HTTP sink
+const sinkTimeout = 10 * time.Second
+
+// maxSinkQueue is the number of batches an HTTP sink holds while pushing, when more are waiting
+// the batch is dropped rather than stalling the callers that log
+const maxSinkQueue = 16
+
+// httpSink batches lines and pushes them with the given encoding from a goroutine of its own,
+// so a slow endpoint does not hold up logging
+type httpSink struct {
+	mutex  sync.Mutex
+	url    string
+	labels map[string]string
+	lines  []sinkLine
+	encode func(labels map[string]string, lines []sinkLine) ([]byte, error)
+	client *http.Client
+	start  sync.Once
+	queue  chan sinkBatch
+}
+
+// sinkBatch is a batch of lines queued for an HTTP sink, or with flushed set a marker closed
+// once the batches queued before are pushed
+type sinkBatch struct {
+	lines   []sinkLine
+	flushed chan struct{}
+}
+
+func newHTTPSink(sinkURL string, labels map[string]string, encode func(labels map[string]string, lines []sinkLine) ([]byte, error)) *httpSink {
+	return &httpSink{
+		url:    sinkURL,
+		labels: labels,
+		encode: encode,
+		client: &http.Client{Timeout: sinkTimeout},
+		queue:  make(chan sinkBatch, maxSinkQueue)}
+}
+
+func (sink *httpSink) WriteLine(topic string, line string) error {
+	sink.mutex.Lock()
+	sink.lines = append(sink.lines, sinkLine{topic: topic, time: time.Now(), line: line})
+	var lines []sinkLine
+	if len(sink.lines) >= maxSinkBatch {
+		lines = sink.lines
+		sink.lines = nil
+	}
+	sink.mutex.Unlock()
+
+	if lines == nil {
+		return nil
+	}
+
+	return sink.enqueue(lines)
+}
+
+// enqueue hands the batch to the sender, dropping it when the sender is too far behind
+func (sink *httpSink) enqueue(lines []sinkLine) error {
+	sink.start.Do(func() { go sink.send() })
+
+	select {
+	case sink.queue <- sinkBatch{lines: lines}:
+		return nil
+	default:
+		return fmt.Errorf("%s: behind, %d lines dropped", sink.url, len(lines))
+	}
+}
+
+// send pushes the queued batches one by one, problems go to stderr as the log can't take them
+func (sink *httpSink) send() {
+	for batch := range sink.queue {
+		if batch.flushed != nil {
+			close(batch.flushed)
+			continue
+		}
+		err := sink.push(batch.lines)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Log sink: %v\n", err)
+		}
+	}
+}
+
+func (sink *httpSink) push(lines []sinkLine) error {
+	body, err := sink.encode(sink.labels, lines)
+	if err != nil {
+		return err
+	}
+
+	response, err := sink.client.Post(sink.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+
+	if response.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("%s: %s", sink.url, response.Status)
+	}
+
+	return nil
+}
+
+// Flush queues the lines held and waits until all queued batches are pushed, each push is
+// bounded by the sink timeout
+func (sink *httpSink) Flush() error {
+	sink.mutex.Lock()
+	lines := sink.lines
+	sink.lines = nil
+	sink.mutex.Unlock()
+
+	var err error
+	if len(lines) > 0 {
+		err = sink.enqueue(lines)
+	}
+
+	flushed := make(chan struct{})
+	sink.start.Do(func() { go sink.send() })
+	sink.queue <- sinkBatch{flushed: flushed}
+	<-flushed
+
+	return err
+}
+
+// NewLokiSink pushes the log lines to Loki, labeled with the topic and the given labels
+func NewLokiSink(lokiURL string, labels map[string]string) LogSink {
+	return newHTTPSink(strings.TrimRight(lokiURL, "/")+"/loki/api/v1/push", labels, encodeLoki)
+}
+
+func encodeLoki(labels map[string]string, lines []sinkLine) ([]byte, error) {
+	type stream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+
+	// One stream per topic
+	streams := map[string]*stream{}
+	for _, line := range lines {
+		topicStream, found := streams[line.topic]
+		if !found {
+			streamLabels := map[string]string{"topic": line.topic}
+			for key, value := range labels {
+				streamLabels[key] = value
+			}
+			topicStream = &stream{Stream: streamLabels}
+			streams[line.topic] = topicStream
+		}
+		topicStream.Values = append(topicStream.Values,
+			[2]string{strconv.FormatInt(line.time.UnixNano(), 10), line.line})
+	}
+
+	push := struct {
+		Streams []*stream `json:"streams"`
+	}{}
+	for _, topicStream := range streams {
+		push.Streams = append(push.Streams, topicStream)
+	}
+
+	return json.Marshal(&push)
+}
+
+// NewOTLPSink pushes the log lines to an OpenTelemetry collector over OTLP/HTTP with JSON encoding
+func NewOTLPSink(collectorURL string, attributes map[string]string) LogSink {
+	return newHTTPSink(strings.TrimRight(collectorURL, "/")+"/v1/logs", attributes, encodeOTLP)
+}
+
+func encodeOTLP(attributes map[string]string, lines []sinkLine) ([]byte, error) {
+	type value struct {
+		StringValue string `json:"stringValue"`
+	}
+	type attribute struct {
+		Key   string `json:"key"`
+		Value value  `json:"value"`
+	}
+	type logRecord struct {
+		TimeUnixNano string      `json:"timeUnixNano"`
+		Body         value       `json:"body"`
+		Attributes   []attribute `json:"attributes"`
+	}
+
+	resource := []attribute{{Key: "service.name", Value: value{"geography"}}}
+	for key, attributeValue := range attributes {
+		resource = append(resource, attribute{Key: key, Value: value{attributeValue}})
+	}
+
+	records := make([]logRecord, len(lines))
+	for i, line := range lines {
+		records[i] = logRecord{
+			TimeUnixNano: strconv.FormatInt(line.time.UnixNano(), 10),
+			Body:         value{line.line},
+			Attributes:   []attribute{{Key: "topic", Value: value{line.topic}}}}
+	}
+
+	export := map[string]interface{}{
+		"resourceLogs": []interface{}{map[string]interface{}{
+			"resource":  map[string]interface{}{"attributes": resource},
+			"scopeLogs": []interface{}{map[string]interface{}{"logRecords": records}}}}}
+
+	return json.Marshal(export)
+}
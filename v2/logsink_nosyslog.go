@@ -0,0 +1,13 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package application
+
+import (
+	"errors"
+)
+
+// NewSyslogSink is not available on this platform
+func NewSyslogSink(address string, tag string) (LogSink, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
@@ -0,0 +1,44 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package application
+
+import (
+	"log/syslog"
+	"net/url"
+)
+
+type syslogSink struct {
+	writer *syslog.Writer
+}
+
+// NewSyslogSink sends the log lines to syslog, either local or at an address like udp://host:514
+func NewSyslogSink(address string, tag string) (LogSink, error) {
+	if tag == "" {
+		tag = "geography"
+	}
+
+	network, host := "", ""
+	if address != "" {
+		syslogURL, err := url.Parse(address)
+		if err != nil {
+			return nil, err
+		}
+		network, host = syslogURL.Scheme, syslogURL.Host
+	}
+
+	writer, err := syslog.Dial(network, host, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	return &syslogSink{writer: writer}, nil
+}
+
+func (sink *syslogSink) WriteLine(topic string, line string) error {
+	return sink.writer.Info(topic + ": " + line)
+}
+
+func (sink *syslogSink) Flush() error {
+	return nil
+}
@@ -0,0 +1,88 @@
+package application
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// logSpool keeps a log that could not be uploaded in the local spool directory
+func (appContext *AppContext) logSpool(logName string, logData []byte) error {
+	err := os.MkdirAll(appContext.LogSpoolDir, 0700)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(appContext.LogSpoolDir, logName), logData, 0600)
+}
+
+// LogSpoolFlush uploads the spooled logs, removing each one once it is stored
+func (appContext *AppContext) LogSpoolFlush() error {
+	spooled, err := ioutil.ReadDir(appContext.LogSpoolDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, logFile := range spooled {
+		if logFile.IsDir() {
+			continue
+		}
+
+		spoolName := filepath.Join(appContext.LogSpoolDir, logFile.Name())
+		logData, err := ioutil.ReadFile(spoolName)
+		if err != nil {
+			return err
+		}
+
+		err = appContext.storeLog("log", logFile.Name(), logData)
+		if err != nil {
+			return err
+		}
+
+		err = os.Remove(spoolName)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LogSpoolStart retries uploading the spooled logs at the given interval in the background
+func (appContext *AppContext) LogSpoolStart(interval time.Duration) {
+	appContext.LogSpoolStop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	appContext.logSpoolCancel = cancel
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := appContext.LogSpoolFlush()
+				if err != nil {
+					log.Printf("Log spool: %v\n", err)
+				}
+			}
+		}
+	}()
+}
+
+// LogSpoolStop ends the background retries
+func (appContext *AppContext) LogSpoolStop() {
+	if appContext.logSpoolCancel != nil {
+		appContext.logSpoolCancel()
+		appContext.logSpoolCancel = nil
+	}
+}
@@ -0,0 +1,167 @@
+package application
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// The kinds of the maintenance jobs, reindex and compact take the base name of a collection as
+// the collection param
+const (
+	JobReindex       = "reindex"
+	JobCompact       = "compact"
+	JobRecompute     = "recompute"
+	JobRebuildCaches = "rebuild-caches"
+)
+
+// MaintenanceJobs lists the kinds of the maintenance jobs, which need the admin role to enqueue
+var MaintenanceJobs = []string{JobReindex, JobCompact, JobRecompute, JobRebuildCaches}
+
+// IsMaintenanceJob tells whether the kind is that of a maintenance job
+func IsMaintenanceJob(kind string) bool {
+	for _, maintenanceJob := range MaintenanceJobs {
+		if kind == maintenanceJob {
+			return true
+		}
+	}
+
+	return false
+}
+
+// existingCollection returns the configured name of the collection for the base name, failing
+// when there is no such collection so a typo does not go by unnoticed
+func (mongoClient *MongoClient) existingCollection(ctx context.Context, base string) (string, error) {
+	if base == "" {
+		return "", fmt.Errorf("collection is required")
+	}
+
+	name := mongoClient.appContext.CollectionName(base)
+	names, err := mongoClient.Database().ListCollectionNames(ctx, bson.M{"name": name})
+	if err != nil {
+		return "", err
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("collection %s: %v", base, ErrNotFound)
+	}
+
+	return name, nil
+}
+
+// Reindex drops all indexes of the collection but the one on _id and creates them again from
+// their definitions, fixing indexes grown lopsided by many imports. Collections without index
+// definitions of their own are refused. Queries are slow while it runs.
+func (mongoClient *MongoClient) Reindex(ctx context.Context, base string) error {
+	err := mongoClient.appContext.CheckWritable()
+	if err != nil {
+		return err
+	}
+	name, err := mongoClient.existingCollection(ctx, base)
+	if err != nil {
+		return err
+	}
+
+	ensure, found := collectionIndexes[base]
+	if !found {
+		return fmt.Errorf("collection %s: no indexes to rebuild", base)
+	}
+
+	collection := mongoClient.Database().Collection(name)
+	_, err = collection.Indexes().DropAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	return ensure(mongoClient, ctx, collection)
+}
+
+// Compact returns the space freed by removed documents to the operating system, the collection
+// is blocked while it runs
+func (mongoClient *MongoClient) Compact(ctx context.Context, base string) error {
+	err := mongoClient.appContext.CheckWritable()
+	if err != nil {
+		return err
+	}
+	name, err := mongoClient.existingCollection(ctx, base)
+	if err != nil {
+		return err
+	}
+
+	return mongoClient.Database().RunCommand(ctx, bson.D{{Key: "compact", Value: name}}).Err()
+}
+
+// Recompute computes the statistics and airport pages again from the current data, as an
+// import does
+func (mongoClient *MongoClient) Recompute(ctx context.Context) error {
+	err := mongoClient.StatsRefresh(ctx)
+	if err != nil {
+		return err
+	}
+	err = mongoClient.RefreshViews(ctx)
+	if err != nil {
+		return err
+	}
+	mongoClient.appContext.CacheReset()
+
+	return nil
+}
+
+// RebuildCaches empties the query caches of this process and fills the ones served on every
+// request again. Other processes pick up the changes when their entries expire.
+func (mongoClient *MongoClient) RebuildCaches(ctx context.Context) error {
+	appContext := mongoClient.appContext
+	appContext.CacheReset()
+
+	_, err := appContext.cachedDatasets(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = mongoClient.Dashboard(ctx)
+
+	return err
+}
+
+// Maintain runs the maintenance operation, one of the maintenance job kinds, on the collection
+// for those taking one
+func (mongoClient *MongoClient) Maintain(ctx context.Context, operation string, collection string) error {
+	var err error
+
+	switch operation {
+	case JobReindex:
+		err = mongoClient.Reindex(ctx, collection)
+	case JobCompact:
+		err = mongoClient.Compact(ctx, collection)
+	case JobRecompute:
+		err = mongoClient.Recompute(ctx)
+	case JobRebuildCaches:
+		err = mongoClient.RebuildCaches(ctx)
+	default:
+		return fmt.Errorf("unknown maintenance operation %s", operation)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", operation, err)
+	}
+
+	mongoClient.appContext.Logger().With("operation", operation, "collection", collection).Println("Maintenance: done")
+
+	return nil
+}
+
+// MaintenanceJob is the handler of the maintenance jobs
+func (appContext *AppContext) MaintenanceJob(ctx context.Context, job *Job) error {
+	mongoClient, err := appContext.DBOpen()
+	if err != nil {
+		return err
+	}
+	defer mongoClient.DBClose()
+
+	return mongoClient.Maintain(ctx, job.Kind, job.Params["collection"])
+}
+
+// HandleMaintenance registers the handler of all maintenance jobs
+func (worker *JobWorker) HandleMaintenance() {
+	for _, kind := range MaintenanceJobs {
+		worker.Handle(kind, worker.appContext.MaintenanceJob)
+	}
+}
@@ -0,0 +1,131 @@
+package application
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// metricsTTL is how long the metrics are reused, scrapers ask every few seconds while they
+// take a listing of the reports bucket
+const metricsTTL = time.Minute
+
+// The report counts of the records read, rejected and accepted per source, and of the
+// documents the database refused per collection
+const (
+	countRead     = "read:"
+	countRejected = "rejected:"
+	countAccepted = "accepted:"
+	countRefused  = "refused:"
+)
+
+// SourceMetrics are the gauges of a source, for alerts on stale data
+type SourceMetrics struct {
+	Source           string    `json:"source"`
+	Imported         time.Time `json:"imported"`
+	HoursSinceImport float64   `json:"hours-since-import"`
+}
+
+// RunMetrics are the gauges of the latest run of a topic, for alerts on degrading data
+type RunMetrics struct {
+	Topic         string                    `json:"topic"`
+	Finished      time.Time                 `json:"finished"`
+	Succeeded     bool                      `json:"succeeded"`
+	Read          int64                     `json:"read"`
+	Rejected      int64                     `json:"rejected"`
+	RejectedRatio float64                   `json:"rejected-ratio"`
+	Usage         map[string]*ResourceUsage `json:"usage"`
+}
+
+// ImportMetrics are the gauges standard alert rules look at
+type ImportMetrics struct {
+	Sources []*SourceMetrics `json:"sources"`
+	Runs    []*RunMetrics    `json:"runs"`
+}
+
+// runMetrics sums the records read and rejected over the sources of the run
+func runMetrics(report *RunReport) *RunMetrics {
+	metrics := RunMetrics{Topic: report.Topic, Finished: report.Finished, Succeeded: report.Succeeded, Usage: report.Usage}
+
+	for name, count := range report.Counts {
+		if strings.HasPrefix(name, countRead) {
+			metrics.Read += count
+		}
+		if strings.HasPrefix(name, countRejected) {
+			metrics.Rejected += count
+		}
+	}
+	if metrics.Read > 0 {
+		metrics.RejectedRatio = float64(metrics.Rejected) / float64(metrics.Read)
+	}
+
+	return &metrics
+}
+
+// latestReports returns the name of the latest report of every topic in the reports bucket
+func (appContext *AppContext) latestReports(ctx context.Context) (map[string]string, error) {
+	latest := map[string]string{}
+
+	reports, err := appContext.listObjects(ctx, "reports", "", false)
+	if err != nil {
+		return nil, err
+	}
+	for _, reportInfo := range reports {
+		key := reportInfo.Key
+
+		// Names are <topic>-20060102-150405.json, the date stamp sorts the runs of a topic
+		name := strings.TrimSuffix(key, ".json")
+		if len(name) < 17 || name[len(name)-16] != '-' {
+			continue
+		}
+		topic := name[:len(name)-16]
+		if key > latest[topic] {
+			latest[topic] = key
+		}
+	}
+
+	return latest, nil
+}
+
+// ImportMetrics returns the time since the last successful import of every source and the
+// share of records rejected by the latest run of every topic
+func (appContext *AppContext) ImportMetrics(ctx context.Context) (*ImportMetrics, error) {
+	if appContext.importMetrics != nil {
+		cached, found := appContext.importMetrics.get("")
+		if found {
+			return cached.(*ImportMetrics), nil
+		}
+	}
+
+	datasets, err := appContext.cachedDatasets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := appContext.now()
+	metrics := ImportMetrics{Sources: []*SourceMetrics{}, Runs: []*RunMetrics{}}
+	for _, dataset := range datasets {
+		metrics.Sources = append(metrics.Sources, &SourceMetrics{
+			Source:           dataset.Source,
+			Imported:         dataset.Imported,
+			HoursSinceImport: now.Sub(dataset.Imported).Hours()})
+	}
+
+	latest, err := appContext.latestReports(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range latest {
+		report, err := appContext.Report(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		metrics.Runs = append(metrics.Runs, runMetrics(report))
+	}
+
+	if appContext.importMetrics != nil {
+		appContext.importMetrics.put("", &metrics)
+	}
+
+	return &metrics, nil
+}
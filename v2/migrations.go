@@ -0,0 +1,220 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// migration is a versioned change to the database, run once in the order of the versions
+type migration struct {
+	version int
+	name    string
+	up      func(ctx context.Context, mongoClient *MongoClient) error
+}
+
+// MigrationRecord is the record of a migration in the migrations collection. A migration
+// without Applied is running under the lease of its owner, or was interrupted when the lease
+// expired.
+type MigrationRecord struct {
+	Version    int           `bson:"_id" json:"version"`
+	Name       string        `bson:"name" json:"name"`
+	Started    time.Time     `bson:"started" json:"started"`
+	Applied    *time.Time    `bson:"applied,omitempty" json:"applied,omitempty"`
+	Duration   time.Duration `bson:"duration" json:"duration"`
+	Owner      string        `bson:"owner,omitempty" json:"owner,omitempty"`
+	LeaseUntil *time.Time    `bson:"lease_until,omitempty" json:"lease-until,omitempty"`
+}
+
+// migrations lists all migrations, new ones are added at the end with the next version
+var migrations = []migration{
+	{1, "airport-indexes", func(ctx context.Context, mongoClient *MongoClient) error {
+		return mongoClient.EnsureAirportIndexes(ctx)
+	}},
+	{2, "runway-indexes", func(ctx context.Context, mongoClient *MongoClient) error {
+		return mongoClient.EnsureRunwayIndexes(ctx)
+	}},
+	{3, "job-indexes", func(ctx context.Context, mongoClient *MongoClient) error {
+		return mongoClient.EnsureJobIndexes(ctx)
+	}},
+	{4, "airport-search-indexes", func(ctx context.Context, mongoClient *MongoClient) error {
+		return mongoClient.EnsureAirportIndexes(ctx)
+	}},
+	{5, "job-priorities", func(ctx context.Context, mongoClient *MongoClient) error {
+		return mongoClient.prioritizeJobs(ctx)
+	}},
+	{6, "airport-pages", func(ctx context.Context, mongoClient *MongoClient) error {
+		return mongoClient.RefreshView(ctx, AirportPagesView)
+	}},
+	{7, "document-hashes", func(ctx context.Context, mongoClient *MongoClient) error {
+		for _, base := range hashedCollections {
+			err := mongoClient.hashDocuments(ctx, base)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+}
+
+func (mongoClient *MongoClient) migrations() *mongo.Collection {
+	return mongoClient.collection(MigrationsCollection)
+}
+
+// Migrations returns the migrations recorded in the database, by version
+func (mongoClient *MongoClient) Migrations(ctx context.Context) ([]*MigrationRecord, error) {
+
+	cursor, err := mongoClient.migrations().Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	records := []*MigrationRecord{}
+	err = cursor.All(ctx, &records)
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// migrationLease is how long a process may run a migration before others take it over, it
+// renews the lease while running
+const migrationLease = time.Minute
+
+// migrationPoll is the wait between looks at a migration another process is running
+const migrationPoll = 2 * time.Second
+
+// leaseMigration takes the lease on the migration, inserting its record or taking over one
+// whose lease expired, like that of an interrupted run. It returns false when the migration
+// is applied, or leased by another process.
+func (mongoClient *MongoClient) leaseMigration(ctx context.Context, step migration, owner string) (bool, *MigrationRecord, error) {
+	now := mongoClient.appContext.now()
+	leaseUntil := now.Add(migrationLease)
+	record := MigrationRecord{Version: step.version, Name: step.name, Started: now, Owner: owner, LeaseUntil: &leaseUntil}
+
+	_, err := mongoClient.migrations().InsertOne(ctx, &record)
+	if err == nil {
+		return true, &record, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return false, nil, err
+	}
+
+	var current MigrationRecord
+	err = mongoClient.migrations().FindOne(ctx, bson.M{"_id": step.version}).Decode(&current)
+	if err == mongo.ErrNoDocuments {
+		return false, nil, nil
+	}
+	if err != nil || current.Applied != nil {
+		return false, &current, err
+	}
+	if current.LeaseUntil != nil && current.LeaseUntil.After(now) {
+		return false, nil, nil
+	}
+
+	// Of the processes finding the lease expired only one matches the lease it saw
+	result, err := mongoClient.migrations().UpdateOne(ctx, bson.M{
+		"_id":         step.version,
+		"applied":     bson.M{"$exists": false},
+		"lease_until": current.LeaseUntil},
+		bson.M{"$set": bson.M{"started": now, "owner": owner, "lease_until": leaseUntil}})
+	if err != nil || result.ModifiedCount == 0 {
+		return false, nil, err
+	}
+
+	return true, &record, nil
+}
+
+// renewMigration extends the lease on the migration until the context is done
+func (mongoClient *MongoClient) renewMigration(ctx context.Context, step migration, owner string) {
+	ticker := time.NewTicker(migrationLease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			leaseUntil := mongoClient.appContext.now().Add(migrationLease)
+			_, err := mongoClient.migrations().UpdateOne(ctx, bson.M{"_id": step.version, "owner": owner},
+				bson.M{"$set": bson.M{"lease_until": leaseUntil}})
+			if err != nil && ctx.Err() == nil {
+				mongoClient.appContext.LogError(fmt.Errorf("migration %d %s: %v", step.version, step.name, err))
+			}
+		}
+	}
+}
+
+// migrate runs the migration unless it was applied before. A process takes a lease on it first,
+// others wait until it is applied, or take it over once the lease expires, so no process carries
+// on against a half migrated database. A failed migration is released to be retried.
+func (mongoClient *MongoClient) migrate(ctx context.Context, step migration) (bool, error) {
+	owner := mongoClient.appContext.newID().Hex()
+
+	for {
+		leased, record, err := mongoClient.leaseMigration(ctx, step, owner)
+		if err != nil {
+			return false, err
+		}
+		if leased {
+			break
+		}
+		if record != nil && record.Applied != nil {
+			return false, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(migrationPoll):
+		}
+	}
+
+	started := mongoClient.appContext.now()
+	renewCtx, stopRenewing := context.WithCancel(ctx)
+	go mongoClient.renewMigration(renewCtx, step, owner)
+	err := step.up(ctx, mongoClient)
+	stopRenewing()
+	if err != nil {
+		mongoClient.migrations().DeleteOne(context.Background(), bson.M{"_id": step.version, "owner": owner})
+		return false, fmt.Errorf("migration %d %s: %v", step.version, step.name, err)
+	}
+
+	applied := mongoClient.appContext.now()
+	_, err = mongoClient.migrations().UpdateOne(ctx, bson.M{"_id": step.version, "owner": owner}, bson.M{
+		"$set":   bson.M{"applied": applied, "duration": applied.Sub(started)},
+		"$unset": bson.M{"lease_until": ""}})
+
+	return true, err
+}
+
+// Migrate brings the database up to date by running the migrations not recorded yet
+func (appContext *AppContext) Migrate(ctx context.Context) error {
+	err := appContext.CheckWritable()
+	if err != nil {
+		return err
+	}
+
+	mongoClient, err := appContext.DBOpen()
+	if err != nil {
+		return err
+	}
+	defer mongoClient.DBClose()
+
+	for _, step := range migrations {
+		ran, err := mongoClient.migrate(ctx, step)
+		if err != nil {
+			return err
+		}
+		if ran {
+			appContext.Logger().With("version", step.version, "name", step.name).Println("Migration applied")
+		}
+	}
+
+	return nil
+}
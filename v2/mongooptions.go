@@ -0,0 +1,119 @@
+package application
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoOptions describes the mongo section of the options file, for clusters that need more
+// than the connection string offers. The certificate key file holds the client certificate and
+// its key, as used with the MONGODB-X509 mechanism; MONGODB-AWS takes the credentials from the
+// environment when the connection string has none.
+type mongoOptions struct {
+	TLSCAFile       string   `json:"tls-ca-file"`
+	TLSCertKeyFile  string   `json:"tls-cert-key-file"`
+	TLSInsecure     bool     `json:"tls-insecure"`
+	AuthMechanism   string   `json:"auth-mechanism"`
+	AuthSource      string   `json:"auth-source"`
+	Compressors     []string `json:"compressors"`
+	AppName         string   `json:"app-name"`
+	MaxPoolSize     uint64   `json:"max-pool-size"`
+	ServerSelection int64    `json:"server-selection-seconds"`
+}
+
+// knownCompressors are the wire compressors the driver supports
+var knownCompressors = []string{"zstd", "snappy", "zlib"}
+
+// WithMongoOptions customizes the client options of every connection to the database, after
+// the connection string and the mongo section of the options file are applied
+func WithMongoOptions(customize func(clientOptions *options.ClientOptions)) Option {
+	return func(appContext *AppContext) {
+		appContext.MongoOptions = append(appContext.MongoOptions, customize)
+	}
+}
+
+// mongoTLS reads the certificates of the mongo section into a TLS configuration, nil when
+// there are none
+func mongoTLS(mongo mongoOptions) (*tls.Config, error) {
+	if mongo.TLSCAFile == "" && mongo.TLSCertKeyFile == "" && !mongo.TLSInsecure {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: mongo.TLSInsecure}
+	if mongo.TLSCAFile != "" {
+		caData, err := ioutil.ReadFile(mongo.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("%s: no certificates", mongo.TLSCAFile)
+		}
+	}
+	if mongo.TLSCertKeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(mongo.TLSCertKeyFile, mongo.TLSCertKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", mongo.TLSCertKeyFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
+
+// mongoCustomizer turns the mongo section of the options file into a customization of the
+// client options, nil when the section is empty. The files are read once, here.
+func mongoCustomizer(mongo mongoOptions) (func(clientOptions *options.ClientOptions), error) {
+	for _, compressor := range mongo.Compressors {
+		known := false
+		for _, knownCompressor := range knownCompressors {
+			known = known || compressor == knownCompressor
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown mongo compressor %q", compressor)
+		}
+	}
+	tlsConfig, err := mongoTLS(mongo)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(clientOptions *options.ClientOptions) {
+		if tlsConfig != nil {
+			clientOptions.SetTLSConfig(tlsConfig)
+		}
+
+		// The credentials of the connection string stay, only the mechanism is added
+		if mongo.AuthMechanism != "" || mongo.AuthSource != "" {
+			credential := options.Credential{}
+			if clientOptions.Auth != nil {
+				credential = *clientOptions.Auth
+			}
+			if mongo.AuthMechanism != "" {
+				credential.AuthMechanism = mongo.AuthMechanism
+			}
+			if mongo.AuthSource != "" {
+				credential.AuthSource = mongo.AuthSource
+			}
+			clientOptions.SetAuth(credential)
+		}
+
+		if len(mongo.Compressors) > 0 {
+			clientOptions.SetCompressors(mongo.Compressors)
+		}
+		if mongo.AppName != "" {
+			clientOptions.SetAppName(mongo.AppName)
+		}
+		if mongo.MaxPoolSize > 0 {
+			clientOptions.SetMaxPoolSize(mongo.MaxPoolSize)
+		}
+		if mongo.ServerSelection > 0 {
+			clientOptions.SetServerSelectionTimeout(time.Duration(mongo.ServerSelection) * time.Second)
+		}
+	}, nil
+}
@@ -0,0 +1,73 @@
+package application
+
+import (
+	"strings"
+	"unicode"
+)
+
+// isCode tells whether a keyword is a code like LON or EGLL rather than a name, codes are
+// short, without spaces and in upper case
+func isCode(keyword string) bool {
+	if len(keyword) > 4 {
+		return false
+	}
+	for _, r := range keyword {
+		if !unicode.IsUpper(r) && !unicode.IsDigit(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// alternateNames picks the names from the comma separated keywords of the source, like the
+// localized "Londres" of London, leaving out codes and the name itself
+func alternateNames(name string, keywords string) []string {
+	var names []string
+	seen := map[string]bool{strings.ToLower(name): true}
+
+	for _, keyword := range strings.Split(keywords, ",") {
+		keyword = strings.Join(strings.Fields(keyword), " ")
+		if keyword == "" || isCode(keyword) || seen[strings.ToLower(keyword)] {
+			continue
+		}
+		seen[strings.ToLower(keyword)] = true
+		names = append(names, keyword)
+	}
+
+	return names
+}
+
+// keywordTokens splits the comma separated keywords of the source into its entries, like old
+// idents and city names, in lower case for exact matching
+func keywordTokens(keywords string) []string {
+	var tokens []string
+	seen := map[string]bool{}
+
+	for _, keyword := range strings.Split(keywords, ",") {
+		token := strings.ToLower(strings.Join(strings.Fields(keyword), " "))
+		if token == "" || seen[token] {
+			continue
+		}
+		seen[token] = true
+		tokens = append(tokens, token)
+	}
+
+	return tokens
+}
+
+// AddName adds an alternate name to the airport unless it has it already, for enrichers
+// bringing the names of an auxiliary source
+func (airport *Airport) AddName(name string) {
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" || strings.EqualFold(name, airport.Name) {
+		return
+	}
+	for _, known := range airport.Names {
+		if strings.EqualFold(name, known) {
+			return
+		}
+	}
+
+	airport.Names = append(airport.Names, name)
+}
@@ -0,0 +1,233 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/ralph-nijpels/geography-application/v2/units"
+)
+
+// NavaidType classifies navaids as in the OurAirports type column
+type NavaidType string
+
+// The navaid types known in the source data
+const (
+	VOR    NavaidType = "VOR"
+	VORDME NavaidType = "VOR-DME"
+	VORTAC NavaidType = "VORTAC"
+	TACAN  NavaidType = "TACAN"
+	DME    NavaidType = "DME"
+	NDB    NavaidType = "NDB"
+	NDBDME NavaidType = "NDB-DME"
+)
+
+// NavaidTypes lists all known navaid types
+var NavaidTypes = []NavaidType{VOR, VORDME, VORTAC, TACAN, DME, NDB, NDBDME}
+
+// The frequency bands of the navaids
+const (
+	ndbLowestKHz  units.FrequencyKHz = 190
+	ndbHighestKHz units.FrequencyKHz = 1750
+	vorLowestKHz  units.FrequencyKHz = 108000
+	vorHighestKHz units.FrequencyKHz = 117950
+)
+
+// ParseNavaidType reads a navaid type, forgiving case, spaces and underscores
+func ParseNavaidType(s string) (NavaidType, error) {
+	normalized := strings.ToUpper(strings.TrimSpace(s))
+	normalized = strings.NewReplacer(" ", "-", "_", "-", "/", "-").Replace(normalized)
+
+	for _, navaidType := range NavaidTypes {
+		if string(navaidType) == normalized {
+			return navaidType, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown navaid type %q", s)
+}
+
+// ValidFrequency tells whether the frequency lies in the band of the navaid type. NDBs
+// transmit on LF/MF, the others on (or paired with) the VHF navigation band.
+func (navaidType NavaidType) ValidFrequency(frequency units.FrequencyKHz) bool {
+	if navaidType == NDB || navaidType == NDBDME {
+		return frequency >= ndbLowestKHz && frequency <= ndbHighestKHz
+	}
+
+	return frequency >= vorLowestKHz && frequency <= vorHighestKHz
+}
+
+// Navaid describes a radio navigation aid as stored in the navaids collection
+type Navaid struct {
+	NavaidID          int64              `bson:"_id" json:"id"`
+	Ident             string             `bson:"ident" json:"ident"`
+	Name              string             `bson:"name" json:"name"`
+	Type              NavaidType         `bson:"type" json:"type"`
+	Frequency         units.FrequencyKHz `bson:"frequency_khz" json:"frequency-khz"`
+	Location          Coordinate         `bson:"location" json:"location"`
+	Elevation         units.LengthFeet   `bson:"elevation_ft,omitempty" json:"elevation-ft,omitempty"`
+	Country           string             `bson:"iso_country" json:"country"`
+	DMEChannel        string             `bson:"dme_channel,omitempty" json:"dme-channel,omitempty"`
+	MagneticVariation float64            `bson:"magnetic_variation_deg,omitempty" json:"magnetic-variation-deg,omitempty"`
+	AssociatedAirport string             `bson:"associated_airport,omitempty" json:"associated-airport,omitempty"`
+}
+
+func (mongoClient *MongoClient) navaids() *mongo.Collection {
+	return mongoClient.collection(NavaidsCollection)
+}
+
+// navaidFromRecord converts a row of the navaids source, rejecting frequencies outside the band
+func navaidFromRecord(record map[string]string) (*Navaid, error) {
+	var err error
+	navaid := Navaid{
+		Ident:             NormalizeCode(record["ident"]),
+		Name:              record["name"],
+		Country:           NormalizeCode(record["iso_country"]),
+		DMEChannel:        NormalizeCode(record["dme_channel"]),
+		AssociatedAirport: NormalizeCode(record["associated_airport"])}
+
+	navaid.NavaidID, err = parseInt(record, "id")
+	if err != nil {
+		return nil, err
+	}
+	navaid.Type, err = ParseNavaidType(record["type"])
+	if err != nil {
+		return nil, err
+	}
+	frequency, err := parseFloat(record, "frequency_khz")
+	if err != nil {
+		return nil, err
+	}
+	navaid.Frequency = units.FrequencyKHz(frequency)
+	if !navaid.Type.ValidFrequency(navaid.Frequency) {
+		return nil, fmt.Errorf("%s %s: frequency %v kHz out of band", navaid.Type, navaid.Ident, frequency)
+	}
+	navaid.Location, err = ParseCoordinate(record["latitude_deg"], record["longitude_deg"])
+	if err != nil {
+		return nil, err
+	}
+	elevation, err := parseFloat(record, "elevation_ft")
+	if err != nil {
+		return nil, err
+	}
+	navaid.Elevation = units.LengthFeet(elevation)
+	navaid.MagneticVariation, err = parseFloat(record, "magnetic_variation_deg")
+	if err != nil {
+		return nil, err
+	}
+
+	return &navaid, nil
+}
+
+// EnsureNavaidIndexes creates the indexes backing the lookups by ident and airport and the geo
+// queries
+func (mongoClient *MongoClient) EnsureNavaidIndexes(ctx context.Context) error {
+	return mongoClient.ensureNavaidIndexes(ctx, mongoClient.navaids())
+}
+
+// ensureNavaidIndexes creates the navaid indexes on the given collection, which may be a shadow
+// collection that is swapped in later
+func (mongoClient *MongoClient) ensureNavaidIndexes(ctx context.Context, collection *mongo.Collection) error {
+	err := mongoClient.appContext.CheckWritable()
+	if err != nil {
+		return err
+	}
+
+	_, err = collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "location", Value: "2dsphere"}}},
+		{Keys: bson.D{{Key: "ident", Value: 1}}},
+		{Keys: bson.D{{Key: "associated_airport", Value: 1}}},
+	})
+
+	return err
+}
+
+// ImportNavaids downloads the navaids source and upserts all navaids
+func (mongoClient *MongoClient) ImportNavaids(ctx context.Context, report *RunReport) error {
+	appContext := mongoClient.appContext
+
+	err := appContext.CheckWritable()
+	if err != nil {
+		return err
+	}
+	if appContext.NavaidsURL == "" {
+		return ErrNoSource
+	}
+
+	err = mongoClient.EnsureNavaidIndexes(ctx)
+	if err != nil {
+		return err
+	}
+
+	source := &CSVSource{SourceName: "navaids", URL: appContext.NavaidsURL, KeyColumn: "id"}
+	live, err := mongoClient.navaids().CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	_, err = appContext.importSource(ctx, report, source, live,
+		func(record map[string]string) (*keyedDocument, error) {
+			navaid, err := navaidFromRecord(record)
+			if err != nil {
+				return nil, err
+			}
+			report.AddCount("navaid-type:"+string(navaid.Type), 1)
+			return &keyedDocument{id: navaid.NavaidID, document: navaid}, nil
+		},
+		func(batch []keyedDocument) (int64, error) {
+			return mongoClient.bulkUpsert(ctx, mongoClient.navaids(), batch, report)
+		})
+	if err != nil {
+		return err
+	}
+
+	err = mongoClient.recordDataset(ctx, source.Name(), report)
+	if err != nil {
+		return err
+	}
+	err = mongoClient.RefreshViews(ctx)
+	if err != nil {
+		return err
+	}
+	appContext.CacheReset()
+
+	return nil
+}
+
+// NavaidsByIdent returns the navaids with the given ident, which is only unique per region
+func (mongoClient *MongoClient) NavaidsByIdent(ctx context.Context, ident string) ([]*Navaid, error) {
+	return mongoClient.findNavaids(ctx, bson.M{"ident": NormalizeCode(ident)}, options.Find().SetSort(bson.M{"iso_country": 1}))
+}
+
+// NavaidsByAirport returns the navaids associated with the airport of the given ident
+func (mongoClient *MongoClient) NavaidsByAirport(ctx context.Context, airportIdent string) ([]*Navaid, error) {
+	return mongoClient.findNavaids(ctx, bson.M{"associated_airport": NormalizeCode(airportIdent)}, options.Find().SetSort(bson.M{"ident": 1}))
+}
+
+// NavaidsNear returns the navaids within the radius of the location, nearest first
+func (mongoClient *MongoClient) NavaidsNear(ctx context.Context, location Coordinate, radius units.DistanceKm) ([]*Navaid, error) {
+	filter := bson.M{"location": bson.M{"$nearSphere": bson.M{
+		"$geometry":    location,
+		"$maxDistance": float64(radius.Meters())}}}
+
+	return mongoClient.findNavaids(ctx, filter, options.Find().SetLimit(mongoClient.appContext.PageLimit(0)))
+}
+
+func (mongoClient *MongoClient) findNavaids(ctx context.Context, filter bson.M, findOptions *options.FindOptions) ([]*Navaid, error) {
+
+	cursor, err := mongoClient.readCollection(NavaidsCollection).Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	navaids := []*Navaid{}
+	err = cursor.All(ctx, &navaids)
+	if err != nil {
+		return nil, err
+	}
+
+	return navaids, nil
+}
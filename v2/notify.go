@@ -0,0 +1,128 @@
+package application
+
+import (
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+// Notification describes an event worth telling an operator about
+type Notification struct {
+	Topic   string
+	Subject string
+	Message string
+	LogName string
+}
+
+// Notifier delivers notifications to operators
+type Notifier interface {
+	Notify(notification *Notification) error
+}
+
+type smtpOptions struct {
+	Server   string   `json:"server"`
+	User     string   `json:"user"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+}
+
+type notifyOptions struct {
+	SMTP *smtpOptions `json:"smtp"`
+}
+
+// SMTPNotifier sends notifications as plain text email
+type SMTPNotifier struct {
+	Server   string
+	User     string
+	Password string
+	From     string
+	To       []string
+}
+
+func createNotifiers(notifyOptions *notifyOptions) []Notifier {
+	notifiers := []Notifier{}
+
+	if notifyOptions.SMTP != nil && notifyOptions.SMTP.Server != "" {
+		notifiers = append(notifiers, &SMTPNotifier{
+			Server:   notifyOptions.SMTP.Server,
+			User:     notifyOptions.SMTP.User,
+			Password: notifyOptions.SMTP.Password,
+			From:     notifyOptions.SMTP.From,
+			To:       notifyOptions.SMTP.To})
+	}
+
+	return notifiers
+}
+
+// Notify sends the notification by email
+func (smtpNotifier *SMTPNotifier) Notify(notification *Notification) error {
+
+	// Authenticate only when credentials are given
+	var auth smtp.Auth
+	if smtpNotifier.User != "" {
+		host, _, err := net.SplitHostPort(smtpNotifier.Server)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", smtpNotifier.User, smtpNotifier.Password, host)
+	}
+
+	var message strings.Builder
+	fmt.Fprintf(&message, "From: %s\r\n", headerValue(smtpNotifier.From))
+	fmt.Fprintf(&message, "To: %s\r\n", headerValue(strings.Join(smtpNotifier.To, ", ")))
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", headerValue(notification.Subject)))
+	fmt.Fprintf(&message, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&message, "%s\r\n", notification.Message)
+	if notification.LogName != "" {
+		fmt.Fprintf(&message, "\r\nLog: log/%s\r\n", notification.LogName)
+	}
+
+	return smtp.SendMail(smtpNotifier.Server, auth, smtpNotifier.From, smtpNotifier.To, []byte(message.String()))
+}
+
+// headerValue keeps a value on its header line, an error in the subject could otherwise add
+// headers or start the body
+func headerValue(value string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+}
+
+// Notify passes the notification to all configured notifiers
+func (appContext *AppContext) Notify(notification *Notification) error {
+	var firstErr error
+
+	for _, notifier := range appContext.Notifiers {
+		err := notifier.Notify(notification)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// NotifyReport notifies operators when the run failed or reported errors
+func (appContext *AppContext) NotifyReport(report *RunReport) error {
+	if report.Succeeded && report.Errors == 0 {
+		return nil
+	}
+
+	subject := fmt.Sprintf("%s: run reported %d errors", report.Topic, report.Errors)
+	if !report.Succeeded {
+		subject = fmt.Sprintf("%s: run failed", report.Topic)
+	}
+
+	var message strings.Builder
+	fmt.Fprintf(&message, "Run %s started %s\r\n", report.Name, report.Started.Format("2006-01-02 15:04:05"))
+	for _, sample := range report.Samples {
+		fmt.Fprintf(&message, "- %s\r\n", sample)
+	}
+
+	return appContext.Notify(&Notification{
+		Topic:   report.Topic,
+		Subject: subject,
+		Message: message.String(),
+		LogName: appContext.LogName()})
+}
@@ -0,0 +1,169 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/ralph-nijpels/geography-application/v2/units"
+)
+
+// defaultOpenAIPURL is the openAIP core API
+const defaultOpenAIPURL = "https://api.core.openaip.net/api"
+
+// openAIPPageSize is the number of items asked from the openAIP API per page
+const openAIPPageSize = 1000
+
+// openAIP encodes units as numbers, these are the ones used for elevations
+const (
+	openAIPMeters = 0
+	openAIPFeet   = 1
+)
+
+// OpenAIPSource reads a resource of the openAIP core API, like reporting-points, page by page.
+// The items are flattened into records: _id becomes id, the geometry is handled as by
+// flattenFeature and the elevation becomes elevation_ft. Other objects, like the limits of
+// an airspace, are kept as JSON text.
+type OpenAIPSource struct {
+	SourceName string
+	BaseURL    string
+	Resource   string
+	APIKey     string
+	Country    string
+}
+
+// openAIPPage is a single page of an openAIP list response
+type openAIPPage struct {
+	Page       int               `json:"page"`
+	TotalPages int               `json:"totalPages"`
+	Items      []json.RawMessage `json:"items"`
+}
+
+// Name identifies the source
+func (source *OpenAIPSource) Name() string {
+	return source.SourceName
+}
+
+// fetchPage retrieves a single page of the resource
+func (source *OpenAIPSource) fetchPage(ctx context.Context, page int) (*openAIPPage, error) {
+	query := url.Values{}
+	query.Set("page", strconv.Itoa(page))
+	query.Set("limit", strconv.Itoa(openAIPPageSize))
+	if source.Country != "" {
+		query.Set("country", source.Country)
+	}
+	target := source.BaseURL + "/" + source.Resource + "?" + query.Encode()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("x-openaip-api-key", source.APIKey)
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", source.Resource, response.Status)
+	}
+
+	var result openAIPPage
+	err = json.NewDecoder(response.Body).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// writeItems writes the items of all pages as a single JSON array
+func (source *OpenAIPSource) writeItems(ctx context.Context, writer io.Writer) error {
+	separator := "["
+
+	for page := 1; ; page++ {
+		result, err := source.fetchPage(ctx, page)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range result.Items {
+			_, err = io.WriteString(writer, separator)
+			if err != nil {
+				return err
+			}
+			_, err = writer.Write(item)
+			if err != nil {
+				return err
+			}
+			separator = ","
+		}
+
+		if page >= result.TotalPages {
+			break
+		}
+	}
+
+	if separator == "[" {
+		_, err := io.WriteString(writer, "[]")
+		return err
+	}
+	_, err := io.WriteString(writer, "]")
+
+	return err
+}
+
+// Fetch retrieves all pages, the snapshot holds the items of all of them as one array
+func (source *OpenAIPSource) Fetch(ctx context.Context, appContext *AppContext, report *RunReport) (io.ReadCloser, error) {
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(source.writeItems(ctx, writer))
+	}()
+	defer reader.Close()
+
+	return appContext.storeSource(ctx, source.SourceName, ".json", reader, report)
+}
+
+// Parse streams the items of the snapshot
+func (source *OpenAIPSource) Parse(input io.Reader) (RecordReader, error) {
+	return newJSONReader(input, "", flattenOpenAIP)
+}
+
+// Key returns the openAIP id of the record
+func (source *OpenAIPSource) Key(record map[string]string) string {
+	return record["id"]
+}
+
+// flattenOpenAIP turns an openAIP item into a record
+func flattenOpenAIP(item map[string]interface{}) map[string]string {
+	properties := make(map[string]interface{}, len(item))
+	for field, value := range item {
+		if field != "geometry" && field != "elevation" {
+			properties[field] = value
+		}
+	}
+	record := flattenFeature(map[string]interface{}{"properties": properties, "geometry": item["geometry"]})
+
+	record["id"] = record["_id"]
+	delete(record, "_id")
+
+	elevation, _ := item["elevation"].(map[string]interface{})
+	value, err := strconv.ParseFloat(jsonText(elevation["value"]), 64)
+	if err == nil {
+		switch jsonText(elevation["unit"]) {
+		case strconv.Itoa(openAIPFeet):
+			record["elevation_ft"] = strconv.FormatFloat(value, 'f', -1, 64)
+		case strconv.Itoa(openAIPMeters):
+			feet := units.LengthMeters(value).Feet()
+			record["elevation_ft"] = strconv.FormatFloat(float64(feet), 'f', 0, 64)
+		}
+	}
+
+	return record
+}
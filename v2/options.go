@@ -0,0 +1,65 @@
+package application
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrReadOnly is returned when a write is attempted on a read-only context
+var ErrReadOnly = errors.New("application context is read-only")
+
+// Option overrides a setting of the options file when creating the AppContext
+type Option func(appContext *AppContext)
+
+// WithReadOnly makes the AppContext refuse all write operations
+func WithReadOnly(readOnly bool) Option {
+	return func(appContext *AppContext) {
+		appContext.ReadOnly = readOnly
+	}
+}
+
+// CheckWritable returns ErrReadOnly when the AppContext only serves queries
+func (appContext *AppContext) CheckWritable() error {
+	if appContext.ReadOnly {
+		return ErrReadOnly
+	}
+
+	return nil
+}
+
+// WithNegativeCache remembers lookups that found nothing for the given time,
+// zero disables the cache
+func WithNegativeCache(ttl time.Duration) Option {
+	return func(appContext *AppContext) {
+		appContext.NegativeCacheTTL = ttl
+	}
+}
+
+// WithQueryCache keeps search results for the given time, keyed by the query and the dataset
+// versions, zero disables the cache
+func WithQueryCache(ttl time.Duration) Option {
+	return func(appContext *AppContext) {
+		appContext.QueryCacheTTL = ttl
+	}
+}
+
+// WithProfile selects the profile in the options file, overriding the GEO_PROFILE variable
+func WithProfile(profile string) Option {
+	return func(appContext *AppContext) {
+		appContext.Profile = profile
+	}
+}
+
+// WithOptionsFile reads the options from the given file instead of options.json
+func WithOptionsFile(fileName string) Option {
+	return func(appContext *AppContext) {
+		appContext.OptionsFile = fileName
+	}
+}
+
+// WithAirportsSource imports the airports from the given source instead of the configured one
+func WithAirportsSource(source Source) Option {
+	return func(appContext *AppContext) {
+		appContext.AirportsSource = source
+	}
+}
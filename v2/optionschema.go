@@ -0,0 +1,295 @@
+package application
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+)
+
+// OptionError is a problem found in the options file, with the line it was found on
+type OptionError struct {
+	Line    int
+	Path    string
+	Message string
+}
+
+func (optionError *OptionError) Error() string {
+	return fmt.Sprintf("line %d: %s: %s", optionError.Line, optionError.Path, optionError.Message)
+}
+
+// jsonName returns the name of a struct field in json
+func jsonName(field reflect.StructField) string {
+	return strings.Split(field.Tag.Get("json"), ",")[0]
+}
+
+// typeSchema describes a Go type as JSON Schema
+func typeSchema(goType reflect.Type) map[string]interface{} {
+	switch goType.Kind() {
+	case reflect.Ptr:
+		return typeSchema(goType.Elem())
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		for i := 0; i < goType.NumField(); i++ {
+			name := jsonName(goType.Field(i))
+			if name != "" && name != "-" {
+				properties[name] = typeSchema(goType.Field(i).Type)
+			}
+		}
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": typeSchema(goType.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(goType.Elem())}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	default:
+		return map[string]interface{}{"type": "string"}
+	}
+}
+
+// OptionsSchema returns the JSON Schema of the options file
+func OptionsSchema() ([]byte, error) {
+	optionType := reflect.TypeOf(optionFile{})
+
+	// Profiles take the same options as the base section
+	schema := typeSchema(optionType)
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "geography application options"
+	schema["definitions"] = map[string]interface{}{"options": typeSchema(optionType)}
+	schema["properties"].(map[string]interface{})["profiles"] = map[string]interface{}{
+		"type":                 "object",
+		"additionalProperties": map[string]interface{}{"$ref": "#/definitions/options"}}
+
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+type optionValidator struct {
+	content []byte
+	decoder *json.Decoder
+	errors  []error
+}
+
+func (validator *optionValidator) line() int {
+	offset := validator.decoder.InputOffset()
+	return bytes.Count(validator.content[:offset], []byte("\n")) + 1
+}
+
+func (validator *optionValidator) report(path string, format string, args ...interface{}) {
+	validator.errors = append(validator.errors, &OptionError{
+		Line:    validator.line(),
+		Path:    path,
+		Message: fmt.Sprintf(format, args...)})
+}
+
+// skip consumes the remainder of a value of which the first token was read
+func (validator *optionValidator) skip(token json.Token) error {
+	delim, isDelim := token.(json.Delim)
+	if !isDelim || delim == '}' || delim == ']' {
+		return nil
+	}
+
+	for depth := 1; depth > 0; {
+		token, err := validator.decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+
+	return nil
+}
+
+// value checks the next value against the Go type, returning only syntax errors
+func (validator *optionValidator) value(goType reflect.Type, path string) error {
+	token, err := validator.decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	if goType.Kind() == reflect.Ptr {
+		if token == nil {
+			return nil
+		}
+		goType = goType.Elem()
+	}
+
+	expected := typeSchema(goType)["type"]
+	switch goType.Kind() {
+	case reflect.Struct:
+		if token != json.Delim('{') {
+			validator.report(path, "expected an object")
+			return validator.skip(token)
+		}
+		return validator.object(goType, path)
+
+	case reflect.Slice:
+		if token != json.Delim('[') {
+			validator.report(path, "expected an array")
+			return validator.skip(token)
+		}
+		for i := 0; validator.decoder.More(); i++ {
+			err = validator.value(goType.Elem(), fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return err
+			}
+		}
+		_, err = validator.decoder.Token()
+		return err
+
+	case reflect.Map:
+		if token != json.Delim('{') {
+			validator.report(path, "expected an object")
+			return validator.skip(token)
+		}
+		for validator.decoder.More() {
+			key, err := validator.decoder.Token()
+			if err != nil {
+				return err
+			}
+			err = validator.value(goType.Elem(), fmt.Sprintf("%s.%v", path, key))
+			if err != nil {
+				return err
+			}
+		}
+		_, err = validator.decoder.Token()
+		return err
+
+	case reflect.Bool:
+		_, valid := token.(bool)
+		if !valid {
+			validator.report(path, "expected a %s", expected)
+		}
+
+	case reflect.String:
+		_, valid := token.(string)
+		if !valid {
+			validator.report(path, "expected a %s", expected)
+		}
+
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Float32, reflect.Float64:
+		number, valid := token.(json.Number)
+		if valid && expected == "integer" {
+			_, err = number.Int64()
+			valid = err == nil
+		}
+		if !valid && expected == "integer" {
+			validator.report(path, "expected an integer")
+		} else if !valid {
+			validator.report(path, "expected a number")
+		}
+	}
+
+	return validator.skip(token)
+}
+
+// object checks the members of an object of which the opening brace was read
+func (validator *optionValidator) object(goType reflect.Type, path string) error {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < goType.NumField(); i++ {
+		name := jsonName(goType.Field(i))
+		if name != "" && name != "-" {
+			fields[name] = goType.Field(i).Type
+		}
+	}
+
+	for validator.decoder.More() {
+		token, err := validator.decoder.Token()
+		if err != nil {
+			return err
+		}
+		key := token.(string)
+		keyPath := strings.TrimPrefix(path+"."+key, ".")
+
+		// Profiles take the same options as the base section
+		if path == "" && key == "profiles" {
+			err = validator.profiles(goType)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		fieldType, found := fields[key]
+		if !found {
+			validator.report(keyPath, "unknown option")
+			token, err = validator.decoder.Token()
+			if err == nil {
+				err = validator.skip(token)
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = validator.value(fieldType, keyPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := validator.decoder.Token()
+	return err
+}
+
+func (validator *optionValidator) profiles(goType reflect.Type) error {
+	token, err := validator.decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != json.Delim('{') {
+		validator.report("profiles", "expected an object")
+		return validator.skip(token)
+	}
+
+	for validator.decoder.More() {
+		token, err = validator.decoder.Token()
+		if err != nil {
+			return err
+		}
+		err = validator.value(goType, "profiles."+token.(string))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = validator.decoder.Token()
+	return err
+}
+
+// ValidateOptions checks an options file against the schema, returning all problems found
+func ValidateOptions(reader io.Reader) []error {
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return []error{err}
+	}
+
+	validator := optionValidator{
+		content: content,
+		decoder: json.NewDecoder(bytes.NewReader(content)),
+		errors:  []error{}}
+	validator.decoder.UseNumber()
+
+	err = validator.value(reflect.TypeOf(optionFile{}), "")
+	if err != nil {
+		validator.errors = append(validator.errors, &OptionError{Line: validator.line(), Path: "", Message: err.Error()})
+	}
+
+	return validator.errors
+}
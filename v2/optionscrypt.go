@@ -0,0 +1,130 @@
+package application
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// OptionsKeyVariable is the environment variable holding the key of an encrypted options file,
+// base64 encoded
+const OptionsKeyVariable = "GEO_OPTIONS_KEY"
+
+// encryptedMagic starts an encrypted options file, followed by the nonce and the sealed JSON
+const encryptedMagic = "geo-options-aes-gcm-1\n"
+
+// ErrNoOptionsKey is returned reading an encrypted options file without a key
+var ErrNoOptionsKey = errors.New("encrypted options file without a key, set " + OptionsKeyVariable)
+
+// OptionsKeyFunc returns the AES key of an encrypted options file, 16, 24 or 32 bytes, for
+// instance by having a KMS decrypt the data key
+type OptionsKeyFunc func() ([]byte, error)
+
+// WithOptionsKey decrypts the options file with the key returned by the function, rather than
+// the one in the GEO_OPTIONS_KEY variable
+func WithOptionsKey(keyFunc OptionsKeyFunc) Option {
+	return func(appContext *AppContext) {
+		appContext.OptionsKey = keyFunc
+	}
+}
+
+// optionsKeyFromEnv returns the key in the GEO_OPTIONS_KEY variable
+func optionsKeyFromEnv() ([]byte, error) {
+	encoded := os.Getenv(OptionsKeyVariable)
+	if encoded == "" {
+		return nil, ErrNoOptionsKey
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", OptionsKeyVariable, err)
+	}
+
+	return key, nil
+}
+
+func optionsCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// IsEncryptedOptions tells whether the content of an options file is encrypted
+func IsEncryptedOptions(content []byte) bool {
+	return bytes.HasPrefix(content, []byte(encryptedMagic))
+}
+
+// EncryptOptions seals the content of an options file with AES-GCM
+func EncryptOptions(content []byte, key []byte) ([]byte, error) {
+	gcm, err := optionsCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := append([]byte(encryptedMagic), nonce...)
+	return gcm.Seal(sealed, nonce, content, []byte(encryptedMagic)), nil
+}
+
+// DecryptOptions opens the content of an encrypted options file
+func DecryptOptions(content []byte, key []byte) ([]byte, error) {
+	gcm, err := optionsCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := bytes.TrimPrefix(content, []byte(encryptedMagic))
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("encrypted options file is truncated")
+	}
+	nonce, sealed := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+
+	plain, err := gcm.Open(nil, nonce, sealed, []byte(encryptedMagic))
+	if err != nil {
+		return nil, errors.New("encrypted options file does not open with the key")
+	}
+
+	return plain, nil
+}
+
+// ReadOptionsFile returns the JSON of an options file, decrypted when it is encrypted with the
+// key of the function, or without one that of the GEO_OPTIONS_KEY variable
+func ReadOptionsFile(fileName string, keyFunc OptionsKeyFunc) ([]byte, error) {
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if !IsEncryptedOptions(content) {
+		return content, nil
+	}
+
+	if keyFunc == nil {
+		keyFunc = optionsKeyFromEnv
+	}
+	key, err := keyFunc()
+	if err != nil {
+		return nil, err
+	}
+
+	content, err = DecryptOptions(content, key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fileName, err)
+	}
+
+	return content, nil
+}
@@ -0,0 +1,178 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AirportOverride is a local correction to an airport, keyed by its ident, that survives
+// every import. Fields uses the column names of the airports source, like latitude_deg
+// or iata_code, so corrections are parsed and normalized like the upstream data.
+type AirportOverride struct {
+	Ident   string            `bson:"_id" json:"ident"`
+	Fields  map[string]string `bson:"fields" json:"fields"`
+	Reason  string            `bson:"reason,omitempty" json:"reason,omitempty"`
+	Updated time.Time         `bson:"updated" json:"updated"`
+}
+
+func (mongoClient *MongoClient) overrides() *mongo.Collection {
+	return mongoClient.collection(OverridesCollection)
+}
+
+// OverrideSet stores a correction, replacing an earlier one for the same airport
+func (mongoClient *MongoClient) OverrideSet(ctx context.Context, override *AirportOverride) error {
+
+	err := mongoClient.appContext.CheckWritable()
+	if err != nil {
+		return err
+	}
+
+	override.Ident = NormalizeCode(override.Ident)
+	override.Updated = mongoClient.appContext.now()
+	_, err = mongoClient.overrides().ReplaceOne(ctx, bson.M{"_id": override.Ident}, override,
+		options.Replace().SetUpsert(true))
+
+	return err
+}
+
+// OverrideDelete removes the correction of an airport, the next import restores the upstream data
+func (mongoClient *MongoClient) OverrideDelete(ctx context.Context, ident string) error {
+
+	err := mongoClient.appContext.CheckWritable()
+	if err != nil {
+		return err
+	}
+
+	result, err := mongoClient.overrides().DeleteOne(ctx, bson.M{"_id": NormalizeCode(ident)})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Overrides returns all stored corrections
+func (mongoClient *MongoClient) Overrides(ctx context.Context) ([]*AirportOverride, error) {
+
+	cursor, err := mongoClient.overrides().Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*AirportOverride{}
+	err = cursor.All(ctx, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// overrideFields takes the corrections from a row of the overrides CSV, empty cells are left alone
+func overrideFields(record map[string]string) map[string]string {
+	fields := map[string]string{}
+	for column, value := range record {
+		if column != "ident" && value != "" {
+			fields[column] = value
+		}
+	}
+
+	return fields
+}
+
+// readOverrides reads the corrections from an overrides CSV, rows without an ident are
+// reported when there is a report
+func readOverrides(reader RecordReader, report *RunReport) (map[string]map[string]string, error) {
+	result := map[string]map[string]string{}
+
+	for reader.Next() {
+		record := reader.Record()
+		ident := NormalizeCode(record["ident"])
+		if ident == "" {
+			if report != nil {
+				report.AddError(fmt.Errorf("overrides line %d: no ident", reader.Line()))
+			}
+			continue
+		}
+		result[ident] = overrideFields(record)
+	}
+
+	return result, reader.Err()
+}
+
+// airportOverrides collects the corrections by ident, those in the collection take
+// precedence over the ones in the overrides CSV
+func (mongoClient *MongoClient) airportOverrides(ctx context.Context, report *RunReport) (map[string]map[string]string, error) {
+	appContext := mongoClient.appContext
+
+	// The CSV has an ident column and any of the airports columns
+	result := map[string]map[string]string{}
+	if appContext.OverridesURL != "" {
+		file, err := appContext.fetchSource(ctx, "overrides", appContext.OverridesURL, ".csv", report)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		reader, err := NewCSVReader(file)
+		if err != nil {
+			return nil, err
+		}
+		result, err = readOverrides(reader, report)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return mongoClient.mergeOverrides(ctx, result)
+}
+
+// mergeOverrides lays the corrections in the collection over those read from a CSV
+func (mongoClient *MongoClient) mergeOverrides(ctx context.Context, result map[string]map[string]string) (map[string]map[string]string, error) {
+	overrides, err := mongoClient.Overrides(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, override := range overrides {
+		fields, found := result[override.Ident]
+		if !found {
+			fields = map[string]string{}
+			result[override.Ident] = fields
+		}
+		for column, value := range override.Fields {
+			fields[column] = value
+		}
+	}
+
+	return result, nil
+}
+
+// applyOverrides overlays the corrections onto the source records, returning the number applied
+func applyOverrides(records []map[string]string, overrides map[string]map[string]string) int64 {
+	var applied int64
+
+	if len(overrides) == 0 {
+		return 0
+	}
+
+	for _, record := range records {
+		fields, found := overrides[NormalizeCode(record["ident"])]
+		if !found {
+			continue
+		}
+		for column, value := range fields {
+			record[column] = value
+		}
+		applied++
+	}
+
+	return applied
+}
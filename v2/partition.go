@@ -0,0 +1,79 @@
+package application
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrNotSharded is returned when sharding is asked for on a database not served by mongos
+var ErrNotSharded = errors.New("not connected to a sharded cluster")
+
+// shardKeys are the shard keys of the collections that are sharded on a cluster. Only the
+// history, which grows with every import, is worth it and can be: the airports carry unique
+// indexes on their codes and are swapped in by a rename, the runways and frequencies are joined
+// by $lookup, none of which a sharded collection allows. Changes are kept together per airport,
+// so the history of an airport is read from a single shard.
+var shardKeys = map[string]bson.D{
+	HistoryCollection: {{Key: "airport_ref", Value: 1}, {Key: "changed", Value: 1}},
+}
+
+// sharded tells whether the database is served by mongos
+func (mongoClient *MongoClient) sharded(ctx context.Context) (bool, error) {
+	var hello struct {
+		Msg string `bson:"msg"`
+	}
+	err := mongoClient.DBClient.Database("admin").RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&hello)
+	if err != nil {
+		return false, err
+	}
+
+	return hello.Msg == "isdbgrid", nil
+}
+
+// Shard enables sharding of the database and shards the collections that can be, creating
+// the indexes on their shard keys first. Sharding again with the same key does no harm. This is
+// the only partitioning offered: mongos routes the queries on the shard key to the shard holding
+// the data, so the query layer needs no routing of its own. Collections per continent are not,
+// as airports are looked up by code, box and distance across continents, so every such query
+// would have to visit all of them.
+func (mongoClient *MongoClient) Shard(ctx context.Context) error {
+	appContext := mongoClient.appContext
+
+	err := appContext.CheckWritable()
+	if err != nil {
+		return err
+	}
+	sharded, err := mongoClient.sharded(ctx)
+	if err != nil {
+		return err
+	}
+	if !sharded {
+		return ErrNotSharded
+	}
+
+	admin := mongoClient.DBClient.Database("admin")
+	dbName := mongoClient.Database().Name()
+	err = admin.RunCommand(ctx, bson.D{{Key: "enableSharding", Value: dbName}}).Err()
+	if err != nil {
+		return err
+	}
+
+	for base, key := range shardKeys {
+		_, err = mongoClient.collection(base).Indexes().CreateOne(ctx, mongo.IndexModel{Keys: key})
+		if err != nil {
+			return err
+		}
+
+		namespace := dbName + "." + appContext.CollectionName(base)
+		err = admin.RunCommand(ctx, bson.D{{Key: "shardCollection", Value: namespace}, {Key: "key", Value: key}}).Err()
+		if err != nil {
+			return err
+		}
+		appContext.Logger().With("collection", namespace).Println("Sharded")
+	}
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrPaused is returned by an import that stopped at the end of a batch to be resumed later
+var ErrPaused = errors.New("paused at the end of a batch")
+
+// ErrNotPaused is returned resuming a run whose job is not paused
+var ErrNotPaused = errors.New("the job of the run is not paused")
+
+// ImportCheckpoint is where a paused import of a source stopped, the records read and the
+// documents stored by then, for the version of the source it was reading
+type ImportCheckpoint struct {
+	Version string `bson:"version" json:"version"`
+	Read    int64  `bson:"read" json:"read"`
+	Stored  int64  `bson:"stored" json:"stored"`
+}
+
+// jobControl passes a pause request from the worker to the import of a running job, and the
+// checkpoints between the job and the import
+type jobControl struct {
+	mutex       sync.Mutex
+	pause       int32
+	paused      bool
+	restarts    bool
+	checkpoints map[string]*ImportCheckpoint
+}
+
+type jobControlKey struct{}
+
+// withJobControl lets the imports run for the job pause and resume
+func withJobControl(ctx context.Context, control *jobControl) context.Context {
+	return context.WithValue(ctx, jobControlKey{}, control)
+}
+
+// jobControlFrom returns the control of the job running the import, nil outside a job
+func jobControlFrom(ctx context.Context) *jobControl {
+	control, _ := ctx.Value(jobControlKey{}).(*jobControl)
+	return control
+}
+
+// restartImport tells the job that its import starts over when resumed, as it loads into a
+// collection it drops first
+func restartImport(ctx context.Context) {
+	control := jobControlFrom(ctx)
+	if control == nil {
+		return
+	}
+
+	control.mutex.Lock()
+	control.restarts = true
+	control.checkpoints = nil
+	control.mutex.Unlock()
+}
+
+// requestPause has the import stop at the end of the batch it is at
+func (control *jobControl) requestPause() {
+	atomic.StoreInt32(&control.pause, 1)
+}
+
+// pauseRequested tells whether the import should stop at the end of this batch
+func (control *jobControl) pauseRequested() bool {
+	return control != nil && atomic.LoadInt32(&control.pause) == 1
+}
+
+// checkpoint returns where the import of the source paused before, nil when it starts at the
+// beginning, like when the source changed since
+func (control *jobControl) checkpoint(source string, version string) *ImportCheckpoint {
+	if control == nil {
+		return nil
+	}
+
+	control.mutex.Lock()
+	defer control.mutex.Unlock()
+
+	checkpoint := control.checkpoints[source]
+	if checkpoint == nil || control.restarts || checkpoint.Version != version {
+		return nil
+	}
+
+	return checkpoint
+}
+
+// stop registers that the import of the source paused, where that is when it can be resumed
+func (control *jobControl) stop(source string, checkpoint *ImportCheckpoint) {
+	control.mutex.Lock()
+	defer control.mutex.Unlock()
+
+	control.paused = true
+	if control.restarts {
+		return
+	}
+	if control.checkpoints == nil {
+		control.checkpoints = map[string]*ImportCheckpoint{}
+	}
+	control.checkpoints[source] = checkpoint
+}
+
+// PauseRun pauses the job of the run: a queued job right away, a running import at the end of
+// the batch it is at, within a few seconds. Resuming picks the import up from there, or from
+// the start when it loads into a collection it drops first. A job that does not import runs to
+// its end. The run id is that of the job params or the job id.
+func (mongoClient *MongoClient) PauseRun(ctx context.Context, runID string) (*Job, error) {
+	err := mongoClient.appContext.CheckWritable()
+	if err != nil {
+		return nil, err
+	}
+
+	now := mongoClient.appContext.now()
+	filter := runFilter(runID)
+	var job Job
+
+	filter["status"] = JobQueued
+	err = mongoClient.jobs().FindOneAndUpdate(ctx, filter,
+		bson.M{"$set": bson.M{"status": JobPaused, "updated": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&job)
+	if err != mongo.ErrNoDocuments {
+		return &job, err
+	}
+
+	filter["status"] = JobRunning
+	err = mongoClient.jobs().FindOneAndUpdate(ctx, filter,
+		bson.M{"$set": bson.M{"pause_requested": true, "updated": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// ResumeRun queues the paused job of the run again, it continues from its checkpoints
+func (mongoClient *MongoClient) ResumeRun(ctx context.Context, runID string) (*Job, error) {
+	err := mongoClient.appContext.CheckWritable()
+	if err != nil {
+		return nil, err
+	}
+
+	filter := runFilter(runID)
+	filter["status"] = JobPaused
+	var job Job
+	err = mongoClient.jobs().FindOneAndUpdate(ctx, filter,
+		bson.M{"$set": bson.M{"status": JobQueued, "pause_requested": false, "updated": mongoClient.appContext.now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		count, err := mongoClient.jobs().CountDocuments(ctx, runFilter(runID))
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, ErrNotFound
+		}
+		return nil, ErrNotPaused
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// jobSignals tells whether the job was asked to stop or to pause
+func (mongoClient *MongoClient) jobSignals(ctx context.Context, jobID primitive.ObjectID) (bool, bool, error) {
+	var signals struct {
+		Cancel bool `bson:"cancel_requested"`
+		Pause  bool `bson:"pause_requested"`
+	}
+
+	err := mongoClient.jobs().FindOne(ctx, bson.M{"_id": jobID},
+		options.FindOne().SetProjection(bson.M{"cancel_requested": 1, "pause_requested": 1})).Decode(&signals)
+
+	return signals.Cancel, signals.Pause, err
+}
@@ -0,0 +1,130 @@
+package application
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/ralph-nijpels/geography-application/v2/units"
+)
+
+// Pipeline builds an aggregation pipeline stage by stage
+type Pipeline struct {
+	stages mongo.Pipeline
+}
+
+// GeoNear describes a $geoNear stage on a 2dsphere index, the distance is written in meters
+type GeoNear struct {
+	Near          Coordinate
+	Key           string
+	DistanceField string
+	MaxDistance   units.DistanceKm
+	Query         bson.M
+}
+
+// Lookup describes a $lookup stage, either joining on a local and foreign field or running a
+// pipeline with the variables in Let
+type Lookup struct {
+	From         string
+	LocalField   string
+	ForeignField string
+	Let          bson.M
+	Pipeline     *Pipeline
+	As           string
+}
+
+// NewPipeline starts an empty pipeline
+func NewPipeline() *Pipeline {
+	return &Pipeline{stages: mongo.Pipeline{}}
+}
+
+// NewGeoNearPipeline starts a pipeline with a $geoNear stage, which has to come first
+func NewGeoNearPipeline(near GeoNear) *Pipeline {
+	stage := bson.M{
+		"near":          near.Near,
+		"key":           near.Key,
+		"distanceField": near.DistanceField,
+		"spherical":     true}
+	if near.MaxDistance > 0 {
+		stage["maxDistance"] = float64(near.MaxDistance.Meters())
+	}
+	if near.Query != nil {
+		stage["query"] = near.Query
+	}
+
+	return NewPipeline().Stage("$geoNear", stage)
+}
+
+// Stage adds a stage the builder has no method for
+func (pipeline *Pipeline) Stage(operator string, value interface{}) *Pipeline {
+	pipeline.stages = append(pipeline.stages, bson.D{{Key: operator, Value: value}})
+	return pipeline
+}
+
+// Match adds a $match stage
+func (pipeline *Pipeline) Match(filter bson.M) *Pipeline {
+	return pipeline.Stage("$match", filter)
+}
+
+// MatchExpr adds a $match stage on an aggregation expression, as needed for $lookup variables
+func (pipeline *Pipeline) MatchExpr(expression interface{}) *Pipeline {
+	return pipeline.Stage("$match", bson.M{"$expr": expression})
+}
+
+// Lookup adds a $lookup stage, the collection is given by its base name
+func (pipeline *Pipeline) Lookup(appContext *AppContext, lookup Lookup) *Pipeline {
+	stage := bson.M{
+		"from": appContext.CollectionName(lookup.From),
+		"as":   lookup.As}
+	if lookup.LocalField != "" {
+		stage["localField"] = lookup.LocalField
+		stage["foreignField"] = lookup.ForeignField
+	}
+	if lookup.Let != nil {
+		stage["let"] = lookup.Let
+	}
+	if lookup.Pipeline != nil {
+		stage["pipeline"] = lookup.Pipeline.Stages()
+	}
+
+	return pipeline.Stage("$lookup", stage)
+}
+
+// Project adds a $project stage
+func (pipeline *Pipeline) Project(fields bson.M) *Pipeline {
+	return pipeline.Stage("$project", fields)
+}
+
+// AddFields adds an $addFields stage
+func (pipeline *Pipeline) AddFields(fields bson.M) *Pipeline {
+	return pipeline.Stage("$addFields", fields)
+}
+
+// Group adds a $group stage on the expression, with the accumulated fields
+func (pipeline *Pipeline) Group(id interface{}, fields bson.M) *Pipeline {
+	group := bson.M{"_id": id}
+	for name, accumulator := range fields {
+		group[name] = accumulator
+	}
+
+	return pipeline.Stage("$group", group)
+}
+
+// Sort adds a $sort stage, the order of the keys is kept
+func (pipeline *Pipeline) Sort(keys bson.D) *Pipeline {
+	return pipeline.Stage("$sort", keys)
+}
+
+// Limit adds a $limit stage
+func (pipeline *Pipeline) Limit(limit int64) *Pipeline {
+	return pipeline.Stage("$limit", limit)
+}
+
+// Count adds a $count stage writing the count to the field
+func (pipeline *Pipeline) Count(field string) *Pipeline {
+	return pipeline.Stage("$count", field)
+}
+
+// Stages returns the pipeline as passed to Aggregate
+func (pipeline *Pipeline) Stages() mongo.Pipeline {
+	return pipeline.stages
+}
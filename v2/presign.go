@@ -0,0 +1,65 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// The lifetime of a presigned URL, S3 does not sign for longer than a week
+const (
+	DefaultLinkTTL = 15 * time.Minute
+	MaxLinkTTL     = 7 * 24 * time.Hour
+)
+
+// ErrLinkTTL is returned when asking for a presigned URL living longer than S3 allows
+var ErrLinkTTL = fmt.Errorf("link ttl exceeds %v", MaxLinkTTL)
+
+// ErrNoStorage is returned when a presigned URL is asked for without an object store
+var ErrNoStorage = errors.New("no object store connected")
+
+// PresignedURL returns a time-limited download link to the object, so it can be handed to
+// someone without sharing the storage credentials. A ttl of zero gives DefaultLinkTTL.
+func (appContext *AppContext) PresignedURL(ctx context.Context, bucket string, object string, ttl time.Duration) (*url.URL, error) {
+	if ttl <= 0 {
+		ttl = DefaultLinkTTL
+	}
+	if ttl > MaxLinkTTL {
+		return nil, ErrLinkTTL
+	}
+	if appContext.S3Client() == nil {
+		return nil, ErrNoStorage
+	}
+
+	// Signing does not look at the object, so check it is there rather than handing out a dead link
+	key, err := appContext.objectKey(ctx, object)
+	if err != nil {
+		return nil, err
+	}
+	_, err = appContext.S3Client().StatObject(ctx, bucket, key, minio.StatObjectOptions{})
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" || minio.ToErrorResponse(err).Code == "NoSuchBucket" {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	parameters := url.Values{}
+	parameters.Set("response-content-disposition", fmt.Sprintf("attachment; filename=%q", path.Base(object)))
+
+	return appContext.S3Client().PresignedGetObject(ctx, bucket, key, ttl, parameters)
+}
+
+// LogBuckets returns the buckets holding the logs, the error log may have one of its own
+func (appContext *AppContext) LogBuckets() []string {
+	if appContext.LogErrorsBucket == "" || appContext.LogErrorsBucket == "log" {
+		return []string{"log"}
+	}
+
+	return []string{"log", appContext.LogErrorsBucket}
+}
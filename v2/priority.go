@@ -0,0 +1,64 @@
+package application
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// JobPriority orders the queue, a job of a higher priority is claimed before the older jobs of
+// a lower one
+type JobPriority int
+
+// The priorities of jobs, apart so others can be fitted in between
+const (
+	JobPriorityLow    JobPriority = 10
+	JobPriorityNormal JobPriority = 20
+	JobPriorityHigh   JobPriority = 30
+)
+
+// ParseJobPriority reads a priority by name, empty is normal
+func ParseJobPriority(s string) (JobPriority, error) {
+	switch s {
+	case "low":
+		return JobPriorityLow, nil
+	case "", "normal":
+		return JobPriorityNormal, nil
+	case "high":
+		return JobPriorityHigh, nil
+	}
+
+	return 0, fmt.Errorf("unknown job priority %q", s)
+}
+
+type jobPriorityKey struct{}
+
+// WithJobPriority returns a context under which jobs are enqueued with the given priority, like
+// a refresh support asks for that should not wait for the nightly imports
+func WithJobPriority(ctx context.Context, priority JobPriority) context.Context {
+	return context.WithValue(ctx, jobPriorityKey{}, priority)
+}
+
+// jobPriority returns the priority of the jobs enqueued under the context, normal by default
+func jobPriority(ctx context.Context) JobPriority {
+	priority, found := ctx.Value(jobPriorityKey{}).(JobPriority)
+	if !found {
+		return JobPriorityNormal
+	}
+
+	return priority
+}
+
+// prioritizeJobs gives the jobs queued before there were priorities the normal one, as a job
+// without one would wait for all others
+func (mongoClient *MongoClient) prioritizeJobs(ctx context.Context) error {
+	_, err := mongoClient.jobs().UpdateMany(ctx,
+		bson.M{"priority": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"priority": JobPriorityNormal}})
+	if err != nil {
+		return err
+	}
+
+	return mongoClient.EnsureJobIndexes(ctx)
+}
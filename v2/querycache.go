@@ -0,0 +1,53 @@
+package application
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// queryKey returns the key of a query on the collection in the query cache, empty when there is
+// no cache. The key ends in the dataset tag, so the entries of the previous datasets are never
+// found again once an import goes live, on any instance, even before they expire. Maps print
+// with sorted keys, so the same query gives the same key.
+func (mongoClient *MongoClient) queryKey(ctx context.Context, collection *mongo.Collection, query ...interface{}) string {
+	appContext := mongoClient.appContext
+	if appContext.queryResults == nil {
+		return ""
+	}
+
+	tag, err := appContext.DatasetTag(ctx)
+	if err != nil || tag == "" {
+		return ""
+	}
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s.%s", collection.Database().Name(), collection.Name())
+	for _, part := range query {
+		fmt.Fprintf(hash, "\n%v", part)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)) + ":" + tag
+}
+
+// cachedQuery returns the result of the query cached under the key
+func (appContext *AppContext) cachedQuery(key string) (interface{}, bool) {
+	if key == "" {
+		return nil, false
+	}
+
+	return appContext.queryResults.get(key)
+}
+
+// cacheQuery keeps the result of the query under the key, results are shared between callers
+// and must not be changed
+func (appContext *AppContext) cacheQuery(key string, result interface{}) {
+	if key == "" {
+		return
+	}
+
+	appContext.queryResults.put(key, result)
+}
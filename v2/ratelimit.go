@@ -0,0 +1,101 @@
+package application
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned when a caller exceeds its request rate
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// maxRateBuckets bounds the number of callers tracked at once
+const maxRateBuckets = 10000
+
+type rateLimitOptions struct {
+	Rate  float64 `json:"rate"`
+	Burst float64 `json:"burst"`
+}
+
+type rateBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// RateLimiter is a token bucket per caller, refilling at Rate tokens per second up to Burst
+type RateLimiter struct {
+	mutex   sync.Mutex
+	Rate    float64
+	Burst   float64
+	buckets map[string]*rateBucket
+}
+
+// NewRateLimiter creates a limiter allowing rate requests per second with the given burst
+func NewRateLimiter(rate float64, burst float64) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &RateLimiter{
+		Rate:    rate,
+		Burst:   burst,
+		buckets: map[string]*rateBucket{}}
+}
+
+// WithRateLimit limits every caller to rate requests per second with the given burst,
+// a zero rate disables the limiter
+func WithRateLimit(rate float64, burst float64) Option {
+	return func(appContext *AppContext) {
+		appContext.RateLimiter = nil
+		if rate > 0 {
+			appContext.RateLimiter = NewRateLimiter(rate, burst)
+		}
+	}
+}
+
+// Allow takes a token from the bucket of the caller, returning false if there is none
+func (limiter *RateLimiter) Allow(key string) bool {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	now := time.Now()
+	bucket, found := limiter.buckets[key]
+	if !found {
+		// Full buckets carry no state, so they are the ones to drop when crowded
+		if len(limiter.buckets) >= maxRateBuckets {
+			for key, bucket := range limiter.buckets {
+				if bucket.tokens+now.Sub(bucket.updated).Seconds()*limiter.Rate >= limiter.Burst {
+					delete(limiter.buckets, key)
+				}
+			}
+		}
+		bucket = &rateBucket{tokens: limiter.Burst, updated: now}
+		limiter.buckets[key] = bucket
+	}
+
+	bucket.tokens += now.Sub(bucket.updated).Seconds() * limiter.Rate
+	if bucket.tokens > limiter.Burst {
+		bucket.tokens = limiter.Burst
+	}
+	bucket.updated = now
+
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+
+	return true
+}
+
+// Limit returns ErrRateLimited when the caller identified by key exceeds its rate
+func (appContext *AppContext) Limit(key string) error {
+	if appContext.RateLimiter == nil {
+		return nil
+	}
+
+	if !appContext.RateLimiter.Allow(key) {
+		return ErrRateLimited
+	}
+
+	return nil
+}
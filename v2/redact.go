@@ -0,0 +1,116 @@
+package application
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// redacted stands in for a secret in logs, errors and health output
+const redacted = "xxxxx"
+
+// secrets are the passwords and keys read from the options, kept for every context created as
+// an error may be shown by the server of another
+var secrets = struct {
+	sync.RWMutex
+	values map[string]bool
+}{values: map[string]bool{}}
+
+// urlCredentials matches the user info of a URL, for secrets that were never registered
+var urlCredentials = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://[^:/@\s]*:)[^@/\s]+@`)
+
+// registerSecret adds the secret to the ones redacted, short values would redact too much
+func registerSecret(secret string) {
+	if len(secret) < 4 {
+		return
+	}
+
+	secrets.Lock()
+	secrets.values[secret] = true
+	secrets.Unlock()
+}
+
+// registerURISecret adds the password in the user info of the URI
+func registerURISecret(uri string) {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.User == nil {
+		return
+	}
+	password, found := parsed.User.Password()
+	if !found {
+		return
+	}
+
+	registerSecret(password)
+	registerSecret(url.QueryEscape(password))
+}
+
+// registerOptionSecrets adds the secrets of the options file
+func registerOptionSecrets(applicationOptions *optionFile) {
+	registerURISecret(applicationOptions.Database)
+	registerSecret(applicationOptions.Storage.Secret)
+	registerSecret(applicationOptions.Replica.Secret)
+	for _, key := range applicationOptions.Auth.APIKeys {
+		registerSecret(key)
+	}
+	registerSecret(applicationOptions.Source.OpenAIPKey)
+	if applicationOptions.Notify.SMTP != nil {
+		registerSecret(applicationOptions.Notify.SMTP.Password)
+	}
+	for _, sinkOption := range applicationOptions.EventSinks {
+		registerSecret(sinkOption.Password)
+		registerURISecret(sinkOption.URL)
+	}
+}
+
+// Redact replaces the registered secrets and the passwords of URLs in the text
+func Redact(text string) string {
+	text = urlCredentials.ReplaceAllString(text, "${1}"+redacted+"@")
+
+	secrets.RLock()
+	defer secrets.RUnlock()
+	for secret := range secrets.values {
+		text = strings.Replace(text, secret, redacted, -1)
+	}
+
+	return text
+}
+
+// redactError returns the error with its secrets redacted, the error itself when it has none
+func redactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	message := Redact(err.Error())
+	if message == err.Error() {
+		return err
+	}
+
+	return errors.New(message)
+}
+
+// redactLog redacts what the standard logger writes, wherever it writes to. A logfile redacts
+// by itself.
+func redactLog() {
+	switch log.Writer().(type) {
+	case *redactWriter, *logWriter:
+		return
+	}
+
+	log.SetOutput(&redactWriter{writer: log.Writer()})
+}
+
+// redactWriter redacts what is written before passing it on
+type redactWriter struct {
+	writer io.Writer
+}
+
+// Write passes the redacted text on, reporting all of p as written
+func (writer *redactWriter) Write(p []byte) (int, error) {
+	_, err := writer.writer.Write([]byte(Redact(string(p))))
+	return len(p), err
+}
@@ -0,0 +1,254 @@
+package application
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// JobRefreshAirport is the kind of job refreshing a single airport, with the ident as param
+const JobRefreshAirport = "refresh-airport"
+
+// AirportRefresh tells what refreshing an airport did, the airport is nil when the closed
+// airports policy dropped it
+type AirportRefresh struct {
+	Ident       string   `json:"ident"`
+	Snapshot    string   `json:"snapshot"`
+	Airport     *Airport `json:"airport"`
+	Runways     int64    `json:"runways"`
+	Frequencies int64    `json:"frequencies"`
+	Report      string   `json:"report"`
+}
+
+// latestOverrides returns the corrections as the latest import applied them, from the snapshot
+// of the overrides CSV if there is one and the collection
+func (mongoClient *MongoClient) latestOverrides(ctx context.Context) (map[string]map[string]string, error) {
+	appContext := mongoClient.appContext
+
+	overrides := map[string]map[string]string{}
+	snapshot, err := appContext.snapshotAsOf(ctx, "overrides", appContext.now())
+	if err != nil && err != ErrNotFound {
+		return nil, err
+	}
+	if err == nil {
+		object, reader, err := appContext.snapshotReader(ctx, &CSVSource{SourceName: "overrides"}, snapshot)
+		if err != nil {
+			return nil, err
+		}
+		overrides, err = readOverrides(reader, nil)
+		object.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return mongoClient.mergeOverrides(ctx, overrides)
+}
+
+// refreshRows upserts the rows of the airport from the latest snapshot of a source keyed by
+// airport_ref, like the runways, and removes the ones the snapshot no longer has. Without a
+// snapshot of the source nothing is done.
+func (mongoClient *MongoClient) refreshRows(ctx context.Context, report *RunReport, source string, base string,
+	airportID int64, convert func(record map[string]string) (*keyedDocument, error)) (int64, error) {
+	appContext := mongoClient.appContext
+
+	snapshot, err := appContext.snapshotAsOf(ctx, source, appContext.now())
+	if err == ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	object, reader, err := appContext.snapshotReader(ctx, &CSVSource{SourceName: source, KeyColumn: "id"}, snapshot)
+	if err != nil {
+		return 0, err
+	}
+	defer object.Close()
+
+	documents := []keyedDocument{}
+	ids := bson.A{}
+	for reader.Next() {
+		record := reader.Record()
+		airportRef, err := parseInt(record, "airport_ref")
+		if err != nil || airportRef != airportID {
+			continue
+		}
+		document, err := convert(record)
+		if err != nil {
+			report.AddError(fmt.Errorf("%s line %d: %v", source, reader.Line(), err))
+			continue
+		}
+		documents = append(documents, *document)
+		ids = append(ids, document.id)
+	}
+	if reader.Err() != nil {
+		return 0, reader.Err()
+	}
+
+	collection := mongoClient.collection(base)
+	_, err = collection.DeleteMany(ctx, bson.M{"airport_ref": airportID, "_id": bson.M{"$nin": ids}})
+	if err != nil {
+		return 0, err
+	}
+
+	return mongoClient.bulkUpsert(ctx, collection, documents, report)
+}
+
+// RefreshAirport spot-fixes a single airport: its row is read again from the latest snapshot of
+// the airports source with the corrections applied, validated like an import does, and
+// upserted with its history; its runways and frequencies follow when their sources were
+// snapshotted, and so does its page. The refresh is reported under the airport-refresh topic.
+func (mongoClient *MongoClient) RefreshAirport(ctx context.Context, ident string) (*AirportRefresh, error) {
+	appContext := mongoClient.appContext
+
+	err := appContext.CheckWritable()
+	if err != nil {
+		return nil, err
+	}
+	ident = NormalizeCode(ident)
+	if ident == "" {
+		return nil, ErrNotFound
+	}
+
+	report := appContext.ReportCreate("airport-refresh")
+	refresh, err := mongoClient.refreshAirport(ctx, report, ident)
+	reportName, reportErr := appContext.ReportClose(ctx, report, err == nil)
+	if reportErr != nil {
+		appContext.LogError(reportErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	refresh.Report = reportName
+
+	// The dataset changed under the same version, the run tells the caches
+	err = mongoClient.recordDataset(ctx, appContext.AirportsSource.Name(), report)
+	if err != nil {
+		return nil, err
+	}
+	appContext.CacheReset()
+
+	return refresh, nil
+}
+
+func (mongoClient *MongoClient) refreshAirport(ctx context.Context, report *RunReport, ident string) (*AirportRefresh, error) {
+	appContext := mongoClient.appContext
+	source := appContext.AirportsSource
+	refresh := AirportRefresh{Ident: ident}
+
+	snapshot, err := appContext.snapshotAsOf(ctx, source.Name(), appContext.now())
+	if err != nil {
+		return nil, err
+	}
+	refresh.Snapshot = snapshot
+
+	// The history is recorded under the version live now, which the snapshot is normally of
+	datasets, err := appContext.cachedDatasets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, dataset := range datasets {
+		if dataset.Source == source.Name() {
+			report.setVersion(source.Name(), dataset.Version)
+		}
+	}
+
+	overrides, err := mongoClient.latestOverrides(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	object, reader, err := appContext.snapshotReader(ctx, source, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	var record map[string]string
+	for record == nil && reader.Next() {
+		if NormalizeCode(reader.Record()["ident"]) == ident {
+			record = reader.Record()
+		}
+	}
+	object.Close()
+	if reader.Err() != nil {
+		return nil, reader.Err()
+	}
+	if record == nil {
+		return nil, ErrNotFound
+	}
+
+	report.AddCount("overrides", applyOverrides([]map[string]string{record}, overrides))
+	airport, err := airportFromRecord(record)
+	if err != nil {
+		report.AddError(err)
+		return nil, fmt.Errorf("%s: %v", ident, err)
+	}
+	if appContext.dropsClosed(airport) {
+		report.AddCount("closed-dropped", 1)
+		_, err = mongoClient.airports().DeleteOne(ctx, bson.M{"_id": airport.AirportID})
+		if err != nil {
+			return nil, err
+		}
+		return &refresh, mongoClient.refreshAirportPage(ctx, airport.AirportID)
+	}
+	enriched, err := appContext.enrich(ctx, source.Name(), airport)
+	if err != nil {
+		report.AddError(err)
+		return nil, fmt.Errorf("%s: %v", ident, err)
+	}
+	airport, _ = enriched.(*Airport)
+	if airport == nil {
+		report.AddCount("dropped", 1)
+		return &refresh, nil
+	}
+
+	_, err = mongoClient.storeAirports(ctx, report, mongoClient.airports())([]keyedDocument{{id: airport.AirportID, document: airport}})
+	if err != nil {
+		return nil, err
+	}
+	refresh.Airport = airport
+
+	refresh.Runways, err = mongoClient.refreshRows(ctx, report, "runways", RunwaysCollection, airport.AirportID,
+		func(record map[string]string) (*keyedDocument, error) {
+			runway, err := runwayFromRecord(record)
+			if err != nil {
+				return nil, err
+			}
+			appContext.normalizeSurface(report, runway)
+			return &keyedDocument{id: runway.RunwayID, document: runway}, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	refresh.Frequencies, err = mongoClient.refreshRows(ctx, report, "frequencies", FrequenciesCollection, airport.AirportID,
+		func(record map[string]string) (*keyedDocument, error) {
+			frequency, err := frequencyFromRecord(record)
+			if err != nil {
+				return nil, err
+			}
+			return &keyedDocument{id: frequency.FrequencyID, document: frequency}, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return &refresh, mongoClient.refreshAirportPage(ctx, airport.AirportID)
+}
+
+// RefreshAirportJob is the handler of refresh-airport jobs
+func (appContext *AppContext) RefreshAirportJob(ctx context.Context, job *Job) error {
+	mongoClient, err := appContext.DBOpen()
+	if err != nil {
+		return err
+	}
+	defer mongoClient.DBClose()
+
+	_, err = mongoClient.RefreshAirport(ctx, job.Params["ident"])
+
+	return err
+}
+
+// HandleRefresh registers the handler of refresh-airport jobs
+func (worker *JobWorker) HandleRefresh() {
+	worker.Handle(JobRefreshAirport, worker.appContext.RefreshAirportJob)
+}
@@ -0,0 +1,229 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// ErrNoReplica is returned when replicating without a replica configured
+var ErrNoReplica = errors.New("no replica configured")
+
+// defaultReplicaBuckets are the buckets holding what cannot be downloaded again: the source
+// snapshots and the run reports
+var defaultReplicaBuckets = []string{"csv", "reports"}
+
+// replicaOptions describes the replica section of the options file, a second S3 endpoint in
+// another region or at another provider
+type replicaOptions struct {
+	Server  string   `json:"server"`
+	Key     string   `json:"key"`
+	Secret  string   `json:"secret"`
+	Secure  bool     `json:"secure"`
+	Region  string   `json:"region"`
+	Buckets []string `json:"buckets"`
+}
+
+// ReplicationReport counts the objects copied to the replica per bucket
+type ReplicationReport struct {
+	Copied  map[string]int64 `json:"copied"`
+	Skipped map[string]int64 `json:"skipped"`
+	Bytes   int64            `json:"bytes"`
+}
+
+// Replicator copies the objects of the buckets to a secondary object store
+type Replicator struct {
+	client  *minio.Client
+	region  string
+	buckets []string
+	pending sync.WaitGroup
+}
+
+// NewReplicator copies to the S3 endpoint with the given credentials, the buckets default to
+// the csv snapshots and the reports
+func NewReplicator(server string, key string, secret string, secure bool, region string, buckets []string) (*Replicator, error) {
+	client, err := minio.New(server, &minio.Options{Creds: credentials.NewStaticV4(key, secret, ""), Secure: secure})
+	if err != nil {
+		return nil, err
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	if len(buckets) == 0 {
+		buckets = defaultReplicaBuckets
+	}
+
+	return &Replicator{client: client, region: region, buckets: buckets}, nil
+}
+
+// WithReplicator copies the snapshots and reports to a secondary object store after each run
+func WithReplicator(replicator *Replicator) Option {
+	return func(appContext *AppContext) {
+		appContext.Replicator = replicator
+	}
+}
+
+// newReplicator creates the replicator configured in the options file, nil if there is none
+func newReplicator(options replicaOptions) (*Replicator, error) {
+	if options.Server == "" {
+		return nil, nil
+	}
+
+	return NewReplicator(options.Server, options.Key, options.Secret, options.Secure, options.Region, options.Buckets)
+}
+
+// replicates tells whether the objects of the bucket are copied to the replica
+func (replicator *Replicator) replicates(bucket string) bool {
+	for _, replicated := range replicator.buckets {
+		if replicated == bucket {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ensureBucket creates the bucket on the replica when it is missing, telling whether it was
+func (replicator *Replicator) ensureBucket(ctx context.Context, bucket string) (bool, error) {
+	bucketFound, err := replicator.client.BucketExists(ctx, bucket)
+	if err != nil || bucketFound {
+		return false, err
+	}
+
+	return true, replicator.client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{Region: replicator.region})
+}
+
+// replicaSizes lists the objects in the bucket of the replica with their size, creating the
+// bucket when it is missing
+func (replicator *Replicator) replicaSizes(ctx context.Context, bucket string) (map[string]int64, error) {
+	sizes := map[string]int64{}
+
+	created, err := replicator.ensureBucket(ctx, bucket)
+	if err != nil || created {
+		return sizes, err
+	}
+
+	listCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for objectInfo := range replicator.client.ListObjects(listCtx, bucket, minio.ListObjectsOptions{Recursive: true}) {
+		if objectInfo.Err != nil {
+			return nil, objectInfo.Err
+		}
+		sizes[objectInfo.Key] = objectInfo.Size
+	}
+
+	return sizes, nil
+}
+
+// copyObject streams an object with its tags from the primary store to the replica, returning
+// its size
+func (replicator *Replicator) copyObject(ctx context.Context, source *minio.Client, bucket string, key string) (int64, error) {
+	object, err := source.GetObject(ctx, bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return 0, err
+	}
+	defer object.Close()
+
+	// Listing leaves out the metadata, the object itself carries its content type and tags
+	stat, err := object.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = replicator.client.PutObject(ctx, bucket, key, object, stat.Size,
+		objectTags(stat).putOptions(stat.ContentType))
+
+	return stat.Size, err
+}
+
+// Replicate copies the objects missing on the replica, or differing in size, from the primary
+// object store. Snapshots and reports are never changed once written, so an object that
+// is there already is skipped.
+func (appContext *AppContext) Replicate(ctx context.Context) (*ReplicationReport, error) {
+	replicator := appContext.Replicator
+	report := ReplicationReport{Copied: map[string]int64{}, Skipped: map[string]int64{}}
+	if replicator == nil {
+		return &report, ErrNoReplica
+	}
+	if appContext.S3Client() == nil {
+		return &report, ErrNoStorage
+	}
+
+	for _, bucket := range replicator.buckets {
+		replicated, err := replicator.replicaSizes(ctx, bucket)
+		if err != nil {
+			return &report, fmt.Errorf("replica %s: %v", bucket, err)
+		}
+
+		listCtx, cancel := context.WithCancel(ctx)
+		for objectInfo := range appContext.S3Client().ListObjects(listCtx, bucket, minio.ListObjectsOptions{Recursive: true}) {
+			if objectInfo.Err != nil {
+				cancel()
+				return &report, objectInfo.Err
+			}
+
+			size, found := replicated[objectInfo.Key]
+			if found && size == objectInfo.Size {
+				report.Skipped[bucket]++
+				continue
+			}
+
+			_, err = replicator.copyObject(ctx, appContext.S3Client(), bucket, objectInfo.Key)
+			if err != nil {
+				cancel()
+				return &report, fmt.Errorf("replica %s/%s: %v", bucket, objectInfo.Key, err)
+			}
+			report.Copied[bucket]++
+			report.Bytes += objectInfo.Size
+		}
+		cancel()
+	}
+
+	return &report, nil
+}
+
+// replicateRun copies the snapshots and report of the run just closed in the background, so
+// closing the run does not wait for the replica; Destroy does. A failure is logged and left
+// for Replicate to catch up on.
+func (appContext *AppContext) replicateRun(objects []storedObject) {
+	replicator := appContext.Replicator
+	source := appContext.S3Client()
+	if replicator == nil || source == nil {
+		return
+	}
+
+	replicator.pending.Add(1)
+	go func() {
+		defer replicator.pending.Done()
+
+		ctx := context.Background()
+		report := ReplicationReport{Copied: map[string]int64{}, Skipped: map[string]int64{}}
+		ensured := map[string]bool{}
+		for _, object := range objects {
+			if !replicator.replicates(object.bucket) {
+				continue
+			}
+			if !ensured[object.bucket] {
+				_, err := replicator.ensureBucket(ctx, object.bucket)
+				if err != nil {
+					appContext.LogError(fmt.Errorf("replica %s: %v", object.bucket, err))
+					return
+				}
+				ensured[object.bucket] = true
+			}
+
+			size, err := replicator.copyObject(ctx, source, object.bucket, object.key)
+			if err != nil {
+				appContext.LogError(fmt.Errorf("replica %s/%s: %v", object.bucket, object.key, err))
+				return
+			}
+			report.Copied[object.bucket]++
+			report.Bytes += size
+		}
+		appContext.Logger().With("copied", report.Copied, "bytes", report.Bytes).Println("Replica: updated")
+	}()
+}
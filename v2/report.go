@@ -0,0 +1,250 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxErrorSamples limits the number of errors kept in a report
+const maxErrorSamples = 25
+
+// StageReport describes the timing and volume of a single stage in a run
+type StageReport struct {
+	Name     string        `json:"name"`
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"`
+	Rows     int64         `json:"rows"`
+}
+
+// RunReport is the machine-readable summary of a single pipeline run
+type RunReport struct {
+	mutex         sync.Mutex
+	clock         Clock
+	RunID         string                    `json:"run-id"`
+	Name          string                    `json:"name"`
+	Topic         string                    `json:"topic"`
+	Started       time.Time                 `json:"started"`
+	Finished      time.Time                 `json:"finished"`
+	Succeeded     bool                      `json:"succeeded"`
+	Stages        []*StageReport            `json:"stages"`
+	Errors        int64                     `json:"errors"`
+	Samples       []string                  `json:"error-samples"`
+	Versions      map[string]string         `json:"versions"`
+	Counts        map[string]int64          `json:"counts"`
+	Usage         map[string]*ResourceUsage `json:"usage"`
+	KeptWorkspace string                    `json:"workspace,omitempty"`
+	workspace     *Workspace
+	objects       []storedObject
+}
+
+// storedObject is an object the run wrote to the object store, by its full key
+type storedObject struct {
+	bucket string
+	key    string
+}
+
+// addObject registers an object written by the run, so it can be replicated when it closes
+func (report *RunReport) addObject(bucket string, key string) {
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+
+	report.objects = append(report.objects, storedObject{bucket: bucket, key: key})
+}
+
+// ReportCreate starts a new report for the given topic
+func (appContext *AppContext) ReportCreate(topic string) *RunReport {
+	runID := appContext.newID().Hex()
+
+	return &RunReport{
+		clock:     appContext.Clock,
+		RunID:     runID,
+		Topic:     topic,
+		Started:   appContext.now(),
+		Stages:    []*StageReport{},
+		Samples:   []string{},
+		Versions:  map[string]string{},
+		Counts:    map[string]int64{},
+		Usage:     map[string]*ResourceUsage{},
+		workspace: appContext.newWorkspace(runID)}
+}
+
+// Workspace returns the scratch area of the run, cleaned up when the report is closed; a report
+// read back only tells where a failed run kept it
+func (report *RunReport) Workspace() *Workspace {
+	return report.workspace
+}
+
+// now reads the clock of the AppContext that created the report
+func (report *RunReport) now() time.Time {
+	if report.clock == nil {
+		return time.Now()
+	}
+
+	return report.clock.Now()
+}
+
+// findStage returns the latest stage of the name, as a run may import several sources
+func (report *RunReport) findStage(name string) *StageReport {
+	for i := len(report.Stages) - 1; i >= 0; i-- {
+		if report.Stages[i].Name == name {
+			return report.Stages[i]
+		}
+	}
+
+	return nil
+}
+
+// StageStart registers the start of a stage
+func (report *RunReport) StageStart(name string) {
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+
+	report.Stages = append(report.Stages, &StageReport{Name: name, Started: report.now()})
+}
+
+// StageEnd registers the end of a stage and the number of rows it processed
+func (report *RunReport) StageEnd(name string, rows int64) {
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+
+	stage := report.findStage(name)
+	if stage == nil {
+		return
+	}
+
+	stage.Duration = report.now().Sub(stage.Started)
+	stage.Rows = rows
+}
+
+// AddError counts an error and keeps a sample of the first ones
+func (report *RunReport) AddError(err error) {
+	if err == nil {
+		return
+	}
+
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+
+	report.Errors++
+	if len(report.Samples) < maxErrorSamples {
+		report.Samples = append(report.Samples, Redact(err.Error()))
+	}
+}
+
+// AddCount adds to a named counter, like the number of imported rows per category
+func (report *RunReport) AddCount(name string, n int64) {
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+
+	report.Counts[name] += n
+}
+
+// count returns the named count
+func (report *RunReport) count(name string) int64 {
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+
+	return report.Counts[name]
+}
+
+// AddVersion registers the hash of the source data used for the given source
+func (report *RunReport) AddVersion(source string, data []byte) string {
+	hash := sha256.Sum256(data)
+
+	return report.setVersion(source, hex.EncodeToString(hash[:]))
+}
+
+// setVersion registers a version computed elsewhere, like while streaming the source
+func (report *RunReport) setVersion(source string, version string) string {
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+
+	report.Versions[source] = version
+
+	return version
+}
+
+// ReportClose finalizes the report and stores it in S3 for the tenant of the context, returning
+// the object name
+func (appContext *AppContext) ReportClose(ctx context.Context, report *RunReport, succeeded bool) (string, error) {
+
+	kept := ""
+	if report.workspace != nil {
+		kept = appContext.closeWorkspace(ctx, report.workspace, succeeded)
+	}
+
+	report.mutex.Lock()
+	report.KeptWorkspace = kept
+	report.Finished = report.now()
+	report.Succeeded = succeeded
+	report.Name = fmt.Sprintf("%s-%s.json", report.Topic, report.Started.Format("20060102-150405"))
+	reportData, err := json.MarshalIndent(report, "", "  ")
+	tags := ObjectTags{TagRunID: report.RunID, TagTopic: report.Topic, TagSucceeded: strconv.FormatBool(succeeded)}
+	report.mutex.Unlock()
+	if err != nil {
+		return "", err
+	}
+
+	err = appContext.putObject(ctx, "reports", report.Name, bytes.NewReader(reportData),
+		int64(len(reportData)), tags.putOptions("application/json"))
+	if err != nil {
+		return "", err
+	}
+	key, _ := appContext.objectKey(ctx, report.Name)
+	report.addObject("reports", key)
+
+	report.mutex.Lock()
+	objects := append([]storedObject{}, report.objects...)
+	report.mutex.Unlock()
+	appContext.replicateRun(objects)
+
+	return report.Name, nil
+}
+
+// Report retrieves a stored report of the tenant of the context by its object name
+func (appContext *AppContext) Report(ctx context.Context, name string) (*RunReport, error) {
+
+	reportObject, err := appContext.getObject(ctx, "reports", name)
+	if err != nil {
+		return nil, err
+	}
+	defer reportObject.Close()
+
+	var report RunReport
+	err = json.NewDecoder(reportObject).Decode(&report)
+	if err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
+
+// ReportLatest retrieves the most recent report for the given topic
+func (appContext *AppContext) ReportLatest(ctx context.Context, topic string) (*RunReport, error) {
+
+	reports, err := appContext.listObjects(ctx, "reports", topic+"-", false)
+	if err != nil {
+		return nil, err
+	}
+
+	// Names are date-stamped, so the last one in lexical order is the latest
+	latest := ""
+	for _, reportInfo := range reports {
+		if reportInfo.Key > latest {
+			latest = reportInfo.Key
+		}
+	}
+
+	if latest == "" {
+		return nil, fmt.Errorf("no report for %s", topic)
+	}
+
+	return appContext.Report(ctx, latest)
+}
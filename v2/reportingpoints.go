@@ -0,0 +1,141 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/ralph-nijpels/geography-application/v2/units"
+)
+
+// ErrNoSource is returned when importing from a source that is not configured
+var ErrNoSource = errors.New("source not configured")
+
+// ReportingPoint describes a VFR reporting point as stored in the reporting points collection
+type ReportingPoint struct {
+	ReportingPointID string           `bson:"_id" json:"id"`
+	Name             string           `bson:"name" json:"name"`
+	Country          string           `bson:"iso_country" json:"country"`
+	Compulsory       bool             `bson:"compulsory" json:"compulsory"`
+	Location         Coordinate       `bson:"location" json:"location"`
+	Elevation        units.LengthFeet `bson:"elevation_ft,omitempty" json:"elevation-ft,omitempty"`
+}
+
+func (mongoClient *MongoClient) reportingPoints() *mongo.Collection {
+	return mongoClient.collection(ReportingPointsCollection)
+}
+
+// reportingPointFromRecord converts a record of the openAIP reporting points
+func reportingPointFromRecord(record map[string]string) (*ReportingPoint, error) {
+	var err error
+	reportingPoint := ReportingPoint{
+		ReportingPointID: record["id"],
+		Name:             record["name"],
+		Country:          NormalizeCode(record["country"])}
+
+	reportingPoint.Compulsory, _ = strconv.ParseBool(record["compulsory"])
+	reportingPoint.Location, err = ParseCoordinate(record["latitude_deg"], record["longitude_deg"])
+	if err != nil {
+		return nil, err
+	}
+	elevation, err := parseFloat(record, "elevation_ft")
+	if err != nil {
+		return nil, err
+	}
+	reportingPoint.Elevation = units.LengthFeet(elevation)
+
+	return &reportingPoint, nil
+}
+
+// EnsureReportingPointIndexes creates the indexes backing the lookups by country and the geo
+// queries
+func (mongoClient *MongoClient) EnsureReportingPointIndexes(ctx context.Context) error {
+	return mongoClient.ensureReportingPointIndexes(ctx, mongoClient.reportingPoints())
+}
+
+// ensureReportingPointIndexes creates the reporting point indexes on the given collection, which may be a shadow
+// collection that is swapped in later
+func (mongoClient *MongoClient) ensureReportingPointIndexes(ctx context.Context, collection *mongo.Collection) error {
+	err := mongoClient.appContext.CheckWritable()
+	if err != nil {
+		return err
+	}
+
+	_, err = collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "location", Value: "2dsphere"}}},
+		{Keys: bson.D{{Key: "iso_country", Value: 1}}},
+	})
+
+	return err
+}
+
+// ImportReportingPoints imports the VFR reporting points from openAIP
+func (mongoClient *MongoClient) ImportReportingPoints(ctx context.Context, report *RunReport) error {
+	appContext := mongoClient.appContext
+
+	err := appContext.CheckWritable()
+	if err != nil {
+		return err
+	}
+	if appContext.ReportingPointsSource == nil {
+		return ErrNoSource
+	}
+
+	err = mongoClient.EnsureReportingPointIndexes(ctx)
+	if err != nil {
+		return err
+	}
+
+	live, err := mongoClient.reportingPoints().CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	_, err = appContext.importSource(ctx, report, appContext.ReportingPointsSource, live,
+		func(record map[string]string) (*keyedDocument, error) {
+			reportingPoint, err := reportingPointFromRecord(record)
+			if err != nil {
+				return nil, err
+			}
+			return &keyedDocument{id: reportingPoint.ReportingPointID, document: reportingPoint}, nil
+		},
+		func(batch []keyedDocument) (int64, error) {
+			return mongoClient.bulkUpsert(ctx, mongoClient.reportingPoints(), batch, report)
+		})
+	if err != nil {
+		return err
+	}
+
+	err = mongoClient.recordDataset(ctx, appContext.ReportingPointsSource.Name(), report)
+	if err != nil {
+		return err
+	}
+	err = mongoClient.RefreshViews(ctx)
+	if err != nil {
+		return err
+	}
+	appContext.CacheReset()
+
+	return nil
+}
+
+// ReportingPointsByCountry lists the reporting points of a country by name
+func (mongoClient *MongoClient) ReportingPointsByCountry(ctx context.Context, country string) ([]*ReportingPoint, error) {
+
+	cursor, err := mongoClient.readCollection(ReportingPointsCollection).Find(ctx, bson.M{"iso_country": NormalizeCode(country)},
+		options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*ReportingPoint{}
+	err = cursor.All(ctx, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,37 @@
+package application
+
+import (
+	"context"
+)
+
+// requestIDKey is the context key of the request ID
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the request ID, it ends up in the logs of all
+// operations done on behalf of the request
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the request ID carried by the context, empty if there is none
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// NewRequestID hands out an ID for a request that did not bring one
+func (appContext *AppContext) NewRequestID() string {
+	return appContext.newID().Hex()
+}
+
+// ContextLogger returns a logger with the request ID of the context, if any
+func (appContext *AppContext) ContextLogger(ctx context.Context) *Logger {
+	logger := appContext.Logger()
+
+	requestID := RequestID(ctx)
+	if requestID != "" {
+		logger = logger.With("request-id", requestID)
+	}
+
+	return logger
+}
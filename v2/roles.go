@@ -0,0 +1,130 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrForbidden is returned when the caller lacks the role an operation requires
+var ErrForbidden = errors.New("forbidden")
+
+// Role is the level of access of a caller, each role includes the ones below it
+type Role string
+
+// The roles, from least to most access
+const (
+	RoleReader   Role = "reader"
+	RoleImporter Role = "importer"
+	RoleAdmin    Role = "admin"
+)
+
+// roleRanks orders the roles, a higher rank includes the lower ones
+var roleRanks = map[Role]int{
+	RoleReader:   1,
+	RoleImporter: 2,
+	RoleAdmin:    3,
+}
+
+// ParseRole returns the role with the given name
+func ParseRole(name string) (Role, error) {
+	role := Role(name)
+	if roleRanks[role] == 0 {
+		return "", fmt.Errorf("unknown role: %s", name)
+	}
+
+	return role, nil
+}
+
+// Includes tells whether the role grants at least the access of the other role
+func (role Role) Includes(other Role) bool {
+	return roleRanks[role] >= roleRanks[other]
+}
+
+// WithRoles grants roles to the subjects of tokens, callers without one are readers
+func WithRoles(roles map[string]Role) Option {
+	return func(appContext *AppContext) {
+		appContext.Roles = roles
+	}
+}
+
+// WithAPIKeyRoles grants roles to API keys, by the name of the key
+func WithAPIKeyRoles(roles map[string]Role) Option {
+	return func(appContext *AppContext) {
+		appContext.APIKeyRoles = roles
+	}
+}
+
+// parseRoles converts a roles section of the options file
+func parseRoles(section string, names map[string]string) (map[string]Role, error) {
+	roles := map[string]Role{}
+
+	for subject, name := range names {
+		role, err := ParseRole(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", section, subject, err)
+		}
+		roles[subject] = role
+	}
+
+	return roles, nil
+}
+
+// claimedRoles returns the roles in the roles claim of a token, ignoring names not known
+func claimedRoles(claims map[string]interface{}) []Role {
+	roles := []Role{}
+
+	values, _ := claims["roles"].([]interface{})
+	if name, ok := claims["role"].(string); ok {
+		values = append(values, name)
+	}
+	for _, value := range values {
+		name, _ := value.(string)
+		role, err := ParseRole(name)
+		if err == nil {
+			roles = append(roles, role)
+		}
+	}
+
+	return roles
+}
+
+// RoleOf returns the highest role of the principal, from the roles configured for its API key
+// or for the subject and claims of its token, a principal without one is a reader
+func (appContext *AppContext) RoleOf(principal *Principal) Role {
+	role := RoleReader
+
+	roles := appContext.Roles
+	if principal.Method == "api-key" {
+		roles = appContext.APIKeyRoles
+	}
+	granted, found := roles[principal.Subject]
+	if found && granted.Includes(role) {
+		role = granted
+	}
+	for _, claimed := range claimedRoles(principal.Claims) {
+		if claimed.Includes(role) {
+			role = claimed
+		}
+	}
+
+	return role
+}
+
+// Authorize returns ErrForbidden unless the caller of the context holds the role. Without an
+// authenticator nobody is identified, so like authentication the check is off.
+func (appContext *AppContext) Authorize(ctx context.Context, role Role) error {
+	if appContext.Authenticator == nil {
+		return nil
+	}
+
+	principal := PrincipalFrom(ctx)
+	if principal == nil {
+		return ErrUnauthenticated
+	}
+	if !appContext.RoleOf(principal).Includes(role) {
+		return ErrForbidden
+	}
+
+	return nil
+}
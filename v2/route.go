@@ -0,0 +1,188 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/ralph-nijpels/geography-application/v2/units"
+)
+
+// earthRadiusKm is the mean radius of the earth
+const earthRadiusKm = 6371.0
+
+// routeSampleKm is the spacing of the samples taken along a route to build its corridor
+const routeSampleKm = 100.0
+
+// ErrEmptyRoute is returned for a route without length or a corridor without width
+var ErrEmptyRoute = errors.New("route and corridor need a length and width")
+
+// AirportOnRoute is an airport within a route corridor, with its distance from the start
+// of the route measured along the route and its distance off the route
+type AirportOnRoute struct {
+	Airport *Airport         `json:"airport"`
+	Along   units.DistanceKm `json:"along-km"`
+	Offset  units.DistanceKm `json:"offset-km"`
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+func degrees(radians float64) float64 {
+	return radians * 180 / math.Pi
+}
+
+// angularDistance returns the great-circle distance between the coordinates in radians
+func angularDistance(from Coordinate, to Coordinate) float64 {
+	dLatitude := radians(to.Latitude - from.Latitude)
+	dLongitude := radians(to.Longitude - from.Longitude)
+
+	a := math.Sin(dLatitude/2)*math.Sin(dLatitude/2) +
+		math.Cos(radians(from.Latitude))*math.Cos(radians(to.Latitude))*math.Sin(dLongitude/2)*math.Sin(dLongitude/2)
+
+	return 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// GreatCircleDistance returns the distance between the coordinates over the surface of the earth
+func GreatCircleDistance(from Coordinate, to Coordinate) units.DistanceKm {
+	return units.DistanceKm(angularDistance(from, to) * earthRadiusKm)
+}
+
+// initialBearing returns the bearing in radians to follow from the first coordinate to the second
+func initialBearing(from Coordinate, to Coordinate) float64 {
+	latitude1 := radians(from.Latitude)
+	latitude2 := radians(to.Latitude)
+	dLongitude := radians(to.Longitude - from.Longitude)
+
+	return math.Atan2(math.Sin(dLongitude)*math.Cos(latitude2),
+		math.Cos(latitude1)*math.Sin(latitude2)-math.Sin(latitude1)*math.Cos(latitude2)*math.Cos(dLongitude))
+}
+
+// destination returns the coordinate reached following the bearing in radians for the distance,
+// a negative distance goes the opposite way
+func destination(from Coordinate, bearing float64, distance units.DistanceKm) Coordinate {
+	latitude := radians(from.Latitude)
+	angle := float64(distance) / earthRadiusKm
+
+	latitude2 := math.Asin(math.Sin(latitude)*math.Cos(angle) + math.Cos(latitude)*math.Sin(angle)*math.Cos(bearing))
+	longitude2 := radians(from.Longitude) + math.Atan2(math.Sin(bearing)*math.Sin(angle)*math.Cos(latitude),
+		math.Cos(angle)-math.Sin(latitude)*math.Sin(latitude2))
+
+	return Coordinate{Latitude: degrees(latitude2), Longitude: degrees(longitude2)}.Normalize()
+}
+
+// routePosition returns the distance of the point along the great circle from the start of the
+// route and its distance off the route
+func routePosition(from Coordinate, bearing float64, point Coordinate) (units.DistanceKm, units.DistanceKm) {
+	distance := angularDistance(from, point)
+	relative := initialBearing(from, point) - bearing
+
+	crossTrack := math.Asin(math.Sin(distance) * math.Sin(relative))
+	alongTrack := math.Acos(math.Max(-1, math.Min(1, math.Cos(distance)/math.Cos(crossTrack))))
+	if math.Cos(relative) < 0 {
+		alongTrack = -alongTrack
+	}
+
+	return units.DistanceKm(alongTrack * earthRadiusKm), units.DistanceKm(math.Abs(crossTrack) * earthRadiusKm)
+}
+
+// SampleRoute returns the points along the great circle between the coordinates, no further
+// apart than the spacing and including both ends
+func SampleRoute(from Coordinate, to Coordinate, spacing units.DistanceKm) []Coordinate {
+	return sampleRoute(from, initialBearing(from, to), 0, GreatCircleDistance(from, to), spacing)
+}
+
+func sampleRoute(from Coordinate, bearing float64, start units.DistanceKm, end units.DistanceKm, spacing units.DistanceKm) []Coordinate {
+	count := int(math.Ceil(float64((end - start) / spacing)))
+	if count < 1 {
+		count = 1
+	}
+
+	samples := make([]Coordinate, count+1)
+	for i := range samples {
+		samples[i] = destination(from, bearing, start+(end-start)*units.DistanceKm(i)/units.DistanceKm(count))
+	}
+
+	return samples
+}
+
+// routeCorridor returns the GeoJSON polygon around the great circle between the coordinates,
+// extending the width on all sides, including beyond both ends
+func routeCorridor(from Coordinate, to Coordinate, width units.DistanceKm) Boundary {
+	bearing := initialBearing(from, to)
+	samples := sampleRoute(from, bearing, -width, GreatCircleDistance(from, to)+width, routeSampleKm)
+
+	left := make([][2]float64, len(samples))
+	right := make([][2]float64, len(samples))
+	for i, sample := range samples {
+		// The track at the sample is the bearing towards the next, or away from the previous
+		var track float64
+		if i < len(samples)-1 {
+			track = initialBearing(sample, samples[i+1])
+		} else {
+			track = initialBearing(sample, samples[i-1]) + math.Pi
+		}
+
+		point := destination(sample, track-math.Pi/2, width)
+		left[i] = [2]float64{point.Longitude, point.Latitude}
+		point = destination(sample, track+math.Pi/2, width)
+		right[len(samples)-1-i] = [2]float64{point.Longitude, point.Latitude}
+	}
+
+	ring := append(left, right...)
+	ring = append(ring, ring[0])
+
+	return Boundary{Type: "Polygon", Coordinates: [][][2]float64{ring}}
+}
+
+// AirportsAlongRoute returns the airports within the corridor around the great circle between
+// the coordinates, ordered by their distance along the route. The corridor extends beyond both
+// ends, so the airports around departure and destination are included as well.
+func (mongoClient *MongoClient) AirportsAlongRoute(ctx context.Context, from Coordinate, to Coordinate, corridor units.DistanceKm) ([]*AirportOnRoute, error) {
+
+	from = from.Normalize()
+	to = to.Normalize()
+	for _, coordinate := range []Coordinate{from, to} {
+		err := coordinate.Validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if corridor <= 0 || GreatCircleDistance(from, to) == 0 {
+		return nil, ErrEmptyRoute
+	}
+
+	filter := bson.M{"location": bson.M{"$geoWithin": bson.M{"$geometry": routeCorridor(from, to, corridor)}}}
+	filter = mongoClient.appContext.excludeClosed(ctx, filter)
+	cursor, err := mongoClient.readCollection(AirportsCollection).Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	airports := []*Airport{}
+	err = cursor.All(ctx, &airports)
+	if err != nil {
+		return nil, err
+	}
+
+	bearing := initialBearing(from, to)
+	result := make([]*AirportOnRoute, 0, len(airports))
+	for _, airport := range airports {
+		along, offset := routePosition(from, bearing, airport.Location)
+		result = append(result, &AirportOnRoute{Airport: airport, Along: along, Offset: offset})
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Along < result[j].Along
+	})
+
+	limit := mongoClient.appContext.PageLimit(0)
+	if limit > 0 && int64(len(result)) > limit {
+		result = result[:limit]
+	}
+
+	return result, nil
+}
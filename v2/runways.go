@@ -0,0 +1,204 @@
+package application
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/ralph-nijpels/geography-application/v2/units"
+)
+
+// Runway describes a runway as stored in the runways collection
+type Runway struct {
+	RunwayID     int64            `bson:"_id" json:"id"`
+	AirportID    int64            `bson:"airport_ref" json:"airport-id"`
+	AirportIdent string           `bson:"airport_ident" json:"airport-ident"`
+	Length       units.LengthFeet `bson:"length_ft,omitempty" json:"length-ft,omitempty"`
+	Width        units.LengthFeet `bson:"width_ft,omitempty" json:"width-ft,omitempty"`
+	Surface      string           `bson:"surface,omitempty" json:"surface,omitempty"`
+	SurfaceType  RunwaySurface    `bson:"surface_type,omitempty" json:"surface-type,omitempty"`
+	Lighted      bool             `bson:"lighted" json:"lighted"`
+	Closed       bool             `bson:"closed" json:"closed"`
+	LowIdent     string           `bson:"le_ident,omitempty" json:"le-ident,omitempty"`
+	HighIdent    string           `bson:"he_ident,omitempty" json:"he-ident,omitempty"`
+}
+
+func (mongoClient *MongoClient) runways() *mongo.Collection {
+	return mongoClient.collection(RunwaysCollection)
+}
+
+// runwayFromRecord converts a row of the OurAirports runways file
+func runwayFromRecord(record map[string]string) (*Runway, error) {
+	var err error
+	runway := Runway{
+		AirportIdent: record["airport_ident"],
+		Surface:      record["surface"],
+		LowIdent:     NormalizeCode(record["le_ident"]),
+		HighIdent:    NormalizeCode(record["he_ident"])}
+
+	runway.RunwayID, err = parseInt(record, "id")
+	if err != nil {
+		return nil, err
+	}
+	runway.AirportID, err = parseInt(record, "airport_ref")
+	if err != nil {
+		return nil, err
+	}
+	length, err := parseFloat(record, "length_ft")
+	if err != nil {
+		return nil, err
+	}
+	runway.Length = units.LengthFeet(length)
+	width, err := parseFloat(record, "width_ft")
+	if err != nil {
+		return nil, err
+	}
+	runway.Width = units.LengthFeet(width)
+	runway.Lighted, err = parseFlag(record, "lighted")
+	if err != nil {
+		return nil, err
+	}
+	runway.Closed, err = parseFlag(record, "closed")
+	if err != nil {
+		return nil, err
+	}
+
+	return &runway, nil
+}
+
+// RunwaysByAirport returns the runways of the given airport
+func (mongoClient *MongoClient) RunwaysByAirport(ctx context.Context, airportID int64) ([]*Runway, error) {
+
+	cursor, err := mongoClient.readCollection(RunwaysCollection).Find(ctx, bson.M{"airport_ref": airportID},
+		options.Find().SetSort(bson.M{"le_ident": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	runways := []*Runway{}
+	err = cursor.All(ctx, &runways)
+	if err != nil {
+		return nil, err
+	}
+
+	return runways, nil
+}
+
+// pavedSurfaces lists the surface codes in the source data that count as paved
+var pavedSurfaces = []string{
+	"ASP", "ASPH", "ASPHALT", "CON", "CONC", "CONCRETE", "PEM", "BIT", "BITUMEN", "TAR", "PAVED",
+	"ASP-CON", "CON-ASP", "ASPH-CONC", "CONC-ASPH", "TARMAC", "BRI", "BRICK"}
+
+// RunwayFilter selects the runways an airport needs to have, an empty filter accepts any
+// open runway. Surfaces are as in the source data, surface types the canonical ones.
+type RunwayFilter struct {
+	MinLength     units.LengthFeet
+	Surfaces      []string
+	SurfaceTypes  []RunwaySurface
+	Paved         bool
+	IncludeClosed bool
+}
+
+// AirportRunways is an airport with its distance from the search location and the runways
+// that matched the filter, longest first
+type AirportRunways struct {
+	Airport  *Airport         `bson:"airport" json:"airport"`
+	Distance units.DistanceKm `bson:"-" json:"distance-km"`
+	Meters   float64          `bson:"distance_m" json:"-"`
+	Runways  []*Runway        `bson:"runways" json:"runways"`
+}
+
+// EnsureRunwayIndexes creates the indexes used to join the runways onto their airports
+func (mongoClient *MongoClient) EnsureRunwayIndexes(ctx context.Context) error {
+	return mongoClient.ensureRunwayIndexes(ctx, mongoClient.runways())
+}
+
+// ensureRunwayIndexes creates the runway indexes on the given collection, which may be a shadow
+// collection that is swapped in later
+func (mongoClient *MongoClient) ensureRunwayIndexes(ctx context.Context, collection *mongo.Collection) error {
+	err := mongoClient.appContext.CheckWritable()
+	if err != nil {
+		return err
+	}
+
+	_, err = collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "airport_ref", Value: 1}, {Key: "length_ft", Value: -1}}},
+	})
+
+	return err
+}
+
+// runwayConditions translates the filter into the conditions on a runway
+func (filter *RunwayFilter) runwayConditions() bson.A {
+	conditions := bson.A{bson.M{"$eq": bson.A{"$airport_ref", "$$airport"}}}
+
+	if filter.MinLength > 0 {
+		conditions = append(conditions, bson.M{"$gte": bson.A{"$length_ft", float64(filter.MinLength)}})
+	}
+	if !filter.IncludeClosed {
+		conditions = append(conditions, bson.M{"$ne": bson.A{"$closed", true}})
+	}
+
+	surfaces := []string{}
+	for _, surface := range filter.Surfaces {
+		surfaces = append(surfaces, NormalizeCode(surface))
+	}
+	if filter.Paved {
+		surfaces = append(surfaces, pavedSurfaces...)
+	}
+	if len(surfaces) > 0 {
+		conditions = append(conditions, bson.M{"$in": bson.A{
+			bson.M{"$toUpper": bson.M{"$ifNull": bson.A{"$surface", ""}}}, surfaces}})
+	}
+	if len(filter.SurfaceTypes) > 0 {
+		conditions = append(conditions, bson.M{"$in": bson.A{
+			bson.M{"$ifNull": bson.A{"$surface_type", ""}}, filter.SurfaceTypes}})
+	}
+
+	return conditions
+}
+
+// AirportsWithRunway returns the airports within the radius of the location having at least
+// one runway matching the filter, nearest first
+func (mongoClient *MongoClient) AirportsWithRunway(ctx context.Context, location Coordinate, radius units.DistanceKm, filter *RunwayFilter) ([]*AirportRunways, error) {
+	appContext := mongoClient.appContext
+
+	pipeline := NewGeoNearPipeline(GeoNear{
+		Near:          location,
+		Key:           "location",
+		DistanceField: "distance_m",
+		MaxDistance:   radius,
+		Query:         appContext.excludeClosed(ctx, nil)}).
+		Lookup(appContext, Lookup{
+			From: RunwaysCollection,
+			Let:  bson.M{"airport": "$_id"},
+			Pipeline: NewPipeline().
+				MatchExpr(bson.M{"$and": filter.runwayConditions()}).
+				Sort(bson.D{{Key: "length_ft", Value: -1}}),
+			As: "runways"}).
+		Match(bson.M{"runways.0": bson.M{"$exists": true}})
+	limit := appContext.PageLimit(0)
+	if limit > 0 {
+		pipeline.Limit(limit)
+	}
+	pipeline.Project(bson.M{"_id": 0, "airport": "$$ROOT", "distance_m": 1, "runways": 1})
+
+	cursor, err := mongoClient.readCollection(AirportsCollection).Aggregate(ctx, pipeline.Stages())
+	if err != nil {
+		return nil, err
+	}
+
+	airports := []*AirportRunways{}
+	err = cursor.All(ctx, &airports)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, airport := range airports {
+		airport.Distance = units.LengthMeters(airport.Meters).Kilometers()
+	}
+
+	return airports, nil
+}
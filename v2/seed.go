@@ -0,0 +1,127 @@
+package application
+
+import (
+	"context"
+	"embed"
+	"io"
+)
+
+// seedFiles is a small sample of the OurAirports files: a few countries in western Europe
+// with their main airports, runways and frequencies
+//
+//go:embed seed/*.csv
+var seedFiles embed.FS
+
+// seedSource reads one of the bundled sample files instead of downloading it
+type seedSource struct {
+	CSVSource
+}
+
+// Fetch opens the bundled file, no snapshot is kept
+func (source *seedSource) Fetch(ctx context.Context, appContext *AppContext, report *RunReport) (io.ReadCloser, error) {
+	return seedFiles.Open("seed/" + source.SourceName + ".csv")
+}
+
+// seedCollection describes how a sample file is converted and where it is stored
+type seedCollection struct {
+	source     string
+	key        string
+	collection string
+	convert    func(record map[string]string) (*keyedDocument, error)
+}
+
+// seedCollections lists the files of the OurAirports format in the order they are loaded
+func (appContext *AppContext) seedCollections(report *RunReport) []seedCollection {
+	return []seedCollection{
+		{"countries", "code", CountriesCollection, func(record map[string]string) (*keyedDocument, error) {
+			country, err := countryFromRecord(record)
+			if err != nil {
+				return nil, err
+			}
+			return &keyedDocument{id: country.Code, document: country}, nil
+		}},
+		{"regions", "code", RegionsCollection, func(record map[string]string) (*keyedDocument, error) {
+			region, err := regionFromRecord(record)
+			if err != nil {
+				return nil, err
+			}
+			return &keyedDocument{id: region.Code, document: region}, nil
+		}},
+		{"airports", "id", AirportsCollection, func(record map[string]string) (*keyedDocument, error) {
+			airport, err := airportFromRecord(record)
+			if err != nil {
+				return nil, err
+			}
+			report.AddAirportType(airport.Type)
+			return &keyedDocument{id: airport.AirportID, document: airport}, nil
+		}},
+		{"runways", "id", RunwaysCollection, func(record map[string]string) (*keyedDocument, error) {
+			runway, err := runwayFromRecord(record)
+			if err != nil {
+				return nil, err
+			}
+			appContext.normalizeSurface(report, runway)
+			return &keyedDocument{id: runway.RunwayID, document: runway}, nil
+		}},
+		{"frequencies", "id", FrequenciesCollection, func(record map[string]string) (*keyedDocument, error) {
+			frequency, err := frequencyFromRecord(record)
+			if err != nil {
+				return nil, err
+			}
+			return &keyedDocument{id: frequency.FrequencyID, document: frequency}, nil
+		}},
+	}
+}
+
+// Seed loads the bundled sample data, for local development and integration tests
+// without downloading the full upstream files
+func (appContext *AppContext) Seed(ctx context.Context) (*RunReport, error) {
+	report := appContext.ReportCreate("seed")
+
+	err := appContext.CheckWritable()
+	if err != nil {
+		return report, err
+	}
+
+	mongoClient, err := appContext.DBOpen()
+	if err != nil {
+		return report, err
+	}
+	defer mongoClient.DBClose()
+
+	err = mongoClient.EnsureAirportIndexes(ctx)
+	if err != nil {
+		return report, err
+	}
+	err = mongoClient.EnsureRunwayIndexes(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	for _, seed := range appContext.seedCollections(report) {
+		collection := mongoClient.collection(seed.collection)
+		source := &seedSource{CSVSource{SourceName: seed.source, KeyColumn: seed.key}}
+
+		n, err := appContext.importSource(ctx, report, source, 0, seed.convert, func(batch []keyedDocument) (int64, error) {
+			return mongoClient.bulkUpsert(ctx, collection, batch, report)
+		})
+		if err != nil {
+			return report, err
+		}
+		report.AddCount("seed:"+seed.source, n)
+
+		err = mongoClient.recordDataset(ctx, seed.source, report)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	err = mongoClient.RefreshViews(ctx)
+	if err != nil {
+		return report, err
+	}
+	appContext.CacheReset()
+	report.Succeeded = true
+
+	return report, nil
+}
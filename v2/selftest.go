@@ -0,0 +1,173 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SelfTestCheck is the outcome of a single check in the self-test
+type SelfTestCheck struct {
+	Name     string        `json:"name"`
+	Passed   bool          `json:"passed"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// SelfTestResult is the outcome of the self-test, passed only if all checks passed
+type SelfTestResult struct {
+	Passed bool             `json:"passed"`
+	Checks []*SelfTestCheck `json:"checks"`
+}
+
+func (result *SelfTestResult) run(clock func() time.Time, name string, check func() error) {
+	started := clock()
+	err := check()
+
+	selfTestCheck := SelfTestCheck{Name: name, Passed: err == nil, Duration: clock().Sub(started)}
+	if err != nil {
+		selfTestCheck.Error = err.Error()
+		result.Passed = false
+	}
+
+	result.Checks = append(result.Checks, &selfTestCheck)
+}
+
+// selfTestStorage writes, reads back and deletes a probe object, or only lists when read-only
+func (appContext *AppContext) selfTestStorage(ctx context.Context) error {
+	if appContext.ReadOnly {
+		_, err := appContext.listObjects(ctx, "log", "", false)
+		return err
+	}
+
+	probeName := fmt.Sprintf("selftest-%d.txt", appContext.now().UnixNano())
+	probe := []byte("geography self-test probe")
+
+	err := appContext.putObject(ctx, "log", probeName, bytes.NewReader(probe), int64(len(probe)),
+		minio.PutObjectOptions{ContentType: "text/plain"})
+	if err != nil {
+		return err
+	}
+	defer appContext.removeObject(ctx, "log", probeName)
+
+	probeObject, err := appContext.getObject(ctx, "log", probeName)
+	if err != nil {
+		return err
+	}
+	defer probeObject.Close()
+
+	content, err := ioutil.ReadAll(probeObject)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(content, probe) {
+		return fmt.Errorf("probe object read back differs from what was written")
+	}
+
+	return appContext.removeObject(ctx, "log", probeName)
+}
+
+// selfTestDatabase writes, reads back and deletes a probe document, or only reads when read-only
+func (appContext *AppContext) selfTestDatabase(ctx context.Context) error {
+	mongoClient, err := appContext.DBOpen()
+	if err != nil {
+		return err
+	}
+	defer mongoClient.DBClose()
+
+	probes := mongoClient.collection(SelfTestCollection)
+	if appContext.ReadOnly {
+		_, err = probes.CountDocuments(ctx, bson.M{})
+		return err
+	}
+
+	probeID := primitive.NewObjectID()
+	_, err = probes.InsertOne(ctx, bson.M{"_id": probeID, "created": appContext.now()})
+	if err != nil {
+		return err
+	}
+	defer probes.DeleteOne(context.Background(), bson.M{"_id": probeID})
+
+	err = probes.FindOne(ctx, bson.M{"_id": probeID}).Err()
+	if err != nil {
+		return err
+	}
+
+	_, err = probes.DeleteOne(ctx, bson.M{"_id": probeID})
+
+	return err
+}
+
+// selfTestSource checks the source URL answers a HEAD request, or the local file exists
+func selfTestSource(ctx context.Context, sourceURL string) error {
+	location, err := url.Parse(sourceURL)
+	if err != nil {
+		return err
+	}
+	if location.Scheme == "file" {
+		_, err = os.Stat(location.Path)
+		return err
+	}
+	if location.Scheme == "" {
+		_, err = os.Stat(sourceURL)
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodHead, sourceURL, nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+
+	if response.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("%s: %s", sourceURL, response.Status)
+	}
+
+	return nil
+}
+
+// SelfTest verifies the object store, the database and the sources are usable,
+// so problems surface at startup instead of halfway an import
+func (appContext *AppContext) SelfTest(ctx context.Context) *SelfTestResult {
+	result := SelfTestResult{Passed: true, Checks: []*SelfTestCheck{}}
+
+	result.run(appContext.now, "storage", func() error { return appContext.selfTestStorage(ctx) })
+	result.run(appContext.now, "database", func() error { return appContext.selfTestDatabase(ctx) })
+
+	sources := []struct {
+		name string
+		url  string
+	}{
+		{"countries", appContext.CountriesURL},
+		{"regions", appContext.RegionsURL},
+		{"airports", appContext.AirportsURL},
+		{"runways", appContext.RunwaysURL},
+		{"frequencies", appContext.FrequenciesURL},
+		{"overrides", appContext.OverridesURL},
+		{"navaids", appContext.NavaidsURL},
+		{"fixes", appContext.FixesURL},
+	}
+	for _, source := range sources {
+		if source.url == "" {
+			continue
+		}
+		sourceURL := source.url
+		result.run(appContext.now, "source "+source.name, func() error { return selfTestSource(ctx, sourceURL) })
+	}
+
+	return &result
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+
+	application "github.com/ralph-nijpels/geography-application/v2"
+)
+
+// registerDiagnostics adds the runtime statistics and the pprof profiles, only when the
+// application context enables them as they expose the internals of the process. The profiles
+// show the command line and can keep the process busy, and the statistics can force a garbage
+// collection, so they are for admins only.
+func (server *Server) registerDiagnostics() {
+	if !server.appContext.Diagnostics {
+		return
+	}
+
+	server.mux.HandleFunc("/debug/runtime", server.withRole(application.RoleAdmin, server.runtimeStats))
+	server.mux.HandleFunc("/debug/pprof/", server.withRole(application.RoleAdmin, pprof.Index))
+	server.mux.HandleFunc("/debug/pprof/cmdline", server.withRole(application.RoleAdmin, pprof.Cmdline))
+	server.mux.HandleFunc("/debug/pprof/profile", server.withRole(application.RoleAdmin, pprof.Profile))
+	server.mux.HandleFunc("/debug/pprof/symbol", server.withRole(application.RoleAdmin, pprof.Symbol))
+	server.mux.HandleFunc("/debug/pprof/trace", server.withRole(application.RoleAdmin, pprof.Trace))
+}
+
+// withRole serves the handler to callers holding the role
+func (server *Server) withRole(role application.Role, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := server.appContext.Authorize(r.Context(), role)
+		if err == application.ErrUnauthenticated {
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// runtimeStats reports goroutines, heap and garbage collection, with ?gc=1 collecting first
+func (server *Server) runtimeStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if r.URL.Query().Get("gc") == "1" {
+		runtime.GC()
+	}
+
+	writeJSON(w, http.StatusOK, application.ReadRuntimeStats())
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	application "github.com/ralph-nijpels/geography-application/v2"
+	"github.com/ralph-nijpels/geography-application/v2/units"
+)
+
+// queryFloat reads a required number from the query, the error names the parameter
+func queryFloat(r *http.Request, name string) (float64, error) {
+	value, err := strconv.ParseFloat(r.URL.Query().Get(name), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s", name)
+	}
+
+	return value, nil
+}
+
+// nearestHeliports returns the heliports nearest to a location at
+// /heliports?lat={lat}&lon={lon}&radius-km={radius}
+func (server *Server) nearestHeliports(w http.ResponseWriter, r *http.Request, mongoClient *application.MongoClient) {
+	var location application.Coordinate
+	var radius float64
+	var err error
+
+	location.Latitude, err = queryFloat(r, "lat")
+	if err == nil {
+		location.Longitude, err = queryFloat(r, "lon")
+	}
+	if err == nil {
+		radius, err = queryFloat(r, "radius-km")
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	location = location.Normalize()
+	err = location.Validate()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit, _ := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64)
+
+	heliports, err := mongoClient.NearestHeliports(r.Context(), location, units.DistanceKm(radius), limit)
+	writeResult(w, heliports, err)
+}
+
+// seaplaneBases returns the seaplane bases inside a box at
+// /seaplane-bases?south={lat}&west={lon}&north={lat}&east={lon}
+func (server *Server) seaplaneBases(w http.ResponseWriter, r *http.Request, mongoClient *application.MongoClient) {
+	var box application.BoundingBox
+	var err error
+
+	box.SouthWest.Latitude, err = queryFloat(r, "south")
+	if err == nil {
+		box.SouthWest.Longitude, err = queryFloat(r, "west")
+	}
+	if err == nil {
+		box.NorthEast.Latitude, err = queryFloat(r, "north")
+	}
+	if err == nil {
+		box.NorthEast.Longitude, err = queryFloat(r, "east")
+	}
+	if err == nil {
+		err = box.Validate()
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	seaplaneBases, err := mongoClient.SeaplaneBasesWithin(r.Context(), box)
+	writeResult(w, seaplaneBases, err)
+}
@@ -0,0 +1,280 @@
+package server
+
+import (
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	application "github.com/ralph-nijpels/geography-application/v2"
+)
+
+// corsMaxAge is how long browsers may reuse a preflight response, in seconds
+const corsMaxAge = 600
+
+// allowedOrigin returns the value of Access-Control-Allow-Origin for the origin, empty when
+// the origin is not allowed, and whether credentials may be sent along. Only an origin listed
+// by name gets credentials: "*" lets any site read the public responses, never those of the
+// user, so it is answered literally instead of reflecting the origin.
+func allowedOrigin(origins []string, origin string) (string, bool) {
+	if origin == "" {
+		return "", false
+	}
+
+	wildcard := false
+	for _, allowed := range origins {
+		if allowed == "*" {
+			wildcard = true
+			continue
+		}
+		if strings.EqualFold(allowed, origin) {
+			return origin, true
+		}
+	}
+	if wildcard {
+		return "*", false
+	}
+
+	return "", false
+}
+
+// CORS lets browsers on the configured origins call the API and answers their preflight requests
+func CORS(appContext *application.AppContext, next http.Handler) http.Handler {
+	if len(appContext.CORSOrigins) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+
+		origin, credentials := allowedOrigin(appContext.CORSOrigins, r.Header.Get("Origin"))
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if credentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+		w.Header().Set("Access-Control-Expose-Headers", requestIDHeader+", ETag, Last-Modified")
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Idempotency-Key, X-API-Key, "+requestIDHeader)
+			w.Header().Set("Access-Control-Max-Age", fmt.Sprint(corsMaxAge))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// acceptsGzip tells whether the client accepts gzip, it may refuse it explicitly with q=0
+func acceptsGzip(r *http.Request) bool {
+	for _, coding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		parts := strings.Split(coding, ";")
+		if strings.TrimSpace(parts[0]) != "gzip" {
+			continue
+		}
+		for _, parameter := range parts[1:] {
+			parameter = strings.TrimSpace(parameter)
+			if strings.HasPrefix(parameter, "q=") {
+				quality, err := strconv.ParseFloat(parameter[2:], 64)
+				return err == nil && quality > 0
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+// gzipWriter compresses the body, unless the response has no body or is encoded already
+type gzipWriter struct {
+	http.ResponseWriter
+	gzip        *gzip.Writer
+	wroteHeader bool
+}
+
+func (writer *gzipWriter) WriteHeader(status int) {
+	if writer.wroteHeader {
+		return
+	}
+	writer.wroteHeader = true
+
+	header := writer.Header()
+	if status != http.StatusNoContent && status != http.StatusNotModified && header.Get("Content-Encoding") == "" {
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		writer.gzip = gzip.NewWriter(writer.ResponseWriter)
+	}
+
+	writer.ResponseWriter.WriteHeader(status)
+}
+
+func (writer *gzipWriter) Write(data []byte) (int, error) {
+	if !writer.wroteHeader {
+		writer.WriteHeader(http.StatusOK)
+	}
+	if writer.gzip == nil {
+		return writer.ResponseWriter.Write(data)
+	}
+
+	return writer.gzip.Write(data)
+}
+
+// close flushes the compressed body
+func (writer *gzipWriter) close() error {
+	if writer.gzip == nil {
+		return nil
+	}
+
+	return writer.gzip.Close()
+}
+
+// Compress gzips the responses for clients accepting it, if compression is enabled
+func Compress(appContext *application.AppContext, next http.Handler) http.Handler {
+	if !appContext.Compression {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Method == http.MethodHead || !acceptsGzip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		writer := gzipWriter{ResponseWriter: w}
+		defer writer.close()
+
+		next.ServeHTTP(&writer, r)
+	})
+}
+
+// uncachedPrefixes are never cached, as they report on the process or on live data rather
+// than on the imported data. GraphQL queries may select the live weather.
+var uncachedPrefixes = []string{"/health", "/debug/", "/jobs", "/metar/", "/taf/", "/links/", "/stagings/", "/metrics", "/dashboard", "/sync/", "/uploads/", "/graphql"}
+
+// cacheWriter adds the cache headers to successful responses only, errors are not cached
+type cacheWriter struct {
+	http.ResponseWriter
+	headers     map[string]string
+	wroteHeader bool
+}
+
+func (writer *cacheWriter) WriteHeader(status int) {
+	if !writer.wroteHeader && status == http.StatusOK {
+		for name, value := range writer.headers {
+			writer.Header().Set(name, value)
+		}
+	}
+	writer.wroteHeader = true
+
+	writer.ResponseWriter.WriteHeader(status)
+}
+
+func (writer *cacheWriter) Write(data []byte) (int, error) {
+	if !writer.wroteHeader {
+		writer.WriteHeader(http.StatusOK)
+	}
+
+	return writer.ResponseWriter.Write(data)
+}
+
+// cacheable tells whether the response to the request depends on the imported data only
+func cacheable(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	for _, prefix := range uncachedPrefixes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchesETag tells whether the If-None-Match header lists the tag, weak comparison as the
+// tag covers every encoding of the response
+func matchesETag(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// notModified tells whether the client has the current version, If-None-Match takes
+// precedence over If-Modified-Since
+func notModified(r *http.Request, etag string, lastImport time.Time) bool {
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	if ifNoneMatch != "" {
+		return etag != "" && matchesETag(ifNoneMatch, etag)
+	}
+
+	ifModifiedSince, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || lastImport.IsZero() {
+		return false
+	}
+
+	return !lastImport.Truncate(time.Second).After(ifModifiedSince)
+}
+
+// CacheHeaders tags query responses with the dataset version as ETag and the time of the last
+// import as Last-Modified, answering 304 when the client has them already. With a max age
+// clients may use their copy without asking for the configured time; responses for
+// authenticated callers are private.
+func CacheHeaders(appContext *application.AppContext, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !cacheable(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		visibility := "public"
+		if appContext.Authenticator != nil {
+			visibility = "private"
+		}
+		headers := map[string]string{"Cache-Control": visibility + ", no-cache"}
+		if appContext.CacheMaxAge > 0 {
+			headers["Cache-Control"] = fmt.Sprintf("%s, max-age=%d", visibility, int64(appContext.CacheMaxAge.Seconds()))
+		}
+
+		// Without the dataset version the response is served as is, validators are an optimization
+		tag, err := appContext.DatasetTag(r.Context())
+		if err != nil || tag == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		lastImport, err := appContext.LastImport(r.Context())
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		etag := `W/"` + tag + `"`
+		headers["ETag"] = etag
+		if !lastImport.IsZero() {
+			headers["Last-Modified"] = lastImport.UTC().Format(http.TimeFormat)
+		}
+
+		if notModified(r, etag, lastImport) {
+			for name, value := range headers {
+				w.Header().Set(name, value)
+			}
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		next.ServeHTTP(&cacheWriter{ResponseWriter: w, headers: headers}, r)
+	})
+}
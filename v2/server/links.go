@@ -0,0 +1,80 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	application "github.com/ralph-nijpels/geography-application/v2"
+)
+
+// Link is a time-limited download URL of a stored object
+type Link struct {
+	URL     string    `json:"url"`
+	Expires time.Time `json:"expires"`
+}
+
+// linkRole returns the role needed for a link into the bucket, the logs may contain more
+// than readers should see. Buckets without a role are not handed out at all.
+func (server *Server) linkRole(bucket string) (application.Role, bool) {
+	if bucket == "reports" {
+		return application.RoleReader, true
+	}
+	for _, logBucket := range server.appContext.LogBuckets() {
+		if bucket == logBucket {
+			return application.RoleAdmin, true
+		}
+	}
+
+	return "", false
+}
+
+// link answers a presigned URL to the object at /links/{bucket}/{object}, valid for the
+// ttl-seconds asked for or the default
+func (server *Server) link(w http.ResponseWriter, r *http.Request, mongoClient *application.MongoClient) {
+	parts := strings.SplitN(pathKey(r, "/links/"), "/", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		writeError(w, http.StatusBadRequest, "expected /links/{bucket}/{object}")
+		return
+	}
+	bucket, object := parts[0], parts[1]
+
+	role, found := server.linkRole(bucket)
+	if !found {
+		writeError(w, http.StatusNotFound, application.ErrNotFound.Error())
+		return
+	}
+	err := server.appContext.Authorize(r.Context(), role)
+	if err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	ttl := application.DefaultLinkTTL
+	if r.URL.Query().Get("ttl-seconds") != "" {
+		seconds, err := strconv.Atoi(r.URL.Query().Get("ttl-seconds"))
+		if err != nil || seconds <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid ttl-seconds")
+			return
+		}
+		ttl = time.Duration(seconds) * time.Second
+	}
+
+	expires := server.appContext.Clock.Now().Add(ttl)
+	presigned, err := server.appContext.PresignedURL(r.Context(), bucket, object, ttl)
+	if err == application.ErrLinkTTL {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err == application.ErrNoStorage {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		writeResult(w, nil, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &Link{URL: presigned.String(), Expires: expires})
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	application "github.com/ralph-nijpels/geography-application/v2"
+)
+
+// metricsContentType is the Prometheus text exposition format
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// labelValue escapes a label value for the text format
+func labelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// writeGauge writes the help and type lines of a gauge, followed by a sample per label value
+func writeGauge(w io.Writer, name string, help string, label string, samples map[string]float64) {
+	values := make([]string, 0, len(samples))
+	for value := range samples {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	for _, value := range values {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %s\n", name, label, labelValue(value), strconv.FormatFloat(samples[value], 'g', -1, 64))
+	}
+}
+
+// dashboard serves the figures of a simple dashboard as JSON
+func (server *Server) dashboard(w http.ResponseWriter, r *http.Request, mongoClient *application.MongoClient) {
+	dashboard, err := mongoClient.Dashboard(r.Context())
+	writeResult(w, dashboard, err)
+}
+
+// metrics serves the import gauges in the Prometheus text format, so standard alert rules can
+// detect stale or degrading data
+func (server *Server) metrics(w http.ResponseWriter, r *http.Request, mongoClient *application.MongoClient) {
+	metrics, err := server.appContext.ImportMetrics(r.Context())
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	hours := map[string]float64{}
+	for _, source := range metrics.Sources {
+		hours[source.Source] = source.HoursSinceImport
+	}
+	rejected := map[string]float64{}
+	succeeded := map[string]float64{}
+	downloaded := map[string]float64{}
+	uploaded := map[string]float64{}
+	mongoOps := map[string]float64{}
+	seconds := map[string]float64{}
+	for _, run := range metrics.Runs {
+		rejected[run.Topic] = run.RejectedRatio
+		succeeded[run.Topic] = 0
+		if run.Succeeded {
+			succeeded[run.Topic] = 1
+		}
+
+		// A source imported by several topics spent what their latest runs did together
+		for source, usage := range run.Usage {
+			downloaded[source] += float64(usage.Downloaded)
+			uploaded[source] += float64(usage.Uploaded)
+			mongoOps[source] += float64(usage.MongoOps)
+			seconds[source] += usage.Duration.Seconds()
+		}
+	}
+
+	w.Header().Set("Content-Type", metricsContentType)
+	writeGauge(w, "geography_hours_since_last_import", "Hours since the last successful import of the source.",
+		"source", hours)
+	writeGauge(w, "geography_last_run_rejected_ratio", "Share of the records rejected by the latest run of the topic.",
+		"topic", rejected)
+	writeGauge(w, "geography_last_run_succeeded", "Whether the latest run of the topic succeeded.",
+		"topic", succeeded)
+	writeGauge(w, "geography_last_run_downloaded_bytes", "Bytes of the source downloaded by the latest runs.",
+		"source", downloaded)
+	writeGauge(w, "geography_last_run_uploaded_bytes", "Bytes of snapshots of the source uploaded by the latest runs.",
+		"source", uploaded)
+	writeGauge(w, "geography_last_run_mongo_ops", "Documents of the source written to Mongo by the latest runs.",
+		"source", mongoOps)
+	writeGauge(w, "geography_last_run_seconds", "Wall time the latest runs spent on the source.",
+		"source", seconds)
+}
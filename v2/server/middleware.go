@@ -0,0 +1,127 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	application "github.com/ralph-nijpels/geography-application/v2"
+)
+
+// callerKey identifies the caller of a request by its address
+func callerKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// RateLimit rejects requests from callers exceeding the rate of the application context
+func RateLimit(appContext *application.AppContext, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := appContext.Limit(callerKey(r))
+		if err != nil {
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusTooManyRequests, err.Error())
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestIDHeader carries the request ID in and out, so callers can correlate with our logs
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the request IDs accepted from callers
+const maxRequestIDLength = 64
+
+// statusRecorder remembers the status written through it
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	recorder.status = status
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+// validRequestID accepts short printable IDs without spaces from the caller
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range requestID {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RequestLog assigns every request an ID, taken from the caller when it sends a valid one,
+// and logs method, path, status and duration once it is served
+func RequestLog(appContext *application.AppContext, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+
+		requestID := r.Header.Get(requestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = appContext.NewRequestID()
+		}
+		w.Header().Set(requestIDHeader, requestID)
+		ctx := application.WithRequestID(r.Context(), requestID)
+
+		recorder := statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(&recorder, r.WithContext(ctx))
+
+		appContext.ContextLogger(ctx).With(
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.status,
+			"duration", time.Since(started)).Println("Request")
+	})
+}
+
+// unauthenticatedPaths are served without a credential, so probes and SDK generators keep working
+var unauthenticatedPaths = map[string]bool{"/health": true, "/openapi.json": true}
+
+// credential returns the bearer token or API key presented with the request
+func credential(r *http.Request) string {
+	authorization := r.Header.Get("Authorization")
+	if len(authorization) > 7 && strings.EqualFold(authorization[:7], "bearer ") {
+		return strings.TrimSpace(authorization[7:])
+	}
+
+	return r.Header.Get("X-API-Key")
+}
+
+// Authenticate rejects requests without a credential accepted by the authenticator of the
+// application context, and passes the principal on in the request context
+func Authenticate(appContext *application.AppContext, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if appContext.Authenticator == nil || unauthenticatedPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		principal, err := appContext.Authenticator.Authenticate(r.Context(), credential(r))
+		if err == application.ErrUnauthenticated {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if err != nil {
+			appContext.ContextLogger(r.Context()).Error(err)
+			writeError(w, http.StatusServiceUnavailable, "authentication unavailable")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(application.WithPrincipal(r.Context(), principal)))
+	})
+}
@@ -0,0 +1,336 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	application "github.com/ralph-nijpels/geography-application/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// apiParameter describes a path or query parameter of an operation
+type apiParameter struct {
+	name        string
+	in          string
+	schema      string
+	required    bool
+	description string
+}
+
+// apiOperation describes a route of the server for the OpenAPI document, request and response
+// are example values of the Go types sent and returned
+type apiOperation struct {
+	path        string
+	method      string
+	summary     string
+	parameters  []apiParameter
+	request     interface{}
+	response    interface{}
+	status      int
+	description string
+}
+
+// The parameters shared by several operations
+var (
+	identParameter = apiParameter{name: "ident", in: "path", schema: "string", required: true,
+		description: "ICAO, IATA or local ident of the airport"}
+	latParameter = apiParameter{name: "lat", in: "query", schema: "number", required: true,
+		description: "latitude in decimal degrees"}
+	lonParameter = apiParameter{name: "lon", in: "query", schema: "number", required: true,
+		description: "longitude in decimal degrees"}
+	fieldsParameter = apiParameter{name: "fields", in: "query", schema: "string",
+		description: "comma separated json fields to return, all if empty"}
+	closedParameter = apiParameter{name: "include-closed", in: "query", schema: "boolean",
+		description: "include the closed airports the closed-airport policy leaves out"}
+)
+
+// apiOperations lists the routes registered by New, keep the two in step
+var apiOperations = []apiOperation{
+	{path: "/airports", method: http.MethodGet, summary: "Search airports",
+		parameters: []apiParameter{
+			{name: "country", in: "query", schema: "string", description: "ISO country code"},
+			{name: "region", in: "query", schema: "string", description: "ISO region code"},
+			{name: "name", in: "query", schema: "string", description: "part of the name or of an alternate name"},
+			{name: "keyword", in: "query", schema: "string", description: "one of the keywords, like an old ident"},
+			{name: "q", in: "query", schema: "string", description: "text searched in names, keywords and municipality, best match first"},
+			{name: "continent", in: "query", schema: "string", description: "continent code, like EU"},
+			{name: "scheduled-service", in: "query", schema: "boolean"},
+			{name: "type", in: "query", schema: "string", description: "airport type like large_airport, may be repeated"},
+			{name: "offset", in: "query", schema: "integer", description: "next of the previous page"},
+			{name: "limit", in: "query", schema: "integer"},
+			fieldsParameter, closedParameter},
+		response: AirportPage{}},
+	{path: "/airports/{ident}", method: http.MethodGet, summary: "Look up an airport",
+		parameters: []apiParameter{identParameter, fieldsParameter},
+		response:   application.Airport{}},
+	{path: "/airport-pages/{ident}", method: http.MethodGet, summary: "Airport with its runways and frequencies",
+		description: "Read from the pages materialized after every import, in a single read.",
+		parameters:  []apiParameter{identParameter},
+		response:    application.AirportPage{}},
+	{path: "/countries/{code}", method: http.MethodGet, summary: "Country with its regions and airport count",
+		parameters: []apiParameter{{name: "code", in: "path", schema: "string", required: true}},
+		response:   application.CountryTree{}},
+	{path: "/stats/{name}", method: http.MethodGet, summary: "Precomputed statistic, or the freshness of a view as view-{view}",
+		parameters: []apiParameter{{name: "name", in: "path", schema: "string", required: true}},
+		response:   application.Statistic{}},
+	{path: "/jobs", method: http.MethodPost, summary: "Enqueue a job, like an import",
+		description: "Requires the importer role, the admin role for maintenance like reindex. A retry with the same Idempotency-Key returns the job of the first request.",
+		parameters: []apiParameter{{name: "Idempotency-Key", in: "header", schema: "string",
+			description: "key deduplicating retried or concurrent triggers, like the source and version"}},
+		request: JobRequest{}, response: application.Job{}, status: http.StatusAccepted},
+	{path: "/jobs/{id}", method: http.MethodGet, summary: "Status of a job",
+		parameters: []apiParameter{{name: "id", in: "path", schema: "string", required: true}},
+		response:   application.Job{}},
+	{path: "/runs/{run-id}", method: http.MethodDelete, summary: "Cancel the job of a run",
+		description: "Requires the importer role. A queued job is cancelled right away, a running one stops within seconds.",
+		parameters:  []apiParameter{{name: "run-id", in: "path", schema: "string", required: true, description: "run id of the job params, or the job id"}},
+		response:    application.Job{}},
+	{path: "/runs/{run-id}", method: http.MethodPost, summary: "Pause or resume the job of a run",
+		description: "Requires the importer role. A running import pauses at the end of a batch and resumes from there.",
+		parameters:  []apiParameter{{name: "run-id", in: "path", schema: "string", required: true, description: "run id of the job params, or the job id"}},
+		request:     RunAction{}, response: application.Job{}},
+	{path: "/reporting-points/{country}", method: http.MethodGet, summary: "VFR reporting points of a country",
+		parameters: []apiParameter{{name: "country", in: "path", schema: "string", required: true}},
+		response:   []*application.ReportingPoint{}},
+	{path: "/navaids/{ident}", method: http.MethodGet, summary: "Navaids by ident",
+		parameters: []apiParameter{{name: "ident", in: "path", schema: "string", required: true}},
+		response:   []*application.Navaid{}},
+	{path: "/airspaces", method: http.MethodGet, summary: "Airspaces containing a position",
+		parameters: []apiParameter{latParameter, lonParameter,
+			{name: "altitude-ft", in: "query", schema: "number", required: true}},
+		response: []*application.Airspace{}},
+	{path: "/runway-search", method: http.MethodGet, summary: "Airports near a position with a suitable runway",
+		parameters: []apiParameter{latParameter, lonParameter,
+			{name: "radius-km", in: "query", schema: "number", required: true},
+			{name: "min-length-ft", in: "query", schema: "number"},
+			{name: "surface", in: "query", schema: "string", description: "runway surface, may be repeated"},
+			{name: "surface-type", in: "query", schema: "string", description: "canonical runway surface like asphalt or grass, may be repeated"},
+			{name: "paved", in: "query", schema: "boolean"},
+			closedParameter},
+		response: []*application.AirportRunways{}},
+	{path: "/route", method: http.MethodGet, summary: "Airports along the great circle between two airports",
+		parameters: []apiParameter{
+			{name: "from", in: "query", schema: "string", required: true},
+			{name: "to", in: "query", schema: "string", required: true},
+			{name: "corridor-km", in: "query", schema: "number", required: true},
+			closedParameter},
+		response: []*application.AirportOnRoute{}},
+	{path: "/heliports", method: http.MethodGet, summary: "Heliports nearest to a position",
+		parameters: []apiParameter{latParameter, lonParameter,
+			{name: "radius-km", in: "query", schema: "number", required: true},
+			{name: "limit", in: "query", schema: "integer"}},
+		response: []*application.NearbyAirport{}},
+	{path: "/seaplane-bases", method: http.MethodGet, summary: "Seaplane bases inside a box",
+		description: "A box with west east of east crosses the antimeridian.",
+		parameters: []apiParameter{
+			{name: "south", in: "query", schema: "number", required: true},
+			{name: "west", in: "query", schema: "number", required: true},
+			{name: "north", in: "query", schema: "number", required: true},
+			{name: "east", in: "query", schema: "number", required: true}},
+		response: []*application.Airport{}},
+	{path: "/metar/{ident}", method: http.MethodGet, summary: "Current METAR of an airport",
+		parameters: []apiParameter{identParameter}, response: application.WeatherReport{}},
+	{path: "/taf/{ident}", method: http.MethodGet, summary: "Current TAF of an airport",
+		parameters: []apiParameter{identParameter}, response: application.WeatherReport{}},
+	{path: "/dashboard", method: http.MethodGet, summary: "Document counts, last imports and storage usage",
+		description: "Flat lists for a dashboard, refreshed every five minutes.",
+		response:    application.Dashboard{}},
+	{path: "/sync/airports", method: http.MethodGet, summary: "Airports changed since the version a mirror holds",
+		description: "With resync set the mirror has to start over from a bundle.",
+		parameters: []apiParameter{{name: "since", in: "query", schema: "string",
+			description: "airports dataset version the mirror holds"}},
+		response: application.AirportSync{}},
+	{path: "/uploads/airports", method: http.MethodPost, summary: "Upload an airports file and queue its import",
+		description: "Requires the importer role. The CSV is posted as the file field of a multipart form and kept as a snapshot.",
+		response:    application.Job{}, status: http.StatusAccepted},
+	{path: "/stagings/{run-id}", method: http.MethodGet, summary: "Airport import staged for approval",
+		description: "Requires the admin role.",
+		parameters:  []apiParameter{{name: "run-id", in: "path", schema: "string", required: true}},
+		response:    application.Staging{}},
+	{path: "/stagings/{run-id}", method: http.MethodPost, summary: "Approve or reject a staged airport import",
+		description: "Requires the admin role. Approving puts the staged airports live, rejecting discards them.",
+		parameters:  []apiParameter{{name: "run-id", in: "path", schema: "string", required: true}},
+		request:     StagingDecision{}, response: application.Staging{}},
+	{path: "/links/{bucket}/{object}", method: http.MethodGet, summary: "Time-limited download link to a report or log",
+		description: "Links into the reports bucket need the reader role, into the log buckets the admin role.",
+		parameters: []apiParameter{
+			{name: "bucket", in: "path", schema: "string", required: true, description: "reports or a log bucket"},
+			{name: "object", in: "path", schema: "string", required: true, description: "object name, like a report or log name"},
+			{name: "ttl-seconds", in: "query", schema: "integer", description: "lifetime of the link, 15 minutes if empty"}},
+		response: Link{}},
+	{path: "/health", method: http.MethodGet, summary: "Health of the database and storage connections",
+		description: "Answers 503 when a component is unhealthy.",
+		response:    []*application.ComponentHealth{}},
+}
+
+// openAPISchemas collects the component schemas while describing the operations
+type openAPISchemas map[string]interface{}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	objectIDType = reflect.TypeOf(primitive.ObjectID{})
+	pointType    = reflect.TypeOf(application.Coordinate{})
+)
+
+// properties adds the json fields of the struct type, descending into embedded structs
+func (schemas openAPISchemas) properties(goType reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < goType.NumField(); i++ {
+		field := goType.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.Anonymous && name == "" {
+			schemas.properties(field.Type, properties)
+			continue
+		}
+		if name == "" || name == "-" || field.PkgPath != "" {
+			continue
+		}
+		properties[name] = schemas.schema(field.Type)
+	}
+}
+
+// schema describes the Go type, named structs become components referred to by name
+func (schemas openAPISchemas) schema(goType reflect.Type) map[string]interface{} {
+	switch goType {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case durationType:
+		return map[string]interface{}{"type": "integer", "description": "nanoseconds"}
+	case objectIDType:
+		return map[string]interface{}{"type": "string", "pattern": "^[0-9a-f]{24}$"}
+	case pointType:
+		return map[string]interface{}{"$ref": "#/components/schemas/Point"}
+	}
+
+	switch goType.Kind() {
+	case reflect.Ptr:
+		return schemas.schema(goType.Elem())
+	case reflect.Struct:
+		name := goType.Name()
+		_, found := schemas[name]
+		if !found {
+			// Registered before descending, so types referring to themselves end
+			schemas[name] = nil
+			properties := map[string]interface{}{}
+			schemas.properties(goType, properties)
+			schemas[name] = map[string]interface{}{"type": "object", "properties": properties}
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemas.schema(goType.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemas.schema(goType.Elem())}
+	case reflect.Interface:
+		return map[string]interface{}{}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	default:
+		return map[string]interface{}{"type": "string"}
+	}
+}
+
+// content describes a JSON body of the type of the value
+func (schemas openAPISchemas) content(value interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{"schema": schemas.schema(reflect.TypeOf(value))}}
+}
+
+// operation describes a single operation in OpenAPI
+func (schemas openAPISchemas) operation(operation *apiOperation) map[string]interface{} {
+	parameters := []interface{}{}
+	for _, parameter := range operation.parameters {
+		description := map[string]interface{}{
+			"name":     parameter.name,
+			"in":       parameter.in,
+			"required": parameter.required,
+			"schema":   map[string]interface{}{"type": parameter.schema}}
+		if parameter.description != "" {
+			description["description"] = parameter.description
+		}
+		parameters = append(parameters, description)
+	}
+
+	status := operation.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	description := map[string]interface{}{
+		"summary":    operation.summary,
+		"parameters": parameters,
+		"responses": map[string]interface{}{
+			strconv.Itoa(status): map[string]interface{}{
+				"description": http.StatusText(status),
+				"content":     schemas.content(operation.response)},
+			"default": map[string]interface{}{
+				"description": "error",
+				"content":     schemas.content(ErrorResponse{})}}}
+	if operation.description != "" {
+		description["description"] = operation.description
+	}
+	if operation.request != nil {
+		description["requestBody"] = map[string]interface{}{"required": true, "content": schemas.content(operation.request)}
+	}
+
+	return description
+}
+
+// OpenAPI returns the OpenAPI 3 document describing the routes of the server
+func (server *Server) OpenAPI() ([]byte, error) {
+	schemas := openAPISchemas{
+		"Point": map[string]interface{}{
+			"type":        "object",
+			"description": "GeoJSON point, coordinates are longitude and latitude",
+			"properties": map[string]interface{}{
+				"type":        map[string]interface{}{"type": "string", "enum": []string{"Point"}},
+				"coordinates": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "number"}}}}}
+
+	paths := map[string]interface{}{}
+	for i := range apiOperations {
+		operation := &apiOperations[i]
+		path, found := paths[operation.path].(map[string]interface{})
+		if !found {
+			path = map[string]interface{}{}
+			paths[operation.path] = path
+		}
+		path[strings.ToLower(operation.method)] = schemas.operation(operation)
+	}
+
+	document := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Geography API",
+			"version": "2"},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas}}
+
+	if server.appContext.Authenticator != nil {
+		document["components"].(map[string]interface{})["securitySchemes"] = map[string]interface{}{
+			"bearer": map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			"apiKey": map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-API-Key"}}
+		document["security"] = []interface{}{
+			map[string]interface{}{"bearer": []string{}},
+			map[string]interface{}{"apiKey": []string{}}}
+	}
+
+	return json.MarshalIndent(document, "", "  ")
+}
+
+// openAPI serves the OpenAPI document, so clients can generate their SDKs from it
+func (server *Server) openAPI(w http.ResponseWriter, r *http.Request) {
+	document, err := server.OpenAPI()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(document)
+}
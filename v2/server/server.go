@@ -0,0 +1,563 @@
+// Package server exposes the geography queries as a JSON HTTP API
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	application "github.com/ralph-nijpels/geography-application/v2"
+	"github.com/ralph-nijpels/geography-application/v2/graphql"
+	"github.com/ralph-nijpels/geography-application/v2/units"
+)
+
+// AirportPage is a page of search results, Next is empty on the last page
+type AirportPage struct {
+	Airports []*application.Airport `json:"airports"`
+	Next     string                 `json:"next,omitempty"`
+}
+
+// ErrorResponse is the body returned with every non-2xx status
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Server routes the HTTP API onto the application context
+type Server struct {
+	appContext *application.AppContext
+	mux        *http.ServeMux
+}
+
+// New creates the server with all routes registered
+func New(appContext *application.AppContext) *Server {
+	server := Server{
+		appContext: appContext,
+		mux:        http.NewServeMux()}
+
+	server.mux.HandleFunc("/airports", server.withDB(server.airports))
+	server.mux.HandleFunc("/airports/", server.withDB(server.airport))
+	server.mux.HandleFunc("/airport-pages/", server.withDB(server.airportPage))
+	server.mux.HandleFunc("/countries/", server.withDB(server.country))
+	server.mux.HandleFunc("/stats/", server.withDB(server.stat))
+	server.mux.HandleFunc("/jobs", server.withAccess(http.MethodPost, application.RoleImporter, server.jobEnqueue))
+	server.mux.HandleFunc("/jobs/", server.withDB(server.job))
+	server.mux.HandleFunc("/runs/", server.runs)
+	server.mux.HandleFunc("/reporting-points/", server.withDB(server.reportingPoints))
+	server.mux.HandleFunc("/navaids/", server.withDB(server.navaids))
+	server.mux.HandleFunc("/airspaces", server.withDB(server.airspaces))
+	server.mux.HandleFunc("/runway-search", server.withDB(server.runwaySearch))
+	server.mux.HandleFunc("/route", server.withDB(server.route))
+	server.mux.HandleFunc("/heliports", server.withDB(server.nearestHeliports))
+	server.mux.HandleFunc("/seaplane-bases", server.withDB(server.seaplaneBases))
+	server.mux.HandleFunc("/metar/", server.withDB(server.metar))
+	server.mux.HandleFunc("/taf/", server.withDB(server.taf))
+	server.mux.HandleFunc("/metrics", server.withDB(server.metrics))
+	server.mux.HandleFunc("/dashboard", server.withDB(server.dashboard))
+	server.mux.HandleFunc("/sync/airports", server.withDB(server.syncAirports))
+	server.mux.HandleFunc("/uploads/airports", server.withAccess(http.MethodPost, application.RoleImporter, server.uploadAirports))
+	server.mux.HandleFunc("/stagings/", server.stagings)
+	server.mux.HandleFunc("/links/", server.withDB(server.link))
+	server.mux.HandleFunc("/health", server.health)
+	server.mux.HandleFunc("/openapi.json", server.openAPI)
+	server.mux.Handle("/graphql", graphql.Handler(appContext))
+	server.registerDiagnostics()
+
+	return &server
+}
+
+// Handler returns the handler serving all routes, wrapped in the middleware from the
+// innermost out
+func (server *Server) Handler() http.Handler {
+	handler := http.Handler(server.mux)
+	handler = CacheHeaders(server.appContext, handler)
+	handler = Compress(server.appContext, handler)
+	handler = Authenticate(server.appContext, handler)
+	handler = RateLimit(server.appContext, handler)
+	handler = CORS(server.appContext, handler)
+
+	return RequestLog(server.appContext, handler)
+}
+
+// ListenAndServe serves the API on the given address until the context is done, with the health
+// monitor checking the connections meanwhile
+func (server *Server) ListenAndServe(ctx context.Context, address string) error {
+	httpServer := http.Server{Addr: address, Handler: server.Handler()}
+
+	// Enqueueing a job once relies on the unique index of the idempotency keys
+	if !server.appContext.ReadOnly {
+		mongoClient, err := server.appContext.DBOpen()
+		if err != nil {
+			return err
+		}
+		err = mongoClient.EnsureJobIndexes(ctx)
+		mongoClient.DBClose()
+		if err != nil {
+			return err
+		}
+	}
+
+	// The health endpoint serves what the monitor saw last
+	server.appContext.HealthStart(server.appContext.HealthInterval)
+	defer server.appContext.HealthStop()
+
+	go func() {
+		<-ctx.Done()
+		httpServer.Shutdown(context.Background())
+	}()
+
+	err := httpServer.ListenAndServe()
+	if err == http.ErrServerClosed {
+		return nil
+	}
+
+	return err
+}
+
+type dbHandler func(w http.ResponseWriter, r *http.Request, mongoClient *application.MongoClient)
+
+// withDB opens a database connection for the duration of a query
+func (server *Server) withDB(handler dbHandler) http.HandlerFunc {
+	return server.withAccess(http.MethodGet, application.RoleReader, handler)
+}
+
+// withAccess serves the method to callers holding the role, opening a database connection
+// for the duration of the request
+func (server *Server) withAccess(method string, role application.Role, handler dbHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		err := server.appContext.Authorize(r.Context(), role)
+		if err == application.ErrUnauthenticated {
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+
+		mongoClient, err := server.appContext.DBOpen()
+		if err != nil {
+			writeError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		defer mongoClient.DBClose()
+
+		handler(w, r, mongoClient)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, &ErrorResponse{Error: application.Redact(message)})
+}
+
+// writeResult writes the value, mapping the error to the proper status
+func writeResult(w http.ResponseWriter, value interface{}, err error) {
+	if err == application.ErrNotFound {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, value)
+}
+
+// pathKey returns the last path element after the prefix
+func pathKey(r *http.Request, prefix string) string {
+	return strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/")
+}
+
+// health reports the connections as last checked by the health monitor
+func (server *Server) health(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+	if !server.appContext.Healthy() {
+		status = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, status, server.appContext.Health())
+}
+
+// searchContext returns the context for an airport search, including the closed airports when
+// the request asks for them with include-closed=true
+func searchContext(r *http.Request) context.Context {
+	if r.URL.Query().Get("include-closed") == "true" {
+		return application.IncludeClosed(r.Context())
+	}
+
+	return r.Context()
+}
+
+func (server *Server) airports(w http.ResponseWriter, r *http.Request, mongoClient *application.MongoClient) {
+	query := r.URL.Query()
+
+	filter := application.AirportFilter{
+		Country: query.Get("country"),
+		Region:  query.Get("region"),
+		Name:    query.Get("name"),
+		Keyword: query.Get("keyword"),
+		Text:    query.Get("q")}
+
+	if query.Get("continent") != "" {
+		continent, err := application.ParseContinent(query.Get("continent"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		filter.Continent = continent
+	}
+
+	if query.Get("scheduled-service") != "" {
+		scheduledService, err := application.ParseScheduledService(query.Get("scheduled-service"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		filter.ScheduledService = &scheduledService
+	}
+
+	for _, typeName := range query["type"] {
+		airportType, err := application.ParseAirportType(typeName)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		filter.Types = append(filter.Types, airportType)
+	}
+
+	var page application.Page
+	page.Offset, _ = strconv.ParseInt(query.Get("offset"), 10, 64)
+	page.Limit, _ = strconv.ParseInt(query.Get("limit"), 10, 64)
+	page.Fields = application.ParseFieldMask(query.Get("fields"))
+	err := page.Fields.Validate(application.Airport{})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	airports, err := mongoClient.AirportSearch(searchContext(r), &filter, &page)
+	if err != nil {
+		writeResult(w, nil, err)
+		return
+	}
+
+	// A full page suggests there is more
+	result := AirportPage{Airports: airports}
+	limit := server.appContext.PageLimit(page.Limit)
+	if len(airports) > 0 && int64(len(airports)) == limit {
+		result.Next = strconv.FormatInt(page.Offset+int64(len(airports)), 10)
+	}
+	if len(page.Fields) > 0 {
+		masked, err := page.Fields.Apply(airports)
+		maskedPage := map[string]interface{}{"airports": masked}
+		if result.Next != "" {
+			maskedPage["next"] = result.Next
+		}
+		writeResult(w, maskedPage, err)
+		return
+	}
+
+	writeResult(w, &result, nil)
+}
+
+func (server *Server) airport(w http.ResponseWriter, r *http.Request, mongoClient *application.MongoClient) {
+	fields := application.ParseFieldMask(r.URL.Query().Get("fields"))
+	err := fields.Validate(application.Airport{})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	airport, err := mongoClient.LookupIdent(r.Context(), pathKey(r, "/airports/"), fields...)
+	if err != nil {
+		writeResult(w, nil, err)
+		return
+	}
+
+	masked, err := fields.Apply(airport)
+	writeResult(w, masked, err)
+}
+
+// airportPage serves an airport with its runways and frequencies in a single read
+func (server *Server) airportPage(w http.ResponseWriter, r *http.Request, mongoClient *application.MongoClient) {
+	page, err := mongoClient.AirportPage(r.Context(), pathKey(r, "/airport-pages/"))
+	writeResult(w, page, err)
+}
+
+func (server *Server) country(w http.ResponseWriter, r *http.Request, mongoClient *application.MongoClient) {
+	country, err := mongoClient.CountryTree(r.Context(), pathKey(r, "/countries/"))
+	writeResult(w, country, err)
+}
+
+func (server *Server) stat(w http.ResponseWriter, r *http.Request, mongoClient *application.MongoClient) {
+	statistic, err := mongoClient.Stat(r.Context(), pathKey(r, "/stats/"))
+	writeResult(w, statistic, err)
+}
+
+func (server *Server) job(w http.ResponseWriter, r *http.Request, mongoClient *application.MongoClient) {
+	job, err := mongoClient.Job(r.Context(), pathKey(r, "/jobs/"))
+	writeResult(w, job, err)
+}
+
+// RunAction is the body pausing or resuming the job of a run
+type RunAction struct {
+	Action string `json:"action"`
+}
+
+// runs serves /runs/{run-id}: cancelling the job of the run on DELETE, pausing or resuming it
+// on POST
+func (server *Server) runs(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		server.withAccess(http.MethodPost, application.RoleImporter, server.runAction)(w, r)
+		return
+	}
+
+	server.withAccess(http.MethodDelete, application.RoleImporter, server.cancelRun)(w, r)
+}
+
+// cancelRun stops the job of a run, a running import stops within seconds
+func (server *Server) cancelRun(w http.ResponseWriter, r *http.Request, mongoClient *application.MongoClient) {
+	job, err := mongoClient.CancelRun(r.Context(), pathKey(r, "/runs/"))
+	writeRunResult(w, job, err)
+}
+
+// runAction pauses the job of a run at the end of a batch, or resumes it from there
+func (server *Server) runAction(w http.ResponseWriter, r *http.Request, mongoClient *application.MongoClient) {
+	var action RunAction
+
+	err := json.NewDecoder(r.Body).Decode(&action)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	runID := pathKey(r, "/runs/")
+	var job *application.Job
+	switch action.Action {
+	case "pause":
+		job, err = mongoClient.PauseRun(r.Context(), runID)
+	case "resume":
+		job, err = mongoClient.ResumeRun(r.Context(), runID)
+	default:
+		writeError(w, http.StatusBadRequest, "action must be pause or resume")
+		return
+	}
+	writeRunResult(w, job, err)
+}
+
+// writeRunResult writes the job of a run, mapping the errors of the run actions
+func writeRunResult(w http.ResponseWriter, job *application.Job, err error) {
+	if err == application.ErrReadOnly {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if err == application.ErrNotPaused {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeResult(w, job, err)
+}
+
+// JobRequest is the body of a request to enqueue a job, like an import, with a priority of low,
+// normal or high
+type JobRequest struct {
+	Kind     string            `json:"kind"`
+	Params   map[string]string `json:"params"`
+	Priority string            `json:"priority,omitempty"`
+}
+
+// jobEnqueue queues a job, the caller polls /jobs/{id} for its outcome. With an Idempotency-Key
+// header the job is only queued once per key.
+func (server *Server) jobEnqueue(w http.ResponseWriter, r *http.Request, mongoClient *application.MongoClient) {
+	var request JobRequest
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if request.Kind == "" {
+		writeError(w, http.StatusBadRequest, "kind is required")
+		return
+	}
+	priority, err := application.ParseJobPriority(request.Priority)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if application.IsMaintenanceJob(request.Kind) {
+		err = server.appContext.Authorize(r.Context(), application.RoleAdmin)
+		if err != nil {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+	}
+
+	key := r.Header.Get("Idempotency-Key")
+	ctx := application.WithJobPriority(r.Context(), priority)
+	job, created, err := mongoClient.JobEnqueueOnce(ctx, request.Kind, request.Params, key)
+	if err == application.ErrReadOnly {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if err == application.ErrIdempotencyConflict {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// A retried trigger gets the job started by the first one
+	if !created {
+		writeJSON(w, http.StatusOK, job)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+func (server *Server) reportingPoints(w http.ResponseWriter, r *http.Request, mongoClient *application.MongoClient) {
+	reportingPoints, err := mongoClient.ReportingPointsByCountry(r.Context(), pathKey(r, "/reporting-points/"))
+	writeResult(w, reportingPoints, err)
+}
+
+func (server *Server) navaids(w http.ResponseWriter, r *http.Request, mongoClient *application.MongoClient) {
+	navaids, err := mongoClient.NavaidsByIdent(r.Context(), pathKey(r, "/navaids/"))
+	writeResult(w, navaids, err)
+}
+
+// runwaySearch returns the airports near a location with a runway of the requested length and surface
+func (server *Server) runwaySearch(w http.ResponseWriter, r *http.Request, mongoClient *application.MongoClient) {
+	query := r.URL.Query()
+
+	latitude, err := strconv.ParseFloat(query.Get("lat"), 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid lat")
+		return
+	}
+	longitude, err := strconv.ParseFloat(query.Get("lon"), 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid lon")
+		return
+	}
+	radius, err := strconv.ParseFloat(query.Get("radius-km"), 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid radius-km")
+		return
+	}
+
+	filter := application.RunwayFilter{Surfaces: query["surface"], Paved: query.Get("paved") == "true"}
+	for _, surfaceType := range query["surface-type"] {
+		surface, err := application.ParseRunwaySurface(surfaceType)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		filter.SurfaceTypes = append(filter.SurfaceTypes, surface)
+	}
+	if query.Get("min-length-ft") != "" {
+		length, err := strconv.ParseFloat(query.Get("min-length-ft"), 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid min-length-ft")
+			return
+		}
+		filter.MinLength = units.LengthFeet(length)
+	}
+
+	location := application.Coordinate{Latitude: latitude, Longitude: longitude}.Normalize()
+	err = location.Validate()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	airports, err := mongoClient.AirportsWithRunway(searchContext(r), location, units.DistanceKm(radius), &filter)
+	writeResult(w, airports, err)
+}
+
+// route returns the airports along the route between two airports, given by their idents
+func (server *Server) route(w http.ResponseWriter, r *http.Request, mongoClient *application.MongoClient) {
+	query := r.URL.Query()
+
+	corridor, err := strconv.ParseFloat(query.Get("corridor-km"), 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid corridor-km")
+		return
+	}
+	from, err := mongoClient.LookupIdent(r.Context(), query.Get("from"))
+	if err != nil {
+		writeResult(w, nil, err)
+		return
+	}
+	to, err := mongoClient.LookupIdent(r.Context(), query.Get("to"))
+	if err != nil {
+		writeResult(w, nil, err)
+		return
+	}
+
+	airports, err := mongoClient.AirportsAlongRoute(searchContext(r), from.Location, to.Location, units.DistanceKm(corridor))
+	if err == application.ErrEmptyRoute {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeResult(w, airports, err)
+}
+
+func (server *Server) metar(w http.ResponseWriter, r *http.Request, mongoClient *application.MongoClient) {
+	airport, err := mongoClient.LookupIdent(r.Context(), pathKey(r, "/metar/"))
+	if err != nil {
+		writeResult(w, nil, err)
+		return
+	}
+
+	report, err := mongoClient.METAR(r.Context(), airport)
+	writeResult(w, report, err)
+}
+
+func (server *Server) taf(w http.ResponseWriter, r *http.Request, mongoClient *application.MongoClient) {
+	airport, err := mongoClient.LookupIdent(r.Context(), pathKey(r, "/taf/"))
+	if err != nil {
+		writeResult(w, nil, err)
+		return
+	}
+
+	report, err := mongoClient.TAF(r.Context(), airport)
+	writeResult(w, report, err)
+}
+
+func (server *Server) airspaces(w http.ResponseWriter, r *http.Request, mongoClient *application.MongoClient) {
+	query := r.URL.Query()
+
+	latitude, err := strconv.ParseFloat(query.Get("lat"), 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid lat")
+		return
+	}
+	longitude, err := strconv.ParseFloat(query.Get("lon"), 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid lon")
+		return
+	}
+	altitude, err := strconv.ParseFloat(query.Get("altitude-ft"), 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid altitude-ft")
+		return
+	}
+
+	airspaces, err := mongoClient.AirspacesAt(r.Context(), latitude, longitude, units.LengthFeet(altitude))
+	writeResult(w, airspaces, err)
+}
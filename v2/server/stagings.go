@@ -0,0 +1,62 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	application "github.com/ralph-nijpels/geography-application/v2"
+)
+
+// StagingDecision is the body deciding on a staged import, approve or reject
+type StagingDecision struct {
+	Decision string `json:"decision"`
+}
+
+// stagings serves /stagings/{run-id}: the staging on GET, a decision on POST
+func (server *Server) stagings(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		server.withAccess(http.MethodPost, application.RoleAdmin, server.stagingDecide)(w, r)
+		return
+	}
+
+	server.withAccess(http.MethodGet, application.RoleAdmin, server.staging)(w, r)
+}
+
+func (server *Server) staging(w http.ResponseWriter, r *http.Request, mongoClient *application.MongoClient) {
+	staging, err := mongoClient.Staging(r.Context(), pathKey(r, "/stagings/"))
+	writeResult(w, staging, err)
+}
+
+// stagingDecide approves or rejects a staged import, as required by change management before
+// the data goes live
+func (server *Server) stagingDecide(w http.ResponseWriter, r *http.Request, mongoClient *application.MongoClient) {
+	var decision StagingDecision
+
+	err := json.NewDecoder(r.Body).Decode(&decision)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	runID := pathKey(r, "/stagings/")
+	var staging *application.Staging
+	switch decision.Decision {
+	case "approve":
+		staging, err = mongoClient.Approve(r.Context(), runID)
+	case "reject":
+		staging, err = mongoClient.Reject(r.Context(), runID)
+	default:
+		writeError(w, http.StatusBadRequest, "decision must be approve or reject")
+		return
+	}
+	if err == application.ErrNotPending {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err == application.ErrReadOnly {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	writeResult(w, staging, err)
+}
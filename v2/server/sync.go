@@ -0,0 +1,14 @@
+package server
+
+import (
+	"net/http"
+
+	application "github.com/ralph-nijpels/geography-application/v2"
+)
+
+// syncAirports answers the airports changed since the version a mirror presents at
+// /sync/airports?since={version}
+func (server *Server) syncAirports(w http.ResponseWriter, r *http.Request, mongoClient *application.MongoClient) {
+	sync, err := mongoClient.SyncAirports(r.Context(), r.URL.Query().Get("since"))
+	writeResult(w, sync, err)
+}
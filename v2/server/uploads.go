@@ -0,0 +1,42 @@
+package server
+
+import (
+	"net/http"
+
+	application "github.com/ralph-nijpels/geography-application/v2"
+)
+
+// maxUploadSize caps the size of an uploaded airports file, the full OurAirports file is well
+// below it
+const maxUploadSize = 64 << 20
+
+// uploadAirports keeps the airports file posted as the file field of a multipart form as a
+// snapshot and queues its import, the caller polls /jobs/{id} for its outcome
+func (server *Server) uploadAirports(w http.ResponseWriter, r *http.Request, mongoClient *application.MongoClient) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer file.Close()
+
+	snapshot, runID, err := server.appContext.StoreUpload(r.Context(), file)
+	if err == application.ErrReadOnly {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	params := map[string]string{"snapshot": snapshot, "run-id": runID}
+	job, err := mongoClient.JobEnqueue(r.Context(), application.JobImportSnapshot, params)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, job)
+}
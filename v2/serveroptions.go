@@ -0,0 +1,45 @@
+package application
+
+import (
+	"time"
+)
+
+// serverOptions describes the server section of the options file
+type serverOptions struct {
+	CORSOrigins   []string `json:"cors-origins"`
+	Compression   bool     `json:"compression"`
+	CacheSeconds  int64    `json:"cache-seconds"`
+	HealthSeconds int64    `json:"health-seconds"`
+}
+
+// defaultHealthInterval is how often the server checks its connections unless configured
+const defaultHealthInterval = 30 * time.Second
+
+// WithCORS lets browser clients on the given origins call the server with their credentials,
+// "*" allows any origin to call it without
+func WithCORS(origins ...string) Option {
+	return func(appContext *AppContext) {
+		appContext.CORSOrigins = origins
+	}
+}
+
+// WithCompression gzips the responses of the server for clients accepting it
+func WithCompression(enabled bool) Option {
+	return func(appContext *AppContext) {
+		appContext.Compression = enabled
+	}
+}
+
+// WithHealthInterval checks the connections of a server at the given interval
+func WithHealthInterval(interval time.Duration) Option {
+	return func(appContext *AppContext) {
+		appContext.HealthInterval = interval
+	}
+}
+
+// WithCacheMaxAge lets clients cache query responses for the given time, zero disables caching
+func WithCacheMaxAge(maxAge time.Duration) Option {
+	return func(appContext *AppContext) {
+		appContext.CacheMaxAge = maxAge
+	}
+}
@@ -0,0 +1,78 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// forceKey is the context key of the force flag
+type forceKey struct{}
+
+// WithForce returns a context under which imports skip the shrink guard, for when a source
+// did lose most of its records
+func WithForce(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forceKey{}, true)
+}
+
+// forced tells whether the context carries the force flag
+func forced(ctx context.Context) bool {
+	force, _ := ctx.Value(forceKey{}).(bool)
+	return force
+}
+
+// WithMaxShrink aborts imports of sources holding more than the percentage fewer records than
+// there are in the database, which points at a truncated download rather than a real change.
+// Zero never aborts; a source may set a maximum of its own, see SourceImport.
+func WithMaxShrink(percent float64) Option {
+	return func(appContext *AppContext) {
+		appContext.MaxShrinkPercent = percent
+	}
+}
+
+// countRecords parses the fetched source once to count its records, leaving the file at its
+// start. A source that can not be read twice is not counted, returning -1.
+func countRecords(source Source, file io.Reader) (int64, error) {
+	seeker, isSeeker := file.(io.Seeker)
+	if !isSeeker {
+		return -1, nil
+	}
+
+	reader, err := source.Parse(file)
+	if err != nil {
+		return 0, err
+	}
+	var records int64
+	for reader.Next() {
+		records++
+	}
+	if reader.Err() != nil {
+		return 0, reader.Err()
+	}
+
+	_, err = seeker.Seek(0, io.SeekStart)
+
+	return records, err
+}
+
+// checkShrink returns an error when the source holds too few records compared to the live
+// count of the collection it is imported into, before anything is written. A forced context,
+// an empty collection and a maximum of zero skip the check.
+func checkShrink(ctx context.Context, source Source, file io.Reader, maxPercent float64, live int64) error {
+	if maxPercent <= 0 || live <= 0 || forced(ctx) {
+		return nil
+	}
+
+	records, err := countRecords(source, file)
+	if err != nil || records < 0 || records >= live {
+		return err
+	}
+
+	shrink := float64(live-records) * 100 / float64(live)
+	if shrink <= maxPercent {
+		return nil
+	}
+
+	return fmt.Errorf("%s: %d records, %.1f%% fewer than the %d in the database, force the import to accept it",
+		source.Name(), records, shrink, live)
+}
@@ -0,0 +1,63 @@
+package application
+
+import (
+	"context"
+)
+
+// simulationSuffix names the scratch database of a simulation after the real one
+const simulationSuffix = "_simulation"
+
+// Simulate runs the import of generated data, as produced by GenerateSynthetic, into a scratch
+// database next to the real one, for load tests and training. The scratch database is dropped
+// afterwards unless keep is set, so it can be inspected. Nothing is stored in the object store,
+// the report is left to the caller.
+func (appContext *AppContext) Simulate(ctx context.Context, options SyntheticOptions, keep bool) (*RunReport, error) {
+	report := appContext.ReportCreate("simulate")
+
+	files, err := GenerateSynthetic(options)
+	if err != nil {
+		return report, err
+	}
+
+	mongoClient, err := appContext.DBOpen()
+	if err != nil {
+		return report, err
+	}
+	defer mongoClient.DBClose()
+	mongoClient.dbName = appContext.DBName + simulationSuffix
+
+	// Start from an empty database, a kept earlier simulation would skew the counts
+	err = mongoClient.Database().Drop(ctx)
+	if err != nil {
+		return report, err
+	}
+	if !keep {
+		defer mongoClient.Database().Drop(context.Background())
+	}
+
+	err = mongoClient.EnsureAirportIndexes(ctx)
+	if err != nil {
+		return report, err
+	}
+	err = mongoClient.EnsureRunwayIndexes(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	for _, seed := range appContext.seedCollections(report) {
+		collection := mongoClient.collection(seed.collection)
+		source := &syntheticSource{CSVSource{SourceName: seed.source, KeyColumn: seed.key}, files[seed.source]}
+
+		n, err := appContext.importSource(ctx, report, source, 0, seed.convert, func(batch []keyedDocument) (int64, error) {
+			return mongoClient.bulkUpsert(ctx, collection, batch, report)
+		})
+		if err != nil {
+			return report, err
+		}
+		report.AddCount("simulate:"+seed.source, n)
+	}
+
+	report.Succeeded = true
+
+	return report, nil
+}
@@ -0,0 +1,138 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// slowQueryFields are the parts of a command that describe what it selects
+var slowQueryFields = []string{"filter", "query", "pipeline", "updates", "deletes"}
+
+type slowQueryCommand struct {
+	name       string
+	collection string
+	filter     string
+	requestID  string
+}
+
+// slowQueryMonitor times Mongo commands and logs the ones exceeding the threshold
+type slowQueryMonitor struct {
+	mutex      sync.Mutex
+	appContext *AppContext
+	commands   map[int64]*slowQueryCommand
+}
+
+// WithSlowQueryThreshold logs every Mongo operation taking longer than the threshold,
+// zero disables the logging
+func WithSlowQueryThreshold(threshold time.Duration) Option {
+	return func(appContext *AppContext) {
+		appContext.SlowQueryThreshold = threshold
+	}
+}
+
+// SlowQueries returns the number of slow operations seen so far
+func (appContext *AppContext) SlowQueries() int64 {
+	return atomic.LoadInt64(appContext.slowQueries)
+}
+
+// sanitizeValue replaces all values by placeholders, keeping only the structure
+func sanitizeValue(value bson.RawValue) string {
+	switch value.Type {
+	case bsontype.EmbeddedDocument:
+		return sanitizeDocument(value.Document())
+	case bsontype.Array:
+		values, err := value.Array().Values()
+		if err != nil {
+			return "[?]"
+		}
+		parts := make([]string, len(values))
+		for i, element := range values {
+			parts[i] = sanitizeValue(element)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	default:
+		return "?"
+	}
+}
+
+func sanitizeDocument(document bson.Raw) string {
+	elements, err := document.Elements()
+	if err != nil {
+		return "{?}"
+	}
+
+	parts := make([]string, len(elements))
+	for i, element := range elements {
+		parts[i] = fmt.Sprintf("%s: %s", element.Key(), sanitizeValue(element.Value()))
+	}
+
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+func newSlowQueryMonitor(appContext *AppContext) *event.CommandMonitor {
+	monitor := slowQueryMonitor{
+		appContext: appContext,
+		commands:   map[int64]*slowQueryCommand{}}
+
+	return &event.CommandMonitor{
+		Started: monitor.started,
+		Succeeded: func(ctx context.Context, succeeded *event.CommandSucceededEvent) {
+			monitor.finished(&succeeded.CommandFinishedEvent)
+		},
+		Failed: func(ctx context.Context, failed *event.CommandFailedEvent) {
+			monitor.finished(&failed.CommandFinishedEvent)
+		},
+	}
+}
+
+func (monitor *slowQueryMonitor) started(ctx context.Context, started *event.CommandStartedEvent) {
+
+	// The collection is the value of the command element itself
+	command := slowQueryCommand{name: started.CommandName, requestID: RequestID(ctx)}
+	collection, err := started.Command.LookupErr(started.CommandName)
+	if err == nil && collection.Type == bsontype.String {
+		command.collection = collection.StringValue()
+	}
+
+	filters := []string{}
+	for _, field := range slowQueryFields {
+		filter, err := started.Command.LookupErr(field)
+		if err == nil {
+			filters = append(filters, fmt.Sprintf("%s: %s", field, sanitizeValue(filter)))
+		}
+	}
+	command.filter = strings.Join(filters, ", ")
+
+	monitor.mutex.Lock()
+	monitor.commands[started.RequestID] = &command
+	monitor.mutex.Unlock()
+}
+
+func (monitor *slowQueryMonitor) finished(finished *event.CommandFinishedEvent) {
+
+	monitor.mutex.Lock()
+	command, found := monitor.commands[finished.RequestID]
+	delete(monitor.commands, finished.RequestID)
+	monitor.mutex.Unlock()
+
+	duration := time.Duration(finished.DurationNanos)
+	if !found || duration < monitor.appContext.SlowQueryThreshold {
+		return
+	}
+
+	atomic.AddInt64(monitor.appContext.slowQueries, 1)
+	logger := monitor.appContext.Logger()
+	if command.requestID != "" {
+		logger = logger.With("request-id", command.requestID)
+	}
+	logger.Printf("Slow query: %s on %s took %v (%s)",
+		command.name, command.collection, duration, command.filter)
+}
@@ -0,0 +1,274 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// RecordReader streams the records of a source, CSVReader is the most common one
+type RecordReader interface {
+	Next() bool
+	Record() map[string]string
+	Line() int
+	Err() error
+}
+
+// Source is a provider of geography data. The records it parses are keyed by the column
+// names of the OurAirports CSV files, so every source feeds the same pipeline.
+type Source interface {
+	// Name identifies the source in snapshots, reports and enricher registrations
+	Name() string
+	// Fetch retrieves the data, keeping a snapshot of it in the csv bucket
+	Fetch(ctx context.Context, appContext *AppContext, report *RunReport) (io.ReadCloser, error)
+	// Parse streams the records from the fetched data or a snapshot of it
+	Parse(input io.Reader) (RecordReader, error)
+	// Key identifies a record within the source
+	Key(record map[string]string) string
+}
+
+// NewSource creates a source of the given format, being csv, json, geojson or gpkg. The key names
+// the column, field or property identifying a record. A JSON source expects an array of objects.
+// The table of a GeoPackage follows the URL after a #, it defaults to the name of the source.
+func NewSource(name string, format string, sourceURL string, key string) (Source, error) {
+	switch format {
+	case "gpkg":
+		table := name
+		hash := strings.LastIndex(sourceURL, "#")
+		if hash >= 0 {
+			table = sourceURL[hash+1:]
+			sourceURL = sourceURL[:hash]
+		}
+		return &GeoPackageSource{SourceName: name, URL: sourceURL, Table: table, KeyColumn: key}, nil
+	case "", "csv":
+		return &CSVSource{SourceName: name, URL: sourceURL, KeyColumn: key}, nil
+	case "json":
+		return &JSONSource{SourceName: name, URL: sourceURL, KeyField: key}, nil
+	case "geojson":
+		return &GeoJSONSource{SourceName: name, URL: sourceURL, KeyProperty: key}, nil
+	}
+
+	return nil, fmt.Errorf("unknown source format %s", format)
+}
+
+// CSVSource is a CSV file with a header, like those of OurAirports
+type CSVSource struct {
+	SourceName string
+	URL        string
+	KeyColumn  string
+}
+
+// Name identifies the source
+func (source *CSVSource) Name() string {
+	return source.SourceName
+}
+
+// Fetch downloads the file
+func (source *CSVSource) Fetch(ctx context.Context, appContext *AppContext, report *RunReport) (io.ReadCloser, error) {
+	return appContext.fetchSource(ctx, source.SourceName, source.URL, ".csv", report)
+}
+
+// Parse streams the rows of the file
+func (source *CSVSource) Parse(input io.Reader) (RecordReader, error) {
+	return NewCSVReader(input)
+}
+
+// Key returns the key column of the record
+func (source *CSVSource) Key(record map[string]string) string {
+	return record[source.KeyColumn]
+}
+
+// JSONSource is a JSON API answering an array of flat objects, or an object holding such an
+// array in ArrayField
+type JSONSource struct {
+	SourceName string
+	URL        string
+	KeyField   string
+	ArrayField string
+}
+
+// Name identifies the source
+func (source *JSONSource) Name() string {
+	return source.SourceName
+}
+
+// Fetch calls the API
+func (source *JSONSource) Fetch(ctx context.Context, appContext *AppContext, report *RunReport) (io.ReadCloser, error) {
+	return appContext.fetchSource(ctx, source.SourceName, source.URL, ".json", report)
+}
+
+// Parse streams the objects of the array
+func (source *JSONSource) Parse(input io.Reader) (RecordReader, error) {
+	return newJSONReader(input, source.ArrayField, flattenObject)
+}
+
+// Key returns the key field of the record
+func (source *JSONSource) Key(record map[string]string) string {
+	return record[source.KeyField]
+}
+
+// GeoJSONSource is a GeoJSON feature collection, like a local export of a GIS. The properties
+// become the columns, see flattenFeature for the geometry.
+type GeoJSONSource struct {
+	SourceName  string
+	URL         string
+	KeyProperty string
+}
+
+// Name identifies the source
+func (source *GeoJSONSource) Name() string {
+	return source.SourceName
+}
+
+// Fetch reads the file
+func (source *GeoJSONSource) Fetch(ctx context.Context, appContext *AppContext, report *RunReport) (io.ReadCloser, error) {
+	return appContext.fetchSource(ctx, source.SourceName, source.URL, ".geojson", report)
+}
+
+// Parse streams the features of the collection
+func (source *GeoJSONSource) Parse(input io.Reader) (RecordReader, error) {
+	return newJSONReader(input, "features", flattenFeature)
+}
+
+// Key returns the key property of the record
+func (source *GeoJSONSource) Key(record map[string]string) string {
+	return record[source.KeyProperty]
+}
+
+// jsonReader streams the objects of a JSON array, converting each one to a record
+type jsonReader struct {
+	decoder *json.Decoder
+	convert func(object map[string]interface{}) map[string]string
+	record  map[string]string
+	line    int
+	err     error
+}
+
+// newJSONReader positions the decoder at the start of the array, which is either the document
+// itself or the named field of it
+func newJSONReader(input io.Reader, arrayField string, convert func(object map[string]interface{}) map[string]string) (*jsonReader, error) {
+	decoder := json.NewDecoder(input)
+	decoder.UseNumber()
+
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	for arrayField != "" {
+		if token != json.Delim('{') {
+			return nil, fmt.Errorf("expected an object holding %s", arrayField)
+		}
+		if !decoder.More() {
+			return nil, fmt.Errorf("no %s in the document", arrayField)
+		}
+		token, err = decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		if token == arrayField {
+			token, err = decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+
+		// Skip the value of any other field
+		var skipped json.RawMessage
+		err = decoder.Decode(&skipped)
+		if err != nil {
+			return nil, err
+		}
+		token = json.Delim('{')
+	}
+
+	if token != json.Delim('[') {
+		return nil, fmt.Errorf("expected an array")
+	}
+
+	return &jsonReader{decoder: decoder, convert: convert}, nil
+}
+
+// Next moves to the next object, returning false at the end or on an error
+func (reader *jsonReader) Next() bool {
+	if reader.err != nil || !reader.decoder.More() {
+		return false
+	}
+
+	var object map[string]interface{}
+	reader.err = reader.decoder.Decode(&object)
+	if reader.err != nil {
+		return false
+	}
+	reader.line++
+	reader.record = reader.convert(object)
+
+	return true
+}
+
+// Record returns the current record
+func (reader *jsonReader) Record() map[string]string {
+	return reader.record
+}
+
+// Line returns the position of the current object in the array, starting at 1
+func (reader *jsonReader) Line() int {
+	return reader.line
+}
+
+// Err returns the error that ended the iteration, if any
+func (reader *jsonReader) Err() error {
+	return reader.err
+}
+
+// jsonText renders a JSON value as the text it would have in a CSV file
+func jsonText(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case bool:
+		return strconv.FormatBool(value)
+	}
+
+	text, _ := json.Marshal(value)
+	return string(text)
+}
+
+// flattenObject turns the fields of an object into a record
+func flattenObject(object map[string]interface{}) map[string]string {
+	record := make(map[string]string, len(object))
+	for field, value := range object {
+		record[field] = jsonText(value)
+	}
+
+	return record
+}
+
+// flattenFeature turns the properties and geometry of a feature into a record. A point becomes
+// latitude_deg and longitude_deg, any other geometry is kept as GeoJSON text in geometry.
+func flattenFeature(feature map[string]interface{}) map[string]string {
+	properties, _ := feature["properties"].(map[string]interface{})
+	record := flattenObject(properties)
+
+	geometry, _ := feature["geometry"].(map[string]interface{})
+	if geometry == nil {
+		return record
+	}
+	coordinates, _ := geometry["coordinates"].([]interface{})
+	if geometry["type"] == "Point" && len(coordinates) >= 2 {
+		record["longitude_deg"] = jsonText(coordinates[0])
+		record["latitude_deg"] = jsonText(coordinates[1])
+		return record
+	}
+	record["geometry"] = jsonText(geometry)
+
+	return record
+}
@@ -0,0 +1,122 @@
+package application
+
+import (
+	"fmt"
+)
+
+// Validation decides what happens to a record that cannot be converted
+type Validation string
+
+// The validation modes, lenient reports and skips bad records while strict aborts the import
+// on the first one
+const (
+	ValidationLenient Validation = "lenient"
+	ValidationStrict  Validation = "strict"
+)
+
+// ParseValidation reads a validation mode, empty is lenient
+func ParseValidation(s string) (Validation, error) {
+	switch Validation(s) {
+	case "", ValidationLenient:
+		return ValidationLenient, nil
+	case ValidationStrict:
+		return ValidationStrict, nil
+	}
+
+	return "", fmt.Errorf("unknown validation %q", s)
+}
+
+// rejectedMinimum is the number of records read before the share rejected is judged, so a
+// bad record among the first few does not abort a lenient import
+const rejectedMinimum = 1000
+
+// SourceImport tunes the import of a single source, like big batches for the airports and
+// strict validation for the frequencies. Zero values fall back to the global settings.
+// A lenient import aborts once more than MaxRejectedPercent of the records are rejected, any
+// import before it starts when the source holds more than MaxShrinkPercent fewer records than
+// the database. A strict import holds the records in memory until all of them passed.
+type SourceImport struct {
+	BatchRows          int        `json:"batch-rows"`
+	Workers            int        `json:"workers"`
+	Validation         Validation `json:"validation"`
+	MaxRejectedPercent float64    `json:"max-rejected-percent"`
+	MaxShrinkPercent   float64    `json:"max-shrink-percent"`
+}
+
+// validationOptions describes the validation section of the options file, the default of
+// all sources
+type validationOptions struct {
+	Mode               string  `json:"mode"`
+	MaxRejectedPercent float64 `json:"max-rejected-percent"`
+}
+
+// WithValidation sets the validation of all sources without one of their own, a maximum
+// of zero never aborts a lenient import
+func WithValidation(validation Validation, maxRejectedPercent float64) Option {
+	return func(appContext *AppContext) {
+		appContext.Validation = validation
+		appContext.MaxRejectedPercent = maxRejectedPercent
+	}
+}
+
+// WithSourceImport tunes the import of the named source
+func WithSourceImport(source string, settings SourceImport) Option {
+	return func(appContext *AppContext) {
+		if appContext.SourceImports == nil {
+			appContext.SourceImports = map[string]SourceImport{}
+		}
+		appContext.SourceImports[source] = settings
+	}
+}
+
+// checkSourceImports rejects settings that would only fail once an import runs
+func checkSourceImports(settings map[string]SourceImport) error {
+	for source, setting := range settings {
+		_, err := ParseValidation(string(setting.Validation))
+		if err != nil {
+			return fmt.Errorf("imports %s: %v", source, err)
+		}
+		if setting.BatchRows < 0 || setting.Workers < 0 || setting.MaxRejectedPercent < 0 || setting.MaxShrinkPercent < 0 {
+			return fmt.Errorf("imports %s: negative batch-rows, workers, max-rejected-percent or max-shrink-percent", source)
+		}
+	}
+
+	return nil
+}
+
+// sourceImport returns the settings of the named source with the defaults filled in
+func (appContext *AppContext) sourceImport(source string) SourceImport {
+	settings := appContext.SourceImports[source]
+
+	if settings.BatchRows <= 0 {
+		settings.BatchRows = appContext.ImportBatchRows
+	}
+	if settings.BatchRows <= 0 {
+		settings.BatchRows = importBatchSize
+	}
+	if settings.Workers <= 0 {
+		settings.Workers = 1
+	}
+	if settings.Validation == "" {
+		settings.Validation = appContext.Validation
+	}
+	settings.Validation, _ = ParseValidation(string(settings.Validation))
+	if settings.MaxRejectedPercent <= 0 {
+		settings.MaxRejectedPercent = appContext.MaxRejectedPercent
+	}
+	if settings.MaxShrinkPercent <= 0 {
+		settings.MaxShrinkPercent = appContext.MaxShrinkPercent
+	}
+
+	return settings
+}
+
+// tooManyRejected tells whether the share of records rejected exceeds the maximum of the
+// settings, judged only after rejectedMinimum records unless final
+func (settings *SourceImport) tooManyRejected(rejected int64, read int64, final bool) bool {
+	if settings.MaxRejectedPercent <= 0 || read == 0 || (!final && read < rejectedMinimum) {
+		return false
+	}
+
+	return float64(rejected)*100/float64(read) > settings.MaxRejectedPercent
+}
@@ -0,0 +1,340 @@
+package application
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/ralph-nijpels/geography-application/v2/units"
+)
+
+// sqliteSchema creates the airports table with the columns looked up by, the airport itself
+// kept as a BSON document, and the R*-tree over the locations the geo queries go through
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS airports (
+		id INTEGER PRIMARY KEY,
+		type TEXT NOT NULL,
+		icao_code TEXT,
+		iata_code TEXT,
+		iso_country TEXT,
+		name TEXT,
+		document BLOB NOT NULL)`,
+	`CREATE INDEX IF NOT EXISTS airports_icao_code ON airports (icao_code)`,
+	`CREATE INDEX IF NOT EXISTS airports_iata_code ON airports (iata_code)`,
+	`CREATE VIRTUAL TABLE IF NOT EXISTS airport_locations USING rtree(id, min_lat, max_lat, min_lon, max_lon)`,
+}
+
+// SQLiteDriver is the name of the database/sql driver SQLite and GeoPackage files are opened
+// with. The module does not bring a driver of its own, the binary embedding it imports one, like
+// github.com/mattn/go-sqlite3 registering sqlite3; modernc.org/sqlite registers sqlite.
+var SQLiteDriver = "sqlite3"
+
+// SQLiteStore keeps the airports in a single SQLite file, for running without a database
+// server. Like GeoPackage files it needs a database/sql driver registered under SQLiteDriver,
+// built with the R*-tree module.
+type SQLiteStore struct {
+	appContext *AppContext
+	db         *sql.DB
+}
+
+// OpenSQLiteStore opens the SQLite file, creating it and its tables when missing. The module
+// brings no driver, the binary registers one by importing it, like
+//
+//	import _ "github.com/mattn/go-sqlite3"
+//
+// with SQLiteDriver naming it.
+func (appContext *AppContext) OpenSQLiteStore(ctx context.Context, path string) (*SQLiteStore, error) {
+	if !sqliteDriverRegistered() {
+		return nil, fmt.Errorf("%s: no database/sql driver registered as %q, the binary should import one", path, SQLiteDriver)
+	}
+
+	db, err := sql.Open(SQLiteDriver, path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, statement := range sqliteSchema {
+		_, err = db.ExecContext(ctx, statement)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+
+	return &SQLiteStore{appContext: appContext, db: db}, nil
+}
+
+func sqliteDriverRegistered() bool {
+	for _, driver := range sql.Drivers() {
+		if driver == SQLiteDriver {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Close closes the SQLite file
+func (store *SQLiteStore) Close() error {
+	return store.db.Close()
+}
+
+// ImportAirports fills the SQLite file from the airports source through the same pipeline as
+// the import into MongoDB: same source, conversion, validation and shrink check. The local
+// overrides live in MongoDB, so they are not applied.
+func (store *SQLiteStore) ImportAirports(ctx context.Context, report *RunReport) error {
+	appContext := store.appContext
+
+	var live int64
+	err := store.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM airports`).Scan(&live)
+	if err != nil {
+		return err
+	}
+
+	_, err = appContext.importSource(ctx, report, appContext.AirportsSource, live, func(record map[string]string) (*keyedDocument, error) {
+		airport, err := airportFromRecord(record)
+		if err != nil {
+			return nil, err
+		}
+		if appContext.dropsClosed(airport) {
+			report.AddCount("closed-dropped", 1)
+			return nil, nil
+		}
+		report.AddAirportType(airport.Type)
+
+		return &keyedDocument{id: airport.AirportID, document: airport}, nil
+	}, func(batch []keyedDocument) (int64, error) {
+		return store.storeAirports(ctx, batch)
+	})
+
+	return err
+}
+
+// storeAirports replaces the airports of the batch and their locations in one transaction
+func (store *SQLiteStore) storeAirports(ctx context.Context, batch []keyedDocument) (int64, error) {
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, document := range batch {
+		airport := document.document.(*Airport)
+		data, err := bson.Marshal(airport)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT OR REPLACE INTO airports (id, type, icao_code, iata_code, iso_country, name, document)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			airport.AirportID, string(airport.Type), airport.ICAOCode, airport.IATACode, airport.Country, airport.Name, data)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, `INSERT OR REPLACE INTO airport_locations (id, min_lat, max_lat, min_lon, max_lon)
+				VALUES (?, ?, ?, ?, ?)`,
+				airport.AirportID, airport.Location.Latitude, airport.Location.Latitude,
+				airport.Location.Longitude, airport.Location.Longitude)
+		}
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	return int64(len(batch)), tx.Commit()
+}
+
+// scanAirports decodes the airport documents the rows select, reduced to the projection when
+// there is one
+func scanAirports(rows *sql.Rows, projection bson.M) ([]*Airport, error) {
+	defer rows.Close()
+
+	airports := []*Airport{}
+	for rows.Next() {
+		var data []byte
+		err := rows.Scan(&data)
+		if err != nil {
+			return nil, err
+		}
+		if projection != nil {
+			data, err = projectDocument(data, projection)
+			if err != nil {
+				return nil, err
+			}
+		}
+		var airport Airport
+		err = bson.Unmarshal(data, &airport)
+		if err != nil {
+			return nil, err
+		}
+		airports = append(airports, &airport)
+	}
+
+	return airports, rows.Err()
+}
+
+// projectDocument keeps the elements of the document the projection selects, as MongoDB does
+func projectDocument(data []byte, projection bson.M) ([]byte, error) {
+	elements, err := bson.Raw(data).Elements()
+	if err != nil {
+		return nil, err
+	}
+
+	projected := bson.D{}
+	for _, element := range elements {
+		_, found := projection[element.Key()]
+		if found {
+			projected = append(projected, bson.E{Key: element.Key(), Value: element.Value()})
+		}
+	}
+
+	return bson.Marshal(projected)
+}
+
+// airportBy finds an airport by the value of a code column, with only the given fields
+func (store *SQLiteStore) airportBy(ctx context.Context, column string, code string, fields FieldMask) (*Airport, error) {
+	code = NormalizeCode(code)
+	if code == "" {
+		return nil, ErrNotFound
+	}
+
+	projection, err := fields.projection(Airport{})
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := store.db.QueryContext(ctx, `SELECT document FROM airports WHERE `+column+` = ? LIMIT 1`, code)
+	if err != nil {
+		return nil, err
+	}
+	airports, err := scanAirports(rows, projection)
+	if err != nil {
+		return nil, err
+	}
+	if len(airports) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return airports[0], nil
+}
+
+// AirportByICAO finds an airport by its ICAO code, optionally with only the given fields
+func (store *SQLiteStore) AirportByICAO(ctx context.Context, icao string, fields ...string) (*Airport, error) {
+	return store.airportBy(ctx, "icao_code", icao, fields)
+}
+
+// AirportByIATA finds an airport by its IATA code, optionally with only the given fields
+func (store *SQLiteStore) AirportByIATA(ctx context.Context, iata string, fields ...string) (*Airport, error) {
+	return store.airportBy(ctx, "iata_code", iata, fields)
+}
+
+// typesWithin selects the airports of the types with their location in the box from the R*-tree,
+// a box crossing the antimeridian being the two boxes on either side of it
+func (store *SQLiteStore) typesWithin(ctx context.Context, types []AirportType, box BoundingBox, order string, limit int64) ([]*Airport, error) {
+	query := `SELECT airports.document FROM airport_locations JOIN airports ON airports.id = airport_locations.id
+		WHERE airport_locations.max_lat >= ? AND airport_locations.min_lat <= ?`
+	arguments := []interface{}{box.SouthWest.Latitude, box.NorthEast.Latitude}
+	if box.SouthWest.Longitude <= box.NorthEast.Longitude {
+		query += ` AND airport_locations.max_lon >= ? AND airport_locations.min_lon <= ?`
+		arguments = append(arguments, box.SouthWest.Longitude, box.NorthEast.Longitude)
+	} else {
+		query += ` AND (airport_locations.max_lon >= ? OR airport_locations.min_lon <= ?)`
+		arguments = append(arguments, box.SouthWest.Longitude, box.NorthEast.Longitude)
+	}
+
+	placeholders := make([]string, len(types))
+	for i, airportType := range types {
+		placeholders[i] = "?"
+		arguments = append(arguments, string(airportType))
+	}
+	query += ` AND airports.type IN (` + strings.Join(placeholders, ", ") + `)`
+	if order != "" {
+		query += ` ORDER BY ` + order
+	}
+	if limit > 0 {
+		query += ` LIMIT ?`
+		arguments = append(arguments, limit)
+	}
+
+	rows, err := store.db.QueryContext(ctx, query, arguments...)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAirports(rows, nil)
+}
+
+// AirportsWithin returns the airports of the given types inside the box, by country and name
+// and limited to MaxResults
+func (store *SQLiteStore) AirportsWithin(ctx context.Context, types []AirportType, box BoundingBox) ([]*Airport, error) {
+	err := box.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return store.typesWithin(ctx, types, box, "airports.iso_country, airports.name", store.appContext.PageLimit(0))
+}
+
+// radiusBox returns the box around the circle of the radius, the whole width of the globe when
+// the circle reaches a pole or crosses the antimeridian too far to tell
+func radiusBox(location Coordinate, radius units.DistanceKm) BoundingBox {
+	latitudeDelta := float64(radius) / earthRadiusKm * 180 / math.Pi
+	south := math.Max(location.Latitude-latitudeDelta, -90)
+	north := math.Min(location.Latitude+latitudeDelta, 90)
+	if south == -90 || north == 90 {
+		return BoundingBox{SouthWest: Coordinate{Latitude: south, Longitude: -180}, NorthEast: Coordinate{Latitude: north, Longitude: 180}}
+	}
+
+	// The parallel furthest from the equator is where a degree of longitude is shortest
+	longitudeDelta := latitudeDelta / math.Cos(math.Max(math.Abs(south), math.Abs(north))*math.Pi/180)
+	if longitudeDelta >= 180 {
+		return BoundingBox{SouthWest: Coordinate{Latitude: south, Longitude: -180}, NorthEast: Coordinate{Latitude: north, Longitude: 180}}
+	}
+	west := location.Longitude - longitudeDelta
+	if west < -180 {
+		west += 360
+	}
+	east := location.Longitude + longitudeDelta
+	if east > 180 {
+		east -= 360
+	}
+
+	return BoundingBox{SouthWest: Coordinate{Latitude: south, Longitude: west}, NorthEast: Coordinate{Latitude: north, Longitude: east}}
+}
+
+// NearestOfType returns the airports of the given types within the radius of the location,
+// nearest first and limited to MaxResults. The R*-tree narrows them down to the box around the
+// radius, the great circle distance decides.
+func (store *SQLiteStore) NearestOfType(ctx context.Context, types []AirportType, location Coordinate, radius units.DistanceKm, limit int64) ([]*NearbyAirport, error) {
+	location = location.Normalize()
+	err := location.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	candidates, err := store.typesWithin(ctx, types, radiusBox(location, radius), "", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	airports := []*NearbyAirport{}
+	for _, airport := range candidates {
+		distance := GreatCircleDistance(location, airport.Location)
+		if distance <= radius {
+			airports = append(airports, &NearbyAirport{Airport: airport, Distance: distance, Meters: float64(distance) * 1000})
+		}
+	}
+	sort.Slice(airports, func(i, j int) bool {
+		return airports[i].Distance < airports[j].Distance
+	})
+	limit = store.appContext.PageLimit(limit)
+	if limit > 0 && int64(len(airports)) > limit {
+		airports = airports[:limit]
+	}
+
+	return airports, nil
+}
@@ -0,0 +1,155 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// StatValue is a single value in a statistic, identified by its key
+type StatValue struct {
+	Key   string  `bson:"_id" json:"key"`
+	Value float64 `bson:"value" json:"value"`
+}
+
+// Statistic is a named list of values as stored in the stats collection
+type Statistic struct {
+	Name    string       `bson:"_id" json:"name"`
+	Updated time.Time    `bson:"updated" json:"updated"`
+	Values  []*StatValue `bson:"values" json:"values"`
+}
+
+type statDefinition struct {
+	collection string
+	pipeline   func() mongo.Pipeline
+}
+
+// countBy groups the collection on the given field and counts the documents
+func countBy(field string) mongo.Pipeline {
+	return NewPipeline().
+		Group("$"+field, bson.M{"value": bson.M{"$sum": 1}}).
+		Sort(bson.D{{Key: "value", Value: -1}}).
+		Stages()
+}
+
+// AirportsPerCountryPipeline counts the airports per country
+func AirportsPerCountryPipeline() mongo.Pipeline {
+	return countBy("iso_country")
+}
+
+// AirportsPerTypePipeline counts the airports per type
+func AirportsPerTypePipeline() mongo.Pipeline {
+	return countBy("type")
+}
+
+// RunwaySurfacesPipeline counts the runways per surface
+func RunwaySurfacesPipeline() mongo.Pipeline {
+	return countBy("surface")
+}
+
+// ElevationPerRegionPipeline averages the airport elevation per region
+func ElevationPerRegionPipeline() mongo.Pipeline {
+	return NewPipeline().
+		Match(bson.M{"elevation_ft": bson.M{"$exists": true}}).
+		Group("$iso_region", bson.M{"value": bson.M{"$avg": "$elevation_ft"}}).
+		Sort(bson.D{{Key: "_id", Value: 1}}).
+		Stages()
+}
+
+// LongestRunwaysPipeline lists the longest runways, keyed by airport and runway idents
+func LongestRunwaysPipeline(limit int64) mongo.Pipeline {
+	return NewPipeline().
+		Match(bson.M{"length_ft": bson.M{"$gt": 0}}).
+		Sort(bson.D{{Key: "length_ft", Value: -1}}).
+		Limit(limit).
+		Project(bson.M{
+			"_id":   bson.M{"$concat": bson.A{"$airport_ident", " ", "$le_ident", "/", "$he_ident"}},
+			"value": "$length_ft"}).
+		Stages()
+}
+
+// statDefinitions lists the statistics known by name
+var statDefinitions = map[string]statDefinition{
+	"airports-per-country": {AirportsCollection, AirportsPerCountryPipeline},
+	"airports-per-type":    {AirportsCollection, AirportsPerTypePipeline},
+	"runway-surfaces":      {RunwaysCollection, RunwaySurfacesPipeline},
+	"elevation-per-region": {AirportsCollection, ElevationPerRegionPipeline},
+	"longest-runways":      {RunwaysCollection, func() mongo.Pipeline { return LongestRunwaysPipeline(100) }},
+}
+
+// statsWorkers is the number of statistics computed at the same time
+const statsWorkers = 2
+
+func (mongoClient *MongoClient) stats() *mongo.Collection {
+	return mongoClient.collection(StatsCollection)
+}
+
+// StatCompute runs the aggregation for the named statistic
+func (mongoClient *MongoClient) StatCompute(ctx context.Context, name string) (*Statistic, error) {
+
+	definition, found := statDefinitions[name]
+	if !found {
+		return nil, fmt.Errorf("unknown statistic %s", name)
+	}
+
+	collection := mongoClient.collection(definition.collection)
+	cursor, err := collection.Aggregate(ctx, definition.pipeline())
+	if err != nil {
+		return nil, err
+	}
+
+	statistic := Statistic{Name: name, Updated: mongoClient.appContext.now(), Values: []*StatValue{}}
+	err = cursor.All(ctx, &statistic.Values)
+	if err != nil {
+		return nil, err
+	}
+
+	return &statistic, nil
+}
+
+// StatsRefresh recomputes all statistics and caches them in the stats collection,
+// typically called after each import
+func (mongoClient *MongoClient) StatsRefresh(ctx context.Context) error {
+
+	err := mongoClient.appContext.CheckWritable()
+	if err != nil {
+		return err
+	}
+
+	// The aggregations are independent, but each of them is heavy on the database
+	group, _ := mongoClient.appContext.NewWorkerGroup(ctx, "stats-refresh", statsWorkers)
+	for name := range statDefinitions {
+		name := name
+		group.Go(func(ctx context.Context) error {
+			statistic, err := mongoClient.StatCompute(ctx, name)
+			if err != nil {
+				return err
+			}
+
+			_, err = mongoClient.stats().ReplaceOne(ctx, bson.M{"_id": name}, statistic,
+				options.Replace().SetUpsert(true))
+			return err
+		})
+	}
+
+	return group.Wait()
+}
+
+// Stat returns the named statistic as cached by the last refresh
+func (mongoClient *MongoClient) Stat(ctx context.Context, name string) (*Statistic, error) {
+
+	var statistic Statistic
+	err := mongoClient.readCollection(StatsCollection).FindOne(ctx, bson.M{"_id": name}).Decode(&statistic)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &statistic, nil
+}
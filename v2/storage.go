@@ -0,0 +1,270 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// WithStorageDir keeps the buckets as folders in the directory when there is no object store,
+// for small deployments and CI pipelines not running MinIO. Tags are not kept.
+func WithStorageDir(dir string) Option {
+	return func(appContext *AppContext) {
+		appContext.StorageDir = dir
+	}
+}
+
+// S3Client returns the client of the object store, nil without one. The health monitor may
+// replace it by a new one at any time, so it is not kept around.
+func (appContext *AppContext) S3Client() *minio.Client {
+	if appContext.s3Client == nil {
+		return nil
+	}
+	client, _ := appContext.s3Client.Load().(*minio.Client)
+
+	return client
+}
+
+// Storageless tells whether the AppContext runs without an object store, keeping its objects in
+// the storage folder or, logs only, writing them to stderr
+func (appContext *AppContext) Storageless() bool {
+	return appContext.S3Client() == nil
+}
+
+// localPath returns the file of the object in the storage folder
+func (appContext *AppContext) localPath(bucket string, key string) string {
+	return filepath.Join(appContext.StorageDir, bucket, filepath.FromSlash(key))
+}
+
+// ensureBucket creates the bucket when it is not there yet, the storage folder makes them as needed
+func (appContext *AppContext) ensureBucket(ctx context.Context, bucket string) error {
+	if appContext.S3Client() == nil {
+		return nil
+	}
+
+	bucketFound, err := appContext.S3Client().BucketExists(ctx, bucket)
+	if err == nil && !bucketFound {
+		err = appContext.S3Client().MakeBucket(ctx, bucket, minio.MakeBucketOptions{Region: "us-east-1"})
+	}
+
+	return err
+}
+
+// putObject stores the object for the tenant of the operation
+func (appContext *AppContext) putObject(ctx context.Context, bucket string, name string, data io.Reader, size int64,
+	options minio.PutObjectOptions) error {
+	key, err := appContext.objectKey(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if appContext.S3Client() != nil {
+		_, err := appContext.S3Client().PutObject(ctx, bucket, key, data, size, options)
+		return err
+	}
+	if appContext.StorageDir == "" {
+		return ErrNoStorage
+	}
+
+	fileName := appContext.localPath(bucket, key)
+	err = os.MkdirAll(filepath.Dir(fileName), 0700)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, data)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// getObject opens the object of the tenant of the operation, it must be closed after use
+func (appContext *AppContext) getObject(ctx context.Context, bucket string, name string) (io.ReadCloser, error) {
+	key, err := appContext.objectKey(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if appContext.S3Client() != nil {
+		return appContext.S3Client().GetObject(ctx, bucket, key, minio.GetObjectOptions{})
+	}
+	if appContext.StorageDir == "" {
+		return nil, ErrNoStorage
+	}
+
+	file, err := os.Open(appContext.localPath(bucket, key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+
+	return file, err
+}
+
+// statObject describes the object of the tenant of the operation, its metadata only when it is
+// kept in the object store
+func (appContext *AppContext) statObject(ctx context.Context, bucket string, name string) (minio.ObjectInfo, error) {
+	key, err := appContext.objectKey(ctx, name)
+	if err != nil {
+		return minio.ObjectInfo{}, err
+	}
+
+	if appContext.S3Client() != nil {
+		return appContext.S3Client().StatObject(ctx, bucket, key, minio.StatObjectOptions{})
+	}
+	if appContext.StorageDir == "" {
+		return minio.ObjectInfo{}, ErrNoStorage
+	}
+
+	info, err := os.Stat(appContext.localPath(bucket, key))
+	if os.IsNotExist(err) {
+		return minio.ObjectInfo{}, ErrNotFound
+	}
+	if err != nil {
+		return minio.ObjectInfo{}, err
+	}
+
+	return minio.ObjectInfo{Key: name, Size: info.Size(), LastModified: info.ModTime(),
+		ContentType: mime.TypeByExtension(path.Ext(name))}, nil
+}
+
+// removeObject deletes the object of the tenant of the operation
+func (appContext *AppContext) removeObject(ctx context.Context, bucket string, name string) error {
+	key, err := appContext.objectKey(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if appContext.S3Client() != nil {
+		return appContext.S3Client().RemoveObject(ctx, bucket, key, minio.RemoveObjectOptions{})
+	}
+	if appContext.StorageDir == "" {
+		return ErrNoStorage
+	}
+
+	return os.Remove(appContext.localPath(bucket, key))
+}
+
+// listObjects returns the objects of the tenant of the operation starting with the prefix, in
+// lexical order and named without the tenant prefix. Unless recursive, objects in folders below
+// the prefix are left out.
+func (appContext *AppContext) listObjects(ctx context.Context, bucket string, prefix string, recursive bool) ([]minio.ObjectInfo, error) {
+	tenantPrefix, err := appContext.tenantPrefix(ctx)
+	if err != nil {
+		return nil, err
+	}
+	objects := []minio.ObjectInfo{}
+
+	if appContext.S3Client() != nil {
+		// Cancelling the listing stops it when returning halfway
+		listCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		listOptions := minio.ListObjectsOptions{Prefix: tenantPrefix + prefix, Recursive: recursive}
+		for info := range appContext.S3Client().ListObjects(listCtx, bucket, listOptions) {
+			if info.Err != nil {
+				return nil, info.Err
+			}
+			if strings.HasSuffix(info.Key, "/") {
+				continue
+			}
+			info.Key = strings.TrimPrefix(info.Key, tenantPrefix)
+			objects = append(objects, info)
+		}
+		return objects, nil
+	}
+	if appContext.StorageDir == "" {
+		return nil, ErrNoStorage
+	}
+
+	root := filepath.Join(appContext.StorageDir, bucket)
+	err = filepath.Walk(root, func(fileName string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		relative, err := filepath.Rel(root, fileName)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(relative)
+		if !strings.HasPrefix(key, tenantPrefix+prefix) {
+			return nil
+		}
+		name := strings.TrimPrefix(key, tenantPrefix)
+		if !recursive && strings.Contains(strings.TrimPrefix(name, prefix), "/") {
+			return nil
+		}
+
+		objects = append(objects, minio.ObjectInfo{Key: name, Size: info.Size(), LastModified: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+
+	return objects, nil
+}
+
+// listBuckets returns the names of the buckets, the folders in the storage folder when there
+// is no object store
+func (appContext *AppContext) listBuckets(ctx context.Context) ([]string, error) {
+	buckets := []string{}
+
+	if appContext.S3Client() != nil {
+		bucketInfos, err := appContext.S3Client().ListBuckets(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, bucketInfo := range bucketInfos {
+			buckets = append(buckets, bucketInfo.Name)
+		}
+		return buckets, nil
+	}
+	if appContext.StorageDir == "" {
+		return buckets, nil
+	}
+
+	folders, err := ioutil.ReadDir(appContext.StorageDir)
+	if os.IsNotExist(err) {
+		return buckets, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, folder := range folders {
+		if folder.IsDir() {
+			buckets = append(buckets, folder.Name())
+		}
+	}
+
+	return buckets, nil
+}
+
+// storeLog stores a log in the bucket, or writes it to stderr when there is nowhere to keep it
+func (appContext *AppContext) storeLog(bucket string, logName string, logData []byte) error {
+	if appContext.S3Client() == nil && appContext.StorageDir == "" {
+		_, err := os.Stderr.Write(logData)
+		return err
+	}
+
+	return appContext.putObject(context.Background(), bucket, logName, bytes.NewReader(logData), int64(len(logData)),
+		logPutOptions(logName, logData))
+}
@@ -0,0 +1,125 @@
+package application
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// streamPageSize is the number of documents read per query while streaming
+const streamPageSize = 1000
+
+// Stream iterates over all documents matching a filter in the order of their id. It reads
+// them in pages, continuing after the last id seen, so a full scan neither holds a cursor
+// open for long nor slows down like skip does.
+type Stream struct {
+	ctx        context.Context
+	collection *mongo.Collection
+	filter     bson.M
+	cursor     *mongo.Cursor
+	lastID     interface{}
+	pageCount  int64
+	done       bool
+	err        error
+}
+
+// StreamCollection streams the documents of the collection, given by its base name, that
+// match the filter
+func (mongoClient *MongoClient) StreamCollection(ctx context.Context, base string, filter bson.M) *Stream {
+	if filter == nil {
+		filter = bson.M{}
+	}
+
+	return &Stream{
+		ctx:        ctx,
+		collection: mongoClient.readCollection(base),
+		filter:     filter}
+}
+
+// FindStream streams the airports matching the filter
+func (mongoClient *MongoClient) FindStream(ctx context.Context, filter *AirportFilter) *Stream {
+	return mongoClient.StreamCollection(ctx, AirportsCollection, filter.query())
+}
+
+// openPage queries the page following the last id seen
+func (stream *Stream) openPage() error {
+	filter := stream.filter
+	if stream.lastID != nil {
+		filter = bson.M{"$and": bson.A{stream.filter, bson.M{"_id": bson.M{"$gt": stream.lastID}}}}
+	}
+
+	cursor, err := stream.collection.Find(stream.ctx, filter,
+		options.Find().SetSort(bson.M{"_id": 1}).SetLimit(streamPageSize))
+	if err != nil {
+		return err
+	}
+
+	stream.cursor = cursor
+	stream.pageCount = 0
+	return nil
+}
+
+// Next moves to the next document, returning false at the end or on an error
+func (stream *Stream) Next() bool {
+	for !stream.done {
+		if stream.cursor == nil {
+			stream.err = stream.openPage()
+			if stream.err != nil {
+				stream.done = true
+				return false
+			}
+		}
+
+		if stream.cursor.Next(stream.ctx) {
+			stream.lastID = stream.cursor.Current.Lookup("_id")
+			stream.pageCount++
+			return true
+		}
+
+		// A short page is the last one
+		stream.err = stream.cursor.Err()
+		stream.cursor.Close(stream.ctx)
+		stream.cursor = nil
+		if stream.err != nil || stream.pageCount < streamPageSize {
+			stream.done = true
+		}
+	}
+
+	return false
+}
+
+// Decode reads the current document into the value
+func (stream *Stream) Decode(value interface{}) error {
+	return stream.cursor.Decode(value)
+}
+
+// Airport returns the current document as an airport
+func (stream *Stream) Airport() (*Airport, error) {
+	var airport Airport
+
+	err := stream.Decode(&airport)
+	if err != nil {
+		return nil, err
+	}
+
+	return &airport, nil
+}
+
+// Err returns the error that ended the stream, if any
+func (stream *Stream) Err() error {
+	return stream.err
+}
+
+// Close releases the stream before its end
+func (stream *Stream) Close() error {
+	stream.done = true
+	if stream.cursor == nil {
+		return nil
+	}
+
+	err := stream.cursor.Close(stream.ctx)
+	stream.cursor = nil
+	return err
+}
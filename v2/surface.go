@@ -0,0 +1,126 @@
+package application
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RunwaySurface is the canonical surface of a runway, the source data spells the same surface
+// in many ways
+type RunwaySurface string
+
+// The canonical runway surfaces
+const (
+	Asphalt        RunwaySurface = "asphalt"
+	Concrete       RunwaySurface = "concrete"
+	Bitumen        RunwaySurface = "bitumen"
+	Gravel         RunwaySurface = "gravel"
+	Grass          RunwaySurface = "grass"
+	Dirt           RunwaySurface = "dirt"
+	Sand           RunwaySurface = "sand"
+	Water          RunwaySurface = "water"
+	Snow           RunwaySurface = "snow"
+	UnknownSurface RunwaySurface = "unknown"
+)
+
+// RunwaySurfaces lists all canonical runway surfaces
+var RunwaySurfaces = []RunwaySurface{Asphalt, Concrete, Bitumen, Gravel, Grass, Dirt, Sand, Water, Snow, UnknownSurface}
+
+// defaultSurfaces maps the common spellings of the source data, in upper case, to the canonical
+// surfaces. The runway-surfaces section of the options file adds to and overrides it.
+var defaultSurfaces = map[string]RunwaySurface{
+	"ASP": Asphalt, "ASPH": Asphalt, "ASPHALT": Asphalt, "ASFALT": Asphalt, "TARMAC": Asphalt,
+	"CON": Concrete, "CONC": Concrete, "CONCRETE": Concrete, "PEM": Concrete,
+	"BIT": Bitumen, "BITUMEN": Bitumen, "BITUMINOUS": Bitumen, "TAR": Bitumen,
+	"GRV": Gravel, "GRVL": Gravel, "GRAVEL": Gravel, "GRE": Gravel,
+	"GRS": Grass, "GRASS": Grass, "TURF": Grass, "TRF": Grass,
+	"DIRT": Dirt, "DRT": Dirt, "EARTH": Dirt, "SOIL": Dirt, "CLAY": Dirt, "LAT": Dirt, "LATERITE": Dirt,
+	"SAND": Sand, "SND": Sand,
+	"WATER": Water, "WAT": Water,
+	"SNOW": Snow, "ICE": Snow}
+
+// ParseRunwaySurface reads a canonical runway surface, forgiving case and whitespace
+func ParseRunwaySurface(s string) (RunwaySurface, error) {
+	normalized := RunwaySurface(strings.ToLower(strings.TrimSpace(s)))
+	for _, surface := range RunwaySurfaces {
+		if surface == normalized {
+			return surface, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown runway surface %q", s)
+}
+
+// parseSurfaces reads the runway-surfaces section of the options file, mapping spellings of the
+// source data to canonical surfaces
+func parseSurfaces(spellings map[string]string) (map[string]RunwaySurface, error) {
+	surfaces := map[string]RunwaySurface{}
+
+	for spelling, name := range spellings {
+		surface, err := ParseRunwaySurface(name)
+		if err != nil {
+			return nil, fmt.Errorf("runway-surfaces %s: %v", spelling, err)
+		}
+		surfaces[NormalizeCode(spelling)] = surface
+	}
+
+	return surfaces, nil
+}
+
+// WithRunwaySurfaces adds spellings of the source data to the surface dictionary, overriding
+// the built-in ones
+func WithRunwaySurfaces(surfaces map[string]RunwaySurface) Option {
+	return func(appContext *AppContext) {
+		if appContext.RunwaySurfaces == nil {
+			appContext.RunwaySurfaces = map[string]RunwaySurface{}
+		}
+		for spelling, surface := range surfaces {
+			appContext.RunwaySurfaces[NormalizeCode(spelling)] = surface
+		}
+	}
+}
+
+// lookupSurface finds the spelling in the configured and built-in dictionary
+func (appContext *AppContext) lookupSurface(spelling string) (RunwaySurface, bool) {
+	surface, found := appContext.RunwaySurfaces[spelling]
+	if !found {
+		surface, found = defaultSurfaces[spelling]
+	}
+
+	return surface, found
+}
+
+// RunwaySurface returns the canonical surface for the surface of the source data, trying the
+// first word of combinations like "ASP-GRS" or "Asphalt, good" when the whole is not known.
+// False when the surface is not known, an empty surface is known to be nothing.
+func (appContext *AppContext) RunwaySurface(spelling string) (RunwaySurface, bool) {
+	spelling = NormalizeCode(spelling)
+	if spelling == "" {
+		return "", true
+	}
+
+	surface, found := appContext.lookupSurface(spelling)
+	if found {
+		return surface, true
+	}
+
+	words := strings.FieldsFunc(spelling, func(r rune) bool { return r < 'A' || r > 'Z' })
+	if len(words) > 0 {
+		surface, found = appContext.lookupSurface(words[0])
+		if found {
+			return surface, true
+		}
+	}
+
+	return UnknownSurface, false
+}
+
+// normalizeSurface sets the canonical surface of the runway, counting the surfaces not in the
+// dictionary in the report so they can be added to it
+func (appContext *AppContext) normalizeSurface(report *RunReport, runway *Runway) {
+	surface, found := appContext.RunwaySurface(runway.Surface)
+	if !found {
+		report.AddCount("unknown-surface:"+NormalizeCode(runway.Surface), 1)
+	}
+	runway.SurfaceType = surface
+}
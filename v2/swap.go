@@ -0,0 +1,163 @@
+package application
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// shadowSuffix marks the collection a blue/green import loads into
+const shadowSuffix = "_next"
+
+// stagingSuffix marks the collection an import staged for approval loads into, followed by
+// the run id, so no other load touches it
+const stagingSuffix = "_staging_"
+
+// checkAirports verifies a freshly loaded airports collection before it is put in service, the
+// number expected is taken from the parsed records rather than from the writes
+func checkAirports(ctx context.Context, collection *mongo.Collection, expected int64) error {
+
+	count, err := collection.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("%s: no airports loaded", collection.Name())
+	}
+	if count != expected {
+		return fmt.Errorf("%s: %d airports loaded, expected %d", collection.Name(), count, expected)
+	}
+
+	// Documents lacking what every query relies on point at a broken parse
+	incomplete, err := collection.CountDocuments(ctx, bson.M{"$or": bson.A{
+		bson.M{"ident": bson.M{"$in": bson.A{nil, ""}}},
+		bson.M{"type": bson.M{"$in": bson.A{nil, ""}}},
+		bson.M{"location.type": bson.M{"$ne": "Point"}}}})
+	if err != nil {
+		return err
+	}
+	if incomplete > 0 {
+		return fmt.Errorf("%s: %d airports are incomplete", collection.Name(), incomplete)
+	}
+
+	return checkHashes(ctx, collection)
+}
+
+// swapCollection atomically replaces the target collection by the shadow collection
+func (mongoClient *MongoClient) swapCollection(ctx context.Context, shadow string, target string) error {
+	dbName := mongoClient.Database().Name()
+
+	return mongoClient.DBClient.Database("admin").RunCommand(ctx, bson.D{
+		{Key: "renameCollection", Value: dbName + "." + shadow},
+		{Key: "to", Value: dbName + "." + target},
+		{Key: "dropTarget", Value: true}}).Err()
+}
+
+// loadShadow loads the airports into a fresh shadow collection with the suffix and runs the
+// integrity checks on it, returning the shadow and the number of airports loaded. Without a
+// summary the history of the airports is recorded on the way, with one the changes are only
+// counted, as the load may never go live.
+func (mongoClient *MongoClient) loadShadow(ctx context.Context, report *RunReport, suffix string, summary *ChangeSummary) (*mongo.Collection, int64, error) {
+	appContext := mongoClient.appContext
+
+	// Leftovers of an aborted run are not to be trusted, a paused one included
+	restartImport(ctx)
+	target := appContext.CollectionName(AirportsCollection)
+	shadow := mongoClient.Database().Collection(target + suffix)
+	err := shadow.Drop(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = mongoClient.ensureAirportIndexes(ctx, shadow)
+	if err != nil {
+		return nil, 0, err
+	}
+	// A truncated download is measured against the live airports before the shadow is loaded
+	previous, err := mongoClient.countAirports(ctx, mongoClient.Database().Collection(target))
+	if err != nil {
+		return nil, 0, err
+	}
+	store := mongoClient.storeAirports(ctx, report, shadow)
+	if summary != nil {
+		store = mongoClient.stageAirports(ctx, report, shadow, summary)
+	}
+	loaded, err := mongoClient.importAirports(ctx, report, previous, store)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// The records accepted by the parse, less those the unique indexes refused, have to be there
+	report.StageStart("check")
+	expected := report.count(countAccepted+appContext.AirportsSource.Name()) - report.count(countRefused+shadow.Name())
+	err = checkAirports(ctx, shadow, expected)
+	if err != nil {
+		return nil, 0, err
+	}
+	report.StageEnd("check", loaded)
+
+	if summary != nil {
+		summary.Previous = previous
+		summary.Loaded = loaded
+		summary.Removed = previous - (loaded - summary.Added)
+	}
+
+	return shadow, loaded, nil
+}
+
+// ImportAirportsSwap imports the airports like ImportAirports, but loads them into a shadow
+// collection first. Only when the indexes are built and the integrity checks pass, the shadow
+// collection replaces the live one in a single rename, so consumers never see a half-loaded dataset.
+// When approval is required the load is only staged, Approve puts it live.
+func (mongoClient *MongoClient) ImportAirportsSwap(ctx context.Context, report *RunReport) error {
+	appContext := mongoClient.appContext
+
+	if appContext.RequireApproval {
+		_, err := mongoClient.StageAirports(ctx, report)
+		return err
+	}
+
+	err := appContext.CheckWritable()
+	if err != nil {
+		return err
+	}
+
+	shadow, loaded, err := mongoClient.loadShadow(ctx, report, shadowSuffix, nil)
+	if err != nil {
+		return err
+	}
+
+	// The airports left out are recorded as removed once the shadow is live, so a sync takes
+	// them away from the mirrors
+	removed, err := mongoClient.shadowRemovals(ctx, shadow)
+	if err != nil {
+		return err
+	}
+
+	report.StageStart("swap")
+	err = mongoClient.swapCollection(ctx, shadow.Name(), appContext.CollectionName(AirportsCollection))
+	if err != nil {
+		return err
+	}
+	report.StageEnd("swap", loaded)
+
+	changes, err := mongoClient.recordRemovals(ctx, removed, report.Versions[appContext.AirportsSource.Name()])
+	if err != nil {
+		return err
+	}
+	report.AddCount("history", changes)
+
+	err = mongoClient.recordDataset(ctx, appContext.AirportsSource.Name(), report)
+	if err != nil {
+		return err
+	}
+	err = mongoClient.RefreshViews(ctx)
+	if err != nil {
+		return err
+	}
+	appContext.CacheReset()
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package application
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AirportSync is the delta bringing a mirror of the airports from the version it holds to the
+// current one. With Resync set the delta cannot be given and the mirror has to start over from
+// a bundle. Every airport carries its hash, an airport the mirror holds with the same hash is
+// unchanged.
+type AirportSync struct {
+	Since    string     `json:"since"`
+	Version  string     `json:"version"`
+	Resync   bool       `json:"resync,omitempty"`
+	Airports []*Airport `json:"airports"`
+	Removed  []int64    `json:"removed"`
+}
+
+// SyncAirports returns the airports changed or added since the version a mirror holds was
+// imported, taken from the history, and those removed since. A version no longer among the
+// imports kept with the dataset, or a delta larger than the maximum number of results, asks
+// for a resync.
+func (mongoClient *MongoClient) SyncAirports(ctx context.Context, since string) (*AirportSync, error) {
+	appContext := mongoClient.appContext
+	sync := AirportSync{Since: since, Airports: []*Airport{}, Removed: []int64{}}
+
+	datasets, err := appContext.cachedDatasets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var imported *time.Time
+	for _, dataset := range datasets {
+		if dataset.Source == appContext.AirportsSource.Name() {
+			sync.Version = dataset.Version
+			imported = dataset.ImportedAt(since)
+		}
+	}
+	if sync.Version == since {
+		return &sync, nil
+	}
+	if since == "" || imported == nil {
+		sync.Resync = true
+		return &sync, nil
+	}
+
+	// The changes of an import are recorded before its version is, those of later imports after
+	changedIDs, err := mongoClient.history().Distinct(ctx, "airport_ref", bson.M{"changed": bson.M{"$gt": *imported}})
+	if err != nil {
+		return nil, err
+	}
+	if appContext.MaxResults > 0 && int64(len(changedIDs)) > appContext.MaxResults {
+		sync.Resync = true
+		return &sync, nil
+	}
+	if len(changedIDs) == 0 {
+		return &sync, nil
+	}
+
+	cursor, err := mongoClient.readCollection(AirportsCollection).Find(ctx, bson.M{"_id": bson.M{"$in": changedIDs}},
+		options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	err = cursor.All(ctx, &sync.Airports)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[int64]bool, len(sync.Airports))
+	for _, airport := range sync.Airports {
+		found[airport.AirportID] = true
+	}
+	for _, changedID := range changedIDs {
+		airportID, _ := changedID.(int64)
+		if !found[airportID] {
+			sync.Removed = append(sync.Removed, airportID)
+		}
+	}
+
+	return &sync, nil
+}
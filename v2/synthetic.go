@@ -0,0 +1,386 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SyntheticSources are the files the generator writes, in the order they are imported
+var SyntheticSources = []string{"countries", "regions", "airports", "runways", "frequencies"}
+
+// SyntheticOptions sizes the generated data. A fraction ErrorRate of the rows gets a fault
+// injected, like an unreadable number or a duplicate key, which the import has to reject.
+type SyntheticOptions struct {
+	Countries             int
+	RegionsPerCountry     int
+	Airports              int
+	RunwaysPerAirport     int
+	FrequenciesPerAirport int
+	ErrorRate             float64
+	Seed                  int64
+}
+
+// DefaultSyntheticOptions is about a quarter of the size of the OurAirports data
+var DefaultSyntheticOptions = SyntheticOptions{
+	Countries:             60,
+	RegionsPerCountry:     8,
+	Airports:              20000,
+	RunwaysPerAirport:     1,
+	FrequenciesPerAirport: 2,
+	ErrorRate:             0.001,
+	Seed:                  1}
+
+// The columns of the OurAirports files
+var (
+	syntheticCountryColumns = []string{"id", "code", "name", "continent", "wikipedia_link", "keywords"}
+	syntheticRegionColumns  = []string{
+		"id", "code", "local_code", "name", "continent", "iso_country", "wikipedia_link", "keywords"}
+	syntheticAirportColumns = []string{
+		"id", "ident", "type", "name", "latitude_deg", "longitude_deg", "elevation_ft", "continent",
+		"iso_country", "iso_region", "municipality", "scheduled_service", "gps_code", "icao_code",
+		"iata_code", "local_code", "home_link", "wikipedia_link", "keywords"}
+	syntheticRunwayColumns = []string{
+		"id", "airport_ref", "airport_ident", "length_ft", "width_ft", "surface", "lighted", "closed",
+		"le_ident", "he_ident"}
+	syntheticFrequencyColumns = []string{"id", "airport_ref", "airport_ident", "type", "description", "frequency_mhz"}
+)
+
+// The airport types by how common they are in the source data
+var syntheticAirportTypes = []AirportType{
+	SmallAirport, SmallAirport, SmallAirport, SmallAirport, SmallAirport, SmallAirport, SmallAirport,
+	SmallAirport, Heliport, Heliport, Heliport, MediumAirport, MediumAirport, ClosedAirport, SeaplaneBase,
+	LargeAirport, BalloonPort}
+
+var (
+	syntheticSyllables = []string{"ar", "ben", "dor", "el", "fa", "gor", "han", "is", "kar", "lin",
+		"mo", "nor", "os", "pel", "ra", "sun", "tor", "ul", "vik", "wes"}
+	syntheticSurfaces  = []string{"ASP", "ASP", "CON", "GRS", "GRE", "TURF", "DIRT", "WATER"}
+	syntheticFrequency = []string{"TWR", "GND", "APP", "ATIS", "CTAF", "UNIC"}
+)
+
+// syntheticCountry is what the airports of a country share
+type syntheticCountry struct {
+	code      string
+	continent Continent
+	latitude  float64
+	longitude float64
+	regions   []string
+}
+
+// syntheticAirport is what the runways and frequencies refer to
+type syntheticAirport struct {
+	id    int
+	ident string
+}
+
+// syntheticGenerator writes the sources from a single random sequence, so the countries,
+// regions and airports refer to each other and the content only depends on the seed
+type syntheticGenerator struct {
+	options   SyntheticOptions
+	random    *rand.Rand
+	countries []*syntheticCountry
+	airports  []*syntheticAirport
+}
+
+// name makes up a pronounceable name
+func (generator *syntheticGenerator) name(syllables int) string {
+	var name strings.Builder
+
+	for i := 0; i < syllables; i++ {
+		name.WriteString(syntheticSyllables[generator.random.Intn(len(syntheticSyllables))])
+	}
+
+	return strings.Title(name.String())
+}
+
+// inject tells whether the next row gets a fault
+func (generator *syntheticGenerator) inject() bool {
+	return generator.options.ErrorRate > 0 && generator.random.Float64() < generator.options.ErrorRate
+}
+
+// corrupt injects a fault in the row: the key of the previous row or the bad value in one of
+// the given columns
+func (generator *syntheticGenerator) corrupt(row []string, key int, previousKey string, bad string, columns ...int) {
+	if previousKey != "" && generator.random.Intn(2) == 0 {
+		row[key] = previousKey
+		return
+	}
+
+	row[columns[generator.random.Intn(len(columns))]] = bad
+}
+
+// writeRows writes the header and the rows produced by row, nil when it is done
+func writeRows(writer io.Writer, columns []string, row func(i int) []string) error {
+	csvWriter := csv.NewWriter(writer)
+
+	err := csvWriter.Write(columns)
+	if err != nil {
+		return err
+	}
+	for i := 0; ; i++ {
+		values := row(i)
+		if values == nil {
+			break
+		}
+		err = csvWriter.Write(values)
+		if err != nil {
+			return err
+		}
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// countryCode returns a unique two letter code for the i-th country
+func countryCode(i int) string {
+	return fmt.Sprintf("%c%c", 'A'+i/26%26, 'A'+i%26)
+}
+
+func (generator *syntheticGenerator) writeCountries(writer io.Writer) error {
+	previous := ""
+
+	return writeRows(writer, syntheticCountryColumns, func(i int) []string {
+		if i == generator.options.Countries {
+			return nil
+		}
+
+		country := &syntheticCountry{
+			code:      countryCode(i),
+			continent: Continents[generator.random.Intn(len(Continents))],
+			latitude:  generator.random.Float64()*140 - 70,
+			longitude: generator.random.Float64()*340 - 170}
+		generator.countries = append(generator.countries, country)
+
+		row := []string{strconv.Itoa(300000 + i), country.code, generator.name(3), string(country.continent), "", ""}
+		if generator.inject() {
+			generator.corrupt(row, 1, previous, "", 1)
+		}
+		previous = country.code
+
+		return row
+	})
+}
+
+func (generator *syntheticGenerator) writeRegions(writer io.Writer) error {
+	country, region := 0, 0
+	previous := ""
+
+	return writeRows(writer, syntheticRegionColumns, func(i int) []string {
+		if region == generator.options.RegionsPerCountry {
+			country, region = country+1, 0
+		}
+		if country >= len(generator.countries) {
+			return nil
+		}
+		region++
+
+		parent := generator.countries[country]
+		localCode := strconv.Itoa(region)
+		code := parent.code + "-" + localCode
+		parent.regions = append(parent.regions, code)
+
+		row := []string{strconv.Itoa(310000 + i), code, localCode, generator.name(2), string(parent.continent),
+			parent.code, "", ""}
+		if generator.inject() {
+			generator.corrupt(row, 1, previous, "", 1)
+		}
+		previous = code
+
+		return row
+	})
+}
+
+func (generator *syntheticGenerator) writeAirports(writer io.Writer) error {
+	previous := ""
+
+	return writeRows(writer, syntheticAirportColumns, func(i int) []string {
+		if i == generator.options.Airports {
+			return nil
+		}
+
+		country := &syntheticCountry{
+			code:      countryCode(generator.random.Intn(26 * 26)),
+			continent: Continents[generator.random.Intn(len(Continents))],
+			latitude:  generator.random.Float64()*140 - 70,
+			longitude: generator.random.Float64()*340 - 170}
+		if len(generator.countries) > 0 {
+			country = generator.countries[generator.random.Intn(len(generator.countries))]
+		}
+		region := country.code + "-U-A"
+		if len(country.regions) > 0 {
+			region = country.regions[generator.random.Intn(len(country.regions))]
+		}
+
+		airport := &syntheticAirport{id: i + 1, ident: fmt.Sprintf("X%06d", i+1)}
+		generator.airports = append(generator.airports, airport)
+		airportType := syntheticAirportTypes[generator.random.Intn(len(syntheticAirportTypes))]
+		scheduled := "no"
+		if airportType == LargeAirport || (airportType == MediumAirport && generator.random.Intn(2) == 0) {
+			scheduled = "yes"
+		}
+		latitude := country.latitude + generator.random.Float64()*10 - 5
+		longitude := country.longitude + generator.random.Float64()*10 - 5
+
+		row := []string{
+			strconv.Itoa(airport.id),
+			airport.ident,
+			string(airportType),
+			generator.name(2) + " " + strings.Title(strings.Replace(string(airportType), "_", " ", -1)),
+			strconv.FormatFloat(latitude, 'f', 6, 64),
+			strconv.FormatFloat(longitude, 'f', 6, 64),
+			strconv.Itoa(generator.random.Intn(8000) - 100),
+			string(country.continent),
+			country.code,
+			region,
+			generator.name(2),
+			scheduled,
+			airport.ident,
+			"",
+			"",
+			airport.ident,
+			"",
+			"",
+			"synthetic"}
+		if generator.inject() {
+			generator.corrupt(row, 0, previous, "n/a", 2, 4, 6, 11)
+		}
+		previous = strconv.Itoa(airport.id)
+
+		return row
+	})
+}
+
+func (generator *syntheticGenerator) writeRunways(writer io.Writer) error {
+	perAirport := generator.options.RunwaysPerAirport
+	previous := ""
+
+	return writeRows(writer, syntheticRunwayColumns, func(i int) []string {
+		if perAirport <= 0 || i == len(generator.airports)*perAirport {
+			return nil
+		}
+
+		airport := generator.airports[i/perAirport]
+		heading := 1 + generator.random.Intn(18)
+		row := []string{
+			strconv.Itoa(200000 + i),
+			strconv.Itoa(airport.id),
+			airport.ident,
+			strconv.Itoa(1000 + generator.random.Intn(12000)),
+			strconv.Itoa(30 + generator.random.Intn(170)),
+			syntheticSurfaces[generator.random.Intn(len(syntheticSurfaces))],
+			strconv.Itoa(generator.random.Intn(2)),
+			"0",
+			fmt.Sprintf("%02d", heading),
+			fmt.Sprintf("%02d", heading+18)}
+		if generator.inject() {
+			generator.corrupt(row, 0, previous, "n/a", 1, 3, 4)
+		}
+		previous = row[0]
+
+		return row
+	})
+}
+
+func (generator *syntheticGenerator) writeFrequencies(writer io.Writer) error {
+	perAirport := generator.options.FrequenciesPerAirport
+	previous := ""
+
+	return writeRows(writer, syntheticFrequencyColumns, func(i int) []string {
+		if perAirport <= 0 || i == len(generator.airports)*perAirport {
+			return nil
+		}
+
+		airport := generator.airports[i/perAirport]
+		frequencyType := syntheticFrequency[generator.random.Intn(len(syntheticFrequency))]
+		row := []string{
+			strconv.Itoa(100000 + i),
+			strconv.Itoa(airport.id),
+			airport.ident,
+			frequencyType,
+			airport.ident + " " + frequencyType,
+			strconv.FormatFloat(118+float64(generator.random.Intn(760))*0.025, 'f', 3, 64)}
+		if generator.inject() {
+			generator.corrupt(row, 0, previous, "n/a", 1, 5)
+		}
+		previous = row[0]
+
+		return row
+	})
+}
+
+// GenerateSynthetic produces realistic files of all SyntheticSources, mapped by source name,
+// in the format of OurAirports
+func GenerateSynthetic(options SyntheticOptions) (map[string][]byte, error) {
+	generator := syntheticGenerator{options: options, random: rand.New(rand.NewSource(options.Seed))}
+	writers := map[string]func(io.Writer) error{
+		"countries":   generator.writeCountries,
+		"regions":     generator.writeRegions,
+		"airports":    generator.writeAirports,
+		"runways":     generator.writeRunways,
+		"frequencies": generator.writeFrequencies}
+
+	files := map[string][]byte{}
+	for _, source := range SyntheticSources {
+		var data bytes.Buffer
+		err := writers[source](&data)
+		if err != nil {
+			return nil, fmt.Errorf("synthetic %s: %v", source, err)
+		}
+		files[source] = data.Bytes()
+	}
+
+	return files, nil
+}
+
+// WriteSyntheticFiles writes the generated files as <source>.csv in the directory, so they
+// can be imported through file URLs
+func WriteSyntheticFiles(directory string, options SyntheticOptions) error {
+	files, err := GenerateSynthetic(options)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(directory, 0755)
+	if err != nil {
+		return err
+	}
+	for source, data := range files {
+		err = ioutil.WriteFile(filepath.Join(directory, source+".csv"), data, 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteSyntheticAirports writes an airports file of the given number of rows in the format of
+// OurAirports. The content only depends on the seed, so runs can be compared.
+func WriteSyntheticAirports(writer io.Writer, rows int, seed int64) error {
+	generator := syntheticGenerator{
+		options: SyntheticOptions{Airports: rows, Seed: seed},
+		random:  rand.New(rand.NewSource(seed))}
+
+	return generator.writeAirports(writer)
+}
+
+// syntheticSource reads a generated file instead of downloading it, no snapshot is kept
+type syntheticSource struct {
+	CSVSource
+	data []byte
+}
+
+// Fetch opens the generated file
+func (source *syntheticSource) Fetch(ctx context.Context, appContext *AppContext, report *RunReport) (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(source.data)), nil
+}
@@ -0,0 +1,147 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// The tags stored with the objects written by the application
+const (
+	TagRunID     = "run-id"
+	TagSource    = "source"
+	TagVersion   = "version"
+	TagRows      = "rows"
+	TagTopic     = "topic"
+	TagLines     = "lines"
+	TagSucceeded = "succeeded"
+)
+
+// userMetadataPrefix is how S3 returns the user metadata an object was stored with
+const userMetadataPrefix = "x-amz-meta-"
+
+// ObjectTags is the metadata stored with an object, as user metadata so any S3 provider
+// keeps it
+type ObjectTags map[string]string
+
+// putOptions returns the options storing an object of the content type with the tags
+func (tags ObjectTags) putOptions(contentType string) minio.PutObjectOptions {
+	return minio.PutObjectOptions{ContentType: contentType, UserMetadata: tags}
+}
+
+// objectTags reads the tags from the metadata of a stored object
+func objectTags(info minio.ObjectInfo) ObjectTags {
+	tags := ObjectTags{}
+
+	for key, values := range info.Metadata {
+		key = strings.ToLower(key)
+		if strings.HasPrefix(key, userMetadataPrefix) && len(values) > 0 {
+			tags[strings.TrimPrefix(key, userMetadataPrefix)] = values[0]
+		}
+	}
+
+	return tags
+}
+
+// logPutOptions tags a log, or a part of it, with its topic and number of lines
+func logPutOptions(logName string, logData []byte) minio.PutObjectOptions {
+	tags := ObjectTags{TagLines: strconv.Itoa(bytes.Count(logData, []byte("\n")))}
+
+	parts := logObjectName.FindStringSubmatch(logName)
+	if parts != nil {
+		tags[TagTopic] = parts[1]
+	}
+
+	return tags.putOptions("text/plain")
+}
+
+// lineCounter counts the lines written through it
+type lineCounter int64
+
+func (counter *lineCounter) Write(p []byte) (int, error) {
+	*counter += lineCounter(bytes.Count(p, []byte("\n")))
+	return len(p), nil
+}
+
+// Artifact is a stored object with its tags
+type Artifact struct {
+	Bucket      string     `json:"bucket"`
+	Name        string     `json:"name"`
+	Size        int64      `json:"size"`
+	Modified    time.Time  `json:"modified"`
+	ContentType string     `json:"content-type"`
+	Tags        ObjectTags `json:"tags"`
+}
+
+// ArtifactFilter selects stored objects by name prefix, time stored and tags, all tags
+// given must match
+type ArtifactFilter struct {
+	Prefix string
+	From   time.Time
+	To     time.Time
+	Tags   ObjectTags
+}
+
+// inRange tells whether the object was stored within the time range of the filter
+func (filter *ArtifactFilter) inRange(modified time.Time) bool {
+	if !filter.From.IsZero() && modified.Before(filter.From) {
+		return false
+	}
+
+	return filter.To.IsZero() || !modified.After(filter.To)
+}
+
+// hasTags tells whether the object carries all tags of the filter
+func (filter *ArtifactFilter) hasTags(tags ObjectTags) bool {
+	for key, value := range filter.Tags {
+		if tags[key] != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Artifacts lists the objects in the bucket selected by the filter with their tags, like all
+// airport snapshots of a month with {Tags: {"source": "airports"}, From: ..., To: ...}. Listing
+// does not return the metadata, so each object within the time range is looked at.
+func (appContext *AppContext) Artifacts(ctx context.Context, bucket string, filter *ArtifactFilter) ([]*Artifact, error) {
+	artifacts := []*Artifact{}
+
+	objects, err := appContext.listObjects(ctx, bucket, filter.Prefix, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range objects {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		if !filter.inRange(info.LastModified) {
+			continue
+		}
+
+		stat, err := appContext.statObject(ctx, bucket, info.Key)
+		if err != nil {
+			return nil, err
+		}
+		tags := objectTags(stat)
+		if !filter.hasTags(tags) {
+			continue
+		}
+
+		artifacts = append(artifacts, &Artifact{
+			Bucket:      bucket,
+			Name:        info.Key,
+			Size:        info.Size,
+			Modified:    info.LastModified,
+			ContentType: stat.ContentType,
+			Tags:        tags})
+	}
+
+	return artifacts, nil
+}
@@ -0,0 +1,62 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ErrTenant is returned for a tenant name that cannot be used as a key prefix
+var ErrTenant = errors.New("tenant names cannot contain a slash or start with a dot")
+
+// tenantKey is the context key of the tenant an operation is for
+type tenantKey struct{}
+
+// WithTenant keeps the objects of the AppContext under <tenant>/ in every bucket, so tenants
+// can share an object store without seeing each other's snapshots, reports and logs
+func WithTenant(tenant string) Option {
+	return func(appContext *AppContext) {
+		appContext.Tenant = tenant
+	}
+}
+
+// ForTenant returns a context under which the object store operations use the prefix of the
+// tenant rather than the one of the AppContext
+func ForTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// checkTenant returns an error when the tenant cannot be used as a key prefix, no tenant is fine
+func checkTenant(tenant string) error {
+	if strings.Contains(tenant, "/") || strings.HasPrefix(tenant, ".") {
+		return ErrTenant
+	}
+
+	return nil
+}
+
+// tenantPrefix returns the key prefix of the tenant of the operation, empty for none. A tenant
+// the operation is for that cannot be used returns ErrTenant, rather than falling back to the
+// tenant of the AppContext.
+func (appContext *AppContext) tenantPrefix(ctx context.Context) (string, error) {
+	tenant := appContext.Tenant
+	if forTenant, found := ctx.Value(tenantKey{}).(string); found {
+		err := checkTenant(forTenant)
+		if err != nil {
+			return "", err
+		}
+		tenant = forTenant
+	}
+	if tenant == "" {
+		return "", nil
+	}
+
+	return tenant + "/", nil
+}
+
+// objectKey returns the key under which the object is stored for the tenant of the operation
+func (appContext *AppContext) objectKey(ctx context.Context, name string) (string, error) {
+	prefix, err := appContext.tenantPrefix(ctx)
+
+	return prefix + name, err
+}
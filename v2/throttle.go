@@ -0,0 +1,134 @@
+package application
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// throttleStep is the first delay once the database is slow, it doubles while it stays slow
+const throttleStep = 50 * time.Millisecond
+
+// defaultThrottleMaxDelay bounds the delay between batches unless configured otherwise
+const defaultThrottleMaxDelay = 5 * time.Second
+
+// throttleOptions describes the import-throttle section of the options file
+type throttleOptions struct {
+	LatencyMs  int64 `json:"latency-ms"`
+	MaxDelayMs int64 `json:"max-delay-ms"`
+}
+
+// Throttle slows down the import batches while the database answers slower than the threshold,
+// so the queries sharing the cluster keep their response times. The delay doubles with every
+// slow batch up to the maximum, and halves with every fast one.
+type Throttle struct {
+	mutex     sync.Mutex
+	threshold time.Duration
+	maxDelay  time.Duration
+	delay     time.Duration
+}
+
+// NewThrottle backs off when a batch takes longer than the threshold, waiting at most maxDelay
+// between batches
+func NewThrottle(threshold time.Duration, maxDelay time.Duration) *Throttle {
+	if maxDelay <= 0 {
+		maxDelay = defaultThrottleMaxDelay
+	}
+
+	return &Throttle{threshold: threshold, maxDelay: maxDelay}
+}
+
+// WithImportThrottle slows the imports down while a batch takes longer than the threshold,
+// zero disables throttling
+func WithImportThrottle(threshold time.Duration, maxDelay time.Duration) Option {
+	return func(appContext *AppContext) {
+		appContext.ImportThrottle = nil
+		if threshold > 0 {
+			appContext.ImportThrottle = NewThrottle(threshold, maxDelay)
+		}
+	}
+}
+
+// Observe adapts the delay to the latency of a batch, returning the new delay and whether
+// throttling started or stopped
+func (throttle *Throttle) Observe(latency time.Duration) (time.Duration, bool) {
+	throttle.mutex.Lock()
+	defer throttle.mutex.Unlock()
+
+	previous := throttle.delay
+	if latency > throttle.threshold {
+		throttle.delay *= 2
+		if throttle.delay < throttleStep {
+			throttle.delay = throttleStep
+		}
+		if throttle.delay > throttle.maxDelay {
+			throttle.delay = throttle.maxDelay
+		}
+	} else {
+		throttle.delay /= 2
+		if throttle.delay < throttleStep {
+			throttle.delay = 0
+		}
+	}
+
+	return throttle.delay, (previous == 0) != (throttle.delay == 0)
+}
+
+// Delay returns the current delay between batches
+func (throttle *Throttle) Delay() time.Duration {
+	throttle.mutex.Lock()
+	defer throttle.mutex.Unlock()
+
+	return throttle.delay
+}
+
+// Wait sleeps the current delay, or until the context is done
+func (throttle *Throttle) Wait(ctx context.Context) error {
+	delay := throttle.Delay()
+	if delay == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// throttleBatch waits before a batch as long as the throttle says, counting the time in the report
+func (appContext *AppContext) throttleBatch(ctx context.Context, report *RunReport) error {
+	throttle := appContext.ImportThrottle
+	if throttle == nil {
+		return nil
+	}
+
+	delay := throttle.Delay()
+	if delay > 0 {
+		report.AddCount("throttled-ms", delay.Milliseconds())
+	}
+
+	return throttle.Wait(ctx)
+}
+
+// observeBatch feeds the latency of a batch to the throttle, logging when throttling starts or stops
+func (appContext *AppContext) observeBatch(collection string, latency time.Duration) {
+	throttle := appContext.ImportThrottle
+	if throttle == nil {
+		return
+	}
+
+	delay, changed := throttle.Observe(latency)
+	if !changed {
+		return
+	}
+	if delay > 0 {
+		appContext.Logger().With("collection", collection, "latency", latency).Println("Import throttled")
+		return
+	}
+	appContext.Logger().With("collection", collection, "latency", latency).Println("Import throttle lifted")
+}
@@ -0,0 +1,83 @@
+// Package units provides explicit types for the physical quantities in the geography data,
+// so lengths, distances and frequencies can't be mixed up by accident
+package units
+
+// Conversion factors
+const (
+	metersPerFoot         = 0.3048
+	kilometersPerNautical = 1.852
+	kilohertzPerMegahertz = 1000.0
+	metersPerKilometer    = 1000.0
+	kilometersPerStatute  = 1.609344
+)
+
+// LengthFeet is a length or elevation in feet, as used in the source data
+type LengthFeet float64
+
+// LengthMeters is a length or elevation in meters
+type LengthMeters float64
+
+// Meters converts feet to meters
+func (feet LengthFeet) Meters() LengthMeters {
+	return LengthMeters(float64(feet) * metersPerFoot)
+}
+
+// Feet converts meters to feet
+func (meters LengthMeters) Feet() LengthFeet {
+	return LengthFeet(float64(meters) / metersPerFoot)
+}
+
+// DistanceKm is a distance in kilometers
+type DistanceKm float64
+
+// DistanceNM is a distance in nautical miles
+type DistanceNM float64
+
+// DistanceMiles is a distance in statute miles
+type DistanceMiles float64
+
+// NauticalMiles converts kilometers to nautical miles
+func (km DistanceKm) NauticalMiles() DistanceNM {
+	return DistanceNM(float64(km) / kilometersPerNautical)
+}
+
+// Miles converts kilometers to statute miles
+func (km DistanceKm) Miles() DistanceMiles {
+	return DistanceMiles(float64(km) / kilometersPerStatute)
+}
+
+// Meters converts kilometers to meters
+func (km DistanceKm) Meters() LengthMeters {
+	return LengthMeters(float64(km) * metersPerKilometer)
+}
+
+// Kilometers converts nautical miles to kilometers
+func (nm DistanceNM) Kilometers() DistanceKm {
+	return DistanceKm(float64(nm) * kilometersPerNautical)
+}
+
+// Kilometers converts statute miles to kilometers
+func (miles DistanceMiles) Kilometers() DistanceKm {
+	return DistanceKm(float64(miles) * kilometersPerStatute)
+}
+
+// Kilometers converts meters to kilometers
+func (meters LengthMeters) Kilometers() DistanceKm {
+	return DistanceKm(float64(meters) / metersPerKilometer)
+}
+
+// FrequencyMHz is a radio frequency in megahertz, as used for VHF communication
+type FrequencyMHz float64
+
+// FrequencyKHz is a radio frequency in kilohertz, as used for NDBs
+type FrequencyKHz float64
+
+// KHz converts megahertz to kilohertz
+func (mhz FrequencyMHz) KHz() FrequencyKHz {
+	return FrequencyKHz(float64(mhz) * kilohertzPerMegahertz)
+}
+
+// MHz converts kilohertz to megahertz
+func (khz FrequencyKHz) MHz() FrequencyMHz {
+	return FrequencyMHz(float64(khz) / kilohertzPerMegahertz)
+}
@@ -0,0 +1,273 @@
+package application
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/notification"
+)
+
+// uploadRetry is the wait before listening again when the bucket notifications broke off
+const uploadRetry = 10 * time.Second
+
+// uploadImport replaces the source of an import by an uploaded file and runs the import
+type uploadImport struct {
+	source func(uploaded *AppContext, file string)
+	run    func(mongoClient *MongoClient, ctx context.Context, report *RunReport) error
+}
+
+// uploadImports are the imports of the files dropped in the csv bucket, by name. The snapshots
+// of the imports carry a date stamp, so they never match.
+var uploadImports = map[string]uploadImport{
+	"airports.csv": {
+		source: func(uploaded *AppContext, file string) {
+			uploaded.AirportsSource = &CSVSource{SourceName: uploaded.AirportsSource.Name(), URL: file, KeyColumn: "id"}
+		},
+		run: (*MongoClient).ImportAirports},
+	"navaids.csv": {
+		source: func(uploaded *AppContext, file string) { uploaded.NavaidsURL = file },
+		run:    (*MongoClient).ImportNavaids},
+	"fixes.csv": {
+		source: func(uploaded *AppContext, file string) { uploaded.FixesURL = file },
+		run:    (*MongoClient).ImportFixes},
+	"airspaces.geojson": {
+		source: func(uploaded *AppContext, file string) {
+			uploaded.AirspacesSource = &GeoJSONSource{SourceName: "airspaces", URL: file, KeyProperty: "id"}
+		},
+		run: (*MongoClient).ImportAirspaces},
+}
+
+// importUpload imports the uploaded object with the import its name belongs to, removing it
+// once it is in
+func (appContext *AppContext) importUpload(ctx context.Context, name string) error {
+	upload := uploadImports[name]
+	uploaded := appContext.WithOverrides(ContextOverrides{})
+	report := uploaded.ReportCreate(strings.TrimSuffix(name, path.Ext(name)) + "-upload")
+
+	object, err := appContext.getObject(ctx, "csv", name)
+	if err == nil {
+		var file *sourceFile
+		file, err = report.Workspace().TempFile("upload-*" + path.Ext(name))
+		if err == nil {
+			_, err = io.Copy(file, object)
+			file.Close()
+
+			// The upload stands in for the configured source, snapshot and all
+			upload.source(uploaded, file.Name())
+		}
+		object.Close()
+	}
+
+	var mongoClient *MongoClient
+	if err == nil {
+		mongoClient, err = uploaded.DBOpen()
+	}
+	if err != nil {
+		uploaded.ReportClose(ctx, report, false)
+		return err
+	}
+	defer mongoClient.DBClose()
+
+	err = upload.run(mongoClient, ctx, report)
+	reportName, reportErr := uploaded.ReportClose(ctx, report, err == nil)
+	if reportErr != nil {
+		appContext.LogError(reportErr)
+	}
+	uploaded.NotifyReport(report)
+	if err != nil {
+		return err
+	}
+
+	appContext.Logger().With("object", name, "report", reportName).Println("Upload: imported")
+
+	return appContext.removeObject(ctx, "csv", name)
+}
+
+// uploadedObject returns the name of the object created by the notification, without the
+// tenant prefix, false when it is not an upload to import
+func (appContext *AppContext) uploadedObject(ctx context.Context, event notification.Event) (string, bool) {
+	if !strings.HasPrefix(event.EventName, "s3:ObjectCreated:") {
+		return "", false
+	}
+
+	// Keys come URL encoded in notifications
+	key, err := url.QueryUnescape(event.S3.Object.Key)
+	if err != nil {
+		return "", false
+	}
+	prefix, err := appContext.tenantPrefix(ctx)
+	if err != nil {
+		return "", false
+	}
+	name := strings.TrimPrefix(key, prefix)
+	_, found := uploadImports[name]
+
+	return name, found
+}
+
+// handleUploads imports the uploads the notifications tell about, until they break off or the
+// context is done
+func (appContext *AppContext) handleUploads(ctx context.Context, notifications <-chan notification.Info) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case info, ok := <-notifications:
+			if !ok {
+				return
+			}
+			if info.Err != nil {
+				appContext.LogError(fmt.Errorf("upload notifications: %v", info.Err))
+				return
+			}
+			for _, event := range info.Records {
+				name, found := appContext.uploadedObject(ctx, event)
+				if !found {
+					continue
+				}
+				err := appContext.importUpload(ctx, name)
+				if err != nil {
+					appContext.LogError(fmt.Errorf("upload %s: %v", name, err))
+				}
+			}
+		}
+	}
+}
+
+// WatchUploads imports an airports.csv, navaids.csv, fixes.csv or airspaces.geojson dropped in
+// the csv bucket as soon as MinIO notifies about it, until the context is done. The import runs
+// like a scheduled one, airports staged for approval when that is required, and the upload is
+// removed once imported; its snapshot stays.
+func (appContext *AppContext) WatchUploads(ctx context.Context) error {
+	if appContext.S3Client() == nil {
+		return ErrNoStorage
+	}
+
+	prefix, err := appContext.tenantPrefix(ctx)
+	if err != nil {
+		return err
+	}
+
+	for ctx.Err() == nil {
+		listenCtx, cancel := context.WithCancel(ctx)
+		notifications := appContext.S3Client().ListenBucketNotification(listenCtx, "csv", prefix, "",
+			[]string{string(notification.ObjectCreatedAll)})
+
+		appContext.handleUploads(ctx, notifications)
+		cancel()
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(uploadRetry):
+		}
+	}
+
+	return nil
+}
+
+// JobImportSnapshot is the kind of job importing the airports from a snapshot in the csv bucket,
+// with the snapshot and run-id as params
+const JobImportSnapshot = "import-snapshot"
+
+// snapshotSource reads the airports from a snapshot kept before, rather than fetching them
+type snapshotSource struct {
+	CSVSource
+	snapshot string
+}
+
+// Fetch copies the snapshot to a temporary file, its hash is the version as it was when stored
+func (source *snapshotSource) Fetch(ctx context.Context, appContext *AppContext, report *RunReport) (io.ReadCloser, error) {
+	object, err := appContext.getObject(ctx, "csv", source.snapshot)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	file, err := report.Workspace().TempFile(source.SourceName + "-*.csv")
+	if err != nil {
+		return nil, err
+	}
+	file.snapshot = source.snapshot
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), &contextReader{ctx: ctx, reader: object})
+	report.AddUsage(source.SourceName, ResourceUsage{Downloaded: size})
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	report.setVersion(source.SourceName, hex.EncodeToString(hash.Sum(nil)))
+
+	return file, nil
+}
+
+// StoreUpload keeps an uploaded airports file as a snapshot in the csv bucket, returning the
+// snapshot and the run id it is tagged with, to be passed to an import-snapshot job
+func (appContext *AppContext) StoreUpload(ctx context.Context, data io.Reader) (string, string, error) {
+	err := appContext.CheckWritable()
+	if err != nil {
+		return "", "", err
+	}
+
+	// The report only lends its run id, the import-snapshot job reports
+	report := appContext.ReportCreate("airports-upload")
+	file, err := appContext.storeSource(ctx, appContext.AirportsSource.Name(), ".csv", data, report)
+	if err == nil {
+		file.Close()
+	}
+	appContext.closeWorkspace(ctx, report.Workspace(), true)
+	if err != nil {
+		return "", "", err
+	}
+
+	return file.snapshot, report.RunID, nil
+}
+
+// ImportSnapshotJob is the handler of import-snapshot jobs, importing the airports from the
+// snapshot under the run id it was stored with
+func (appContext *AppContext) ImportSnapshotJob(ctx context.Context, job *Job) error {
+	snapshot := job.Params["snapshot"]
+	if !strings.HasPrefix(snapshot, appContext.AirportsSource.Name()+"-") {
+		return fmt.Errorf("%s: not an airports snapshot", snapshot)
+	}
+
+	uploaded := appContext.WithOverrides(ContextOverrides{})
+	uploaded.AirportsSource = &snapshotSource{
+		CSVSource: CSVSource{SourceName: appContext.AirportsSource.Name(), KeyColumn: "id"},
+		snapshot:  snapshot}
+
+	mongoClient, err := uploaded.DBOpen()
+	if err != nil {
+		return err
+	}
+	defer mongoClient.DBClose()
+
+	report := uploaded.ReportCreate("airports-upload")
+	if job.Params["run-id"] != "" {
+		report.RunID = job.Params["run-id"]
+		report.workspace = uploaded.newWorkspace(report.RunID)
+	}
+	err = mongoClient.ImportAirports(ctx, report)
+	_, reportErr := uploaded.ReportClose(ctx, report, err == nil)
+	if reportErr != nil {
+		appContext.LogError(reportErr)
+	}
+	uploaded.NotifyReport(report)
+
+	return err
+}
+
+// HandleImportSnapshot registers the handler of import-snapshot jobs
+func (worker *JobWorker) HandleImportSnapshot() {
+	worker.Handle(JobImportSnapshot, worker.appContext.ImportSnapshotJob)
+}
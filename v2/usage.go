@@ -0,0 +1,38 @@
+package application
+
+import (
+	"time"
+)
+
+// ResourceUsage is what a run spent on a source, to attribute the cost of the infrastructure:
+// the bytes downloaded and uploaded, the documents written to Mongo and the time taken
+type ResourceUsage struct {
+	Downloaded int64         `json:"downloaded-bytes"`
+	Uploaded   int64         `json:"uploaded-bytes"`
+	MongoOps   int64         `json:"mongo-ops"`
+	Duration   time.Duration `json:"duration"`
+}
+
+// add adds the other usage to this one
+func (usage *ResourceUsage) add(other ResourceUsage) {
+	usage.Downloaded += other.Downloaded
+	usage.Uploaded += other.Uploaded
+	usage.MongoOps += other.MongoOps
+	usage.Duration += other.Duration
+}
+
+// AddUsage adds to the resources the run spent on the source
+func (report *RunReport) AddUsage(source string, usage ResourceUsage) {
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+
+	if report.Usage == nil {
+		report.Usage = map[string]*ResourceUsage{}
+	}
+	sourceUsage, found := report.Usage[source]
+	if !found {
+		sourceUsage = &ResourceUsage{}
+		report.Usage[source] = sourceUsage
+	}
+	sourceUsage.add(usage)
+}
@@ -0,0 +1,125 @@
+package application
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MaterializedView is an aggregation over a source collection whose result is kept in a target
+// collection, refreshed after every import so readers get it in a single query. Collections
+// are given by their base name, the pipeline gets the context to resolve the names of the
+// collections it looks up.
+type MaterializedView struct {
+	Name       string
+	Collection string
+	Target     string
+	Pipeline   func(appContext *AppContext) *Pipeline
+	Indexes    []mongo.IndexModel
+}
+
+// viewStatPrefix prefixes the name of the statistic holding the freshness of a view
+const viewStatPrefix = "view-"
+
+// builtinViews lists the views the application materializes itself
+var builtinViews = []MaterializedView{airportPagesView}
+
+// WithMaterializedView registers a view to refresh after imports, a view registered under the
+// name of another one replaces it
+func WithMaterializedView(view MaterializedView) Option {
+	return func(appContext *AppContext) {
+		appContext.MaterializedViews = append(appContext.MaterializedViews, view)
+	}
+}
+
+// views returns the builtin and registered views, in the order they are refreshed
+func (appContext *AppContext) views() []MaterializedView {
+	views := []MaterializedView{}
+	position := map[string]int{}
+
+	for _, view := range append(append([]MaterializedView{}, builtinViews...), appContext.MaterializedViews...) {
+		index, found := position[view.Name]
+		if found {
+			views[index] = view
+			continue
+		}
+		position[view.Name] = len(views)
+		views = append(views, view)
+	}
+
+	return views
+}
+
+// refreshView replaces the target collection of the view in one go, so readers never see it
+// half built, and records its freshness as a statistic
+func (mongoClient *MongoClient) refreshView(ctx context.Context, view MaterializedView) error {
+	appContext := mongoClient.appContext
+	started := appContext.now()
+
+	// Indexes of the collection replaced by $out are kept
+	pipeline := view.Pipeline(appContext).Stage("$out", appContext.CollectionName(view.Target))
+	cursor, err := mongoClient.collection(view.Collection).Aggregate(ctx, pipeline.Stages(),
+		options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return fmt.Errorf("view %s: %v", view.Name, err)
+	}
+	cursor.Close(ctx)
+
+	target := mongoClient.collection(view.Target)
+	if len(view.Indexes) > 0 {
+		_, err = target.Indexes().CreateMany(ctx, view.Indexes)
+		if err != nil {
+			return fmt.Errorf("view %s: %v", view.Name, err)
+		}
+	}
+	documents, err := target.EstimatedDocumentCount(ctx)
+	if err != nil {
+		return fmt.Errorf("view %s: %v", view.Name, err)
+	}
+
+	refreshed := appContext.now()
+	statistic := Statistic{Name: viewStatPrefix + view.Name, Updated: refreshed, Values: []*StatValue{
+		{Key: "documents", Value: float64(documents)},
+		{Key: "seconds", Value: refreshed.Sub(started).Seconds()}}}
+	_, err = mongoClient.stats().ReplaceOne(ctx, bson.M{"_id": statistic.Name}, &statistic,
+		options.Replace().SetUpsert(true))
+
+	return err
+}
+
+// RefreshViews materializes all views again, one after the other. Imports refresh them when
+// done; the freshness of each is served as the statistic view-{name}.
+func (mongoClient *MongoClient) RefreshViews(ctx context.Context) error {
+	err := mongoClient.appContext.CheckWritable()
+	if err != nil {
+		return err
+	}
+
+	for _, view := range mongoClient.appContext.views() {
+		err = mongoClient.refreshView(ctx, view)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RefreshView materializes the named view again
+func (mongoClient *MongoClient) RefreshView(ctx context.Context, name string) error {
+	err := mongoClient.appContext.CheckWritable()
+	if err != nil {
+		return err
+	}
+
+	for _, view := range mongoClient.appContext.views() {
+		if view.Name == name {
+			return mongoClient.refreshView(ctx, view)
+		}
+	}
+
+	return fmt.Errorf("unknown view %s", name)
+}
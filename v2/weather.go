@@ -0,0 +1,177 @@
+package application
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// defaultWeatherTTL is how long a fetched report is reused, METARs are issued half-hourly
+const defaultWeatherTTL = 5 * time.Minute
+
+// The kinds of weather reports
+const (
+	METAR = "METAR"
+	TAF   = "TAF"
+)
+
+// stationPlaceholder is replaced by the station ident in the weather endpoints
+const stationPlaceholder = "{station}"
+
+// weatherOptions describes the weather section of the options file
+type weatherOptions struct {
+	MetarURL     string `json:"metar-url"`
+	TAFURL       string `json:"taf-url"`
+	CacheSeconds int64  `json:"cache-seconds"`
+}
+
+// WeatherStation maps an airport to the station reporting its weather, for airports
+// without a station of their own or where the station ident differs from the ICAO code
+type WeatherStation struct {
+	AirportIdent string    `bson:"_id" json:"airport"`
+	Station      string    `bson:"station" json:"station"`
+	Updated      time.Time `bson:"updated" json:"updated"`
+}
+
+// WeatherReport is a raw METAR or TAF as returned by the weather endpoint
+type WeatherReport struct {
+	Station string    `json:"station"`
+	Kind    string    `json:"kind"`
+	Raw     string    `json:"raw"`
+	Fetched time.Time `json:"fetched"`
+}
+
+// WithWeather fetches the reports from the given endpoints, where {station} is replaced by
+// the station ident, an empty endpoint disables that kind of report
+func WithWeather(metarURL string, tafURL string) Option {
+	return func(appContext *AppContext) {
+		appContext.MetarURL = metarURL
+		appContext.TAFURL = tafURL
+	}
+}
+
+func (mongoClient *MongoClient) weatherStations() *mongo.Collection {
+	return mongoClient.collection(WeatherStationsCollection)
+}
+
+// StationSet maps the airport to a weather station
+func (mongoClient *MongoClient) StationSet(ctx context.Context, airportIdent string, station string) error {
+	err := mongoClient.appContext.CheckWritable()
+	if err != nil {
+		return err
+	}
+
+	mapping := WeatherStation{
+		AirportIdent: NormalizeCode(airportIdent),
+		Station:      NormalizeCode(station),
+		Updated:      mongoClient.appContext.now()}
+	_, err = mongoClient.weatherStations().ReplaceOne(ctx, bson.M{"_id": mapping.AirportIdent}, &mapping,
+		options.Replace().SetUpsert(true))
+
+	return err
+}
+
+// StationDelete removes the mapping of the airport, it falls back on its own codes again
+func (mongoClient *MongoClient) StationDelete(ctx context.Context, airportIdent string) error {
+	err := mongoClient.appContext.CheckWritable()
+	if err != nil {
+		return err
+	}
+
+	result, err := mongoClient.weatherStations().DeleteOne(ctx, bson.M{"_id": NormalizeCode(airportIdent)})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// StationFor returns the weather station of the airport: the mapped station if there is
+// one, otherwise the ICAO or GPS code of the airport itself
+func (mongoClient *MongoClient) StationFor(ctx context.Context, airport *Airport) (string, error) {
+	var mapping WeatherStation
+
+	err := mongoClient.weatherStations().FindOne(ctx, bson.M{"_id": airport.Ident}).Decode(&mapping)
+	if err == nil {
+		return mapping.Station, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return "", err
+	}
+
+	if airport.ICAOCode != "" {
+		return airport.ICAOCode, nil
+	}
+	if airport.GPSCode != "" {
+		return airport.GPSCode, nil
+	}
+
+	return "", ErrNotFound
+}
+
+// METAR returns the current METAR for the airport
+func (mongoClient *MongoClient) METAR(ctx context.Context, airport *Airport) (*WeatherReport, error) {
+	return mongoClient.weatherReport(ctx, airport, METAR, mongoClient.appContext.MetarURL)
+}
+
+// TAF returns the current TAF for the airport
+func (mongoClient *MongoClient) TAF(ctx context.Context, airport *Airport) (*WeatherReport, error) {
+	return mongoClient.weatherReport(ctx, airport, TAF, mongoClient.appContext.TAFURL)
+}
+
+func (mongoClient *MongoClient) weatherReport(ctx context.Context, airport *Airport, kind string, endpoint string) (*WeatherReport, error) {
+	appContext := mongoClient.appContext
+
+	if endpoint == "" {
+		return nil, ErrNoSource
+	}
+
+	station, err := mongoClient.StationFor(ctx, airport)
+	if err != nil {
+		return nil, err
+	}
+
+	cached, found := appContext.weatherReports.get(kind + ":" + station)
+	if found {
+		return cached.(*WeatherReport), nil
+	}
+
+	report, err := appContext.fetchWeather(ctx, kind, station, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	appContext.weatherReports.put(kind+":"+station, report)
+	return report, nil
+}
+
+// fetchWeather retrieves the raw report of the station, an empty response means the
+// station has no current report
+func (appContext *AppContext) fetchWeather(ctx context.Context, kind string, station string, endpoint string) (*WeatherReport, error) {
+	reader, err := openSource(ctx, strings.ReplaceAll(endpoint, stationPlaceholder, url.QueryEscape(station)))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := strings.TrimSpace(string(data))
+	if raw == "" {
+		return nil, ErrNotFound
+	}
+
+	return &WeatherReport{Station: station, Kind: kind, Raw: raw, Fetched: appContext.now()}, nil
+}
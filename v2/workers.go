@@ -0,0 +1,203 @@
+package application
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StageFunc processes a single item of a stage, returning the item to pass on
+type StageFunc func(ctx context.Context, item interface{}) (interface{}, error)
+
+// WorkerStats counts what the workers of a group did
+type WorkerStats struct {
+	Started   int64 `json:"started"`
+	Succeeded int64 `json:"succeeded"`
+	Failed    int64 `json:"failed"`
+}
+
+// WorkerGroup runs functions concurrently, at most a fixed number at a time. Go blocks while the
+// group is full, which gives backpressure to the producer. The first error cancels the context of
+// the group, Wait returns it and logs the counts.
+type WorkerGroup struct {
+	logger  *Logger
+	ctx     context.Context
+	cancel  context.CancelFunc
+	slots   chan struct{}
+	done    sync.WaitGroup
+	errOnce sync.Once
+	err     error
+	started time.Time
+	stats   WorkerStats
+}
+
+// NewWorkerGroup creates a group running at most limit functions at a time, the returned
+// context is cancelled on the first error
+func (appContext *AppContext) NewWorkerGroup(ctx context.Context, name string, limit int) (*WorkerGroup, context.Context) {
+	if limit <= 0 {
+		limit = 1
+	}
+
+	groupCtx, cancel := context.WithCancel(ctx)
+
+	return &WorkerGroup{
+		logger:  appContext.Logger().With("group", name),
+		ctx:     groupCtx,
+		cancel:  cancel,
+		slots:   make(chan struct{}, limit),
+		started: time.Now()}, groupCtx
+}
+
+func (group *WorkerGroup) fail(err error) {
+	group.errOnce.Do(func() {
+		group.err = err
+		group.cancel()
+	})
+}
+
+// Go runs the function in the group, waiting for a free slot first
+func (group *WorkerGroup) Go(f func(ctx context.Context) error) {
+	select {
+	case group.slots <- struct{}{}:
+	case <-group.ctx.Done():
+		return
+	}
+
+	atomic.AddInt64(&group.stats.Started, 1)
+	group.done.Add(1)
+	go func() {
+		defer group.done.Done()
+		defer func() { <-group.slots }()
+
+		err := f(group.ctx)
+		if err != nil {
+			atomic.AddInt64(&group.stats.Failed, 1)
+			group.fail(err)
+			return
+		}
+		atomic.AddInt64(&group.stats.Succeeded, 1)
+	}()
+}
+
+// discard drains the channel until it is closed, so the producer of a stage that gave up does not
+// block on it forever
+func discard(in <-chan interface{}) {
+	for range in {
+	}
+}
+
+// Stage processes the items from in with the given number of workers and passes the results on,
+// the output is buffered as much as there are workers and closed when all items are processed.
+// A nil result is not passed on, so a stage can filter as well. Once the group failed the items
+// left in in are discarded, which lets the producer finish; it has to close in all the same.
+func (group *WorkerGroup) Stage(in <-chan interface{}, workers int, f StageFunc) <-chan interface{} {
+	if workers <= 0 {
+		workers = 1
+	}
+	out := make(chan interface{}, workers)
+
+	var stageDone sync.WaitGroup
+	stageDone.Add(workers)
+	for i := 0; i < workers; i++ {
+		group.done.Add(1)
+		go func() {
+			defer group.done.Done()
+			defer stageDone.Done()
+
+			for item := range in {
+				if group.ctx.Err() != nil {
+					discard(in)
+					return
+				}
+				atomic.AddInt64(&group.stats.Started, 1)
+				result, err := f(group.ctx, item)
+				if err != nil {
+					atomic.AddInt64(&group.stats.Failed, 1)
+					group.fail(err)
+					discard(in)
+					return
+				}
+				atomic.AddInt64(&group.stats.Succeeded, 1)
+				if result == nil {
+					continue
+				}
+
+				select {
+				case out <- result:
+				case <-group.ctx.Done():
+					discard(in)
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		stageDone.Wait()
+		close(out)
+	}()
+
+	return out
+}
+
+// FanOut copies every item from in to each of the outputs, a slow output holds back the others
+func (group *WorkerGroup) FanOut(in <-chan interface{}, outputs int) []<-chan interface{} {
+	channels := make([]chan interface{}, outputs)
+	result := make([]<-chan interface{}, outputs)
+	for i := range channels {
+		channels[i] = make(chan interface{}, 1)
+		result[i] = channels[i]
+	}
+
+	group.done.Add(1)
+	go func() {
+		defer group.done.Done()
+		defer func() {
+			for _, channel := range channels {
+				close(channel)
+			}
+		}()
+
+		for item := range in {
+			for _, channel := range channels {
+				select {
+				case channel <- item:
+				case <-group.ctx.Done():
+					discard(in)
+					return
+				}
+			}
+		}
+	}()
+
+	return result
+}
+
+// Stats returns the counts so far
+func (group *WorkerGroup) Stats() WorkerStats {
+	return WorkerStats{
+		Started:   atomic.LoadInt64(&group.stats.Started),
+		Succeeded: atomic.LoadInt64(&group.stats.Succeeded),
+		Failed:    atomic.LoadInt64(&group.stats.Failed)}
+}
+
+// Wait waits for all functions and stages of the group, returning the first error
+func (group *WorkerGroup) Wait() error {
+	group.done.Wait()
+	group.cancel()
+
+	stats := group.Stats()
+	logger := group.logger.With(
+		"started", stats.Started,
+		"succeeded", stats.Succeeded,
+		"failed", stats.Failed,
+		"duration", time.Since(group.started).Round(time.Millisecond))
+	if group.err != nil {
+		logger.With("error", group.err).Println("Worker group failed")
+		return group.err
+	}
+	logger.Println("Worker group finished")
+
+	return nil
+}
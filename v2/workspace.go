@@ -0,0 +1,172 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// workspaceOptions describes the workspace section of the options file. Without a bucket a run
+// only gets a local folder; the workspace of a failed run is kept unless discard-failed is set.
+type workspaceOptions struct {
+	Dir           string `json:"dir"`
+	Bucket        string `json:"bucket"`
+	DiscardFailed bool   `json:"discard-failed"`
+}
+
+// Workspace is the scratch area of a single run, a folder named after the run and, with a
+// workspace bucket, the objects under the run id in that bucket. Both are made on first use.
+type Workspace struct {
+	appContext *AppContext
+	mutex      sync.Mutex
+	RunID      string
+	Dir        string
+	Bucket     string
+	created    bool
+	objects    bool
+}
+
+// WithWorkspace keeps the scratch files of the runs in the given folder, and with a bucket
+// their scratch objects in that bucket
+func WithWorkspace(dir string, bucket string) Option {
+	return func(appContext *AppContext) {
+		appContext.WorkspaceDir = dir
+		appContext.WorkspaceBucket = bucket
+	}
+}
+
+// newWorkspace returns the workspace of the run, nothing is made yet
+func (appContext *AppContext) newWorkspace(runID string) *Workspace {
+	return &Workspace{
+		appContext: appContext,
+		RunID:      runID,
+		Dir:        filepath.Join(appContext.WorkspaceDir, runID),
+		Bucket:     appContext.WorkspaceBucket}
+}
+
+// TempFile creates a file in the folder of the workspace, which stays when closed so a failed
+// run leaves it behind
+func (workspace *Workspace) TempFile(pattern string) (*sourceFile, error) {
+	workspace.mutex.Lock()
+	defer workspace.mutex.Unlock()
+
+	if !workspace.created {
+		err := os.MkdirAll(workspace.Dir, 0700)
+		if err != nil {
+			return nil, err
+		}
+		workspace.created = true
+	}
+
+	tempFile, err := ioutil.TempFile(workspace.Dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sourceFile{File: tempFile, keep: true}, nil
+}
+
+// objectName returns the name of a scratch object, under the run id
+func (workspace *Workspace) objectName(name string) string {
+	return workspace.RunID + "/" + name
+}
+
+// Put stores a scratch object under the run id in the workspace bucket
+func (workspace *Workspace) Put(ctx context.Context, name string, data io.Reader, size int64) error {
+	if workspace.Bucket == "" {
+		return fmt.Errorf("workspace %s: no workspace bucket", workspace.RunID)
+	}
+
+	workspace.mutex.Lock()
+	defer workspace.mutex.Unlock()
+
+	if !workspace.objects {
+		err := workspace.appContext.ensureBucket(ctx, workspace.Bucket)
+		if err != nil {
+			return err
+		}
+		workspace.objects = true
+	}
+
+	return workspace.appContext.putObject(ctx, workspace.Bucket, workspace.objectName(name), data, size,
+		minio.PutObjectOptions{ContentType: "application/octet-stream"})
+}
+
+// Get reads a scratch object stored before
+func (workspace *Workspace) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if workspace.Bucket == "" {
+		return nil, fmt.Errorf("workspace %s: no workspace bucket", workspace.RunID)
+	}
+
+	return workspace.appContext.getObject(ctx, workspace.Bucket, workspace.objectName(name))
+}
+
+// remove deletes the folder and the scratch objects of the workspace
+func (workspace *Workspace) remove(ctx context.Context) error {
+	if workspace.created {
+		err := os.RemoveAll(workspace.Dir)
+		if err != nil {
+			return err
+		}
+		workspace.created = false
+	}
+
+	if workspace.objects {
+		objects, err := workspace.appContext.listObjects(ctx, workspace.Bucket, workspace.RunID+"/", true)
+		if err != nil {
+			return err
+		}
+		for _, object := range objects {
+			err = workspace.appContext.removeObject(ctx, workspace.Bucket, object.Key)
+			if err != nil {
+				return err
+			}
+		}
+		workspace.objects = false
+	}
+
+	return nil
+}
+
+// location describes where the workspace is kept, empty when nothing was made
+func (workspace *Workspace) location() string {
+	switch {
+	case workspace.created && workspace.objects:
+		return fmt.Sprintf("%s %s/%s", workspace.Dir, workspace.Bucket, workspace.objectName(""))
+	case workspace.created:
+		return workspace.Dir
+	case workspace.objects:
+		return fmt.Sprintf("%s/%s", workspace.Bucket, workspace.objectName(""))
+	}
+
+	return ""
+}
+
+// closeWorkspace cleans up the workspace of a run that succeeded, or is configured to discard
+// failed ones, and returns where a failed run left its workspace otherwise
+func (appContext *AppContext) closeWorkspace(ctx context.Context, workspace *Workspace, succeeded bool) string {
+	workspace.mutex.Lock()
+	defer workspace.mutex.Unlock()
+
+	if !succeeded && !appContext.DiscardFailedWorkspaces {
+		location := workspace.location()
+		if location != "" {
+			appContext.Logger().With("run-id", workspace.RunID, "workspace", location).Println("Workspace: kept after failure")
+		}
+		return location
+	}
+
+	err := workspace.remove(ctx)
+	if err != nil {
+		appContext.LogError(fmt.Errorf("workspace %s: %v", workspace.RunID, err))
+		return workspace.location()
+	}
+
+	return ""
+}